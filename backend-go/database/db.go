@@ -9,6 +9,10 @@ import (
 
 var DB *sql.DB
 
+// SearchEnabled reports whether the full-text search index is available. It
+// requires SQLite to be built with FTS5 (go build -tags sqlite_fts5).
+var SearchEnabled bool
+
 func InitDB() {
     var err error
     DB, err = sql.Open("sqlite3", "./mindful.db")
@@ -41,6 +45,385 @@ func InitDB() {
         created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
     );`
 
+    exportJobTable := `
+    CREATE TABLE IF NOT EXISTS export_jobs (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        status TEXT NOT NULL DEFAULT 'pending',
+        token TEXT NOT NULL UNIQUE,
+        file_path TEXT,
+        error TEXT,
+        expires_at TIMESTAMP,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );`
+
+    retentionPolicyTable := `
+    CREATE TABLE IF NOT EXISTS retention_policies (
+        resource TEXT PRIMARY KEY,
+        max_age_days INTEGER NOT NULL,
+        action TEXT NOT NULL,
+        updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );`
+
+    retentionAuditTable := `
+    CREATE TABLE IF NOT EXISTS retention_audit (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        resource TEXT NOT NULL,
+        record_id INTEGER NOT NULL,
+        action TEXT NOT NULL,
+        reason TEXT,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );`
+
+    journalRevisionTable := `
+    CREATE TABLE IF NOT EXISTS journal_revisions (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        journal_id INTEGER NOT NULL,
+        content TEXT NOT NULL,
+        emotional_state TEXT,
+        valid_from TIMESTAMP,
+        replaced_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );`
+
+    gamePlanTaskTable := `
+    CREATE TABLE IF NOT EXISTS gameplan_tasks (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        game_plan_id INTEGER NOT NULL,
+        position INTEGER NOT NULL,
+        description TEXT NOT NULL,
+        status TEXT NOT NULL DEFAULT 'open',
+        sources TEXT,
+        completed_at TIMESTAMP,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );`
+
+    // Tags are shared across entries; journal_tags links them. Suggestions
+    // from the model wait in journal_tag_suggestions until accepted or
+    // rejected, and rejected ones are kept so they are not suggested again.
+    tagTable := `
+    CREATE TABLE IF NOT EXISTS tags (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        name TEXT NOT NULL UNIQUE,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );
+    CREATE TABLE IF NOT EXISTS journal_tags (
+        journal_id INTEGER NOT NULL,
+        tag_id INTEGER NOT NULL,
+        PRIMARY KEY (journal_id, tag_id)
+    );
+    CREATE TABLE IF NOT EXISTS journal_tag_suggestions (
+        journal_id INTEGER NOT NULL,
+        tag TEXT NOT NULL,
+        status TEXT NOT NULL DEFAULT 'pending',
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        PRIMARY KEY (journal_id, tag)
+    );`
+
+    // generated_prompts keeps AI-written journaling prompts so an entry can
+    // link to the prompt it answered, like prompts from the built-in library.
+    generatedPromptTable := `
+    CREATE TABLE IF NOT EXISTS generated_prompts (
+        id TEXT PRIMARY KEY,
+        category TEXT NOT NULL,
+        text TEXT NOT NULL,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );`
+
+    // thought_records holds CBT thought records. emotions and distortions
+    // are JSON arrays; completed_at is set once a balanced thought and an
+    // outcome rating have been recorded.
+    thoughtRecordTable := `
+    CREATE TABLE IF NOT EXISTS thought_records (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        situation TEXT NOT NULL,
+        automatic_thought TEXT NOT NULL,
+        emotions TEXT NOT NULL DEFAULT '[]',
+        distortions TEXT NOT NULL DEFAULT '[]',
+        evidence_for TEXT NOT NULL DEFAULT '',
+        evidence_against TEXT NOT NULL DEFAULT '',
+        balanced_thought TEXT NOT NULL DEFAULT '',
+        outcome_rating INTEGER,
+        completed_at TIMESTAMP,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        updated_at TIMESTAMP
+    );`
+
+    // distortion_findings holds cognitive distortions detected in journal
+    // entries and user transcript turns. Offsets are in characters; turn is
+    // NULL for journal entries.
+    distortionFindingTable := `
+    CREATE TABLE IF NOT EXISTS distortion_findings (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        kind TEXT NOT NULL,
+        record_id INTEGER NOT NULL,
+        turn INTEGER,
+        distortion TEXT NOT NULL,
+        start_offset INTEGER NOT NULL,
+        end_offset INTEGER NOT NULL,
+        excerpt TEXT NOT NULL,
+        confidence REAL NOT NULL,
+        source TEXT NOT NULL,
+        explanation TEXT,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );
+    CREATE INDEX IF NOT EXISTS distortion_findings_record ON distortion_findings (kind, record_id);`
+
+    // habits are recurring self-care activities scheduled by days_of_week
+    // (comma-separated, e.g. "mon,wed") or an RRULE; habit_logs records each
+    // completion against a YYYY-MM-DD date.
+    habitTable := `
+    CREATE TABLE IF NOT EXISTS habits (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        name TEXT NOT NULL,
+        days_of_week TEXT NOT NULL DEFAULT '',
+        rrule TEXT NOT NULL DEFAULT '',
+        target_count INTEGER NOT NULL DEFAULT 1,
+        start_date TEXT NOT NULL,
+        source_task_id INTEGER,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        updated_at TIMESTAMP
+    );
+    CREATE TABLE IF NOT EXISTS habit_logs (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        habit_id INTEGER NOT NULL,
+        log_date TEXT NOT NULL,
+        count INTEGER NOT NULL DEFAULT 1,
+        note TEXT NOT NULL DEFAULT '',
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );
+    CREATE INDEX IF NOT EXISTS habit_logs_habit_date ON habit_logs (habit_id, log_date);`
+
+    // goals give game plans a long-term direction. gameplan_tasks.goal_id
+    // links tasks to a goal; progress is computed from those tasks.
+    goalTable := `
+    CREATE TABLE IF NOT EXISTS goals (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        title TEXT NOT NULL,
+        why TEXT NOT NULL DEFAULT '',
+        target_date TEXT,
+        status TEXT NOT NULL DEFAULT 'active',
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        updated_at TIMESTAMP
+    );
+    CREATE TABLE IF NOT EXISTS goal_milestones (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        goal_id INTEGER NOT NULL,
+        title TEXT NOT NULL,
+        target_date TEXT,
+        completed_at TIMESTAMP,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );`
+
+    // reminders are persisted schedules; next_run_at (UTC, RFC 3339) is
+    // what the scheduler polls, so schedules survive restarts. notifications
+    // is the in-app inbox.
+    reminderTable := `
+    CREATE TABLE IF NOT EXISTS reminders (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        title TEXT NOT NULL,
+        message TEXT NOT NULL DEFAULT '',
+        target_type TEXT NOT NULL DEFAULT '',
+        target_id INTEGER,
+        time_of_day TEXT NOT NULL,
+        timezone TEXT NOT NULL DEFAULT 'UTC',
+        days_of_week TEXT NOT NULL DEFAULT '',
+        rrule TEXT NOT NULL DEFAULT '',
+        start_date TEXT NOT NULL,
+        quiet_hours TEXT NOT NULL DEFAULT '',
+        channels TEXT NOT NULL DEFAULT 'inapp',
+        paused INTEGER NOT NULL DEFAULT 0,
+        next_run_at TEXT,
+        last_run_at TEXT,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        updated_at TIMESTAMP
+    );
+    CREATE INDEX IF NOT EXISTS reminders_next_run ON reminders (next_run_at);
+    CREATE TABLE IF NOT EXISTS notifications (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        reminder_id INTEGER,
+        title TEXT NOT NULL,
+        body TEXT NOT NULL DEFAULT '',
+        target_type TEXT NOT NULL DEFAULT '',
+        target_id INTEGER,
+        read_at TIMESTAMP,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );`
+
+    // Calendar tables: planned_sessions are upcoming therapy or coaching
+    // sessions, calendar_busy_blocks are busy times imported from external
+    // calendars, and calendar_tokens holds the SHA-256 hash of the token that
+    // unlocks the subscription feed. Times are UTC RFC 3339 text.
+    calendarTable := `
+    CREATE TABLE IF NOT EXISTS planned_sessions (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        title TEXT NOT NULL,
+        starts_at TEXT NOT NULL,
+        ends_at TEXT NOT NULL,
+        location TEXT NOT NULL DEFAULT '',
+        notes TEXT NOT NULL DEFAULT '',
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        updated_at TIMESTAMP
+    );
+    CREATE TABLE IF NOT EXISTS calendar_busy_blocks (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        source TEXT NOT NULL,
+        uid TEXT NOT NULL DEFAULT '',
+        summary TEXT NOT NULL DEFAULT '',
+        starts_at TEXT NOT NULL,
+        ends_at TEXT NOT NULL,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );
+    CREATE INDEX IF NOT EXISTS calendar_busy_blocks_starts ON calendar_busy_blocks (starts_at);
+    CREATE TABLE IF NOT EXISTS calendar_tokens (
+        token_hash TEXT PRIMARY KEY,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );`
+
+    // transcript_turns keeps the timed turns of imported transcripts;
+    // transcripts.transcript holds the same turns as "Speaker: text" lines.
+    // prosody is a JSON object of emotion scores for voice session turns.
+    transcriptTurnTable := `
+    CREATE TABLE IF NOT EXISTS transcript_turns (
+        transcript_id INTEGER NOT NULL,
+        turn_index INTEGER NOT NULL,
+        speaker TEXT NOT NULL DEFAULT '',
+        text TEXT NOT NULL,
+        start_ms INTEGER,
+        end_ms INTEGER,
+        prosody TEXT,
+        PRIMARY KEY (transcript_id, turn_index)
+    );`
+
+    // webhook_subscriptions are outbound webhooks; event_types is a
+    // comma-separated list. webhook_deliveries is the delivery log and retry
+    // queue: pending rows are attempted once next_attempt_at (UTC, RFC 3339)
+    // has passed.
+    webhookTable := `
+    CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        url TEXT NOT NULL,
+        secret TEXT NOT NULL,
+        event_types TEXT NOT NULL,
+        description TEXT NOT NULL DEFAULT '',
+        active INTEGER NOT NULL DEFAULT 1,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        updated_at TIMESTAMP
+    );
+    CREATE TABLE IF NOT EXISTS webhook_deliveries (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        subscription_id INTEGER NOT NULL,
+        event_id TEXT NOT NULL,
+        event_type TEXT NOT NULL,
+        payload TEXT NOT NULL,
+        status TEXT NOT NULL DEFAULT 'pending',
+        attempts INTEGER NOT NULL DEFAULT 0,
+        next_attempt_at TEXT,
+        last_status_code INTEGER,
+        last_error TEXT NOT NULL DEFAULT '',
+        redelivery_of INTEGER,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        delivered_at TEXT
+    );
+    CREATE INDEX IF NOT EXISTS webhook_deliveries_due ON webhook_deliveries (status, next_attempt_at);
+    CREATE INDEX IF NOT EXISTS webhook_deliveries_subscription ON webhook_deliveries (subscription_id, id);`
+
+    // session_audio is the recording of a session, uploaded in chunks. The
+    // bytes live in the blob store under blob_key; size and sha256 are
+    // checked when a chunk is stored and again when the upload completes.
+    sessionAudioTable := `
+    CREATE TABLE IF NOT EXISTS session_audio (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        session_id TEXT NOT NULL UNIQUE,
+        content_type TEXT NOT NULL,
+        status TEXT NOT NULL DEFAULT 'uploading',
+        size INTEGER NOT NULL DEFAULT 0,
+        sha256 TEXT NOT NULL DEFAULT '',
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        completed_at TEXT
+    );
+    CREATE TABLE IF NOT EXISTS session_audio_chunks (
+        audio_id INTEGER NOT NULL,
+        chunk_index INTEGER NOT NULL,
+        size INTEGER NOT NULL,
+        sha256 TEXT NOT NULL,
+        blob_key TEXT NOT NULL,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        PRIMARY KEY (audio_id, chunk_index)
+    );`
+
+    // transcription_jobs queues speech-to-text runs over session audio.
+    // Pending and running jobs are picked up once next_attempt_at (UTC,
+    // RFC 3339) has passed; a running job's next_attempt_at is its lease.
+    transcriptionJobTable := `
+    CREATE TABLE IF NOT EXISTS transcription_jobs (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        session_id TEXT NOT NULL,
+        status TEXT NOT NULL DEFAULT 'pending',
+        diarize INTEGER NOT NULL DEFAULT 0,
+        language TEXT NOT NULL DEFAULT '',
+        user_speaker TEXT NOT NULL DEFAULT '',
+        replace_existing INTEGER NOT NULL DEFAULT 0,
+        attempts INTEGER NOT NULL DEFAULT 0,
+        next_attempt_at TEXT,
+        transcript_id INTEGER,
+        error TEXT NOT NULL DEFAULT '',
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        finished_at TEXT
+    );
+    CREATE INDEX IF NOT EXISTS transcription_jobs_due ON transcription_jobs (status, next_attempt_at);
+    CREATE INDEX IF NOT EXISTS transcription_jobs_session ON transcription_jobs (session_id, id);`
+
+    // session_summaries holds the AI summary of each session, made from its
+    // transcripts up to transcript_id. key_moments, topics and commitments
+    // are JSON arrays.
+    sessionSummaryTable := `
+    CREATE TABLE IF NOT EXISTS session_summaries (
+        session_id TEXT PRIMARY KEY,
+        transcript_id INTEGER NOT NULL,
+        status TEXT NOT NULL DEFAULT 'pending',
+        summary TEXT NOT NULL DEFAULT '',
+        key_moments TEXT NOT NULL DEFAULT '[]',
+        topics TEXT NOT NULL DEFAULT '[]',
+        commitments TEXT NOT NULL DEFAULT '[]',
+        error TEXT NOT NULL DEFAULT '',
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );
+    CREATE INDEX IF NOT EXISTS session_summaries_transcript ON session_summaries (transcript_id);`
+
+    // embeddings holds one vector per journal entry or session, encoded as
+    // little-endian float32s. model records which embedder produced it.
+    embeddingTable := `
+    CREATE TABLE IF NOT EXISTS embeddings (
+        kind TEXT NOT NULL,
+        record_id INTEGER NOT NULL,
+        model TEXT NOT NULL,
+        dim INTEGER NOT NULL,
+        vector BLOB NOT NULL,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        PRIMARY KEY (kind, record_id)
+    );`
+
+    // audit_events is append-only: triggers reject any update or delete so
+    // rows can only be added through the hash chain.
+    auditEventTable := `
+    CREATE TABLE IF NOT EXISTS audit_events (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        actor TEXT NOT NULL,
+        action TEXT NOT NULL,
+        resource_type TEXT NOT NULL,
+        resource_id TEXT,
+        request_id TEXT,
+        ip TEXT,
+        status INTEGER,
+        created_at TEXT NOT NULL,
+        prev_hash TEXT NOT NULL,
+        hash TEXT NOT NULL
+    );
+    CREATE TRIGGER IF NOT EXISTS audit_events_no_update BEFORE UPDATE ON audit_events
+    BEGIN SELECT RAISE(ABORT, 'audit_events is append-only'); END;
+    CREATE TRIGGER IF NOT EXISTS audit_events_no_delete BEFORE DELETE ON audit_events
+    BEGIN SELECT RAISE(ABORT, 'audit_events is append-only'); END;`
+
     _, err = DB.Exec(journalTable)
     if err != nil {
         log.Fatalf("could not create journal table: %v", err)
@@ -55,6 +438,223 @@ func InitDB() {
     if err != nil {
         log.Fatalf("could not create game plan table: %v", err)
     }
+
+    _, err = DB.Exec(exportJobTable)
+    if err != nil {
+        log.Fatalf("could not create export job table: %v", err)
+    }
+
+    _, err = DB.Exec(retentionPolicyTable)
+    if err != nil {
+        log.Fatalf("could not create retention policy table: %v", err)
+    }
+
+    _, err = DB.Exec(retentionAuditTable)
+    if err != nil {
+        log.Fatalf("could not create retention audit table: %v", err)
+    }
+
+    _, err = DB.Exec(auditEventTable)
+    if err != nil {
+        log.Fatalf("could not create audit event table: %v", err)
+    }
+
+    _, err = DB.Exec(embeddingTable)
+    if err != nil {
+        log.Fatalf("could not create embedding table: %v", err)
+    }
+
+    _, err = DB.Exec(gamePlanTaskTable)
+    if err != nil {
+        log.Fatalf("could not create game plan task table: %v", err)
+    }
+
+    _, err = DB.Exec(journalRevisionTable)
+    if err != nil {
+        log.Fatalf("could not create journal revision table: %v", err)
+    }
+
+    _, err = DB.Exec(tagTable)
+    if err != nil {
+        log.Fatalf("could not create tag tables: %v", err)
+    }
+
+    _, err = DB.Exec(generatedPromptTable)
+    if err != nil {
+        log.Fatalf("could not create generated prompt table: %v", err)
+    }
+
+    _, err = DB.Exec(thoughtRecordTable)
+    if err != nil {
+        log.Fatalf("could not create thought record table: %v", err)
+    }
+
+    _, err = DB.Exec(distortionFindingTable)
+    if err != nil {
+        log.Fatalf("could not create distortion finding table: %v", err)
+    }
+
+    _, err = DB.Exec(habitTable)
+    if err != nil {
+        log.Fatalf("could not create habit tables: %v", err)
+    }
+
+    _, err = DB.Exec(goalTable)
+    if err != nil {
+        log.Fatalf("could not create goal tables: %v", err)
+    }
+
+    _, err = DB.Exec(reminderTable)
+    if err != nil {
+        log.Fatalf("could not create reminder tables: %v", err)
+    }
+
+    _, err = DB.Exec(calendarTable)
+    if err != nil {
+        log.Fatalf("could not create calendar tables: %v", err)
+    }
+
+    _, err = DB.Exec(transcriptTurnTable)
+    if err != nil {
+        log.Fatalf("could not create transcript turn table: %v", err)
+    }
+
+    _, err = DB.Exec(webhookTable)
+    if err != nil {
+        log.Fatalf("could not create webhook tables: %v", err)
+    }
+
+    _, err = DB.Exec(sessionAudioTable)
+    if err != nil {
+        log.Fatalf("could not create session audio tables: %v", err)
+    }
+
+    _, err = DB.Exec(transcriptionJobTable)
+    if err != nil {
+        log.Fatalf("could not create transcription job table: %v", err)
+    }
+
+    _, err = DB.Exec(sessionSummaryTable)
+    if err != nil {
+        log.Fatalf("could not create session summary table: %v", err)
+    }
+
+    // Columns added after the first release; CREATE TABLE IF NOT EXISTS
+    // does not add them to existing databases.
+    ensureColumn("game_plans", "emotional_state", "TEXT")
+    ensureColumn("game_plans", "citations", "TEXT")
+    ensureColumn("journal_entries", "updated_at", "TIMESTAMP")
+    ensureColumn("journal_entries", "title", "TEXT")
+    ensureColumn("journal_entries", "location", "TEXT")
+    ensureColumn("journal_entries", "mood_intensity", "INTEGER")
+    ensureColumn("journal_entries", "prompt_id", "TEXT")
+    ensureColumn("journal_revisions", "title", "TEXT")
+    ensureColumn("gameplan_tasks", "goal_id", "INTEGER")
+    ensureColumn("gameplan_tasks", "due_at", "TEXT")
+    ensureColumn("gameplan_tasks", "duration_minutes", "INTEGER")
+    ensureColumn("transcripts", "source", "TEXT")
+    ensureColumn("transcript_turns", "prosody", "TEXT")
+    ensureCreatedAt("transcripts")
+    ensureCreatedAt("game_plans")
+
+    migrateLegacyJournals()
+
+    if err := initSearchIndex(); err != nil {
+        log.Printf("Full-text search disabled, could not create search index: %v", err)
+    }
+}
+
+// migrateLegacyJournals moves entries from the old journals table, which had
+// no timestamps, into journal_entries and drops it. IDs are preserved so
+// search and embedding rows keep pointing at the right entry.
+func migrateLegacyJournals() {
+    var count int
+    err := DB.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'journals'`).Scan(&count)
+    if err != nil {
+        log.Fatalf("could not inspect journals table: %v", err)
+    }
+    if count == 0 {
+        return
+    }
+
+    tx, err := DB.Begin()
+    if err != nil {
+        log.Fatalf("could not migrate journals: %v", err)
+    }
+    defer tx.Rollback()
+
+    _, err = tx.Exec(`INSERT INTO journal_entries (id, content)
+        SELECT id, content FROM journals WHERE id NOT IN (SELECT id FROM journal_entries)`)
+    if err != nil {
+        log.Fatalf("could not migrate journals: %v", err)
+    }
+    if _, err := tx.Exec(`DROP TABLE journals`); err != nil {
+        log.Fatalf("could not drop legacy journals table: %v", err)
+    }
+    if err := tx.Commit(); err != nil {
+        log.Fatalf("could not migrate journals: %v", err)
+    }
+    log.Println("Migrated legacy journals into journal_entries")
+}
+
+// ensureColumn adds a column to an existing table if it is missing, and
+// reports whether it did.
+func ensureColumn(table, column, definition string) bool {
+    var count int
+    err := DB.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, table, column).Scan(&count)
+    if err != nil {
+        log.Fatalf("could not inspect %s table: %v", table, err)
+    }
+    if count > 0 {
+        return false
+    }
+
+    if _, err := DB.Exec(`ALTER TABLE ` + table + ` ADD COLUMN ` + column + ` ` + definition); err != nil {
+        log.Fatalf("could not add %s.%s column: %v", table, column, err)
+    }
+    return true
+}
+
+// ensureCreatedAt adds created_at to tables from before it existed. SQLite
+// can't add a column with a CURRENT_TIMESTAMP default, so the column is
+// added bare, existing rows are stamped with the time of the migration, and
+// a trigger stamps rows inserted afterwards.
+func ensureCreatedAt(table string) {
+    if ensureColumn(table, "created_at", "TIMESTAMP") {
+        trigger := `CREATE TRIGGER IF NOT EXISTS ` + table + `_created_at AFTER INSERT ON ` + table + `
+            FOR EACH ROW WHEN NEW.created_at IS NULL
+            BEGIN UPDATE ` + table + ` SET created_at = CURRENT_TIMESTAMP WHERE id = NEW.id; END`
+        if _, err := DB.Exec(trigger); err != nil {
+            log.Fatalf("could not create %s.created_at trigger: %v", table, err)
+        }
+        log.Printf("Added created_at to legacy %s table", table)
+    }
+    if _, err := DB.Exec(`UPDATE ` + table + ` SET created_at = CURRENT_TIMESTAMP WHERE created_at IS NULL`); err != nil {
+        log.Fatalf("could not backfill %s.created_at: %v", table, err)
+    }
+}
+
+// initSearchIndex creates the FTS5 table that indexes journal entries and
+// individual transcript turns. Only body is tokenized; the other columns
+// identify the source record.
+func initSearchIndex() error {
+    searchTable := `
+    CREATE VIRTUAL TABLE IF NOT EXISTS search_index USING fts5(
+        body,
+        kind UNINDEXED,
+        record_id UNINDEXED,
+        session_id UNINDEXED,
+        turn UNINDEXED,
+        speaker UNINDEXED,
+        created_at UNINDEXED,
+        tokenize = 'porter unicode61'
+    );`
+
+    if _, err := DB.Exec(searchTable); err != nil {
+        return err
+    }
+    SearchEnabled = true
+    return nil
 }
 
 func createTables() {
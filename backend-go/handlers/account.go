@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"mindful/backend-go/models"
+	"mindful/backend-go/utils"
+	"net/http"
+)
+
+type DeleteAccountResponse struct {
+	Message string `json:"message"`
+	models.PurgeReport
+}
+
+// DeleteAccountHandler permanently removes all stored data for the user.
+func DeleteAccountHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Audio lives in the blob store, so its keys are read before the rows
+	// go and the blobs are removed after the purge succeeds.
+	blobKeys, err := models.AudioBlobKeys()
+	if err != nil {
+		log.Printf("Error listing audio blobs: %v", err)
+		http.Error(w, "Failed to delete account data", http.StatusInternalServerError)
+		return
+	}
+	report, err := models.DeleteAllUserData(r.Context())
+	if err != nil {
+		log.Printf("Error deleting user data: %v", err)
+		http.Error(w, "Failed to delete account data", http.StatusInternalServerError)
+		return
+	}
+	report.BlobsRemoved = utils.DeleteBlobs(r.Context(), utils.DefaultBlobStore(), blobKeys)
+
+	response := DeleteAccountResponse{
+		Message:     "Account data deleted successfully",
+		PurgeReport: report,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
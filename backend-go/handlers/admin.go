@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"mindful/backend-go/models"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// requireAdmin checks the bearer token against ADMIN_TOKEN. Admin endpoints
+// are disabled entirely when ADMIN_TOKEN is not set.
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	expected := os.Getenv("ADMIN_TOKEN")
+	if expected == "" {
+		http.Error(w, "Admin access is not configured", http.StatusForbidden)
+		return false
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+func AdminAuditHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	q := r.URL.Query()
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	events, err := models.GetAuditEvents(models.AuditFilter{
+		Actor:        q.Get("actor"),
+		Action:       q.Get("action"),
+		ResourceType: q.Get("resource_type"),
+		ResourceID:   q.Get("resource_id"),
+		From:         q.Get("from"),
+		To:           q.Get("to"),
+		Limit:        limit,
+	})
+	if err != nil {
+		http.Error(w, "Failed to retrieve audit events", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
+
+func AdminAuditVerifyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	status, err := models.VerifyAuditChain()
+	if err != nil {
+		http.Error(w, "Failed to verify audit log", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
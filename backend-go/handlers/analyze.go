@@ -2,7 +2,7 @@ package handlers
 
 import (
     "encoding/json"
-    "mindful/backend-go/models"
+    "log"
     "mindful/backend-go/utils"
     "net/http"
 )
@@ -13,47 +13,20 @@ func AnalyzeAndStoreGamePlanHandler(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    // Fetch all transcripts and journals
-    transcripts, err := models.GetTranscripts()
+    // Retrieve the latest session, last plan and related entries
+    planContext, err := utils.BuildGamePlanContext(r.Context(), utils.DefaultEmbedder())
     if err != nil {
-        http.Error(w, "Failed to fetch transcripts", http.StatusInternalServerError)
+        log.Printf("Error building game plan context: %v", err)
+        http.Error(w, "Failed to gather game plan context", http.StatusInternalServerError)
         return
     }
 
-    journals, err := models.GetAllJournalEntries()
-    if err != nil {
-        http.Error(w, "Failed to fetch journals", http.StatusInternalServerError)
-        return
-    }
-
-    // Extract content from transcripts and journals
-    var transcriptTexts []string
-    for _, t := range transcripts {
-        transcriptTexts = append(transcriptTexts, t.Transcript)
-    }
-
-    var journalTexts []string
-    for _, j := range journals {
-        journalTexts = append(journalTexts, j.Content)
-    }
-
-    // Generate game plan using AI
-    tasks, summary, err := utils.GenerateGamePlan(transcriptTexts, journalTexts)
-    if err != nil {
+    // Generate and store the game plan using AI
+    if _, _, err := utils.GenerateGamePlan(planContext); err != nil {
         http.Error(w, "Failed to generate game plan", http.StatusInternalServerError)
         return
     }
 
-    // Categorize emotional state
-    emotionalState := utils.CategorizeEmotionalState(summary)
-
-    // Store the game plan in the database
-    err = models.StoreGamePlan(tasks, summary, emotionalState)
-    if err != nil {
-        http.Error(w, "Failed to store game plan", http.StatusInternalServerError)
-        return
-    }
-
     response := map[string]string{"message": "Game plan generated and stored successfully"}
     w.Header().Set("Content-Type", "application/json")
     json.NewEncoder(w).Encode(response)
@@ -0,0 +1,400 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mindful/backend-go/models"
+	"mindful/backend-go/utils"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxICSUpload bounds the size of an imported calendar.
+const maxICSUpload = 5 << 20
+
+// importHorizon is how far ahead recurring imported events are expanded.
+const importHorizon = 90 * 24 * time.Hour
+
+func writeScheduleError(w http.ResponseWriter, err error, notFound, action string) {
+	switch {
+	case errors.Is(err, models.ErrInvalidSchedule):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, models.ErrScheduleConflict):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, models.ErrNotFound):
+		http.Error(w, notFound, http.StatusNotFound)
+	default:
+		log.Printf("Error trying to %s: %v", action, err)
+		http.Error(w, "Failed to "+action, http.StatusInternalServerError)
+	}
+}
+
+// CalendarFeedHandler serves GET /calendar.ics?token=, the subscription feed
+// for calendar apps. Those can't send headers, so the token is in the URL.
+func CalendarFeedHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ok, err := models.ValidCalendarToken(r.URL.Query().Get("token"))
+	if err != nil {
+		log.Printf("Error checking calendar token: %v", err)
+		http.Error(w, "Failed to build calendar", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "Invalid calendar token", http.StatusUnauthorized)
+		return
+	}
+
+	calendar, err := utils.BuildCalendar(time.Now())
+	if err != nil {
+		log.Printf("Error building calendar: %v", err)
+		http.Error(w, "Failed to build calendar", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="mindful.ics"`)
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	io.WriteString(w, calendar)
+}
+
+// CalendarTokenHandler creates a new subscription URL (POST), revoking the
+// previous one, or disables the feed (DELETE).
+func CalendarTokenHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		token, err := models.RotateCalendarToken()
+		if err != nil {
+			log.Printf("Error creating calendar token: %v", err)
+			http.Error(w, "Failed to create calendar token", http.StatusInternalServerError)
+			return
+		}
+		scheme := "http"
+		if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+			scheme = "https"
+		}
+		response := map[string]string{
+			"token": token,
+			"url":   scheme + "://" + r.Host + "/calendar.ics?token=" + token,
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(response)
+	case http.MethodDelete:
+		if err := models.RevokeCalendarTokens(); err != nil {
+			log.Printf("Error revoking calendar tokens: %v", err)
+			http.Error(w, "Failed to revoke calendar token", http.StatusInternalServerError)
+			return
+		}
+		response := map[string]string{"message": "Calendar feed disabled"}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	default:
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+	}
+}
+
+// readICSUpload returns the calendar from a multipart "file" field or, for
+// any other content type, the raw request body.
+func readICSUpload(w http.ResponseWriter, r *http.Request) (string, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxICSUpload)
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			return "", err
+		}
+		defer file.Close()
+		data, err := io.ReadAll(file)
+		return string(data), err
+	}
+	data, err := io.ReadAll(r.Body)
+	return string(data), err
+}
+
+// CalendarImportHandler imports busy times from an ICS file (POST
+// /calendar/import?source=&tz=). Importing the same source again replaces
+// its blocks. tz is used for floating times and defaults to UTC.
+func CalendarImportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	source := r.URL.Query().Get("source")
+	if source == "" {
+		source = "default"
+	}
+	loc := time.UTC
+	if tz := r.URL.Query().Get("tz"); tz != "" {
+		l, err := time.LoadLocation(tz)
+		if err != nil {
+			http.Error(w, "Unknown time zone", http.StatusBadRequest)
+			return
+		}
+		loc = l
+	}
+
+	data, err := readICSUpload(w, r)
+	if err != nil {
+		http.Error(w, "Failed to read calendar upload", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	blocks, report, err := utils.ParseBusyBlocks(data, loc, now, now.Add(importHorizon))
+	if errors.Is(err, utils.ErrInvalidICS) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err == nil {
+		err = models.ReplaceBusyBlocks(source, blocks)
+	}
+	if err != nil {
+		log.Printf("Error importing calendar: %v", err)
+		http.Error(w, "Failed to import calendar", http.StatusInternalServerError)
+		return
+	}
+
+	response := struct {
+		Source string `json:"source"`
+		utils.ICSImportReport
+	}{source, report}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// CalendarBusyHandler lists imported busy blocks (GET ?from=&to=, RFC 3339)
+// or deletes them (DELETE ?source=, all sources if omitted).
+func CalendarBusyHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		var from, to time.Time
+		for _, p := range []struct {
+			name string
+			t    *time.Time
+		}{{"from", &from}, {"to", &to}} {
+			if v := r.URL.Query().Get(p.name); v != "" {
+				t, err := models.ParseTimestamp(v)
+				if err != nil {
+					http.Error(w, p.name+" must be an RFC 3339 time", http.StatusBadRequest)
+					return
+				}
+				*p.t = t
+			}
+		}
+		blocks, err := models.GetBusyBlocks(from, to)
+		if err != nil {
+			writeScheduleError(w, err, "", "retrieve busy times")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(blocks)
+	case http.MethodDelete:
+		n, err := models.DeleteBusyBlocks(r.URL.Query().Get("source"))
+		if err != nil {
+			writeScheduleError(w, err, "", "delete busy times")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int64{"deleted": n})
+	default:
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+	}
+}
+
+// PlannedSessionsHandler serves /planned-sessions (GET ?upcoming=true, POST)
+// and /planned-sessions/{id} (GET, PUT, DELETE).
+func PlannedSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/planned-sessions"), "/")
+	if path == "" {
+		switch r.Method {
+		case http.MethodGet:
+			sessions, err := models.ListPlannedSessions(r.URL.Query().Get("upcoming") == "true")
+			if err != nil {
+				writeScheduleError(w, err, "Planned session not found", "retrieve planned sessions")
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(sessions)
+		case http.MethodPost:
+			var req models.PlannedSession
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+				return
+			}
+			session, err := models.CreatePlannedSession(req)
+			if err != nil {
+				writeScheduleError(w, err, "Planned session not found", "create planned session")
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(session)
+		default:
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	id, err := strconv.Atoi(path)
+	if err != nil {
+		http.Error(w, "Invalid planned session ID", http.StatusBadRequest)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		session, err := models.GetPlannedSession(id)
+		if err != nil {
+			writeScheduleError(w, err, "Planned session not found", "retrieve planned session")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(session)
+	case http.MethodPut:
+		var req models.PlannedSession
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+			return
+		}
+		session, err := models.UpdatePlannedSession(id, req)
+		if err != nil {
+			writeScheduleError(w, err, "Planned session not found", "update planned session")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(session)
+	case http.MethodDelete:
+		if err := models.DeletePlannedSession(id); err != nil {
+			writeScheduleError(w, err, "Planned session not found", "delete planned session")
+			return
+		}
+		response := map[string]string{"message": "Planned session deleted successfully"}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	default:
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+	}
+}
+
+type TaskDueRequest struct {
+	DueAt    string `json:"due_at"`
+	Duration int    `json:"duration_minutes"`
+}
+
+// SetTaskDueHandler schedules a game plan task at a time, or clears its
+// schedule when due_at is empty.
+func SetTaskDueHandler(w http.ResponseWriter, r *http.Request, planID, taskID int) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req TaskDueRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+	task, err := models.SetGamePlanTaskDue(planID, taskID, req.DueAt, req.Duration)
+	if err != nil {
+		writeScheduleError(w, err, "Task not found", "schedule task")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(task)
+}
+
+// ScheduleProposalRequest adds two more sources of busy times to a schedule
+// request: the text of an .ics file and a free/busy response keyed by
+// calendar, as returned by Google Calendar's freeBusy API.
+type ScheduleProposalRequest struct {
+	models.ScheduleRequest
+	ICS       string `json:"ics"`
+	Calendars map[string]struct {
+		Busy []models.FreeBusyInterval `json:"busy"`
+	} `json:"calendars"`
+}
+
+// ScheduleTasksHandler proposes time slots for a game plan's unscheduled
+// tasks (POST /gameplans/{id}/schedule) without saving them.
+func ScheduleTasksHandler(w http.ResponseWriter, r *http.Request, planID int) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ScheduleProposalRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxICSUpload)).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+			return
+		}
+	}
+	for _, c := range req.Calendars {
+		req.Busy = append(req.Busy, c.Busy...)
+	}
+	if req.ICS != "" {
+		loc, err := time.LoadLocation(req.Timezone)
+		if err != nil {
+			http.Error(w, "Unknown timezone", http.StatusBadRequest)
+			return
+		}
+		from := time.Now()
+		if d, err := models.ParseDate(req.StartDate); err == nil {
+			from = d
+		}
+		blocks, _, err := utils.ParseBusyBlocks(req.ICS, loc, from, from.AddDate(0, 0, 32))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, b := range blocks {
+			req.Busy = append(req.Busy, models.FreeBusyInterval{Start: b.StartsAt, End: b.EndsAt})
+		}
+	}
+
+	proposal, err := models.ProposeSchedule(planID, req.ScheduleRequest, time.Now())
+	if err != nil {
+		writeScheduleError(w, err, "Game plan not found", "propose schedule")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(proposal)
+}
+
+type AcceptScheduleRequest struct {
+	Slots          []models.ScheduledSlot `json:"slots"`
+	IgnoreImported bool                   `json:"ignore_imported"`
+}
+
+// AcceptScheduleHandler stores proposed slots, possibly edited by the user,
+// as the due times of a game plan's tasks (POST
+// /gameplans/{id}/schedule/accept).
+func AcceptScheduleHandler(w http.ResponseWriter, r *http.Request, planID int) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req AcceptScheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+	tasks, err := models.AcceptSchedule(planID, req.Slots, req.IgnoreImported)
+	if err != nil {
+		writeScheduleError(w, err, "Task not found", "save schedule")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tasks)
+}
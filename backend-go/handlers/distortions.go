@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"mindful/backend-go/models"
+	"mindful/backend-go/utils"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// defaultInsightConfidence hides low-confidence rule matches, such as a
+// lone "should", from the insights summary unless asked for.
+const defaultInsightConfidence = 0.5
+
+type DetectDistortionsRequest struct {
+	Text   string `json:"text"`
+	Refine bool   `json:"refine"`
+}
+
+// DetectTextDistortionsHandler tags distortions in arbitrary text without
+// storing anything. The rule-based detector always runs; set refine to have
+// the model review its findings.
+func DetectTextDistortionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req DetectDistortionsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Text) == "" {
+		http.Error(w, "text is required", http.StatusBadRequest)
+		return
+	}
+
+	findings := utils.DetectDistortionFindings(r.Context(), req.Text, req.Refine)
+	if findings == nil {
+		findings = []models.DistortionFinding{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(findings)
+}
+
+func GetJournalDistortionsHandler(w http.ResponseWriter, r *http.Request, id int) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if _, err := models.GetJournalEntry(id); errors.Is(err, models.ErrNotFound) {
+		http.Error(w, "Journal entry not found", http.StatusNotFound)
+		return
+	}
+
+	findings, err := models.GetDistortionFindings(models.SearchKindJournal, id)
+	if err != nil {
+		http.Error(w, "Failed to retrieve distortions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(findings)
+}
+
+// GetTranscriptDistortionsHandler returns the distortions found in the
+// user's turns of a session; offsets are relative to each turn's text.
+// record_id tells transcripts apart when a session has several.
+func GetTranscriptDistortionsHandler(w http.ResponseWriter, r *http.Request, sessionID string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	transcripts, err := models.GetTranscriptsBySessionID(sessionID)
+	if errors.Is(err, models.ErrNotFound) {
+		http.Error(w, "Transcript not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve transcript", http.StatusInternalServerError)
+		return
+	}
+
+	findings := []models.DistortionFinding{}
+	for _, t := range transcripts {
+		found, err := models.GetDistortionFindings(models.SearchKindTranscript, t.ID)
+		if err != nil {
+			http.Error(w, "Failed to retrieve distortions", http.StatusInternalServerError)
+			return
+		}
+		findings = append(findings, found...)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(findings)
+}
+
+// DistortionInsightsHandler summarizes detected distortions across journals
+// and transcripts, optionally within ?from= and ?to= dates.
+func DistortionInsightsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	minConfidence := defaultInsightConfidence
+	if v := q.Get("min_confidence"); v != "" {
+		c, err := strconv.ParseFloat(v, 64)
+		if err != nil || c < 0 || c > 1 {
+			http.Error(w, "min_confidence must be between 0 and 1", http.StatusBadRequest)
+			return
+		}
+		minConfidence = c
+	}
+
+	insights, err := models.GetDistortionInsights(q.Get("from"), q.Get("to"), minConfidence)
+	if err != nil {
+		log.Printf("Error summarizing distortions: %v", err)
+		http.Error(w, "Failed to summarize distortions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(insights)
+}
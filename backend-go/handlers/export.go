@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mindful/backend-go/models"
+	"mindful/backend-go/utils"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportStreamLimit is the number of records above which exports are built by a
+// background job instead of being streamed in the request.
+const exportStreamLimit = 500
+
+type ExportJobResponse struct {
+	models.ExportJob
+	StatusURL   string `json:"status_url"`
+	DownloadURL string `json:"download_url,omitempty"`
+}
+
+func exportDir() string {
+	if dir := os.Getenv("EXPORT_DIR"); dir != "" {
+		return dir
+	}
+	return "./exports"
+}
+
+func newExportJobResponse(job models.ExportJob) ExportJobResponse {
+	resp := ExportJobResponse{
+		ExportJob: job,
+		StatusURL: fmt.Sprintf("/me/export/jobs/%d", job.ID),
+	}
+	if job.Status == "completed" && !job.Expired(time.Now()) {
+		resp.DownloadURL = "/me/export/download?token=" + job.Token
+	}
+	return resp
+}
+
+func ExportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	count, err := utils.CountExportRecords()
+	if err != nil {
+		http.Error(w, "Failed to prepare export", http.StatusInternalServerError)
+		return
+	}
+
+	if r.URL.Query().Get("async") == "true" || count > exportStreamLimit {
+		job, err := utils.StartExportJob(exportDir())
+		if err != nil {
+			http.Error(w, "Failed to start export job", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(newExportJobResponse(job))
+		return
+	}
+
+	filename := fmt.Sprintf("mindful-export-%s.zip", time.Now().UTC().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	if err := utils.WriteExport(w); err != nil {
+		// Headers are already sent, so the truncated archive is all we can signal.
+		log.Printf("Error streaming export: %v", err)
+	}
+}
+
+func GetExportJobHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/me/export/jobs/"))
+	if err != nil {
+		http.Error(w, "Invalid export job ID", http.StatusBadRequest)
+		return
+	}
+
+	job, err := models.GetExportJob(id)
+	if errors.Is(err, models.ErrExportJobNotFound) {
+		http.Error(w, "Export job not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve export job", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newExportJobResponse(job))
+}
+
+func DownloadExportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	job, err := models.GetExportJobByToken(r.URL.Query().Get("token"))
+	if errors.Is(err, models.ErrExportJobNotFound) {
+		http.Error(w, "Export not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve export", http.StatusInternalServerError)
+		return
+	}
+	if job.Status != "completed" {
+		http.Error(w, "Export is not ready", http.StatusConflict)
+		return
+	}
+	if job.Expired(time.Now()) {
+		http.Error(w, "Export link has expired", http.StatusGone)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="mindful-export-%d.zip"`, job.ID))
+	http.ServeFile(w, r, job.FilePath)
+}
@@ -2,9 +2,12 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"mindful/backend-go/models"
 	"mindful/backend-go/utils"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
 type GameplanResponse struct {
@@ -72,3 +75,112 @@ func GetGamePlansHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(gamePlans)
 }
+
+func GamePlanHandler(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/gameplans/"), "/"), "/")
+	id, err := strconv.Atoi(parts[0])
+	if err != nil {
+		http.Error(w, "Invalid game plan ID", http.StatusBadRequest)
+		return
+	}
+
+	if (len(parts) == 3 || len(parts) == 4) && parts[1] == "tasks" {
+		taskID, err := strconv.Atoi(parts[2])
+		if err != nil {
+			http.Error(w, "Invalid task ID", http.StatusBadRequest)
+			return
+		}
+		switch {
+		case len(parts) == 3:
+			UpdateGamePlanTaskHandler(w, r, id, taskID)
+		case parts[3] == "promote":
+			PromoteTaskHandler(w, r, id, taskID)
+		case parts[3] == "goal":
+			SetTaskGoalHandler(w, r, id, taskID)
+		case parts[3] == "due":
+			SetTaskDueHandler(w, r, id, taskID)
+		default:
+			http.NotFound(w, r)
+		}
+		return
+	}
+	if len(parts) >= 2 && parts[1] == "schedule" {
+		switch {
+		case len(parts) == 2:
+			ScheduleTasksHandler(w, r, id)
+		case len(parts) == 3 && parts[2] == "accept":
+			AcceptScheduleHandler(w, r, id)
+		default:
+			http.NotFound(w, r)
+		}
+		return
+	}
+	if len(parts) != 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	err = models.DeleteGamePlan(id)
+	if errors.Is(err, models.ErrNotFound) {
+		http.Error(w, "Game plan not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to delete game plan", http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]string{"message": "Game plan deleted successfully"}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+type TaskStatusRequest struct {
+	Status string `json:"status"`
+}
+
+// UpdateGamePlanTaskHandler marks a game plan task open or completed.
+func UpdateGamePlanTaskHandler(w http.ResponseWriter, r *http.Request, planID, taskID int) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req TaskStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	before, _ := models.GetGamePlanTask(planID, taskID)
+	task, err := models.SetGamePlanTaskStatus(planID, taskID, req.Status)
+	if errors.Is(err, models.ErrInvalidTaskStatus) {
+		http.Error(w, "Status must be open or completed", http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, models.ErrNotFound) {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to update task", http.StatusInternalServerError)
+		return
+	}
+	if task.Status == models.TaskStatusCompleted && before.Status != models.TaskStatusCompleted {
+		utils.EmitEvent(models.EventTaskCompleted, map[string]interface{}{
+			"game_plan_id": planID,
+			"task_id":      task.ID,
+			"description":  task.Description,
+			"goal_id":      task.GoalID,
+			"completed_at": task.CompletedAt,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(task)
+}
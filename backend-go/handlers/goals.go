@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"mindful/backend-go/models"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+func writeGoalError(w http.ResponseWriter, err error, notFound, action string) {
+	switch {
+	case errors.Is(err, models.ErrInvalidGoal):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, models.ErrNotFound):
+		http.Error(w, notFound, http.StatusNotFound)
+	default:
+		log.Printf("Error trying to %s: %v", action, err)
+		http.Error(w, "Failed to "+action, http.StatusInternalServerError)
+	}
+}
+
+// GoalsHandler serves /goals and everything below it.
+func GoalsHandler(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/goals"), "/")
+	if path == "" {
+		switch r.Method {
+		case http.MethodGet:
+			ListGoalsHandler(w, r)
+		case http.MethodPost:
+			CreateGoalHandler(w, r)
+		default:
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	parts := strings.Split(path, "/")
+	id, err := strconv.Atoi(parts[0])
+	if err != nil {
+		http.Error(w, "Invalid goal ID", http.StatusBadRequest)
+		return
+	}
+	switch {
+	case len(parts) == 1:
+		GoalHandler(w, r, id)
+	case len(parts) == 2 && parts[1] == "tasks":
+		GoalTasksHandler(w, r, id)
+	case len(parts) == 2 && parts[1] == "milestones":
+		AddMilestoneHandler(w, r, id)
+	case len(parts) == 3 && parts[1] == "milestones":
+		milestoneID, err := strconv.Atoi(parts[2])
+		if err != nil {
+			http.Error(w, "Invalid milestone ID", http.StatusBadRequest)
+			return
+		}
+		MilestoneHandler(w, r, id, milestoneID)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// ListGoalsHandler lists goals with milestones and progress, optionally
+// filtered by ?status=.
+func ListGoalsHandler(w http.ResponseWriter, r *http.Request) {
+	goals, err := models.ListGoals(r.URL.Query().Get("status"))
+	if err != nil {
+		writeGoalError(w, err, "Goal not found", "retrieve goals")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(goals)
+}
+
+func CreateGoalHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.Goal
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	goal, err := models.CreateGoal(req)
+	if err != nil {
+		writeGoalError(w, err, "Goal not found", "create goal")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(goal)
+}
+
+// GoalHandler serves GET, PUT and DELETE for a single goal.
+func GoalHandler(w http.ResponseWriter, r *http.Request, id int) {
+	switch r.Method {
+	case http.MethodGet:
+		goal, err := models.GetGoal(id)
+		if err != nil {
+			writeGoalError(w, err, "Goal not found", "retrieve goal")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(goal)
+	case http.MethodPut:
+		var req models.Goal
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+			return
+		}
+		goal, err := models.UpdateGoal(id, req)
+		if err != nil {
+			writeGoalError(w, err, "Goal not found", "update goal")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(goal)
+	case http.MethodDelete:
+		if err := models.DeleteGoal(id); err != nil {
+			writeGoalError(w, err, "Goal not found", "delete goal")
+			return
+		}
+		response := map[string]string{"message": "Goal deleted successfully"}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	default:
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+	}
+}
+
+// GoalTasksHandler lists the game plan tasks linked to a goal.
+func GoalTasksHandler(w http.ResponseWriter, r *http.Request, id int) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if _, err := models.GetGoal(id); err != nil {
+		writeGoalError(w, err, "Goal not found", "retrieve goal tasks")
+		return
+	}
+	tasks, err := models.GetGoalTasks(id)
+	if err != nil {
+		writeGoalError(w, err, "Goal not found", "retrieve goal tasks")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tasks)
+}
+
+func AddMilestoneHandler(w http.ResponseWriter, r *http.Request, goalID int) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req models.GoalMilestone
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+	milestone, err := models.AddMilestone(goalID, req)
+	if err != nil {
+		writeGoalError(w, err, "Goal not found", "add milestone")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(milestone)
+}
+
+// MilestoneHandler updates (PUT) or deletes (DELETE) a goal's milestone.
+func MilestoneHandler(w http.ResponseWriter, r *http.Request, goalID, milestoneID int) {
+	switch r.Method {
+	case http.MethodPut:
+		var req models.GoalMilestone
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+			return
+		}
+		milestone, err := models.UpdateMilestone(goalID, milestoneID, req)
+		if err != nil {
+			writeGoalError(w, err, "Milestone not found", "update milestone")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(milestone)
+	case http.MethodDelete:
+		if err := models.DeleteMilestone(goalID, milestoneID); err != nil {
+			writeGoalError(w, err, "Milestone not found", "delete milestone")
+			return
+		}
+		response := map[string]string{"message": "Milestone deleted successfully"}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	default:
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+	}
+}
+
+type TaskGoalRequest struct {
+	GoalID *int `json:"goal_id"`
+}
+
+// SetTaskGoalHandler attaches a game plan task to a goal, or detaches it
+// when goal_id is null.
+func SetTaskGoalHandler(w http.ResponseWriter, r *http.Request, planID, taskID int) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req TaskGoalRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+	task, err := models.SetGamePlanTaskGoal(planID, taskID, req.GoalID)
+	if err != nil {
+		writeGoalError(w, err, "Task not found", "update task")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(task)
+}
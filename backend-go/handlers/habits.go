@@ -0,0 +1,289 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"mindful/backend-go/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type HabitLogRequest struct {
+	Date  string `json:"date"`
+	Count int    `json:"count"`
+	Note  string `json:"note"`
+}
+
+// requestDate returns the ?date= parameter as the user's current day, or the
+// server's date when it is not given. Clients in other time zones should
+// pass it so "today" matches theirs.
+func requestDate(r *http.Request) (time.Time, error) {
+	if d := r.URL.Query().Get("date"); d != "" {
+		return models.ParseDate(d)
+	}
+	return time.Now(), nil
+}
+
+func writeHabitError(w http.ResponseWriter, err error, action string) {
+	switch {
+	case errors.Is(err, models.ErrInvalidHabit):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, models.ErrNotFound):
+		http.Error(w, "Habit not found", http.StatusNotFound)
+	default:
+		log.Printf("Error trying to %s: %v", action, err)
+		http.Error(w, "Failed to "+action, http.StatusInternalServerError)
+	}
+}
+
+// HabitsHandler serves /habits and everything below it.
+func HabitsHandler(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/habits"), "/")
+	if path == "" {
+		switch r.Method {
+		case http.MethodGet:
+			ListHabitsHandler(w, r)
+		case http.MethodPost:
+			CreateHabitHandler(w, r)
+		default:
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+	if path == "today" {
+		HabitsTodayHandler(w, r)
+		return
+	}
+
+	parts := strings.Split(path, "/")
+	id, err := strconv.Atoi(parts[0])
+	if err != nil {
+		http.Error(w, "Invalid habit ID", http.StatusBadRequest)
+		return
+	}
+	switch {
+	case len(parts) == 1:
+		HabitHandler(w, r, id)
+	case len(parts) == 2 && parts[1] == "logs":
+		HabitLogsHandler(w, r, id)
+	case len(parts) == 3 && parts[1] == "logs":
+		logID, err := strconv.Atoi(parts[2])
+		if err != nil {
+			http.Error(w, "Invalid log ID", http.StatusBadRequest)
+			return
+		}
+		DeleteHabitLogHandler(w, r, id, logID)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// ListHabitsHandler lists every habit with its current and longest streak.
+func ListHabitsHandler(w http.ResponseWriter, r *http.Request) {
+	today, err := requestDate(r)
+	if err != nil {
+		http.Error(w, "date must be YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+	habits, err := models.GetAllHabits()
+	if err == nil {
+		habits, err = models.WithStreaks(habits, today)
+	}
+	if err != nil {
+		writeHabitError(w, err, "retrieve habits")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(habits)
+}
+
+func CreateHabitHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.Habit
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+	req.SourceTaskID = nil
+
+	habit, err := models.CreateHabit(req)
+	if err != nil {
+		writeHabitError(w, err, "create habit")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(habit)
+}
+
+// HabitHandler serves GET, PUT and DELETE for a single habit.
+func HabitHandler(w http.ResponseWriter, r *http.Request, id int) {
+	switch r.Method {
+	case http.MethodGet:
+		today, err := requestDate(r)
+		if err != nil {
+			http.Error(w, "date must be YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		habit, err := models.GetHabit(id)
+		if err != nil {
+			writeHabitError(w, err, "retrieve habit")
+			return
+		}
+		withStreak, err := models.WithStreaks([]models.Habit{habit}, today)
+		if err != nil {
+			writeHabitError(w, err, "retrieve habit")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(withStreak[0])
+	case http.MethodPut:
+		var req models.Habit
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+			return
+		}
+		habit, err := models.UpdateHabit(id, req)
+		if err != nil {
+			writeHabitError(w, err, "update habit")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(habit)
+	case http.MethodDelete:
+		if err := models.DeleteHabit(id); err != nil {
+			writeHabitError(w, err, "delete habit")
+			return
+		}
+		response := map[string]string{"message": "Habit deleted successfully"}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	default:
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+	}
+}
+
+// HabitLogsHandler lists a habit's logs (GET, optional ?from=&to=) or logs a
+// completion (POST). A log without a date counts for today.
+func HabitLogsHandler(w http.ResponseWriter, r *http.Request, id int) {
+	switch r.Method {
+	case http.MethodGet:
+		if _, err := models.GetHabit(id); err != nil {
+			writeHabitError(w, err, "retrieve habit logs")
+			return
+		}
+		logs, err := models.GetHabitLogs(id, r.URL.Query().Get("from"), r.URL.Query().Get("to"))
+		if err != nil {
+			writeHabitError(w, err, "retrieve habit logs")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(logs)
+	case http.MethodPost:
+		var req HabitLogRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+			return
+		}
+		if req.Date == "" {
+			req.Date = time.Now().Format(models.DateLayout)
+		}
+		if req.Count == 0 {
+			req.Count = 1
+		}
+		entry, err := models.LogHabit(id, req.Date, req.Count, req.Note)
+		if err != nil {
+			writeHabitError(w, err, "log habit")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(entry)
+	default:
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+	}
+}
+
+func DeleteHabitLogHandler(w http.ResponseWriter, r *http.Request, habitID, logID int) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := models.DeleteHabitLog(habitID, logID)
+	if errors.Is(err, models.ErrNotFound) {
+		http.Error(w, "Habit log not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeHabitError(w, err, "delete habit log")
+		return
+	}
+
+	response := map[string]string{"message": "Habit log deleted successfully"}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// HabitsTodayHandler lists every habit with whether it is due today and how
+// many completions have been logged, due habits first.
+func HabitsTodayHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	today, err := requestDate(r)
+	if err != nil {
+		http.Error(w, "date must be YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+	days, err := models.GetHabitDay(today)
+	if err != nil {
+		writeHabitError(w, err, "retrieve today's habits")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(days)
+}
+
+// PromoteTaskHandler turns a game plan task into a recurring habit. The body
+// is optional and takes the same schedule fields as a habit; without it the
+// habit is due daily.
+func PromoteTaskHandler(w http.ResponseWriter, r *http.Request, planID, taskID int) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req models.Habit
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+			return
+		}
+	}
+
+	habit, err := models.PromoteTaskToHabit(planID, taskID, req)
+	if errors.Is(err, models.ErrTaskAlreadyPromoted) {
+		http.Error(w, "Task has already been promoted to a habit", http.StatusConflict)
+		return
+	}
+	if errors.Is(err, models.ErrNotFound) {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeHabitError(w, err, "promote task")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(habit)
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"io"
+	"mindful/backend-go/database"
+	"mindful/backend-go/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// openTestDB creates a fresh database in a temporary directory and makes it
+// the working directory for the rest of the test.
+func openTestDB(t *testing.T) {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	database.InitDB()
+	models.InitDatabase(database.DB)
+	t.Cleanup(func() { database.DB.Close() })
+}
+
+// serve sends a request with an optional body to h and returns the
+// recorded response.
+func serve(h http.HandlerFunc, method, path, body string) *httptest.ResponseRecorder {
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest(method, path, r))
+	return w
+}
@@ -2,12 +2,33 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"log"
 	"mindful/backend-go/models"
+	"mindful/backend-go/utils"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
 type JournalRequest struct {
-	Content string `json:"content"`
+	Title         string   `json:"title"`
+	Content       string   `json:"content"`
+	Tags          []string `json:"tags"`
+	Location      string   `json:"location"`
+	MoodIntensity *int     `json:"mood_intensity"`
+	PromptID      string   `json:"prompt_id"`
+}
+
+func (req JournalRequest) journal() models.Journal {
+	return models.Journal{
+		Title:         strings.TrimSpace(req.Title),
+		Content:       req.Content,
+		Tags:          req.Tags,
+		Location:      strings.TrimSpace(req.Location),
+		MoodIntensity: req.MoodIntensity,
+		PromptID:      req.PromptID,
+	}
 }
 
 func AddJournalEntryHandler(w http.ResponseWriter, r *http.Request) {
@@ -22,34 +43,295 @@ func AddJournalEntryHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := models.StoreJournalEntry(req.Content); err != nil {
+	if req.PromptID != "" {
+		if _, err := utils.LookupPrompt(req.PromptID); errors.Is(err, utils.ErrUnknownPrompt) {
+			http.Error(w, "Unknown prompt_id", http.StatusBadRequest)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to look up journal prompt", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	id, err := models.StoreJournalEntry(req.journal())
+	if errors.Is(err, models.ErrInvalidMoodIntensity) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
 		http.Error(w, "Failed to store journal entry", http.StatusInternalServerError)
 		return
 	}
+	utils.AnalyzeJournalAsync(id, req.Content)
+	utils.EmitEvent(models.EventJournalCreated, map[string]interface{}{
+		"id":             id,
+		"title":          strings.TrimSpace(req.Title),
+		"tags":           req.Tags,
+		"mood_intensity": req.MoodIntensity,
+		"prompt_id":      req.PromptID,
+	})
 
-	response := map[string]string{"message": "Journal entry created successfully"}
+	response := map[string]interface{}{"message": "Journal entry created successfully", "id": id}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(response)
 }
 
 func GetJournalEntriesHandler(w http.ResponseWriter, r *http.Request) {
+    path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/journals/"), "/")
+    if path != "" {
+        idPart, sub, _ := strings.Cut(path, "/")
+        id, err := strconv.Atoi(idPart)
+        if err != nil {
+            http.Error(w, "Invalid journal entry ID", http.StatusBadRequest)
+            return
+        }
+        switch {
+        case sub == "":
+            JournalEntryHandler(w, r, id)
+        case sub == "related":
+            GetRelatedJournalEntriesHandler(w, r, id)
+        case sub == "distortions":
+            GetJournalDistortionsHandler(w, r, id)
+        case sub == "tag-suggestions":
+            GetTagSuggestionsHandler(w, r, id)
+        case strings.HasPrefix(sub, "tag-suggestions/"):
+            tag, verb, _ := strings.Cut(strings.TrimPrefix(sub, "tag-suggestions/"), "/")
+            ResolveTagSuggestionHandler(w, r, id, tag, verb)
+        case sub == "revisions":
+            GetJournalRevisionsHandler(w, r, id)
+        case strings.HasPrefix(sub, "revisions/") && strings.HasSuffix(sub, "/restore"):
+            revID, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(sub, "revisions/"), "/restore"))
+            if err != nil {
+                http.Error(w, "Invalid revision ID", http.StatusBadRequest)
+                return
+            }
+            RestoreJournalRevisionHandler(w, r, id, revID)
+        default:
+            http.NotFound(w, r)
+        }
+        return
+    }
+
     if r.Method != http.MethodGet {
         http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
         return
     }
 
-    journals, err := models.GetAllJournalEntries()
+    query := r.URL.Query()
+    filter := models.JournalFilter{
+        Tag:     query.Get("tag"),
+        From:    query.Get("from"),
+        To:      query.Get("to"),
+        Emotion: query.Get("emotion"),
+    }
+    journals, err := models.ListJournalEntries(filter)
     if err != nil {
         http.Error(w, "Failed to retrieve journal entries", http.StatusInternalServerError)
         return
     }
 
     if len(journals) == 0 {
-        http.Error(w, "No journal entries available", http.StatusNotFound)
-        return
+        // A filter that matches nothing is a valid, empty result.
+        if filter == (models.JournalFilter{}) {
+            http.Error(w, "No journal entries available", http.StatusNotFound)
+            return
+        }
+        journals = []models.Journal{}
     }
 
     w.Header().Set("Content-Type", "application/json")
     json.NewEncoder(w).Encode(journals)
-}
\ No newline at end of file
+}
+
+// JournalEntryHandler serves GET, PUT and DELETE for a single journal entry.
+func JournalEntryHandler(w http.ResponseWriter, r *http.Request, id int) {
+	switch r.Method {
+	case http.MethodGet:
+		journal, err := models.GetJournalEntry(id)
+		if errors.Is(err, models.ErrNotFound) {
+			http.Error(w, "Journal entry not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to retrieve journal entry", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(journal)
+	case http.MethodPut:
+		UpdateJournalEntryHandler(w, r, id)
+	case http.MethodDelete:
+		DeleteJournalEntryHandler(w, r, id)
+	default:
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+	}
+}
+
+func UpdateJournalEntryHandler(w http.ResponseWriter, r *http.Request, id int) {
+	var req JournalRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	journal, err := models.UpdateJournalEntry(id, req.journal())
+	if errors.Is(err, models.ErrNotFound) {
+		http.Error(w, "Journal entry not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, models.ErrInvalidMoodIntensity) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating journal %d: %v", id, err)
+		http.Error(w, "Failed to update journal entry", http.StatusInternalServerError)
+		return
+	}
+	utils.AnalyzeJournalAsync(journal.ID, journal.Content)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(journal)
+}
+
+func DeleteJournalEntryHandler(w http.ResponseWriter, r *http.Request, id int) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := models.DeleteJournalEntry(id)
+	if errors.Is(err, models.ErrNotFound) {
+		http.Error(w, "Journal entry not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to delete journal entry", http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]string{"message": "Journal entry deleted successfully"}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func GetJournalRevisionsHandler(w http.ResponseWriter, r *http.Request, id int) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if _, err := models.GetJournalEntry(id); errors.Is(err, models.ErrNotFound) {
+		http.Error(w, "Journal entry not found", http.StatusNotFound)
+		return
+	}
+
+	revisions, err := models.GetJournalRevisions(id)
+	if err != nil {
+		http.Error(w, "Failed to retrieve journal revisions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revisions)
+}
+
+// RestoreJournalRevisionHandler makes a previous revision the current content.
+func RestoreJournalRevisionHandler(w http.ResponseWriter, r *http.Request, id, revisionID int) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	journal, err := models.RestoreJournalRevision(id, revisionID)
+	if errors.Is(err, models.ErrNotFound) {
+		http.Error(w, "Journal revision not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error restoring journal %d revision %d: %v", id, revisionID, err)
+		http.Error(w, "Failed to restore journal revision", http.StatusInternalServerError)
+		return
+	}
+	utils.AnalyzeJournalAsync(journal.ID, journal.Content)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(journal)
+}
+
+func GetRelatedJournalEntriesHandler(w http.ResponseWriter, r *http.Request, id int) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	related, err := utils.RelatedRecords(r.Context(), utils.DefaultEmbedder(), models.SearchKindJournal, id, queryInt(r, "limit", 5, 50))
+	if errors.Is(err, models.ErrNotFound) {
+		http.Error(w, "Journal entry not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error finding related entries for journal %d: %v", id, err)
+		http.Error(w, "Failed to find related entries", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(related)
+}
+
+// GetTagSuggestionsHandler lists the tags suggested for an entry. Pass
+// ?all=true to include suggestions that were already accepted or rejected.
+func GetTagSuggestionsHandler(w http.ResponseWriter, r *http.Request, id int) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if _, err := models.GetJournalEntry(id); errors.Is(err, models.ErrNotFound) {
+		http.Error(w, "Journal entry not found", http.StatusNotFound)
+		return
+	}
+
+	suggestions, err := models.GetTagSuggestions(id, r.URL.Query().Get("all") != "true")
+	if err != nil {
+		http.Error(w, "Failed to retrieve tag suggestions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(suggestions)
+}
+
+// ResolveTagSuggestionHandler accepts or rejects a suggested tag via
+// POST /journals/{id}/tag-suggestions/{tag}/accept or .../reject.
+func ResolveTagSuggestionHandler(w http.ResponseWriter, r *http.Request, id int, tag, verb string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	if verb != "accept" && verb != "reject" {
+		http.NotFound(w, r)
+		return
+	}
+
+	err := models.ResolveTagSuggestion(id, tag, verb == "accept")
+	if errors.Is(err, models.ErrNotFound) {
+		http.Error(w, "Tag suggestion not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error resolving tag suggestion %q for journal %d: %v", tag, id, err)
+		http.Error(w, "Failed to update tag suggestion", http.StatusInternalServerError)
+		return
+	}
+
+	journal, err := models.GetJournalEntry(id)
+	if err != nil {
+		http.Error(w, "Failed to retrieve journal entry", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(journal)
+}
@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"mindful/backend-go/models"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+)
+
+type contextKey string
+
+const requestIDKey contextKey = "request_id"
+
+// auditedResources maps path prefixes of sensitive resources to the resource
+// type recorded in the audit log. Longer prefixes must come first.
+var auditedResources = []struct {
+	prefix       string
+	resourceType string
+}{
+	{"/me/export", "export"},
+	{"/me", "account"},
+	{"/transcripts", "transcript"},
+	{"/sessions", "session"},
+	{"/voice/sessions", "session"},
+	{"/voice", "voice"},
+	{"/journal-prompts", "journal_prompt"},
+	{"/journals", "journal"},
+	{"/tags", "tag"},
+	{"/thought-records", "thought_record"},
+	{"/distortions", "distortion"},
+	{"/habits", "habit"},
+	{"/goals", "goal"},
+	{"/reminders", "reminder"},
+	{"/notifications", "notification"},
+	{"/calendar.ics", "calendar"},
+	{"/calendar", "calendar"},
+	{"/planned-sessions", "planned_session"},
+	{"/webhooks", "webhook"},
+	{"/insights", "insights"},
+	{"/gameplans", "game_plan"},
+	{"/gameplan", "game_plan"},
+	{"/retention", "retention"},
+	{"/search", "search"},
+	{"/admin/audit", "audit_log"},
+}
+
+// auditPathVerbs are path segments that name an operation rather than a record.
+var auditPathVerbs = map[string]bool{"add": true, "analyze": true, "semantic": true, "distortions": true, "detect-distortions": true, "detect": true, "today": true, "unread-count": true, "read-all": true, "token": true, "import": true, "busy": true, "deliveries": true, "verify": true, "next": true, "answered": true}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Hijack lets WebSocket handlers take over the connection; the upgrade is
+// recorded as 101 Switching Protocols.
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(r.ResponseWriter).Hijack()
+	if err == nil {
+		r.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// RequestID returns the ID assigned to the request by AuditMiddleware.
+func RequestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey).(string)
+	return id
+}
+
+// AuditMiddleware tags every request with a request ID and appends an audit
+// event for each read or write of a sensitive resource.
+func AuditMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get("X-Request-ID")
+		if requestID == "" {
+			requestID = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", requestID)
+		r = r.WithContext(context.WithValue(r.Context(), requestIDKey, requestID))
+
+		resourceType, resourceID, audited := auditResource(r.URL.Path)
+		if !audited || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		event := models.AuditEvent{
+			Actor:        "user",
+			Action:       auditAction(r.Method),
+			ResourceType: resourceType,
+			ResourceID:   resourceID,
+			RequestID:    requestID,
+			IP:           clientIP(r),
+			Status:       rec.status,
+		}
+		if err := models.AppendAuditEvent(event); err != nil {
+			log.Printf("Error writing audit event for %s %s: %v", r.Method, r.URL.Path, err)
+		}
+	})
+}
+
+func auditResource(path string) (resourceType, resourceID string, ok bool) {
+	for _, res := range auditedResources {
+		if path != res.prefix && !strings.HasPrefix(path, res.prefix+"/") {
+			continue
+		}
+		rest := strings.Trim(strings.TrimPrefix(path, res.prefix), "/")
+		id, _, _ := strings.Cut(rest, "/")
+		if auditPathVerbs[id] {
+			id = ""
+		}
+		return res.resourceType, id, true
+	}
+	return "", "", false
+}
+
+func auditAction(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead:
+		return "read"
+	case http.MethodPost:
+		return "create"
+	case http.MethodPut, http.MethodPatch:
+		return "update"
+	case http.MethodDelete:
+		return "delete"
+	}
+	return strings.ToLower(method)
+}
+
+// clientIP is the address a request came from. X-Forwarded-For is only
+// believed when the connection comes from one of TRUSTED_PROXIES, a
+// comma-separated list of IPs or CIDRs. The client is then the rightmost
+// forwarded address that isn't a trusted proxy, since anything to its left
+// was written by the client.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	proxies := trustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if !isTrustedProxy(proxies, host) {
+		return host
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		if _, err := netip.ParseAddr(hop); err != nil {
+			break
+		}
+		host = hop
+		if !isTrustedProxy(proxies, hop) {
+			break
+		}
+	}
+	return host
+}
+
+// trustedProxies parses a comma-separated list of IPs and CIDRs, skipping
+// entries that are neither.
+func trustedProxies(list string) []netip.Prefix {
+	var proxies []netip.Prefix
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			proxies = append(proxies, prefix.Masked())
+		} else if addr, err := netip.ParseAddr(entry); err == nil {
+			proxies = append(proxies, netip.PrefixFrom(addr, addr.BitLen()))
+		}
+	}
+	return proxies
+}
+
+func isTrustedProxy(proxies []netip.Prefix, ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range proxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"mindful/backend-go/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8, 192.168.1.1, bogus")
+	tests := []struct {
+		name, remote, forwarded, want string
+	}{
+		{"no proxy", "203.0.113.7:4000", "", "203.0.113.7"},
+		{"untrusted peer", "203.0.113.7:4000", "198.51.100.1", "203.0.113.7"},
+		{"trusted peer", "10.1.2.3:4000", "198.51.100.1", "198.51.100.1"},
+		{"spoofed hop", "10.1.2.3:4000", "1.1.1.1, 198.51.100.1", "198.51.100.1"},
+		{"proxy chain", "10.1.2.3:4000", "1.1.1.1, 198.51.100.1, 192.168.1.1, 10.9.9.9", "198.51.100.1"},
+		{"only proxies", "192.168.1.1:4000", "10.9.9.9", "10.9.9.9"},
+		{"trusted peer without header", "10.1.2.3:4000", "", "10.1.2.3"},
+		{"garbage hop", "10.1.2.3:4000", "198.51.100.1, <script>", "10.1.2.3"},
+		{"ipv6 peer", "[2001:db8::1]:4000", "198.51.100.1", "2001:db8::1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/journals", nil)
+			r.RemoteAddr = tt.remote
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if got := clientIP(r); got != tt.want {
+				t.Errorf("clientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientIPWithoutTrustedProxies(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "")
+	r := httptest.NewRequest("GET", "/journals", nil)
+	r.RemoteAddr = "127.0.0.1:4000"
+	r.Header.Set("X-Forwarded-For", "198.51.100.1")
+	if got := clientIP(r); got != "127.0.0.1" {
+		t.Errorf("clientIP = %q, want the peer address", got)
+	}
+}
+
+func TestAuditMiddlewareRecordsResource(t *testing.T) {
+	openTestDB(t)
+	h := AuditMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	tests := []struct {
+		method, path, resourceType, resourceID, action string
+	}{
+		{"GET", "/goals/7/milestones/3", "goal", "7", "read"},
+		{"DELETE", "/journals/12", "journal", "12", "delete"},
+		{"POST", "/journals/add", "journal", "", "create"},
+		{"GET", "/journal-prompts/answered", "journal_prompt", "", "read"},
+		{"GET", "/journal-prompts/next", "journal_prompt", "", "read"},
+		{"GET", "/admin/audit/verify", "audit_log", "", "read"},
+		{"GET", "/sessions/s1/audio/info", "session", "s1", "read"},
+	}
+	for _, tt := range tests {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(tt.method, tt.path, nil))
+		events, err := models.GetAuditEvents(models.AuditFilter{Limit: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 1 {
+			t.Fatalf("%s %s: no audit event", tt.method, tt.path)
+		}
+		e := events[0]
+		if e.ResourceType != tt.resourceType || e.ResourceID != tt.resourceID || e.Action != tt.action {
+			t.Errorf("%s %s recorded %s %s %q, want %s %s %q", tt.method, tt.path,
+				e.Action, e.ResourceType, e.ResourceID, tt.action, tt.resourceType, tt.resourceID)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"mindful/backend-go/utils"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// JournalPromptsHandler serves the prompt library at /journal-prompts and
+// dispatches /journal-prompts/next and /journal-prompts/answered.
+func JournalPromptsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch strings.Trim(strings.TrimPrefix(r.URL.Path, "/journal-prompts"), "/") {
+	case "":
+		category := r.URL.Query().Get("category")
+		if category != "" && !validPromptCategory(category) {
+			http.Error(w, "Invalid prompt category", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(utils.PromptLibrary(category))
+	case "next":
+		NextJournalPromptHandler(w, r)
+	case "answered":
+		AnsweredJournalPromptsHandler(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func validPromptCategory(category string) bool {
+	for _, c := range utils.PromptCategories() {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+// NextJournalPromptHandler picks a prompt for the user. The optional tz
+// parameter (an IANA zone such as Europe/Berlin) sets the user's time of day;
+// category restricts the choice and personalized=true asks the model to
+// write a new prompt.
+func NextJournalPromptHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	now := time.Now()
+	if tz := q.Get("tz"); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			http.Error(w, "Invalid time zone", http.StatusBadRequest)
+			return
+		}
+		now = now.In(loc)
+	}
+	category := q.Get("category")
+	if category != "" && !validPromptCategory(category) {
+		http.Error(w, "Invalid prompt category", http.StatusBadRequest)
+		return
+	}
+
+	selection, err := utils.NextPrompt(r.Context(), utils.PromptOptions{
+		Now:          now,
+		Category:     category,
+		Personalized: q.Get("personalized") == "true",
+	})
+	if err != nil {
+		log.Printf("Error choosing journal prompt: %v", err)
+		http.Error(w, "Failed to choose a journal prompt", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(selection)
+}
+
+func AnsweredJournalPromptsHandler(w http.ResponseWriter, r *http.Request) {
+	answered, err := utils.AnsweredPrompts()
+	if err != nil {
+		http.Error(w, "Failed to retrieve answered prompts", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(answered)
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"mindful/backend-go/models"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+func writeReminderError(w http.ResponseWriter, err error, notFound, action string) {
+	switch {
+	case errors.Is(err, models.ErrInvalidReminder):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, models.ErrNotFound):
+		http.Error(w, notFound, http.StatusNotFound)
+	default:
+		log.Printf("Error trying to %s: %v", action, err)
+		http.Error(w, "Failed to "+action, http.StatusInternalServerError)
+	}
+}
+
+// RemindersHandler serves /reminders and /reminders/{id}.
+func RemindersHandler(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/reminders"), "/")
+	if path == "" {
+		switch r.Method {
+		case http.MethodGet:
+			reminders, err := models.ListReminders()
+			if err != nil {
+				writeReminderError(w, err, "Reminder not found", "retrieve reminders")
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(reminders)
+		case http.MethodPost:
+			var req models.Reminder
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+				return
+			}
+			reminder, err := models.CreateReminder(req)
+			if err != nil {
+				writeReminderError(w, err, "Reminder not found", "create reminder")
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(reminder)
+		default:
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	id, err := strconv.Atoi(path)
+	if err != nil {
+		http.Error(w, "Invalid reminder ID", http.StatusBadRequest)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		reminder, err := models.GetReminder(id)
+		if err != nil {
+			writeReminderError(w, err, "Reminder not found", "retrieve reminder")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(reminder)
+	case http.MethodPut:
+		var req models.Reminder
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+			return
+		}
+		reminder, err := models.UpdateReminder(id, req)
+		if err != nil {
+			writeReminderError(w, err, "Reminder not found", "update reminder")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(reminder)
+	case http.MethodDelete:
+		if err := models.DeleteReminder(id); err != nil {
+			writeReminderError(w, err, "Reminder not found", "delete reminder")
+			return
+		}
+		response := map[string]string{"message": "Reminder deleted successfully"}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	default:
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+	}
+}
+
+// NotificationsHandler serves the in-app inbox: GET /notifications
+// (?unread=true&limit=), GET /notifications/unread-count, POST
+// /notifications/read-all, POST /notifications/{id}/read or /unread, and
+// DELETE /notifications/{id}.
+func NotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/notifications"), "/")
+	switch path {
+	case "":
+		if r.Method != http.MethodGet {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		notifications, err := models.ListNotifications(r.URL.Query().Get("unread") == "true", limit)
+		if err != nil {
+			writeReminderError(w, err, "Notification not found", "retrieve notifications")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(notifications)
+		return
+	case "unread-count":
+		if r.Method != http.MethodGet {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+		n, err := models.CountUnreadNotifications()
+		if err != nil {
+			writeReminderError(w, err, "Notification not found", "count notifications")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int{"unread": n})
+		return
+	case "read-all":
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+		n, err := models.MarkAllNotificationsRead()
+		if err != nil {
+			writeReminderError(w, err, "Notification not found", "update notifications")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int64{"marked_read": n})
+		return
+	}
+
+	idPart, action, _ := strings.Cut(path, "/")
+	id, err := strconv.Atoi(idPart)
+	if err != nil {
+		http.Error(w, "Invalid notification ID", http.StatusBadRequest)
+		return
+	}
+	switch {
+	case action == "" && r.Method == http.MethodDelete:
+		if err := models.DeleteNotification(id); err != nil {
+			writeReminderError(w, err, "Notification not found", "delete notification")
+			return
+		}
+		response := map[string]string{"message": "Notification deleted successfully"}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	case (action == "read" || action == "unread") && r.Method == http.MethodPost:
+		n, err := models.SetNotificationRead(id, action == "read")
+		if err != nil {
+			writeReminderError(w, err, "Notification not found", "update notification")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(n)
+	case action == "" || action == "read" || action == "unread":
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+	default:
+		http.NotFound(w, r)
+	}
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"mindful/backend-go/models"
+	"net/http"
+)
+
+func RetentionPoliciesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req models.RetentionPolicy
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+			return
+		}
+		err := models.SetRetentionPolicy(req)
+		if errors.Is(err, models.ErrInvalidRetentionPolicy) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to store retention policy", http.StatusInternalServerError)
+			return
+		}
+	case http.MethodDelete:
+		err := models.ClearRetentionPolicy(r.URL.Query().Get("resource"))
+		if errors.Is(err, models.ErrNotFound) {
+			http.Error(w, "No user retention policy for resource", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to clear retention policy", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	policies, err := models.GetRetentionPolicies()
+	if err != nil {
+		http.Error(w, "Failed to retrieve retention policies", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(policies)
+}
+
+// RetentionPreviewHandler is a dry run of the retention sweeper: it lists the
+// records the next sweep would delete or redact without touching them.
+func RetentionPreviewHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	candidates, err := models.ApplyRetention(true)
+	if err != nil {
+		log.Printf("Error previewing retention: %v", err)
+		http.Error(w, "Failed to preview retention", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(candidates)
+}
+
+func RetentionAuditHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	entries, err := models.GetRetentionAudit(500)
+	if err != nil {
+		http.Error(w, "Failed to retrieve retention audit", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
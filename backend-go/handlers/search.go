@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"mindful/backend-go/models"
+	"mindful/backend-go/utils"
+	"net/http"
+	"strconv"
+)
+
+// queryInt returns a positive integer query parameter, or def when it is
+// missing or invalid, capped at max when max is non-zero.
+func queryInt(r *http.Request, name string, def, max int) int {
+	n, err := strconv.Atoi(r.URL.Query().Get(name))
+	if err != nil || n <= 0 {
+		return def
+	}
+	if max > 0 && n > max {
+		return max
+	}
+	return n
+}
+
+func SearchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	kind := q.Get("type")
+	if kind != "" && kind != models.SearchKindJournal && kind != models.SearchKindTranscript {
+		http.Error(w, "Invalid search type", http.StatusBadRequest)
+		return
+	}
+
+	results, err := models.Search(models.SearchQuery{
+		Text:  q.Get("q"),
+		Kind:  kind,
+		From:  q.Get("from"),
+		To:    q.Get("to"),
+		Page:  queryInt(r, "page", 1, 0),
+		Limit: queryInt(r, "limit", 20, 100),
+	})
+	if errors.Is(err, models.ErrSearchUnavailable) {
+		http.Error(w, "Search is not available", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		log.Printf("Error searching: %v", err)
+		http.Error(w, "Failed to search", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// SemanticSearchHandler ranks journals and sessions by embedding similarity,
+// so paraphrases match even when no keywords are shared.
+func SemanticSearchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	if q.Get("q") == "" {
+		http.Error(w, "Missing query", http.StatusBadRequest)
+		return
+	}
+	kind := q.Get("type")
+	if kind != "" && kind != models.SearchKindJournal && kind != models.SearchKindTranscript {
+		http.Error(w, "Invalid search type", http.StatusBadRequest)
+		return
+	}
+
+	results, err := utils.SemanticSearch(r.Context(), utils.DefaultEmbedder(), q.Get("q"), kind, queryInt(r, "limit", 10, 50))
+	if err != nil {
+		log.Printf("Error running semantic search: %v", err)
+		http.Error(w, "Failed to search", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
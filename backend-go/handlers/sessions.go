@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mindful/backend-go/models"
+	"mindful/backend-go/utils"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func writeAudioError(w http.ResponseWriter, err error, action string) {
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		http.Error(w, "Audio chunk is too large", http.StatusRequestEntityTooLarge)
+	case errors.Is(err, models.ErrInvalidAudio):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, models.ErrAudioComplete), errors.Is(err, models.ErrAudioIncomplete):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, models.ErrNotFound):
+		http.Error(w, "Audio not found", http.StatusNotFound)
+	default:
+		log.Printf("Error trying to %s: %v", action, err)
+		http.Error(w, "Failed to "+action, http.StatusInternalServerError)
+	}
+}
+
+// SessionsHandler serves /sessions/{id}/audio, /sessions/{id}/audio/info,
+// /sessions/{id}/transcribe, /sessions/{id}/emotions and
+// /sessions/{id}/summary.
+func SessionsHandler(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/sessions"), "/"), "/")
+	if len(parts) < 2 || parts[0] == "" {
+		http.NotFound(w, r)
+		return
+	}
+	sessionID := parts[0]
+
+	switch {
+	case len(parts) == 2 && parts[1] == "audio":
+		sessionAudioHandler(w, r, sessionID)
+	case len(parts) == 3 && parts[1] == "audio" && parts[2] == "info":
+		if r.Method != http.MethodGet {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+		audio, err := models.GetSessionAudio(sessionID)
+		if err != nil {
+			writeAudioError(w, err, "retrieve audio")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(audio)
+	case len(parts) == 2 && parts[1] == "transcribe":
+		transcribeSessionHandler(w, r, sessionID)
+	case len(parts) == 2 && parts[1] == "emotions":
+		sessionEmotionsHandler(w, r, sessionID)
+	case len(parts) == 2 && parts[1] == "summary":
+		sessionSummaryHandler(w, r, sessionID)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func sessionAudioHandler(w http.ResponseWriter, r *http.Request, sessionID string) {
+	store := utils.DefaultBlobStore()
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		audio, content, err := utils.OpenSessionAudio(r.Context(), store, sessionID)
+		if err != nil {
+			writeAudioError(w, err, "retrieve audio")
+			return
+		}
+		defer content.Close()
+		modified, _ := time.Parse(models.TimestampLayout, audio.CompletedAt)
+		w.Header().Set("Content-Type", audio.ContentType)
+		w.Header().Set("ETag", `"`+audio.SHA256+`"`)
+		w.Header().Set("Cache-Control", "private, no-cache")
+		http.ServeContent(w, r, "", modified, content)
+	case http.MethodPost:
+		uploadAudioChunk(w, r, store, sessionID)
+	case http.MethodDelete:
+		if err := utils.DeleteAudio(r.Context(), store, sessionID); err != nil {
+			writeAudioError(w, err, "delete audio")
+			return
+		}
+		response := map[string]string{"message": "Audio deleted successfully"}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	default:
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+	}
+}
+
+// uploadAudioChunk stores the request body as one chunk of the recording
+// (POST /sessions/{id}/audio?chunk=&final=). chunk is the zero-based index
+// and defaults to the next one; X-Chunk-SHA256 is checked against the body.
+// final=true completes the upload after storing the chunk, or on its own
+// with an empty body, checking X-Audio-SHA256 against the whole recording.
+func uploadAudioChunk(w http.ResponseWriter, r *http.Request, store utils.BlobStore, sessionID string) {
+	q := r.URL.Query()
+	index := -1
+	if v := q.Get("chunk"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "chunk must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		index = n
+	}
+	final := q.Get("final") == "true"
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, utils.MaxAudioChunkSize))
+	if err != nil {
+		writeAudioError(w, err, "read audio chunk")
+		return
+	}
+
+	var audio models.SessionAudio
+	if len(data) > 0 || !final {
+		audio, err = utils.UploadAudioChunk(r.Context(), store, sessionID, utils.AudioChunkUpload{
+			Index:       index,
+			Data:        data,
+			ContentType: r.Header.Get("Content-Type"),
+			SHA256:      r.Header.Get("X-Chunk-SHA256"),
+		})
+		if err != nil {
+			writeAudioError(w, err, "store audio chunk")
+			return
+		}
+	}
+	if final {
+		audio, err = utils.CompleteAudioUpload(r.Context(), store, sessionID, r.Header.Get("X-Audio-SHA256"))
+		if err != nil {
+			writeAudioError(w, err, "complete audio upload")
+			return
+		}
+		utils.QueueAutoTranscription(sessionID)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(audio)
+}
+
+// TranscribeRequest is the optional body of POST /sessions/{id}/transcribe.
+type TranscribeRequest struct {
+	Diarize     bool   `json:"diarize"`
+	Language    string `json:"language"`
+	UserSpeaker string `json:"user_speaker"`
+	Replace     bool   `json:"replace"`
+}
+
+// transcribeSessionHandler queues a transcription of the session's
+// recording (POST) or lists the session's transcription jobs (GET).
+func transcribeSessionHandler(w http.ResponseWriter, r *http.Request, sessionID string) {
+	switch r.Method {
+	case http.MethodGet:
+		jobs, err := models.ListTranscriptionJobs(sessionID)
+		if err != nil {
+			log.Printf("Error listing transcription jobs: %v", err)
+			http.Error(w, "Failed to retrieve transcription jobs", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(jobs)
+	case http.MethodPost:
+		var req TranscribeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+			return
+		}
+		language := strings.ToLower(strings.TrimSpace(req.Language))
+		if language != "" && language != "auto" && (len(language) != 2 || strings.Trim(language, "abcdefghijklmnopqrstuvwxyz") != "") {
+			http.Error(w, "language must be a two-letter ISO 639-1 code", http.StatusBadRequest)
+			return
+		}
+		if language == "auto" {
+			language = ""
+		}
+
+		job, err := utils.QueueTranscription(models.TranscriptionJob{
+			SessionID:   sessionID,
+			Diarize:     req.Diarize,
+			Language:    language,
+			UserSpeaker: strings.TrimSpace(req.UserSpeaker),
+			Replace:     req.Replace,
+		})
+		if errors.Is(err, utils.ErrTranscriptExists) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			writeAudioError(w, err, "queue transcription")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(job)
+	default:
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+	}
+}
+
+// sessionEmotionsHandler returns the vocal emotion of the user across a
+// session, from the prosody scores of their turns.
+func sessionEmotionsHandler(w http.ResponseWriter, r *http.Request, sessionID string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	emotions, err := models.GetSessionEmotions(sessionID)
+	if errors.Is(err, models.ErrNotFound) {
+		http.Error(w, "Transcript not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error aggregating emotions for session %s: %v", sessionID, err)
+		http.Error(w, "Failed to retrieve session emotions", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(emotions)
+}
+
+// sessionSummaryHandler returns a session's stored summary (GET) or
+// generates it again from the session's transcripts (POST).
+func sessionSummaryHandler(w http.ResponseWriter, r *http.Request, sessionID string) {
+	var summary models.SessionSummary
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+		summary, err = models.GetSessionSummary(sessionID)
+		if errors.Is(err, models.ErrNotFound) {
+			http.Error(w, "Session summary not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to retrieve session summary", http.StatusInternalServerError)
+			return
+		}
+	case http.MethodPost:
+		summary, err = utils.SummarizeSession(r.Context(), sessionID)
+		if errors.Is(err, models.ErrNotFound) {
+			http.Error(w, "Transcript not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, utils.ErrTranscriptRedacted) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			log.Printf("Error summarizing session %s: %v", sessionID, err)
+			http.Error(w, "Failed to summarize session", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summary)
+}
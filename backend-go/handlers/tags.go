@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"encoding/json"
+	"mindful/backend-go/models"
+	"net/http"
+)
+
+// GetTagsHandler lists every tag in use with how many journal entries use it.
+func GetTagsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	counts, err := models.GetTagCounts()
+	if err != nil {
+		http.Error(w, "Failed to retrieve tags", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(counts)
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"mindful/backend-go/models"
+	"mindful/backend-go/utils"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type DistortionRequest struct {
+	Situation        string `json:"situation"`
+	AutomaticThought string `json:"automatic_thought"`
+}
+
+// ThoughtRecordsHandler serves /thought-records and everything below it:
+// the collection, single records by ID, the distortion catalog and
+// AI distortion detection.
+func ThoughtRecordsHandler(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/thought-records"), "/")
+	switch path {
+	case "":
+		switch r.Method {
+		case http.MethodGet:
+			ListThoughtRecordsHandler(w, r)
+		case http.MethodPost:
+			CreateThoughtRecordHandler(w, r)
+		default:
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		}
+		return
+	case "distortions":
+		if r.Method != http.MethodGet {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.CognitiveDistortions)
+		return
+	case "detect-distortions":
+		DetectDistortionsHandler(w, r)
+		return
+	}
+
+	id, err := strconv.Atoi(path)
+	if err != nil {
+		http.Error(w, "Invalid thought record ID", http.StatusBadRequest)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		record, err := models.GetThoughtRecord(id)
+		if errors.Is(err, models.ErrNotFound) {
+			http.Error(w, "Thought record not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to retrieve thought record", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(record)
+	case http.MethodPut:
+		UpdateThoughtRecordHandler(w, r, id)
+	case http.MethodDelete:
+		err := models.DeleteThoughtRecord(id)
+		if errors.Is(err, models.ErrNotFound) {
+			http.Error(w, "Thought record not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to delete thought record", http.StatusInternalServerError)
+			return
+		}
+		response := map[string]string{"message": "Thought record deleted successfully"}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	default:
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+	}
+}
+
+// ListThoughtRecordsHandler lists thought records, newest first. Pass
+// ?completed=true for completed records only.
+func ListThoughtRecordsHandler(w http.ResponseWriter, r *http.Request) {
+	records, err := models.ListThoughtRecords(r.URL.Query().Get("completed") == "true", 0)
+	if err != nil {
+		http.Error(w, "Failed to retrieve thought records", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(records)
+}
+
+func CreateThoughtRecordHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.ThoughtRecord
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	record, err := models.CreateThoughtRecord(req)
+	if errors.Is(err, models.ErrInvalidThoughtRecord) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Error storing thought record: %v", err)
+		http.Error(w, "Failed to store thought record", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(record)
+}
+
+func UpdateThoughtRecordHandler(w http.ResponseWriter, r *http.Request, id int) {
+	var req models.ThoughtRecord
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	record, err := models.UpdateThoughtRecord(id, req)
+	if errors.Is(err, models.ErrInvalidThoughtRecord) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, models.ErrNotFound) {
+		http.Error(w, "Thought record not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating thought record %d: %v", id, err)
+		http.Error(w, "Failed to update thought record", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(record)
+}
+
+// DetectDistortionsHandler suggests cognitive distortions for a thought,
+// typically while the user is filling in a new record.
+func DetectDistortionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req DistortionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.AutomaticThought) == "" {
+		http.Error(w, "automatic_thought is required", http.StatusBadRequest)
+		return
+	}
+
+	matches, err := utils.DetectDistortions(r.Context(), req.Situation, req.AutomaticThought)
+	if err != nil {
+		log.Printf("Error detecting distortions: %v", err)
+		http.Error(w, "Failed to detect distortions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(matches)
+}
@@ -2,11 +2,15 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"mindful/backend-go/database"
 	"mindful/backend-go/models"
+	"mindful/backend-go/utils"
 	"net/http"
 	"strings"
+	"time"
 )
 
 type TranscriptRequest struct {
@@ -27,12 +31,27 @@ func AddTranscriptHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	query := `INSERT INTO transcripts (session_id, transcript) VALUES (?, ?)`
-	_, err := database.DB.Exec(query, req.SessionID, req.Transcript)
+	result, err := database.DB.Exec(query, req.SessionID, req.Transcript)
 	if err != nil {
 		http.Error(w, "Failed to add transcript", http.StatusInternalServerError)
 		return
 	}
 
+	if id, err := result.LastInsertId(); err == nil {
+		req.ID = int(id)
+		if err := models.IndexTranscript(req); err != nil {
+			log.Printf("Error indexing transcript %d: %v", req.ID, err)
+		}
+		utils.AnalyzeTranscriptDistortionsAsync(req)
+		utils.SummarizeSessionAsync(req.SessionID)
+		utils.EmitEvent(models.EventSessionCompleted, map[string]interface{}{
+			"transcript_id": req.ID,
+			"session_id":    req.SessionID,
+			"turns":         len(models.SplitTranscriptTurns(req.Transcript)),
+		})
+		utils.FlagTranscriptSafety(req)
+	}
+
 	response := map[string]string{"message": "Transcript added successfully"}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
@@ -41,22 +60,30 @@ func AddTranscriptHandler(w http.ResponseWriter, r *http.Request) {
 func GetTranscriptsHandler(w http.ResponseWriter, r *http.Request) {
 	log.Printf("GetTranscriptsHandler received request for path: %s", r.URL.Path)
 
-	if r.Method != http.MethodGet {
-		log.Printf("Invalid method for path %s: %s", r.URL.Path, r.Method)
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
-		return
-	}
-
 	// Check if this is a request for a specific transcript
 	path := strings.TrimPrefix(r.URL.Path, "/transcripts/")
 	log.Printf("Trimmed path is: '%s'", path)
 
 	if path != "" && path != "transcripts" {
+		if sessionID, ok := strings.CutSuffix(path, "/distortions"); ok {
+			GetTranscriptDistortionsHandler(w, r, sessionID)
+			return
+		}
+		if r.Method == http.MethodDelete {
+			DeleteTranscriptHandler(w, r, path)
+			return
+		}
 		log.Printf("Dispatching to GetTranscriptBySessionIDHandler with sessionID: %s", path)
 		GetTranscriptBySessionIDHandler(w, r, path)
 		return
 	}
 
+	if r.Method != http.MethodGet {
+		log.Printf("Invalid method for path %s: %s", r.URL.Path, r.Method)
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
 	log.Println("Proceeding to fetch all transcripts.")
 	rows, err := database.DB.Query(`SELECT id, session_id, transcript, created_at FROM transcripts ORDER BY created_at DESC`)
 	if err != nil {
@@ -85,11 +112,17 @@ func GetTranscriptsHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(transcripts)
 }
 
+// GetTranscriptBySessionIDHandler returns a transcript as JSON, Markdown,
+// plain text, WebVTT, SRT or a printable HTML page.
 func GetTranscriptBySessionIDHandler(w http.ResponseWriter, r *http.Request, sessionID string) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
 		return
 	}
+	format, opts, ok := transcriptExportOptions(w, r)
+	if !ok {
+		return
+	}
 
 	query := `SELECT id, session_id, transcript, created_at FROM transcripts WHERE session_id = ?`
 	row := database.DB.QueryRow(query, sessionID)
@@ -99,7 +132,81 @@ func GetTranscriptBySessionIDHandler(w http.ResponseWriter, r *http.Request, ses
 		http.Error(w, "Transcript not found", http.StatusNotFound)
 		return
 	}
+	turns, err := models.GetTranscriptTurns(transcript.ID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve transcript", http.StatusInternalServerError)
+		return
+	}
+	transcript.Turns = turns
 
+	data, err := utils.ExportTranscript(transcript, format, opts)
+	if err != nil {
+		log.Printf("Error exporting transcript %q as %s: %v", sessionID, format, err)
+		http.Error(w, "Failed to export transcript", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", utils.TranscriptContentType(format))
+	if format != utils.TranscriptFormatJSON {
+		disposition := "inline"
+		if r.URL.Query().Get("download") == "true" {
+			disposition = "attachment"
+		}
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`%s; filename="%s"`, disposition, utils.TranscriptFilename(sessionID, format)))
+	}
+	w.Write(data)
+}
+
+// transcriptExportOptions reads the format of a transcript export from
+// ?format= or, failing that, the Accept header, along with the time zone
+// (tz) and redact options.
+func transcriptExportOptions(w http.ResponseWriter, r *http.Request) (string, utils.TranscriptExportOptions, bool) {
+	q := r.URL.Query()
+	opts := utils.TranscriptExportOptions{Redact: q.Get("redact") == "true"}
+	w.Header().Add("Vary", "Accept")
+
+	format := utils.TranscriptFormatJSON
+	if name := q.Get("format"); name != "" {
+		f, err := utils.TranscriptExportFormat(name)
+		if err != nil {
+			http.Error(w, "format must be json, markdown, text, vtt, srt or html", http.StatusBadRequest)
+			return "", opts, false
+		}
+		format = f
+	} else if f, ok := utils.NegotiateTranscriptFormat(r.Header.Get("Accept")); ok {
+		format = f
+	} else {
+		http.Error(w, "Acceptable formats are application/json, text/markdown, text/plain, text/vtt, application/x-subrip and text/html", http.StatusNotAcceptable)
+		return "", opts, false
+	}
+
+	if tz := q.Get("tz"); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			http.Error(w, "Invalid time zone", http.StatusBadRequest)
+			return "", opts, false
+		}
+		opts.Location = loc
+	}
+	return format, opts, true
+}
+
+func DeleteTranscriptHandler(w http.ResponseWriter, r *http.Request, sessionID string) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := utils.DeleteTranscript(r.Context(), utils.DefaultBlobStore(), sessionID)
+	if errors.Is(err, models.ErrNotFound) {
+		http.Error(w, "Transcript not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to delete transcript", http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]string{"message": "Transcript deleted successfully"}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(transcript)
-}
\ No newline at end of file
+	json.NewEncoder(w).Encode(response)
+}
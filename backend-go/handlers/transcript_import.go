@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"mindful/backend-go/utils"
+	"net/http"
+	"strings"
+)
+
+// maxTranscriptImport caps the combined size of an import request.
+const maxTranscriptImport = 20 << 20
+
+// TranscriptImportRequest is the JSON form of an import: file contents are
+// sent as text.
+type TranscriptImportRequest struct {
+	Files []struct {
+		Filename  string `json:"filename"`
+		Format    string `json:"format"`
+		SessionID string `json:"session_id"`
+		Content   string `json:"content"`
+	} `json:"files"`
+	UserSpeaker string `json:"user_speaker"`
+}
+
+// readTranscriptUploads collects the files of an import request: multipart
+// "file" or "files" parts, a JSON body, or a raw body described by the
+// format, session_id and filename query parameters.
+func readTranscriptUploads(w http.ResponseWriter, r *http.Request) ([]utils.TranscriptUpload, string, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxTranscriptImport)
+	query := r.URL.Query()
+	contentType := r.Header.Get("Content-Type")
+
+	switch {
+	case strings.HasPrefix(contentType, "multipart/form-data"):
+		if err := r.ParseMultipartForm(maxTranscriptImport); err != nil {
+			return nil, "", err
+		}
+		var uploads []utils.TranscriptUpload
+		for _, field := range []string{"file", "files"} {
+			for _, header := range r.MultipartForm.File[field] {
+				file, err := header.Open()
+				if err != nil {
+					return nil, "", err
+				}
+				data, err := io.ReadAll(file)
+				file.Close()
+				if err != nil {
+					return nil, "", err
+				}
+				uploads = append(uploads, utils.TranscriptUpload{Filename: header.Filename, Format: r.FormValue("format"), Content: data})
+			}
+		}
+		if len(uploads) == 1 {
+			uploads[0].SessionID = r.FormValue("session_id")
+		}
+		return uploads, r.FormValue("user_speaker"), nil
+	case strings.HasPrefix(contentType, "application/json"):
+		var req TranscriptImportRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return nil, "", err
+		}
+		uploads := make([]utils.TranscriptUpload, 0, len(req.Files))
+		for _, f := range req.Files {
+			uploads = append(uploads, utils.TranscriptUpload{Filename: f.Filename, Format: f.Format, SessionID: f.SessionID, Content: []byte(f.Content)})
+		}
+		return uploads, req.UserSpeaker, nil
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil || len(data) == 0 {
+		return nil, "", err
+	}
+	upload := utils.TranscriptUpload{Filename: query.Get("filename"), Format: query.Get("format"), SessionID: query.Get("session_id"), Content: data}
+	return []utils.TranscriptUpload{upload}, query.Get("user_speaker"), nil
+}
+
+// ImportTranscriptsHandler imports WebVTT, SRT, plain "Speaker: text" and
+// Hume EVI chat history files (POST /transcripts/import) and reports what
+// was imported, skipped and failed per file.
+func ImportTranscriptsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	uploads, userSpeaker, err := readTranscriptUploads(w, r)
+	if err != nil {
+		http.Error(w, "Failed to read transcript upload", http.StatusBadRequest)
+		return
+	}
+	if len(uploads) == 0 {
+		http.Error(w, "No transcript files provided", http.StatusBadRequest)
+		return
+	}
+	for _, u := range uploads {
+		switch strings.ToLower(u.Format) {
+		case "", utils.TranscriptFormatVTT, utils.TranscriptFormatSRT, utils.TranscriptFormatPlain, utils.TranscriptFormatHume:
+		default:
+			http.Error(w, "format must be vtt, srt, plain or hume", http.StatusBadRequest)
+			return
+		}
+	}
+
+	report := utils.ImportTranscripts(uploads, userSpeaker)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
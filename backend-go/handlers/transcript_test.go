@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"mindful/backend-go/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGetTranscriptNegotiatesFormat(t *testing.T) {
+	openTestDB(t)
+	turns := []models.TranscriptTurn{{Speaker: "user", Text: "I slept badly."}}
+	if _, err := models.ImportTranscript("s1", "test", turns); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path, accept string
+		status       int
+		contentType  string
+	}{
+		{"/transcripts/s1", "", http.StatusOK, "application/json"},
+		{"/transcripts/s1", "*/*", http.StatusOK, "application/json"},
+		{"/transcripts/s1", "text/markdown;q=0.5, text/vtt", http.StatusOK, "text/vtt; charset=utf-8"},
+		{"/transcripts/s1", "text/vtt;q=0.1, application/x-subrip;q=0.9", http.StatusOK, "application/x-subrip; charset=utf-8"},
+		{"/transcripts/s1", "image/png", http.StatusNotAcceptable, ""},
+		{"/transcripts/s1", "text/html;q=0", http.StatusNotAcceptable, ""},
+		// ?format= wins over the Accept header.
+		{"/transcripts/s1?format=md", "image/png", http.StatusOK, "text/markdown; charset=utf-8"},
+		{"/transcripts/s1?format=pdf", "", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.accept != "" {
+			r.Header.Set("Accept", tt.accept)
+		}
+		w := httptest.NewRecorder()
+		GetTranscriptBySessionIDHandler(w, r, "s1")
+		if w.Code != tt.status {
+			t.Errorf("%s with Accept %q: status %d, want %d: %s", tt.path, tt.accept, w.Code, tt.status, w.Body)
+			continue
+		}
+		if tt.contentType != "" && w.Header().Get("Content-Type") != tt.contentType {
+			t.Errorf("%s with Accept %q: Content-Type %q, want %q", tt.path, tt.accept, w.Header().Get("Content-Type"), tt.contentType)
+		}
+		if w.Header().Get("Vary") != "Accept" {
+			t.Errorf("%s with Accept %q: Vary %q, want Accept", tt.path, tt.accept, w.Header().Get("Vary"))
+		}
+		if w.Code == http.StatusNotAcceptable && !strings.Contains(w.Body.String(), "text/vtt") {
+			t.Errorf("406 body doesn't list the acceptable formats: %s", w.Body)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"mindful/backend-go/utils"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// voiceUpgrader accepts WebSocket connections from the frontend's origins.
+var voiceUpgrader = websocket.Upgrader{
+	ReadBufferSize:  16 << 10,
+	WriteBufferSize: 16 << 10,
+	CheckOrigin:     voiceOriginAllowed,
+}
+
+// voiceOriginAllowed accepts requests without an Origin header, same-origin
+// requests and the origins in VOICE_ALLOWED_ORIGINS (comma-separated,
+// default http://localhost:3000). Browsers don't apply CORS to WebSockets,
+// so this is what keeps other sites from opening chats.
+func voiceOriginAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	allowed := os.Getenv("VOICE_ALLOWED_ORIGINS")
+	if allowed == "" {
+		allowed = "http://localhost:3000"
+	}
+	for _, o := range strings.Split(allowed, ",") {
+		if strings.EqualFold(strings.TrimRight(strings.TrimSpace(o), "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// activeVoiceSessions keeps a session to one relayed chat at a time, so two
+// chats don't race to store its transcript.
+var activeVoiceSessions = struct {
+	sync.Mutex
+	ids map[string]bool
+}{ids: map[string]bool{}}
+
+func writeVoiceError(w http.ResponseWriter, err error, action string) {
+	if errors.Is(err, utils.ErrVoiceNotConfigured) {
+		http.Error(w, "Voice is not configured", http.StatusServiceUnavailable)
+		return
+	}
+	log.Printf("Error trying to %s: %v", action, err)
+	http.Error(w, "Failed to "+action, http.StatusBadGateway)
+}
+
+// VoiceHandler serves /voice/token and /voice/sessions/{id}/chat.
+func VoiceHandler(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/voice"), "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "token":
+		voiceTokenHandler(w, r)
+	case len(parts) == 3 && parts[0] == "sessions" && parts[1] != "" && parts[2] == "chat":
+		voiceChatHandler(w, r, parts[1])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// voiceTokenHandler mints a short-lived access token for clients that
+// connect to EVI themselves. Their chats are not captured; use the relay
+// for that.
+func voiceTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	token, err := utils.DefaultHumeClient().AccessToken(r.Context())
+	if err != nil {
+		writeVoiceError(w, err, "get voice access token")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(token)
+}
+
+// voiceChatHandler relays a WebSocket between the browser and an EVI chat
+// (GET /voice/sessions/{id}/chat?config_id=&resumed_chat_group_id=). The
+// browser speaks the EVI message protocol as if connected directly; the
+// chat's user and assistant messages are stored as the session transcript
+// when it ends.
+func voiceChatHandler(w http.ResponseWriter, r *http.Request, sessionID string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	if !websocket.IsWebSocketUpgrade(r) {
+		http.Error(w, "Expected a WebSocket upgrade", http.StatusBadRequest)
+		return
+	}
+	if !voiceOriginAllowed(r) {
+		http.Error(w, "Origin not allowed", http.StatusForbidden)
+		return
+	}
+
+	activeVoiceSessions.Lock()
+	if activeVoiceSessions.ids[sessionID] {
+		activeVoiceSessions.Unlock()
+		http.Error(w, "A voice chat is already active for this session", http.StatusConflict)
+		return
+	}
+	activeVoiceSessions.ids[sessionID] = true
+	activeVoiceSessions.Unlock()
+	defer func() {
+		activeVoiceSessions.Lock()
+		delete(activeVoiceSessions.ids, sessionID)
+		activeVoiceSessions.Unlock()
+	}()
+
+	// The chat is opened first, so a failure is still an HTTP error the
+	// browser can see.
+	q := r.URL.Query()
+	upstream, err := utils.DefaultHumeClient().DialChat(r.Context(), utils.ChatOptions{
+		ConfigID:           q.Get("config_id"),
+		ResumedChatGroupID: q.Get("resumed_chat_group_id"),
+	})
+	if err != nil {
+		writeVoiceError(w, err, "connect to voice service")
+		return
+	}
+	browser, err := voiceUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already replied.
+		upstream.Close()
+		return
+	}
+
+	chat := utils.RelayVoiceChat(browser, upstream)
+	log.Printf("Voice chat %s for session %s ended with %d turns", chat.ChatID, sessionID, len(chat.Turns))
+	if _, err := utils.SaveVoiceChat(sessionID, chat); err != nil {
+		log.Printf("Error saving voice chat for session %s: %v", sessionID, err)
+	}
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"mindful/backend-go/models"
+	"mindful/backend-go/utils"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+func writeWebhookError(w http.ResponseWriter, err error, notFound, action string) {
+	switch {
+	case errors.Is(err, models.ErrInvalidWebhook):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, models.ErrNotFound):
+		http.Error(w, notFound, http.StatusNotFound)
+	default:
+		log.Printf("Error trying to %s: %v", action, err)
+		http.Error(w, "Failed to "+action, http.StatusInternalServerError)
+	}
+}
+
+// WebhooksHandler serves /webhooks, /webhooks/{id} and its deliveries,
+// ping and secret rotation, and /webhooks/deliveries/{id} with redelivery.
+func WebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/webhooks"), "/")
+	if path == "" {
+		switch r.Method {
+		case http.MethodGet:
+			subs, err := models.ListWebhooks()
+			if err != nil {
+				writeWebhookError(w, err, "Webhook not found", "retrieve webhooks")
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(subs)
+		case http.MethodPost:
+			var req models.WebhookSubscription
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+				return
+			}
+			sub, err := models.CreateWebhook(req)
+			if err != nil {
+				writeWebhookError(w, err, "Webhook not found", "create webhook")
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(sub)
+		default:
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	parts := strings.Split(path, "/")
+	if parts[0] == "deliveries" {
+		webhookDeliveryHandler(w, r, parts[1:])
+		return
+	}
+	id, err := strconv.Atoi(parts[0])
+	if err != nil {
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case len(parts) == 1:
+		webhookHandler(w, r, id)
+	case len(parts) == 2 && parts[1] == "deliveries":
+		if r.Method != http.MethodGet {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+		deliveries, err := models.ListWebhookDeliveries(id, r.URL.Query().Get("status"), queryInt(r, "limit", 50, 200))
+		if err != nil {
+			writeWebhookError(w, err, "Webhook not found", "retrieve webhook deliveries")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(deliveries)
+	case len(parts) == 2 && parts[1] == "ping":
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+		delivery, err := utils.PingWebhook(id)
+		if err != nil {
+			writeWebhookError(w, err, "Webhook not found", "ping webhook")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(delivery)
+	case len(parts) == 2 && parts[1] == "rotate-secret":
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+		sub, err := models.RotateWebhookSecret(id)
+		if err != nil {
+			writeWebhookError(w, err, "Webhook not found", "rotate webhook secret")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(sub)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func webhookHandler(w http.ResponseWriter, r *http.Request, id int) {
+	switch r.Method {
+	case http.MethodGet:
+		sub, err := models.GetWebhook(id)
+		if err != nil {
+			writeWebhookError(w, err, "Webhook not found", "retrieve webhook")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(sub)
+	case http.MethodPut:
+		var req models.WebhookSubscription
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+			return
+		}
+		sub, err := models.UpdateWebhook(id, req)
+		if err != nil {
+			writeWebhookError(w, err, "Webhook not found", "update webhook")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(sub)
+	case http.MethodDelete:
+		if err := models.DeleteWebhook(id); err != nil {
+			writeWebhookError(w, err, "Webhook not found", "delete webhook")
+			return
+		}
+		response := map[string]string{"message": "Webhook deleted successfully"}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	default:
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+	}
+}
+
+// webhookDeliveryHandler serves GET /webhooks/deliveries/{id} and POST
+// /webhooks/deliveries/{id}/redeliver.
+func webhookDeliveryHandler(w http.ResponseWriter, r *http.Request, parts []string) {
+	if len(parts) == 0 || len(parts) > 2 || (len(parts) == 2 && parts[1] != "redeliver") {
+		http.NotFound(w, r)
+		return
+	}
+	id, err := strconv.Atoi(parts[0])
+	if err != nil {
+		http.Error(w, "Invalid delivery ID", http.StatusBadRequest)
+		return
+	}
+
+	if len(parts) == 2 {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+		delivery, err := utils.Redeliver(id)
+		if err != nil {
+			writeWebhookError(w, err, "Delivery not found", "redeliver webhook")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(delivery)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	delivery, err := models.GetWebhookDelivery(id)
+	if err != nil {
+		writeWebhookError(w, err, "Delivery not found", "retrieve webhook delivery")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(delivery)
+}
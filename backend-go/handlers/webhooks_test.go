@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mindful/backend-go/models"
+	"mindful/backend-go/utils"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRedeliverWebhook(t *testing.T) {
+	openTestDB(t)
+	received := make(chan http.Header, 2)
+	var secret string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := utils.VerifyWebhookSignature(secret, r.Header.Get(utils.WebhookSignatureHeader), body, time.Now(), time.Minute); err != nil {
+			t.Errorf("signature does not verify: %v", err)
+		}
+		received <- r.Header
+	}))
+	defer srv.Close()
+
+	w := serve(WebhooksHandler, http.MethodPost, "/webhooks", fmt.Sprintf(`{"url": %q, "event_types": ["*"]}`, srv.URL))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", w.Code, w.Body)
+	}
+	var sub models.WebhookSubscription
+	json.NewDecoder(w.Body).Decode(&sub)
+	secret = sub.Secret
+
+	w = serve(WebhooksHandler, http.MethodPost, fmt.Sprintf("/webhooks/%d/ping", sub.ID), "")
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("ping: %d %s", w.Code, w.Body)
+	}
+	var original models.WebhookDelivery
+	json.NewDecoder(w.Body).Decode(&original)
+	first := receive(t, received)
+	waitForDelivery(t, original.ID)
+
+	w = serve(WebhooksHandler, http.MethodPost, fmt.Sprintf("/webhooks/deliveries/%d/redeliver", original.ID), "")
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("redeliver: %d %s", w.Code, w.Body)
+	}
+	var redelivery models.WebhookDelivery
+	json.NewDecoder(w.Body).Decode(&redelivery)
+	if redelivery.ID == original.ID || redelivery.RedeliveryOf == nil || *redelivery.RedeliveryOf != original.ID {
+		t.Errorf("redelivery = %+v, want a new delivery of %d", redelivery, original.ID)
+	}
+	second := receive(t, received)
+	if second.Get("X-Mindful-Event-ID") != first.Get("X-Mindful-Event-ID") {
+		t.Errorf("redelivered event %s, want %s", second.Get("X-Mindful-Event-ID"), first.Get("X-Mindful-Event-ID"))
+	}
+	if second.Get("X-Mindful-Delivery") != fmt.Sprint(redelivery.ID) {
+		t.Errorf("X-Mindful-Delivery = %s, want %d", second.Get("X-Mindful-Delivery"), redelivery.ID)
+	}
+	waitForDelivery(t, redelivery.ID)
+
+	w = serve(WebhooksHandler, http.MethodGet, fmt.Sprintf("/webhooks/%d/deliveries", sub.ID), "")
+	var log []models.WebhookDelivery
+	if err := json.NewDecoder(w.Body).Decode(&log); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("deliveries: %d %v", w.Code, err)
+	}
+	if len(log) != 2 || log[0].ID != redelivery.ID || log[1].ID != original.ID {
+		t.Fatalf("delivery log = %+v, want the redelivery then the original", log)
+	}
+	for _, d := range log {
+		if d.Status != models.DeliveryStatusSucceeded || d.Attempts != 1 || d.LastStatusCode != http.StatusOK {
+			t.Errorf("delivery %d = %+v, want succeeded", d.ID, d)
+		}
+	}
+
+	w = serve(WebhooksHandler, http.MethodPost, "/webhooks/deliveries/999/redeliver", "")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("redeliver unknown delivery: %d, want 404", w.Code)
+	}
+	w = serve(WebhooksHandler, http.MethodGet, fmt.Sprintf("/webhooks/deliveries/%d/redeliver", original.ID), "")
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET redeliver: %d, want 405", w.Code)
+	}
+}
+
+func receive(t *testing.T, received <-chan http.Header) http.Header {
+	t.Helper()
+	select {
+	case h := <-received:
+		return h
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook not delivered")
+		return nil
+	}
+}
+
+// waitForDelivery waits for the background attempt at a delivery to be
+// recorded.
+func waitForDelivery(t *testing.T, id int) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if d, err := models.GetWebhookDelivery(id); err == nil && d.Status != models.DeliveryStatusPending {
+			return
+		}
+	}
+	t.Fatalf("delivery %d still pending", id)
+}
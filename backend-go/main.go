@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
 	"log"
 	"mindful/backend-go/database"
 	"mindful/backend-go/handlers"
 	"mindful/backend-go/models"
+	"mindful/backend-go/utils"
 	"net/http"
     "os"
+	"time"
 	"github.com/joho/godotenv"
 	"github.com/rs/cors"
 )
@@ -20,6 +23,30 @@ func init() {
 
 func main() {
 
+	// "reindex" rebuilds the full-text search index, embeddings and
+	// distortion findings, then exits.
+	if len(os.Args) > 1 && os.Args[1] == "reindex" {
+		database.InitDB()
+		models.InitDatabase(database.DB)
+		n, err := models.RebuildSearchIndex()
+		if err != nil {
+			log.Printf("Failed to rebuild search index: %v", err)
+		} else {
+			log.Printf("Search index rebuilt with %d records", n)
+		}
+		n, err = utils.ReindexEmbeddings(context.Background(), utils.DefaultEmbedder())
+		if err != nil {
+			log.Fatalf("Failed to rebuild embeddings: %v", err)
+		}
+		log.Printf("Embeddings rebuilt for %d records", n)
+		n, err = utils.ReanalyzeDistortions(context.Background())
+		if err != nil {
+			log.Fatalf("Failed to reanalyze distortions: %v", err)
+		}
+		log.Printf("Distortions reanalyzed for %d records", n)
+		return
+	}
+
 	if os.Getenv("GEMINI_API_KEY") == "" {
 		log.Fatal("GEMINI_API_KEY is not set")
 	}
@@ -27,6 +54,30 @@ func main() {
 	database.InitDB()
 	models.InitDatabase(database.DB)
 
+	sweepInterval := time.Hour
+	if d, err := time.ParseDuration(os.Getenv("RETENTION_SWEEP_INTERVAL")); err == nil && d > 0 {
+		sweepInterval = d
+	}
+	utils.StartRetentionSweeper(sweepInterval)
+
+	reminderInterval := time.Minute
+	if d, err := time.ParseDuration(os.Getenv("REMINDER_TICK_INTERVAL")); err == nil && d > 0 {
+		reminderInterval = d
+	}
+	utils.StartReminderScheduler(reminderInterval, utils.NotificationSinksFromEnv())
+
+	webhookInterval := 15 * time.Second
+	if d, err := time.ParseDuration(os.Getenv("WEBHOOK_TICK_INTERVAL")); err == nil && d > 0 {
+		webhookInterval = d
+	}
+	utils.StartWebhookWorker(webhookInterval)
+
+	transcriptionInterval := 30 * time.Second
+	if d, err := time.ParseDuration(os.Getenv("TRANSCRIPTION_TICK_INTERVAL")); err == nil && d > 0 {
+		transcriptionInterval = d
+	}
+	utils.StartTranscriptionWorker(transcriptionInterval, utils.DefaultBlobStore(), utils.DefaultTranscriber())
+
     // Configure CORS
     c := cors.New(cors.Options{
         AllowedOrigins: []string{
@@ -40,13 +91,51 @@ func main() {
 
     mux := http.NewServeMux()
     mux.HandleFunc("/transcripts/add", handlers.AddTranscriptHandler)
+    mux.HandleFunc("/transcripts/import", handlers.ImportTranscriptsHandler)
     mux.HandleFunc("/transcripts/", handlers.GetTranscriptsHandler)
+    mux.HandleFunc("/sessions/", handlers.SessionsHandler)
+    mux.HandleFunc("/voice/", handlers.VoiceHandler)
     mux.HandleFunc("/journals/add", handlers.AddJournalEntryHandler)
     mux.HandleFunc("/journals/", handlers.GetJournalEntriesHandler)
+    mux.HandleFunc("/tags", handlers.GetTagsHandler)
+    mux.HandleFunc("/journal-prompts", handlers.JournalPromptsHandler)
+    mux.HandleFunc("/journal-prompts/", handlers.JournalPromptsHandler)
+    mux.HandleFunc("/thought-records", handlers.ThoughtRecordsHandler)
+    mux.HandleFunc("/thought-records/", handlers.ThoughtRecordsHandler)
+    mux.HandleFunc("/distortions/detect", handlers.DetectTextDistortionsHandler)
+    mux.HandleFunc("/habits", handlers.HabitsHandler)
+    mux.HandleFunc("/habits/", handlers.HabitsHandler)
+    mux.HandleFunc("/goals", handlers.GoalsHandler)
+    mux.HandleFunc("/goals/", handlers.GoalsHandler)
+    mux.HandleFunc("/reminders", handlers.RemindersHandler)
+    mux.HandleFunc("/reminders/", handlers.RemindersHandler)
+    mux.HandleFunc("/notifications", handlers.NotificationsHandler)
+    mux.HandleFunc("/notifications/", handlers.NotificationsHandler)
+    mux.HandleFunc("/calendar.ics", handlers.CalendarFeedHandler)
+    mux.HandleFunc("/calendar/token", handlers.CalendarTokenHandler)
+    mux.HandleFunc("/calendar/import", handlers.CalendarImportHandler)
+    mux.HandleFunc("/calendar/busy", handlers.CalendarBusyHandler)
+    mux.HandleFunc("/planned-sessions", handlers.PlannedSessionsHandler)
+    mux.HandleFunc("/planned-sessions/", handlers.PlannedSessionsHandler)
+    mux.HandleFunc("/webhooks", handlers.WebhooksHandler)
+    mux.HandleFunc("/webhooks/", handlers.WebhooksHandler)
+    mux.HandleFunc("/insights/distortions", handlers.DistortionInsightsHandler)
     mux.HandleFunc("/gameplan/analyze", handlers.AnalyzeAndStoreGamePlanHandler)
     mux.HandleFunc("/gameplans", handlers.GetGamePlansHandler) // New endpoint
+    mux.HandleFunc("/gameplans/", handlers.GamePlanHandler)
+    mux.HandleFunc("/me", handlers.DeleteAccountHandler)
+    mux.HandleFunc("/me/export", handlers.ExportHandler)
+    mux.HandleFunc("/me/export/jobs/", handlers.GetExportJobHandler)
+    mux.HandleFunc("/me/export/download", handlers.DownloadExportHandler)
+    mux.HandleFunc("/retention/policies", handlers.RetentionPoliciesHandler)
+    mux.HandleFunc("/retention/preview", handlers.RetentionPreviewHandler)
+    mux.HandleFunc("/retention/audit", handlers.RetentionAuditHandler)
+    mux.HandleFunc("/search", handlers.SearchHandler)
+    mux.HandleFunc("/search/semantic", handlers.SemanticSearchHandler)
+    mux.HandleFunc("/admin/audit", handlers.AdminAuditHandler)
+    mux.HandleFunc("/admin/audit/verify", handlers.AdminAuditVerifyHandler)
 
-    handler := c.Handler(mux)
+    handler := c.Handler(handlers.AuditMiddleware(mux))
 
 	log.Println("Server is running on port 8080")
 	log.Fatal(http.ListenAndServe(":8080", handler))
@@ -0,0 +1,172 @@
+package models
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mindful/backend-go/database"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuditEvent is one row of the append-only audit log. Each event's Hash covers
+// its own fields and the previous event's hash, so editing or removing a row
+// breaks the chain from that point on.
+type AuditEvent struct {
+	ID           int    `json:"id"`
+	Actor        string `json:"actor"`
+	Action       string `json:"action"`
+	ResourceType string `json:"resource_type"`
+	ResourceID   string `json:"resource_id,omitempty"`
+	RequestID    string `json:"request_id,omitempty"`
+	IP           string `json:"ip,omitempty"`
+	Status       int    `json:"status,omitempty"`
+	CreatedAt    string `json:"created_at"`
+	PrevHash     string `json:"prev_hash"`
+	Hash         string `json:"hash"`
+}
+
+type AuditFilter struct {
+	Actor        string
+	Action       string
+	ResourceType string
+	ResourceID   string
+	From         string
+	To           string
+	Limit        int
+}
+
+// AuditChainStatus is the result of verifying the audit log hash chain.
+type AuditChainStatus struct {
+	Valid    bool `json:"valid"`
+	Checked  int  `json:"checked"`
+	BrokenAt int  `json:"broken_at,omitempty"`
+}
+
+// auditMu serializes appends so each event links to the latest hash.
+var auditMu sync.Mutex
+
+func (e AuditEvent) computeHash() string {
+	fields := []string{
+		e.PrevHash,
+		e.Actor,
+		e.Action,
+		e.ResourceType,
+		e.ResourceID,
+		e.RequestID,
+		e.IP,
+		fmt.Sprint(e.Status),
+		e.CreatedAt,
+	}
+	sum := sha256.Sum256([]byte(strings.Join(fields, "\x1f")))
+	return hex.EncodeToString(sum[:])
+}
+
+// AppendAuditEvent links the event to the end of the chain and stores it.
+func AppendAuditEvent(e AuditEvent) error {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`SELECT hash FROM audit_events ORDER BY id DESC LIMIT 1`).Scan(&e.PrevHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		e.PrevHash = ""
+	} else if err != nil {
+		return err
+	}
+
+	e.CreatedAt = time.Now().UTC().Format(time.RFC3339Nano)
+	e.Hash = e.computeHash()
+
+	query := `INSERT INTO audit_events (actor, action, resource_type, resource_id, request_id, ip, status, created_at, prev_hash, hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err = tx.Exec(query, e.Actor, e.Action, e.ResourceType, e.ResourceID, e.RequestID, e.IP, e.Status, e.CreatedAt, e.PrevHash, e.Hash)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+const auditEventColumns = `id, actor, action, resource_type, COALESCE(resource_id, ''), COALESCE(request_id, ''), COALESCE(ip, ''), COALESCE(status, 0), created_at, prev_hash, hash`
+
+func scanAuditEvents(rows *sql.Rows) ([]AuditEvent, error) {
+	defer rows.Close()
+	events := []AuditEvent{}
+	for rows.Next() {
+		var e AuditEvent
+		err := rows.Scan(&e.ID, &e.Actor, &e.Action, &e.ResourceType, &e.ResourceID, &e.RequestID, &e.IP, &e.Status, &e.CreatedAt, &e.PrevHash, &e.Hash)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// GetAuditEvents returns events matching the filter, newest first.
+func GetAuditEvents(f AuditFilter) ([]AuditEvent, error) {
+	var conditions []string
+	var args []interface{}
+	add := func(cond, value string) {
+		if value != "" {
+			conditions = append(conditions, cond)
+			args = append(args, value)
+		}
+	}
+	add("actor = ?", f.Actor)
+	add("action = ?", f.Action)
+	add("resource_type = ?", f.ResourceType)
+	add("resource_id = ?", f.ResourceID)
+	add("created_at >= ?", f.From)
+	add("created_at <= ?", f.To)
+
+	query := `SELECT ` + auditEventColumns + ` FROM audit_events`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	if f.Limit <= 0 || f.Limit > 1000 {
+		f.Limit = 100
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, f.Limit)
+
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanAuditEvents(rows)
+}
+
+// VerifyAuditChain recomputes every hash in insertion order and reports the
+// first event whose hash or link to its predecessor does not match.
+func VerifyAuditChain() (AuditChainStatus, error) {
+	rows, err := database.DB.Query(`SELECT ` + auditEventColumns + ` FROM audit_events ORDER BY id ASC`)
+	if err != nil {
+		return AuditChainStatus{}, err
+	}
+	events, err := scanAuditEvents(rows)
+	if err != nil {
+		return AuditChainStatus{}, err
+	}
+
+	status := AuditChainStatus{Valid: true}
+	prev := ""
+	for _, e := range events {
+		status.Checked++
+		if e.PrevHash != prev || e.computeHash() != e.Hash {
+			status.Valid = false
+			status.BrokenAt = e.ID
+			return status, nil
+		}
+		prev = e.Hash
+	}
+	return status, nil
+}
@@ -0,0 +1,193 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mindful/backend-go/database"
+	"sort"
+	"time"
+)
+
+var ErrInvalidSchedule = errors.New("invalid schedule")
+
+// DefaultTaskDuration is how long a scheduled task is shown on a calendar
+// when it has no duration of its own.
+const DefaultTaskDuration = 30
+
+// ParseTimestamp parses an RFC 3339 time and returns it in UTC.
+func ParseTimestamp(s string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, s)
+	return t.UTC(), err
+}
+
+// taskDueValue validates a due time and duration and returns the due time
+// as stored, or nil when dueAt is empty.
+func taskDueValue(dueAt string, durationMinutes int) (interface{}, error) {
+	if durationMinutes < 0 {
+		return nil, fmt.Errorf("%w: duration_minutes must not be negative", ErrInvalidSchedule)
+	}
+	if dueAt == "" {
+		return nil, nil
+	}
+	t, err := ParseTimestamp(dueAt)
+	if err != nil {
+		return nil, fmt.Errorf("%w: due_at must be an RFC 3339 time", ErrInvalidSchedule)
+	}
+	return t.Format(TimestampLayout), nil
+}
+
+// SetGamePlanTaskDue schedules a task at dueAt (RFC 3339) for a number of
+// minutes, or clears its schedule when dueAt is empty.
+func SetGamePlanTaskDue(planID, taskID int, dueAt string, durationMinutes int) (GamePlanTask, error) {
+	due, err := taskDueValue(dueAt, durationMinutes)
+	if err != nil {
+		return GamePlanTask{}, err
+	}
+	err = execOne(`UPDATE gameplan_tasks SET due_at = ?, duration_minutes = ? WHERE game_plan_id = ? AND id = ?`,
+		due, durationMinutes, planID, taskID)
+	if err != nil {
+		return GamePlanTask{}, err
+	}
+	return GetGamePlanTask(planID, taskID)
+}
+
+// GetAllGamePlanTasks returns every task across all game plans, oldest
+// first.
+func GetAllGamePlanTasks() ([]GamePlanTask, error) {
+	byPlan, err := getGamePlanTasks(`SELECT ` + gamePlanTaskColumns + ` FROM gameplan_tasks ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	tasks := []GamePlanTask{}
+	for _, planTasks := range byPlan {
+		tasks = append(tasks, planTasks...)
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].ID < tasks[j].ID })
+	return tasks, nil
+}
+
+// BusyBlock is a time the user is unavailable, imported from an external
+// calendar. Source names the calendar so re-importing it replaces its blocks.
+type BusyBlock struct {
+	ID       int    `json:"id"`
+	Source   string `json:"source"`
+	UID      string `json:"uid,omitempty"`
+	Summary  string `json:"summary,omitempty"`
+	StartsAt string `json:"starts_at"`
+	EndsAt   string `json:"ends_at"`
+}
+
+// ReplaceBusyBlocks swaps the stored blocks of a source for new ones.
+func ReplaceBusyBlocks(source string, blocks []BusyBlock) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM calendar_busy_blocks WHERE source = ?`, source); err != nil {
+		return err
+	}
+	for _, b := range blocks {
+		_, err := tx.Exec(`INSERT INTO calendar_busy_blocks (source, uid, summary, starts_at, ends_at) VALUES (?, ?, ?, ?, ?)`,
+			source, b.UID, b.Summary, b.StartsAt, b.EndsAt)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetBusyBlocks returns blocks overlapping [from, to), in start order. Zero
+// times leave that side open.
+func GetBusyBlocks(from, to time.Time) ([]BusyBlock, error) {
+	query := `SELECT id, source, uid, summary, starts_at, ends_at FROM calendar_busy_blocks WHERE 1 = 1`
+	var args []interface{}
+	if !from.IsZero() {
+		query += ` AND ends_at > ?`
+		args = append(args, from.UTC().Format(TimestampLayout))
+	}
+	if !to.IsZero() {
+		query += ` AND starts_at < ?`
+		args = append(args, to.UTC().Format(TimestampLayout))
+	}
+	rows, err := database.DB.Query(query+` ORDER BY starts_at, id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	blocks := []BusyBlock{}
+	for rows.Next() {
+		var b BusyBlock
+		if err := rows.Scan(&b.ID, &b.Source, &b.UID, &b.Summary, &b.StartsAt, &b.EndsAt); err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks, rows.Err()
+}
+
+// DeleteBusyBlocks removes the blocks of one source, or of all sources when
+// source is empty, and returns how many were removed.
+func DeleteBusyBlocks(source string) (int64, error) {
+	query := `DELETE FROM calendar_busy_blocks`
+	var args []interface{}
+	if source != "" {
+		query += ` WHERE source = ?`
+		args = append(args, source)
+	}
+	result, err := database.DB.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func hashCalendarToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// RotateCalendarToken creates a new calendar subscription token, revoking
+// any earlier one. Only its hash is stored, so it can't be shown again.
+func RotateCalendarToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM calendar_tokens`); err != nil {
+		return "", err
+	}
+	if _, err := tx.Exec(`INSERT INTO calendar_tokens (token_hash) VALUES (?)`, hashCalendarToken(token)); err != nil {
+		return "", err
+	}
+	return token, tx.Commit()
+}
+
+// RevokeCalendarTokens disables the subscription feed until a new token is
+// created.
+func RevokeCalendarTokens() error {
+	_, err := database.DB.Exec(`DELETE FROM calendar_tokens`)
+	return err
+}
+
+// ValidCalendarToken reports whether token grants access to the feed.
+func ValidCalendarToken(token string) (bool, error) {
+	if token == "" {
+		return false, nil
+	}
+	var n int
+	err := database.DB.QueryRow(`SELECT COUNT(*) FROM calendar_tokens WHERE token_hash = ?`, hashCalendarToken(token)).Scan(&n)
+	return n > 0, err
+}
@@ -0,0 +1,133 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func busyBlockIDs(blocks []BusyBlock) string {
+	uids := make([]string, len(blocks))
+	for i, b := range blocks {
+		uids[i] = b.UID
+	}
+	return strings.Join(uids, ",")
+}
+
+func TestGetBusyBlocksOverlap(t *testing.T) {
+	openTestDB(t)
+	err := ReplaceBusyBlocks("work", []BusyBlock{
+		{UID: "morning", StartsAt: "2024-03-25T08:00:00Z", EndsAt: "2024-03-25T09:00:00Z"},
+		{UID: "noon", StartsAt: "2024-03-25T12:00:00Z", EndsAt: "2024-03-25T13:00:00Z"},
+		{UID: "evening", StartsAt: "2024-03-25T18:00:00Z", EndsAt: "2024-03-25T19:00:00Z"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	at := func(hour, min int) time.Time { return time.Date(2024, 3, 25, hour, min, 0, 0, time.UTC) }
+	tests := []struct {
+		name     string
+		from, to time.Time
+		want     string
+	}{
+		{"open range", time.Time{}, time.Time{}, "morning,noon,evening"},
+		{"touching ends don't overlap", at(9, 0), at(12, 0), ""},
+		{"partial overlap", at(8, 30), at(12, 30), "morning,noon"},
+		{"inside one block", at(12, 15), at(12, 45), "noon"},
+		{"open start", time.Time{}, at(12, 1), "morning,noon"},
+		{"open end", at(13, 0), time.Time{}, "evening"},
+		// Bounds in other zones are compared in UTC.
+		{"other zone", at(12, 30).In(time.FixedZone("UTC-5", -5*3600)), at(18, 30).In(time.FixedZone("UTC+2", 2*3600)), "noon,evening"},
+	}
+	for _, tt := range tests {
+		blocks, err := GetBusyBlocks(tt.from, tt.to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := busyBlockIDs(blocks); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestReplaceBusyBlocksBySource(t *testing.T) {
+	openTestDB(t)
+	block := func(uid string) BusyBlock {
+		return BusyBlock{UID: uid, StartsAt: "2024-03-25T08:00:00Z", EndsAt: "2024-03-25T09:00:00Z"}
+	}
+	if err := ReplaceBusyBlocks("work", []BusyBlock{block("w1"), block("w2")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReplaceBusyBlocks("home", []BusyBlock{block("h1")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReplaceBusyBlocks("work", []BusyBlock{block("w3")}); err != nil {
+		t.Fatal(err)
+	}
+	blocks, err := GetBusyBlocks(time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := busyBlockIDs(blocks); got != "h1,w3" {
+		t.Errorf("after re-importing work: %q, want h1,w3", got)
+	}
+
+	n, err := DeleteBusyBlocks("work")
+	if err != nil || n != 1 {
+		t.Errorf("DeleteBusyBlocks(work) = %d, %v, want 1", n, err)
+	}
+	n, err = DeleteBusyBlocks("")
+	if err != nil || n != 1 {
+		t.Errorf("DeleteBusyBlocks() = %d, %v, want 1", n, err)
+	}
+}
+
+func TestTaskDueValue(t *testing.T) {
+	due, err := taskDueValue("2024-03-31T09:30:00+02:00", 45)
+	if err != nil || due != "2024-03-31T07:30:00Z" {
+		t.Errorf("taskDueValue = %v, %v, want 2024-03-31T07:30:00Z", due, err)
+	}
+	if due, err := taskDueValue("", 0); err != nil || due != nil {
+		t.Errorf("taskDueValue(\"\") = %v, %v, want nil", due, err)
+	}
+	for _, tt := range []struct {
+		dueAt    string
+		duration int
+	}{
+		{"2024-03-31 09:30", 30},
+		{"2024-03-31T09:30:00Z", -1},
+	} {
+		if _, err := taskDueValue(tt.dueAt, tt.duration); !errors.Is(err, ErrInvalidSchedule) {
+			t.Errorf("taskDueValue(%q, %d) = %v, want ErrInvalidSchedule", tt.dueAt, tt.duration, err)
+		}
+	}
+}
+
+func TestRotateCalendarToken(t *testing.T) {
+	openTestDB(t)
+	if ok, err := ValidCalendarToken(""); err != nil || ok {
+		t.Errorf("empty token valid = %v, %v", ok, err)
+	}
+	first, err := RotateCalendarToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := RotateCalendarToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := ValidCalendarToken(first); ok {
+		t.Error("rotated token is still valid")
+	}
+	if ok, err := ValidCalendarToken(second); err != nil || !ok {
+		t.Errorf("new token valid = %v, %v", ok, err)
+	}
+	if err := RevokeCalendarTokens(); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := ValidCalendarToken(second); ok {
+		t.Error("revoked token is still valid")
+	}
+}
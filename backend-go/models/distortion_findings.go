@@ -0,0 +1,154 @@
+package models
+
+import (
+	"database/sql"
+	"mindful/backend-go/database"
+)
+
+const (
+	DistortionSourceRules = "rules"
+	DistortionSourceLLM   = "llm"
+)
+
+// DistortionFinding is a span of text tagged with a cognitive distortion.
+// Start and End are character (rune) offsets into the journal entry, or into
+// the turn's text for transcripts, where Turn is set.
+type DistortionFinding struct {
+	ID          int     `json:"id,omitempty"`
+	Kind        string  `json:"type,omitempty"`
+	RecordID    int     `json:"record_id,omitempty"`
+	Turn        *int    `json:"turn,omitempty"`
+	Distortion  string  `json:"distortion"`
+	Start       int     `json:"start"`
+	End         int     `json:"end"`
+	Excerpt     string  `json:"excerpt"`
+	Confidence  float64 `json:"confidence"`
+	Source      string  `json:"source"`
+	Explanation string  `json:"explanation,omitempty"`
+	CreatedAt   string  `json:"created_at,omitempty"`
+}
+
+// DistortionCount is how often a distortion was found in an insights window.
+type DistortionCount struct {
+	Distortion      string  `json:"distortion"`
+	Name            string  `json:"name"`
+	Count           int     `json:"count"`
+	Journals        int     `json:"journals"`
+	TranscriptTurns int     `json:"transcript_turns"`
+	AvgConfidence   float64 `json:"avg_confidence"`
+}
+
+// DistortionInsights summarizes the distortions found between From and To.
+type DistortionInsights struct {
+	From          string              `json:"from,omitempty"`
+	To            string              `json:"to,omitempty"`
+	MinConfidence float64             `json:"min_confidence"`
+	Total         int                 `json:"total"`
+	Distortions   []DistortionCount   `json:"distortions"`
+	Recent        []DistortionFinding `json:"recent"`
+}
+
+// ReplaceDistortionFindings stores the findings for a journal entry or
+// transcript, replacing any from an earlier analysis.
+func ReplaceDistortionFindings(kind string, recordID int, findings []DistortionFinding) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM distortion_findings WHERE kind = ? AND record_id = ?`, kind, recordID); err != nil {
+		return err
+	}
+	for _, f := range findings {
+		_, err := tx.Exec(`INSERT INTO distortion_findings (kind, record_id, turn, distortion, start_offset, end_offset,
+			excerpt, confidence, source, explanation) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			kind, recordID, f.Turn, f.Distortion, f.Start, f.End, f.Excerpt, f.Confidence, f.Source, f.Explanation)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+const distortionFindingColumns = `id, kind, record_id, turn, distortion, start_offset, end_offset, excerpt, confidence,
+	source, COALESCE(explanation, ''), created_at`
+
+func queryDistortionFindings(query string, args ...interface{}) ([]DistortionFinding, error) {
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	findings := []DistortionFinding{}
+	for rows.Next() {
+		var f DistortionFinding
+		var turn sql.NullInt64
+		err := rows.Scan(&f.ID, &f.Kind, &f.RecordID, &turn, &f.Distortion, &f.Start, &f.End, &f.Excerpt, &f.Confidence,
+			&f.Source, &f.Explanation, &f.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if turn.Valid {
+			t := int(turn.Int64)
+			f.Turn = &t
+		}
+		findings = append(findings, f)
+	}
+	return findings, rows.Err()
+}
+
+// GetDistortionFindings returns the stored findings for a record in text order.
+func GetDistortionFindings(kind string, recordID int) ([]DistortionFinding, error) {
+	return queryDistortionFindings(`SELECT `+distortionFindingColumns+` FROM distortion_findings
+		WHERE kind = ? AND record_id = ? ORDER BY turn, start_offset`, kind, recordID)
+}
+
+// GetDistortionInsights counts findings at or above minConfidence per
+// distortion, optionally limited to findings made between from and to
+// (inclusive YYYY-MM-DD dates), and lists the most recent ones.
+func GetDistortionInsights(from, to string, minConfidence float64) (DistortionInsights, error) {
+	insights := DistortionInsights{From: from, To: to, MinConfidence: minConfidence, Distortions: []DistortionCount{}}
+
+	where := `WHERE confidence >= ?`
+	args := []interface{}{minConfidence}
+	if from != "" {
+		where += ` AND date(created_at) >= date(?)`
+		args = append(args, from)
+	}
+	if to != "" {
+		where += ` AND date(created_at) <= date(?)`
+		args = append(args, to)
+	}
+
+	rows, err := database.DB.Query(`SELECT distortion, COUNT(*),
+		COUNT(DISTINCT CASE WHEN kind = ? THEN record_id END),
+		COUNT(CASE WHEN kind = ? THEN 1 END),
+		AVG(confidence)
+		FROM distortion_findings `+where+` GROUP BY distortion ORDER BY COUNT(*) DESC, distortion`,
+		append([]interface{}{SearchKindJournal, SearchKindTranscript}, args...)...)
+	if err != nil {
+		return insights, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c DistortionCount
+		if err := rows.Scan(&c.Distortion, &c.Count, &c.Journals, &c.TranscriptTurns, &c.AvgConfidence); err != nil {
+			return insights, err
+		}
+		if d, ok := GetDistortion(c.Distortion); ok {
+			c.Name = d.Name
+		}
+		insights.Total += c.Count
+		insights.Distortions = append(insights.Distortions, c)
+	}
+	if err := rows.Err(); err != nil {
+		return insights, err
+	}
+	rows.Close()
+
+	insights.Recent, err = queryDistortionFindings(`SELECT `+distortionFindingColumns+` FROM distortion_findings `+
+		where+` ORDER BY id DESC LIMIT 10`, args...)
+	return insights, err
+}
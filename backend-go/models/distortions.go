@@ -0,0 +1,35 @@
+package models
+
+// Distortion is a cognitive distortion from the CBT catalog that thought
+// records and the distortion detector refer to by ID.
+type Distortion struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// CognitiveDistortions is the catalog of distortions a thought can be tagged with.
+var CognitiveDistortions = []Distortion{
+	{"all-or-nothing", "All-or-nothing thinking", "Seeing things in black and white categories with no middle ground."},
+	{"overgeneralization", "Overgeneralization", "Treating a single negative event as a never-ending pattern."},
+	{"mental-filter", "Mental filter", "Dwelling on one negative detail so that it colours everything else."},
+	{"discounting-positive", "Discounting the positive", "Insisting that positive experiences do not count."},
+	{"mind-reading", "Mind reading", "Assuming you know what others are thinking without evidence."},
+	{"fortune-telling", "Fortune telling", "Predicting that things will turn out badly as if it were fact."},
+	{"catastrophizing", "Catastrophizing", "Blowing things out of proportion or expecting the worst possible outcome."},
+	{"emotional-reasoning", "Emotional reasoning", "Taking feelings as evidence of how things really are."},
+	{"should-statements", "Should statements", "Rigid rules about how you or others should or must behave."},
+	{"labeling", "Labeling", "Attaching a global negative label to yourself or others instead of describing a behaviour."},
+	{"personalization", "Personalization", "Blaming yourself for events that are not entirely under your control."},
+	{"blaming", "Blaming", "Holding others entirely responsible for your feelings or problems."},
+}
+
+// GetDistortion looks up a distortion in the catalog by ID.
+func GetDistortion(id string) (Distortion, bool) {
+	for _, d := range CognitiveDistortions {
+		if d.ID == id {
+			return d, true
+		}
+	}
+	return Distortion{}, false
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"math"
+	"mindful/backend-go/database"
+)
+
+// Embedding is a stored vector for a journal entry or session transcript.
+type Embedding struct {
+	Kind     string
+	RecordID int
+	Model    string
+	Vector   []float32
+}
+
+func encodeVector(v []float32) []byte {
+	buf := make([]byte, 4*len(v))
+	for i, f := range v {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(f))
+	}
+	return buf
+}
+
+func decodeVector(buf []byte) []float32 {
+	v := make([]float32, len(buf)/4)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:]))
+	}
+	return v
+}
+
+func StoreEmbedding(e Embedding) error {
+	query := `INSERT INTO embeddings (kind, record_id, model, dim, vector) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(kind, record_id) DO UPDATE SET model = excluded.model, dim = excluded.dim, vector = excluded.vector, created_at = CURRENT_TIMESTAMP`
+	_, err := database.DB.Exec(query, e.Kind, e.RecordID, e.Model, len(e.Vector), encodeVector(e.Vector))
+	return err
+}
+
+// GetEmbeddings returns all vectors produced by model, optionally limited to
+// one kind. Vectors from other models are not comparable and are skipped.
+func GetEmbeddings(model, kind string) ([]Embedding, error) {
+	query := `SELECT kind, record_id, model, vector FROM embeddings WHERE model = ?`
+	args := []interface{}{model}
+	if kind != "" {
+		query += ` AND kind = ?`
+		args = append(args, kind)
+	}
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var embeddings []Embedding
+	for rows.Next() {
+		var e Embedding
+		var blob []byte
+		if err := rows.Scan(&e.Kind, &e.RecordID, &e.Model, &blob); err != nil {
+			return nil, err
+		}
+		e.Vector = decodeVector(blob)
+		embeddings = append(embeddings, e)
+	}
+	return embeddings, rows.Err()
+}
+
+// DeleteEmbeddings removes every stored vector of a kind.
+func DeleteEmbeddings(kind string) error {
+	_, err := database.DB.Exec(`DELETE FROM embeddings WHERE kind = ?`, kind)
+	return err
+}
+
+// DeleteSessionEmbeddings removes the vectors of a session's transcripts
+// other than keep.
+func DeleteSessionEmbeddings(sessionID string, keep int) error {
+	_, err := database.DB.Exec(`DELETE FROM embeddings WHERE kind = ?
+		AND record_id IN (SELECT id FROM transcripts WHERE session_id = ? AND id != ?)`, SearchKindTranscript, sessionID, keep)
+	return err
+}
+
+func GetEmbedding(kind string, recordID int) (Embedding, error) {
+	e := Embedding{Kind: kind, RecordID: recordID}
+	var blob []byte
+	err := database.DB.QueryRow(`SELECT model, vector FROM embeddings WHERE kind = ? AND record_id = ?`, kind, recordID).Scan(&e.Model, &blob)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Embedding{}, ErrNotFound
+	}
+	if err != nil {
+		return Embedding{}, err
+	}
+	e.Vector = decodeVector(blob)
+	return e, nil
+}
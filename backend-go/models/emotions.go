@@ -0,0 +1,196 @@
+package models
+
+import "sort"
+
+// ProsodyTopEmotions is how many of a turn's prosody scores are stored. The
+// voice service scores close to fifty emotions per utterance, most of them
+// near zero.
+const ProsodyTopEmotions = 5
+
+// EmotionScore is one emotion's prosody score, from 0 to 1.
+type EmotionScore struct {
+	Name  string  `json:"name"`
+	Score float64 `json:"score"`
+}
+
+// TopEmotions returns the n highest scores, highest first. Ties are broken
+// by name so the result is stable.
+func TopEmotions(scores map[string]float64, n int) []EmotionScore {
+	top := make([]EmotionScore, 0, len(scores))
+	for name, score := range scores {
+		top = append(top, EmotionScore{Name: name, Score: score})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Score != top[j].Score {
+			return top[i].Score > top[j].Score
+		}
+		return top[i].Name < top[j].Name
+	})
+	if len(top) > n {
+		top = top[:n]
+	}
+	return top
+}
+
+// trimProsody keeps a turn's n highest scores.
+func trimProsody(scores map[string]float64, n int) map[string]float64 {
+	if len(scores) <= n {
+		return scores
+	}
+	trimmed := make(map[string]float64, n)
+	for _, e := range TopEmotions(scores, n) {
+		trimmed[e.Name] = e.Score
+	}
+	return trimmed
+}
+
+// Emotions the voice service measures, grouped by whether they are pleasant
+// to feel. Neutral ones such as Concentration or Interest count for neither.
+var (
+	positiveEmotions = map[string]bool{
+		"Admiration": true, "Adoration": true, "Aesthetic Appreciation": true, "Amusement": true,
+		"Calmness": true, "Contentment": true, "Determination": true, "Ecstasy": true,
+		"Entrancement": true, "Excitement": true, "Gratitude": true, "Joy": true, "Love": true,
+		"Pride": true, "Relief": true, "Romance": true, "Satisfaction": true, "Triumph": true,
+	}
+	negativeEmotions = map[string]bool{
+		"Anger": true, "Annoyance": true, "Anxiety": true, "Awkwardness": true, "Boredom": true,
+		"Contempt": true, "Disappointment": true, "Disapproval": true, "Disgust": true,
+		"Distress": true, "Embarrassment": true, "Empathic Pain": true, "Envy": true, "Fear": true,
+		"Guilt": true, "Horror": true, "Pain": true, "Sadness": true, "Shame": true,
+		"Tiredness": true,
+	}
+)
+
+// Valence weighs the pleasant emotions in scores against the unpleasant
+// ones, from -1 (only unpleasant) to 1 (only pleasant). It is 0 when
+// neither kind was heard.
+func Valence(scores map[string]float64) float64 {
+	var pos, neg float64
+	for name, score := range scores {
+		switch {
+		case positiveEmotions[name]:
+			pos += score
+		case negativeEmotions[name]:
+			neg += score
+		}
+	}
+	if pos+neg == 0 {
+		return 0
+	}
+	return (pos - neg) / (pos + neg)
+}
+
+// EmotionArcPoint is the vocal emotion of one of the user's turns.
+type EmotionArcPoint struct {
+	TranscriptID int            `json:"transcript_id"`
+	TurnIndex    int            `json:"turn_index"`
+	StartMs      *int64         `json:"start_ms,omitempty"`
+	EndMs        *int64         `json:"end_ms,omitempty"`
+	Emotions     []EmotionScore `json:"emotions"`
+	Valence      float64        `json:"valence"`
+}
+
+// Trends of a session's emotional arc.
+const (
+	EmotionTrendImproving = "improving"
+	EmotionTrendWorsening = "worsening"
+	EmotionTrendSteady    = "steady"
+)
+
+// emotionTrendThreshold is how far the valence of a session's second half
+// must move from its first half's to count as a change.
+const emotionTrendThreshold = 0.15
+
+// SessionEmotions sums up the vocal emotion of the user across a session.
+// Dominant holds the emotions with the highest mean score over the scored
+// turns; Arc follows the turns in order. Trend compares the mean valence of
+// the second half of the arc with the first, and is empty when fewer than
+// two turns were scored.
+type SessionEmotions struct {
+	SessionID   string            `json:"session_id"`
+	ScoredTurns int               `json:"scored_turns"`
+	Dominant    []EmotionScore    `json:"dominant"`
+	Valence     float64           `json:"valence"`
+	Trend       string            `json:"trend,omitempty"`
+	Arc         []EmotionArcPoint `json:"arc"`
+}
+
+// GetSessionEmotions aggregates the prosody scores of the user's turns in a
+// session's transcripts. It returns ErrNotFound if the session has no
+// transcript; a session whose turns carry no scores has an empty summary.
+func GetSessionEmotions(sessionID string) (SessionEmotions, error) {
+	transcripts, err := GetTranscriptsBySessionID(sessionID)
+	if err != nil {
+		return SessionEmotions{}, err
+	}
+	var arc []EmotionArcPoint
+	var scored []map[string]float64
+	for _, t := range transcripts {
+		turns, err := GetTranscriptTurns(t.ID)
+		if err != nil {
+			return SessionEmotions{}, err
+		}
+		for _, turn := range turns {
+			if turn.Speaker != "user" || len(turn.Prosody) == 0 {
+				continue
+			}
+			arc = append(arc, EmotionArcPoint{
+				TranscriptID: t.ID,
+				TurnIndex:    turn.Index,
+				StartMs:      turn.StartMs,
+				EndMs:        turn.EndMs,
+				Emotions:     TopEmotions(turn.Prosody, ProsodyTopEmotions),
+				Valence:      Valence(turn.Prosody),
+			})
+			scored = append(scored, turn.Prosody)
+		}
+	}
+	return summarizeEmotions(sessionID, arc, scored), nil
+}
+
+func summarizeEmotions(sessionID string, arc []EmotionArcPoint, scored []map[string]float64) SessionEmotions {
+	s := SessionEmotions{SessionID: sessionID, ScoredTurns: len(scored), Dominant: []EmotionScore{}, Arc: arc}
+	if s.Arc == nil {
+		s.Arc = []EmotionArcPoint{}
+	}
+	if len(scored) == 0 {
+		return s
+	}
+
+	// Emotions missing from a turn's top scores count as zero there.
+	means := map[string]float64{}
+	for _, scores := range scored {
+		for name, score := range scores {
+			means[name] += score / float64(len(scored))
+		}
+	}
+	s.Dominant = TopEmotions(means, ProsodyTopEmotions)
+
+	var total float64
+	for _, p := range arc {
+		total += p.Valence
+	}
+	s.Valence = total / float64(len(arc))
+
+	if len(arc) >= 2 {
+		half := len(arc) / 2
+		var first, second float64
+		for _, p := range arc[:half] {
+			first += p.Valence
+		}
+		for _, p := range arc[half:] {
+			second += p.Valence
+		}
+		change := second/float64(len(arc)-half) - first/float64(half)
+		switch {
+		case change >= emotionTrendThreshold:
+			s.Trend = EmotionTrendImproving
+		case change <= -emotionTrendThreshold:
+			s.Trend = EmotionTrendWorsening
+		default:
+			s.Trend = EmotionTrendSteady
+		}
+	}
+	return s
+}
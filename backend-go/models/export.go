@@ -0,0 +1,110 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"mindful/backend-go/database"
+	"time"
+)
+
+// ExportJob tracks a background data export and the download link it produces.
+type ExportJob struct {
+	ID        int    `json:"id"`
+	Status    string `json:"status"`
+	Token     string `json:"-"`
+	FilePath  string `json:"-"`
+	Error     string `json:"error,omitempty"`
+	ExpiresAt string `json:"expires_at,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
+
+var ErrExportJobNotFound = errors.New("export job not found")
+
+func CreateExportJob(token string) (ExportJob, error) {
+	result, err := database.DB.Exec(`INSERT INTO export_jobs (status, token) VALUES ('pending', ?)`, token)
+	if err != nil {
+		return ExportJob{}, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return ExportJob{}, err
+	}
+	return GetExportJob(int(id))
+}
+
+func CompleteExportJob(id int, filePath string, expiresAt time.Time) error {
+	query := `UPDATE export_jobs SET status = 'completed', file_path = ?, expires_at = ? WHERE id = ?`
+	_, err := database.DB.Exec(query, filePath, expiresAt.UTC().Format(time.RFC3339), id)
+	return err
+}
+
+func FailExportJob(id int, message string) error {
+	_, err := database.DB.Exec(`UPDATE export_jobs SET status = 'failed', error = ? WHERE id = ?`, message, id)
+	return err
+}
+
+func GetExportJob(id int) (ExportJob, error) {
+	row := database.DB.QueryRow(`SELECT id, status, token, file_path, error, expires_at, created_at FROM export_jobs WHERE id = ?`, id)
+	return scanExportJob(row)
+}
+
+func GetExportJobByToken(token string) (ExportJob, error) {
+	row := database.DB.QueryRow(`SELECT id, status, token, file_path, error, expires_at, created_at FROM export_jobs WHERE token = ?`, token)
+	return scanExportJob(row)
+}
+
+func scanExportJob(row rowScanner) (ExportJob, error) {
+	var job ExportJob
+	var filePath, jobErr, expiresAt sql.NullString
+	err := row.Scan(&job.ID, &job.Status, &job.Token, &filePath, &jobErr, &expiresAt, &job.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ExportJob{}, ErrExportJobNotFound
+	}
+	if err != nil {
+		return ExportJob{}, err
+	}
+	job.FilePath = filePath.String
+	job.Error = jobErr.String
+	job.ExpiresAt = expiresAt.String
+	return job, nil
+}
+
+// ListExpiredExportFiles returns completed jobs whose download link expired
+// before now while their file is still on disk.
+func ListExpiredExportFiles(now time.Time) ([]ExportJob, error) {
+	rows, err := database.DB.Query(`SELECT id, status, token, file_path, error, expires_at, created_at FROM export_jobs
+		WHERE status = 'completed' AND COALESCE(file_path, '') != '' AND expires_at <= ?`, now.UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []ExportJob
+	for rows.Next() {
+		job, err := scanExportJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// ClearExportFile forgets the file of a job whose link has expired. The job
+// stays completed, so its link reports that it expired.
+func ClearExportFile(id int) error {
+	_, err := database.DB.Exec(`UPDATE export_jobs SET file_path = NULL WHERE id = ?`, id)
+	return err
+}
+
+// Expired reports whether the job's download link is no longer valid.
+func (j ExportJob) Expired(now time.Time) bool {
+	if j.ExpiresAt == "" {
+		return false
+	}
+	expiresAt, err := time.Parse(time.RFC3339, j.ExpiresAt)
+	if err != nil {
+		return true
+	}
+	return now.After(expiresAt)
+}
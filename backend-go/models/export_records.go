@@ -0,0 +1,162 @@
+package models
+
+import (
+	"database/sql"
+	"mindful/backend-go/database"
+)
+
+// exportPageSize is how many rows the export iterators read at a time. A
+// page is read and its rows closed before its records are handed on, so a
+// slow download neither holds every record in memory nor keeps the
+// database locked.
+const exportPageSize = 100
+
+// MoodCheckIn is the mood recorded with a journal entry: the user's own
+// rating and the emotion found by analysis.
+type MoodCheckIn struct {
+	JournalID      int    `json:"journal_id"`
+	MoodIntensity  *int   `json:"mood_intensity,omitempty"`
+	EmotionalState string `json:"emotional_state,omitempty"`
+	CreatedAt      string `json:"created_at"`
+}
+
+// eachPage runs query, which takes the last ID seen and a page size and
+// must return rows in ID order, and passes every record to fn. scan returns
+// a row's record and its ID.
+func eachPage[T any](query string, scan func(*sql.Rows) (T, int, error), fn func(T) error) error {
+	after := 0
+	for {
+		rows, err := database.DB.Query(query, after, exportPageSize)
+		if err != nil {
+			return err
+		}
+		var page []T
+		for rows.Next() {
+			record, id, err := scan(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			page = append(page, record)
+			after = id
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, record := range page {
+			if err := fn(record); err != nil {
+				return err
+			}
+		}
+		if len(page) < exportPageSize {
+			return nil
+		}
+	}
+}
+
+// CountRecords returns the total number of rows in tables.
+func CountRecords(tables ...string) (int, error) {
+	total := 0
+	for _, table := range tables {
+		var n int
+		if err := database.DB.QueryRow(`SELECT COUNT(*) FROM ` + table).Scan(&n); err != nil {
+			return 0, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// EachTranscript passes every transcript, with its turns, to fn in the
+// order they were stored.
+func EachTranscript(fn func(Transcript) error) error {
+	return eachPage(`SELECT id, session_id, transcript, created_at FROM transcripts WHERE id > ? ORDER BY id LIMIT ?`,
+		func(rows *sql.Rows) (Transcript, int, error) {
+			var t Transcript
+			err := rows.Scan(&t.ID, &t.SessionID, &t.Transcript, &t.CreatedAt)
+			return t, t.ID, err
+		},
+		func(t Transcript) error {
+			turns, err := GetTranscriptTurns(t.ID)
+			if err != nil {
+				return err
+			}
+			t.Turns = turns
+			return fn(t)
+		})
+}
+
+// EachJournalEntry passes every journal entry, with its tags, to fn.
+func EachJournalEntry(fn func(Journal) error) error {
+	return eachPage(`SELECT `+journalColumns+` FROM journal_entries WHERE id > ? ORDER BY id LIMIT ?`,
+		func(rows *sql.Rows) (Journal, int, error) {
+			j, err := scanJournal(rows)
+			return j, j.ID, err
+		},
+		func(j Journal) error {
+			tags, err := getJournalTags(`WHERE jt.journal_id = ?`, j.ID)
+			if err != nil {
+				return err
+			}
+			if t, ok := tags[j.ID]; ok {
+				j.Tags = t
+			}
+			return fn(j)
+		})
+}
+
+// EachMoodCheckIn passes the mood of every journal entry that has a rating
+// or an analyzed emotion to fn.
+func EachMoodCheckIn(fn func(MoodCheckIn) error) error {
+	return eachPage(`SELECT id, mood_intensity, COALESCE(emotional_state, ''), created_at FROM journal_entries
+		WHERE id > ? AND (mood_intensity IS NOT NULL OR COALESCE(emotional_state, '') != '') ORDER BY id LIMIT ?`,
+		func(rows *sql.Rows) (MoodCheckIn, int, error) {
+			var m MoodCheckIn
+			var intensity sql.NullInt64
+			if err := rows.Scan(&m.JournalID, &intensity, &m.EmotionalState, &m.CreatedAt); err != nil {
+				return m, 0, err
+			}
+			if intensity.Valid {
+				n := int(intensity.Int64)
+				m.MoodIntensity = &n
+			}
+			return m, m.JournalID, nil
+		}, fn)
+}
+
+// EachThoughtRecord passes every thought record to fn.
+func EachThoughtRecord(fn func(ThoughtRecord) error) error {
+	return eachPage(`SELECT `+thoughtRecordColumns+` FROM thought_records WHERE id > ? ORDER BY id LIMIT ?`,
+		func(rows *sql.Rows) (ThoughtRecord, int, error) {
+			t, err := scanThoughtRecord(rows)
+			return t, t.ID, err
+		}, fn)
+}
+
+// EachGamePlan passes every game plan, with its tasks, to fn.
+func EachGamePlan(fn func(GamePlan) error) error {
+	return eachPage(`SELECT `+gamePlanColumns+` FROM game_plans WHERE id > ? ORDER BY id LIMIT ?`,
+		func(rows *sql.Rows) (GamePlan, int, error) {
+			g, err := scanGamePlan(rows)
+			return g, g.ID, err
+		},
+		func(g GamePlan) error {
+			tasks, err := getGamePlanTasks(`SELECT `+gamePlanTaskColumns+` FROM gameplan_tasks WHERE game_plan_id = ? ORDER BY position`, g.ID)
+			if err != nil {
+				return err
+			}
+			g.TaskItems = tasks[g.ID]
+			return fn(g)
+		})
+}
+
+// EachNotification passes every notification to fn.
+func EachNotification(fn func(Notification) error) error {
+	return eachPage(`SELECT `+notificationColumns+` FROM notifications WHERE id > ? ORDER BY id LIMIT ?`,
+		func(rows *sql.Rows) (Notification, int, error) {
+			n, err := scanNotification(rows)
+			return n, n.ID, err
+		}, fn)
+}
@@ -0,0 +1,403 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"mindful/backend-go/database"
+	"sort"
+	"strings"
+)
+
+const (
+	GoalStatusActive    = "active"
+	GoalStatusPaused    = "paused"
+	GoalStatusCompleted = "completed"
+	GoalStatusAbandoned = "abandoned"
+)
+
+// Goal is a long-term direction that game plan tasks work towards. Why is
+// the user's own reason for the goal, shown to the generator alongside it.
+type Goal struct {
+	ID         int             `json:"id"`
+	Title      string          `json:"title"`
+	Why        string          `json:"why"`
+	TargetDate string          `json:"target_date,omitempty"`
+	Status     string          `json:"status"`
+	Milestones []GoalMilestone `json:"milestones"`
+	Progress   GoalProgress    `json:"progress"`
+	CreatedAt  string          `json:"created_at"`
+	UpdatedAt  string          `json:"updated_at,omitempty"`
+}
+
+type GoalMilestone struct {
+	ID          int    `json:"id"`
+	GoalID      int    `json:"goal_id"`
+	Title       string `json:"title"`
+	TargetDate  string `json:"target_date,omitempty"`
+	Completed   bool   `json:"completed"`
+	CompletedAt string `json:"completed_at,omitempty"`
+	CreatedAt   string `json:"created_at"`
+}
+
+// GoalProgress is computed from the game plan tasks linked to a goal:
+// Percent is the share of them that are completed.
+type GoalProgress struct {
+	LinkedTasks         int `json:"linked_tasks"`
+	CompletedTasks      int `json:"completed_tasks"`
+	Percent             int `json:"percent"`
+	Milestones          int `json:"milestones"`
+	CompletedMilestones int `json:"completed_milestones"`
+}
+
+var ErrInvalidGoal = errors.New("invalid goal")
+
+func validGoalStatus(status string) bool {
+	switch status {
+	case GoalStatusActive, GoalStatusPaused, GoalStatusCompleted, GoalStatusAbandoned:
+		return true
+	}
+	return false
+}
+
+func validateGoal(g *Goal) error {
+	g.Title = strings.TrimSpace(g.Title)
+	if g.Title == "" {
+		return fmt.Errorf("%w: title is required", ErrInvalidGoal)
+	}
+	if g.Status == "" {
+		g.Status = GoalStatusActive
+	}
+	if !validGoalStatus(g.Status) {
+		return fmt.Errorf("%w: status must be active, paused, completed or abandoned", ErrInvalidGoal)
+	}
+	if g.TargetDate != "" {
+		if _, err := ParseDate(g.TargetDate); err != nil {
+			return fmt.Errorf("%w: target_date must be YYYY-MM-DD", ErrInvalidGoal)
+		}
+	}
+	return nil
+}
+
+// CreateGoal stores a goal with any milestones given and returns it.
+func CreateGoal(g Goal) (Goal, error) {
+	if err := validateGoal(&g); err != nil {
+		return Goal{}, err
+	}
+	for i := range g.Milestones {
+		if err := validateMilestone(&g.Milestones[i]); err != nil {
+			return Goal{}, err
+		}
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return Goal{}, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`INSERT INTO goals (title, why, target_date, status) VALUES (?, ?, ?, ?)`,
+		g.Title, g.Why, nullString(g.TargetDate), g.Status)
+	if err != nil {
+		return Goal{}, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return Goal{}, err
+	}
+	for _, m := range g.Milestones {
+		if _, err := insertMilestone(tx, int(id), m); err != nil {
+			return Goal{}, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return Goal{}, err
+	}
+	return GetGoal(int(id))
+}
+
+// UpdateGoal replaces a goal's title, reason, target date and status. Its
+// milestones and linked tasks are kept.
+func UpdateGoal(id int, g Goal) (Goal, error) {
+	if err := validateGoal(&g); err != nil {
+		return Goal{}, err
+	}
+	err := execOne(`UPDATE goals SET title = ?, why = ?, target_date = ?, status = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		g.Title, g.Why, nullString(g.TargetDate), g.Status, id)
+	if err != nil {
+		return Goal{}, err
+	}
+	return GetGoal(id)
+}
+
+const goalColumns = `id, title, why, COALESCE(target_date, ''), status, created_at, updated_at`
+
+func scanGoal(row rowScanner) (Goal, error) {
+	var g Goal
+	var updatedAt sql.NullString
+	err := row.Scan(&g.ID, &g.Title, &g.Why, &g.TargetDate, &g.Status, &g.CreatedAt, &updatedAt)
+	g.UpdatedAt = updatedAt.String
+	return g, err
+}
+
+func GetGoal(id int) (Goal, error) {
+	g, err := scanGoal(database.DB.QueryRow(`SELECT `+goalColumns+` FROM goals WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Goal{}, ErrNotFound
+	}
+	if err != nil {
+		return Goal{}, err
+	}
+	goals := []Goal{g}
+	if err := attachGoalDetails(goals); err != nil {
+		return Goal{}, err
+	}
+	return goals[0], nil
+}
+
+// ListGoals returns goals with their milestones and progress, optionally
+// only those with the given status.
+func ListGoals(status string) ([]Goal, error) {
+	query := `SELECT ` + goalColumns + ` FROM goals`
+	var args []interface{}
+	if status != "" {
+		query += ` WHERE status = ?`
+		args = append(args, status)
+	}
+	rows, err := database.DB.Query(query+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	goals := []Goal{}
+	for rows.Next() {
+		g, err := scanGoal(rows)
+		if err != nil {
+			return nil, err
+		}
+		goals = append(goals, g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if err := attachGoalDetails(goals); err != nil {
+		return nil, err
+	}
+	return goals, nil
+}
+
+// attachGoalDetails fills in milestones and progress for each goal.
+func attachGoalDetails(goals []Goal) error {
+	if len(goals) == 0 {
+		return nil
+	}
+	milestones, err := goalMilestones()
+	if err != nil {
+		return err
+	}
+	rows, err := database.DB.Query(`SELECT goal_id, COUNT(*), SUM(CASE WHEN status = ? THEN 1 ELSE 0 END)
+		FROM gameplan_tasks WHERE goal_id IS NOT NULL GROUP BY goal_id`, TaskStatusCompleted)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	type taskCounts struct{ linked, completed int }
+	counts := map[int]taskCounts{}
+	for rows.Next() {
+		var goalID int
+		var c taskCounts
+		if err := rows.Scan(&goalID, &c.linked, &c.completed); err != nil {
+			return err
+		}
+		counts[goalID] = c
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range goals {
+		g := &goals[i]
+		g.Milestones = milestones[g.ID]
+		if g.Milestones == nil {
+			g.Milestones = []GoalMilestone{}
+		}
+		c := counts[g.ID]
+		g.Progress = GoalProgress{LinkedTasks: c.linked, CompletedTasks: c.completed, Milestones: len(g.Milestones)}
+		if c.linked > 0 {
+			g.Progress.Percent = c.completed * 100 / c.linked
+		}
+		for _, m := range g.Milestones {
+			if m.Completed {
+				g.Progress.CompletedMilestones++
+			}
+		}
+	}
+	return nil
+}
+
+// DeleteGoal removes a goal and its milestones. Linked tasks are kept but
+// detached.
+func DeleteGoal(id int) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM goals WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	if _, err := tx.Exec(`DELETE FROM goal_milestones WHERE goal_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE gameplan_tasks SET goal_id = NULL WHERE goal_id = ?`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func validateMilestone(m *GoalMilestone) error {
+	m.Title = strings.TrimSpace(m.Title)
+	if m.Title == "" {
+		return fmt.Errorf("%w: milestone title is required", ErrInvalidGoal)
+	}
+	if m.TargetDate != "" {
+		if _, err := ParseDate(m.TargetDate); err != nil {
+			return fmt.Errorf("%w: milestone target_date must be YYYY-MM-DD", ErrInvalidGoal)
+		}
+	}
+	return nil
+}
+
+func insertMilestone(ex execer, goalID int, m GoalMilestone) (int, error) {
+	query := `INSERT INTO goal_milestones (goal_id, title, target_date, completed_at) VALUES (?, ?, ?, NULL)`
+	if m.Completed {
+		query = `INSERT INTO goal_milestones (goal_id, title, target_date, completed_at) VALUES (?, ?, ?, CURRENT_TIMESTAMP)`
+	}
+	result, err := ex.Exec(query, goalID, m.Title, nullString(m.TargetDate))
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+const milestoneColumns = `id, goal_id, title, COALESCE(target_date, ''), completed_at, created_at`
+
+func scanMilestone(row rowScanner) (GoalMilestone, error) {
+	var m GoalMilestone
+	var completedAt sql.NullString
+	if err := row.Scan(&m.ID, &m.GoalID, &m.Title, &m.TargetDate, &completedAt, &m.CreatedAt); err != nil {
+		return GoalMilestone{}, err
+	}
+	m.Completed = completedAt.Valid
+	m.CompletedAt = completedAt.String
+	return m, nil
+}
+
+// goalMilestones returns every milestone grouped by goal, by target date
+// with undated milestones last.
+func goalMilestones() (map[int][]GoalMilestone, error) {
+	rows, err := database.DB.Query(`SELECT ` + milestoneColumns + ` FROM goal_milestones
+		ORDER BY goal_id, target_date IS NULL, target_date, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	milestones := map[int][]GoalMilestone{}
+	for rows.Next() {
+		m, err := scanMilestone(rows)
+		if err != nil {
+			return nil, err
+		}
+		milestones[m.GoalID] = append(milestones[m.GoalID], m)
+	}
+	return milestones, rows.Err()
+}
+
+func getMilestone(goalID, milestoneID int) (GoalMilestone, error) {
+	m, err := scanMilestone(database.DB.QueryRow(`SELECT `+milestoneColumns+` FROM goal_milestones WHERE goal_id = ? AND id = ?`,
+		goalID, milestoneID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return GoalMilestone{}, ErrNotFound
+	}
+	return m, err
+}
+
+// AddMilestone adds a milestone to a goal and returns it.
+func AddMilestone(goalID int, m GoalMilestone) (GoalMilestone, error) {
+	if err := validateMilestone(&m); err != nil {
+		return GoalMilestone{}, err
+	}
+	if _, err := GetGoal(goalID); err != nil {
+		return GoalMilestone{}, err
+	}
+	id, err := insertMilestone(database.DB, goalID, m)
+	if err != nil {
+		return GoalMilestone{}, err
+	}
+	return getMilestone(goalID, id)
+}
+
+// UpdateMilestone replaces a milestone's title and target date and marks it
+// completed or not. The original completion time is kept while it stays
+// completed.
+func UpdateMilestone(goalID, milestoneID int, m GoalMilestone) (GoalMilestone, error) {
+	if err := validateMilestone(&m); err != nil {
+		return GoalMilestone{}, err
+	}
+	query := `UPDATE goal_milestones SET title = ?, target_date = ?, completed_at = NULL WHERE goal_id = ? AND id = ?`
+	if m.Completed {
+		query = `UPDATE goal_milestones SET title = ?, target_date = ?, completed_at = COALESCE(completed_at, CURRENT_TIMESTAMP) WHERE goal_id = ? AND id = ?`
+	}
+	if err := execOne(query, m.Title, nullString(m.TargetDate), goalID, milestoneID); err != nil {
+		return GoalMilestone{}, err
+	}
+	return getMilestone(goalID, milestoneID)
+}
+
+func DeleteMilestone(goalID, milestoneID int) error {
+	return execOne(`DELETE FROM goal_milestones WHERE goal_id = ? AND id = ?`, goalID, milestoneID)
+}
+
+// SetGamePlanTaskGoal attaches a task to a goal, or detaches it when goalID
+// is nil.
+func SetGamePlanTaskGoal(planID, taskID int, goalID *int) (GamePlanTask, error) {
+	if goalID != nil {
+		if _, err := GetGoal(*goalID); err != nil {
+			if errors.Is(err, ErrNotFound) {
+				return GamePlanTask{}, fmt.Errorf("%w: goal %d does not exist", ErrInvalidGoal, *goalID)
+			}
+			return GamePlanTask{}, err
+		}
+	}
+	if err := execOne(`UPDATE gameplan_tasks SET goal_id = ? WHERE game_plan_id = ? AND id = ?`, goalID, planID, taskID); err != nil {
+		return GamePlanTask{}, err
+	}
+	return GetGamePlanTask(planID, taskID)
+}
+
+// GetGoalTasks returns the game plan tasks linked to a goal, newest first.
+func GetGoalTasks(goalID int) ([]GamePlanTask, error) {
+	tasks, err := getGamePlanTasks(`SELECT `+gamePlanTaskColumns+` FROM gameplan_tasks WHERE goal_id = ? ORDER BY id DESC`, goalID)
+	if err != nil {
+		return nil, err
+	}
+	linked := []GamePlanTask{}
+	for _, planTasks := range tasks {
+		linked = append(linked, planTasks...)
+	}
+	// getGamePlanTasks groups by plan; restore newest-first across plans.
+	sort.Slice(linked, func(i, j int) bool { return linked[i].ID > linked[j].ID })
+	return linked, nil
+}
@@ -0,0 +1,90 @@
+package models
+
+import "testing"
+
+func TestGoalProgressWithTasksAndMilestones(t *testing.T) {
+	openTestDB(t)
+	goal, err := CreateGoal(Goal{
+		Title: "Run a 5k",
+		Milestones: []GoalMilestone{
+			{Title: "Run 1k", Completed: true},
+			{Title: "Run 3k"},
+			{Title: "Race day", TargetDate: "2024-06-01"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := CreateGoal(Goal{Title: "Sleep earlier"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (GoalProgress{Milestones: 3, CompletedMilestones: 1}); goal.Progress != want {
+		t.Errorf("progress without tasks = %+v, want %+v", goal.Progress, want)
+	}
+
+	planID, tasks := storeTestPlan(t, "Jog", "Stretch", "Buy shoes", "Lights out at 11")
+	for _, task := range tasks[:3] {
+		if _, err := SetGamePlanTaskGoal(planID, task.ID, &goal.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := SetGamePlanTaskGoal(planID, tasks[3].ID, &other.ID); err != nil {
+		t.Fatal(err)
+	}
+	// A completed task linked to another goal doesn't count.
+	for _, task := range []GamePlanTask{tasks[0], tasks[3]} {
+		if _, err := SetGamePlanTaskStatus(planID, task.ID, TaskStatusCompleted); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, m := range goal.Milestones {
+		if m.Title == "Run 3k" {
+			m.Completed = true
+			if _, err := UpdateMilestone(goal.ID, m.ID, m); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// The percentage comes from tasks alone; milestones are counted apart.
+	tests := []struct {
+		name string
+		want GoalProgress
+	}{
+		{"after one task", GoalProgress{LinkedTasks: 3, CompletedTasks: 1, Percent: 33, Milestones: 3, CompletedMilestones: 2}},
+		{"after two tasks", GoalProgress{LinkedTasks: 3, CompletedTasks: 2, Percent: 66, Milestones: 3, CompletedMilestones: 2}},
+		{"after detaching the open task", GoalProgress{LinkedTasks: 2, CompletedTasks: 2, Percent: 100, Milestones: 3, CompletedMilestones: 2}},
+	}
+	for i, tt := range tests {
+		switch i {
+		case 1:
+			if _, err := SetGamePlanTaskStatus(planID, tasks[1].ID, TaskStatusCompleted); err != nil {
+				t.Fatal(err)
+			}
+		case 2:
+			if _, err := SetGamePlanTaskGoal(planID, tasks[2].ID, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		got, err := GetGoal(goal.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Progress != tt.want {
+			t.Errorf("%s: progress = %+v, want %+v", tt.name, got.Progress, tt.want)
+		}
+	}
+
+	// ListGoals computes the same progress for every goal.
+	goals, err := ListGoals("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(goals) != 2 || goals[0].Progress != tests[2].want {
+		t.Fatalf("goals = %+v", goals)
+	}
+	if want := (GoalProgress{LinkedTasks: 1, CompletedTasks: 1, Percent: 100}); goals[1].Progress != want {
+		t.Errorf("other goal progress = %+v, want %+v", goals[1].Progress, want)
+	}
+}
@@ -0,0 +1,262 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DateLayout is the YYYY-MM-DD form used for habit dates.
+const DateLayout = "2006-01-02"
+
+// TimestampLayout is how scheduled times such as reminder runs and task due
+// times are stored: UTC, so that comparing them as text orders them in time.
+const TimestampLayout = "2006-01-02T15:04:05Z"
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+var rruleDays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// recurrence is the subset of RFC 5545 RRULE supported for habits: FREQ of
+// DAILY, WEEKLY or MONTHLY with INTERVAL, BYDAY (plain weekdays), BYMONTHDAY
+// and UNTIL. Occurrences are counted from the habit's start date.
+type recurrence struct {
+	freq       string
+	interval   int
+	byDay      map[time.Weekday]bool
+	byMonthDay map[int]bool
+	until      time.Time
+}
+
+// civilDate truncates t to midnight UTC of its calendar date, so day
+// arithmetic is not affected by time zones or daylight saving.
+func civilDate(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// ParseDate parses a YYYY-MM-DD date as a civil date.
+func ParseDate(s string) (time.Time, error) {
+	return time.Parse(DateLayout, s)
+}
+
+func parseRRule(rule string) (recurrence, error) {
+	r := recurrence{interval: 1}
+	rule = strings.TrimPrefix(strings.TrimSpace(rule), "RRULE:")
+	for _, part := range strings.Split(rule, ";") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return r, fmt.Errorf("malformed rrule part %q", part)
+		}
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			r.freq = strings.ToUpper(value)
+			if r.freq != "DAILY" && r.freq != "WEEKLY" && r.freq != "MONTHLY" {
+				return r, fmt.Errorf("unsupported rrule FREQ %q", value)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return r, fmt.Errorf("invalid rrule INTERVAL %q", value)
+			}
+			r.interval = n
+		case "BYDAY":
+			r.byDay = map[time.Weekday]bool{}
+			for _, d := range strings.Split(value, ",") {
+				wd, ok := rruleDays[strings.ToUpper(d)]
+				if !ok {
+					return r, fmt.Errorf("unsupported rrule BYDAY %q", d)
+				}
+				r.byDay[wd] = true
+			}
+		case "BYMONTHDAY":
+			r.byMonthDay = map[int]bool{}
+			for _, d := range strings.Split(value, ",") {
+				n, err := strconv.Atoi(d)
+				if err != nil || n < 1 || n > 31 {
+					return r, fmt.Errorf("unsupported rrule BYMONTHDAY %q", d)
+				}
+				r.byMonthDay[n] = true
+			}
+		case "UNTIL":
+			if len(value) < len("20060102") {
+				return r, fmt.Errorf("invalid rrule UNTIL %q", value)
+			}
+			until, err := time.Parse("20060102", value[:8])
+			if err != nil {
+				return r, fmt.Errorf("invalid rrule UNTIL %q", value)
+			}
+			r.until = until
+		default:
+			return r, fmt.Errorf("unsupported rrule part %q", key)
+		}
+	}
+	if r.freq == "" {
+		return r, errors.New("rrule needs FREQ")
+	}
+	return r, nil
+}
+
+// monthsBetween counts whole calendar months from a to b.
+func monthsBetween(a, b time.Time) int {
+	return (b.Year()-a.Year())*12 + int(b.Month()) - int(a.Month())
+}
+
+// weekStart returns the Monday of t's week.
+func weekStart(t time.Time) time.Time {
+	return t.AddDate(0, 0, -((int(t.Weekday()) + 6) % 7))
+}
+
+func (r recurrence) occursOn(day, start time.Time) bool {
+	if day.Before(start) || (!r.until.IsZero() && day.After(r.until)) {
+		return false
+	}
+	switch r.freq {
+	case "DAILY":
+		if int(day.Sub(start).Hours()/24)%r.interval != 0 {
+			return false
+		}
+		return r.byDay == nil || r.byDay[day.Weekday()]
+	case "WEEKLY":
+		weeks := int(weekStart(day).Sub(weekStart(start)).Hours() / (24 * 7))
+		if weeks%r.interval != 0 {
+			return false
+		}
+		if r.byDay == nil {
+			return day.Weekday() == start.Weekday()
+		}
+		return r.byDay[day.Weekday()]
+	case "MONTHLY":
+		if monthsBetween(start, day)%r.interval != 0 {
+			return false
+		}
+		if r.byDay != nil && !r.byDay[day.Weekday()] {
+			return false
+		}
+		if r.byMonthDay != nil {
+			return r.byMonthDay[day.Day()]
+		}
+		return r.byDay != nil || day.Day() == start.Day()
+	}
+	return false
+}
+
+// normalizeDaysOfWeek validates weekday names ("mon" or "Monday") and returns
+// them as three-letter lowercase names in week order.
+func normalizeDaysOfWeek(days []string) ([]string, error) {
+	set := map[time.Weekday]bool{}
+	for _, d := range days {
+		key := strings.ToLower(strings.TrimSpace(d))
+		if len(key) > 3 {
+			key = key[:3]
+		}
+		wd, ok := weekdayNames[key]
+		if !ok {
+			return nil, fmt.Errorf("unknown day of week %q", d)
+		}
+		set[wd] = true
+	}
+	var out []string
+	for _, wd := range []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday, time.Sunday} {
+		if set[wd] {
+			out = append(out, strings.ToLower(wd.String()[:3]))
+		}
+	}
+	return out, nil
+}
+
+// scheduledOn reports whether a schedule of normalized days of week or an
+// RRULE, starting on startDate, falls on the given day. Schedules with
+// neither occur every day. Habits and reminders share this.
+func scheduledOn(daysOfWeek []string, rrule, startDate string, day time.Time) bool {
+	day = civilDate(day)
+	start, err := ParseDate(startDate)
+	if err == nil && day.Before(start) {
+		return false
+	}
+	if rrule != "" {
+		r, err := parseRRule(rrule)
+		if err != nil {
+			return false
+		}
+		return r.occursOn(day, start)
+	}
+	if len(daysOfWeek) == 0 {
+		return true
+	}
+	today := strings.ToLower(day.Weekday().String()[:3])
+	for _, d := range daysOfWeek {
+		if d == today {
+			return true
+		}
+	}
+	return false
+}
+
+// DueOn reports whether the habit is scheduled on the given day. Habits
+// with neither days of week nor an RRULE are due every day.
+func (h Habit) DueOn(day time.Time) bool {
+	return scheduledOn(h.DaysOfWeek, h.RRule, h.StartDate, day)
+}
+
+// maxStreakDays bounds how far back streaks are computed.
+const maxStreakDays = 3 * 366
+
+// computeStreak walks due days from the start date to today. A due day
+// counts when its logged total reaches the target. The current streak is not
+// broken by today until the day is over.
+func computeStreak(h Habit, totals map[string]int, today time.Time) HabitStreak {
+	today = civilDate(today)
+	start, err := ParseDate(h.StartDate)
+	if err != nil || start.Before(today.AddDate(0, 0, -maxStreakDays)) {
+		start = today.AddDate(0, 0, -maxStreakDays)
+	}
+
+	var s HabitStreak
+	run := 0
+	for day := start; !day.After(today); day = day.AddDate(0, 0, 1) {
+		if !h.DueOn(day) {
+			continue
+		}
+		if totals[day.Format(DateLayout)] >= h.TargetCount {
+			run++
+			if run > s.Longest {
+				s.Longest = run
+			}
+			s.LastCompleted = day.Format(DateLayout)
+		} else if !day.Equal(today) {
+			run = 0
+		}
+	}
+	s.Current = run
+	return s
+}
+
+// RecurrenceDates returns the dates from..to (inclusive civil dates) on which
+// an RRULE starting on start occurs. Rules outside the supported subset
+// return an error.
+func RecurrenceDates(rule string, start, from, to time.Time) ([]time.Time, error) {
+	r, err := parseRRule(rule)
+	if err != nil {
+		return nil, err
+	}
+	start, from, to = civilDate(start), civilDate(from), civilDate(to)
+	if from.Before(start) {
+		from = start
+	}
+	var dates []time.Time
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		if r.occursOn(day, start) {
+			dates = append(dates, day)
+		}
+	}
+	return dates, nil
+}
@@ -0,0 +1,158 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustDate(t *testing.T, s string) time.Time {
+	t.Helper()
+	d, err := ParseDate(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func formatDates(dates []time.Time) string {
+	var out []string
+	for _, d := range dates {
+		out = append(out, d.Format(DateLayout))
+	}
+	return strings.Join(out, " ")
+}
+
+func TestRecurrenceDates(t *testing.T) {
+	tests := []struct {
+		name, rule, start, from, to, want string
+	}{
+		{"daily interval", "FREQ=DAILY;INTERVAL=3", "2024-03-01", "2024-03-01", "2024-03-10", "2024-03-01 2024-03-04 2024-03-07 2024-03-10"},
+		{"daily by day", "FREQ=DAILY;BYDAY=SA,SU", "2024-03-01", "2024-03-01", "2024-03-10", "2024-03-02 2024-03-03 2024-03-09 2024-03-10"},
+		// Fortnightly on Tuesday and Thursday, counting weeks from the week
+		// of the start date, which is a Wednesday.
+		{"weekly by day with interval", "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU,TH", "2024-03-06", "2024-03-04", "2024-03-31", "2024-03-07 2024-03-19 2024-03-21"},
+		{"weekly on the start weekday", "FREQ=WEEKLY", "2024-03-06", "2024-03-01", "2024-03-20", "2024-03-06 2024-03-13 2024-03-20"},
+		{"monthly by month day", "FREQ=MONTHLY;BYMONTHDAY=1,15", "2024-01-10", "2024-01-01", "2024-02-29", "2024-01-15 2024-02-01 2024-02-15"},
+		{"monthly on the start day", "FREQ=MONTHLY;INTERVAL=2", "2024-01-31", "2024-01-01", "2024-07-31", "2024-01-31 2024-03-31 2024-05-31 2024-07-31"},
+		{"until", "RRULE:FREQ=DAILY;UNTIL=20240303T000000Z", "2024-03-01", "2024-03-01", "2024-03-10", "2024-03-01 2024-03-02 2024-03-03"},
+		// Europe switches to summer time on 2024-03-31 and back on
+		// 2024-10-27; every other day still lands on the right dates.
+		{"daily across daylight saving", "FREQ=DAILY;INTERVAL=2", "2024-03-29", "2024-03-29", "2024-04-02", "2024-03-29 2024-03-31 2024-04-02"},
+		{"weekly across daylight saving", "FREQ=WEEKLY;BYDAY=SU", "2024-10-01", "2024-10-20", "2024-11-03", "2024-10-20 2024-10-27 2024-11-03"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dates, err := RecurrenceDates(tt.rule, mustDate(t, tt.start), mustDate(t, tt.from), mustDate(t, tt.to))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := formatDates(dates); got != tt.want {
+				t.Errorf("dates = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRRuleRejectsUnsupportedRules(t *testing.T) {
+	for _, rule := range []string{
+		"",
+		"INTERVAL=2",
+		"FREQ=YEARLY",
+		"FREQ=DAILY;INTERVAL=0",
+		"FREQ=WEEKLY;BYDAY=1MO",
+		"FREQ=MONTHLY;BYMONTHDAY=32",
+		"FREQ=DAILY;COUNT=3",
+		"FREQ=DAILY;UNTIL=2024",
+	} {
+		if _, err := parseRRule(rule); err == nil {
+			t.Errorf("parseRRule(%q) succeeded", rule)
+		}
+	}
+}
+
+func TestDueOnInLocalTime(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+	h := Habit{RRule: "FREQ=DAILY;INTERVAL=2", StartDate: "2024-03-29"}
+	// Late evening on the days the clocks change is still the local date,
+	// although it is a different date or offset in UTC.
+	for _, tt := range []struct {
+		at  time.Time
+		due bool
+	}{
+		{time.Date(2024, 3, 31, 23, 30, 0, 0, berlin), true},
+		{time.Date(2024, 4, 1, 0, 30, 0, 0, berlin), false},
+		{time.Date(2024, 10, 27, 2, 30, 0, 0, berlin), true},
+		{time.Date(2024, 10, 28, 0, 15, 0, 0, berlin), false},
+	} {
+		if got := h.DueOn(tt.at); got != tt.due {
+			t.Errorf("DueOn(%s) = %v, want %v", tt.at, got, tt.due)
+		}
+	}
+}
+
+func TestComputeStreak(t *testing.T) {
+	// Due on Monday, Wednesday and Friday; 2024-03-04 is a Monday.
+	h := Habit{DaysOfWeek: []string{"mon", "wed", "fri"}, TargetCount: 2, StartDate: "2024-03-04"}
+	tests := []struct {
+		name   string
+		totals map[string]int
+		today  string
+		want   HabitStreak
+	}{
+		{
+			name:   "skips unscheduled days",
+			totals: map[string]int{"2024-03-04": 2, "2024-03-06": 2, "2024-03-08": 3, "2024-03-11": 2},
+			today:  "2024-03-12",
+			want:   HabitStreak{Current: 4, Longest: 4, LastCompleted: "2024-03-11"},
+		},
+		{
+			name:   "below target breaks the streak",
+			totals: map[string]int{"2024-03-04": 2, "2024-03-06": 1, "2024-03-08": 2, "2024-03-11": 2},
+			today:  "2024-03-11",
+			want:   HabitStreak{Current: 2, Longest: 2, LastCompleted: "2024-03-11"},
+		},
+		{
+			name:   "today is not over yet",
+			totals: map[string]int{"2024-03-04": 2, "2024-03-06": 2},
+			today:  "2024-03-08",
+			want:   HabitStreak{Current: 2, Longest: 2, LastCompleted: "2024-03-06"},
+		},
+		{
+			name:   "a missed due day ends the current streak",
+			totals: map[string]int{"2024-03-04": 2, "2024-03-06": 2, "2024-03-08": 2},
+			today:  "2024-03-12",
+			want:   HabitStreak{Current: 0, Longest: 3, LastCompleted: "2024-03-08"},
+		},
+		{
+			name:   "logs on unscheduled days do not count",
+			totals: map[string]int{"2024-03-05": 2, "2024-03-07": 2},
+			today:  "2024-03-08",
+			want:   HabitStreak{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := computeStreak(h, tt.totals, mustDate(t, tt.today)); got != tt.want {
+				t.Errorf("streak = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestComputeStreakWithRRuleAcrossDaylightSaving(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+	h := Habit{RRule: "FREQ=WEEKLY;INTERVAL=2;BYDAY=SA,SU", TargetCount: 1, StartDate: "2024-03-16"}
+	totals := map[string]int{"2024-03-16": 1, "2024-03-17": 1, "2024-03-30": 1, "2024-03-31": 1}
+	today := time.Date(2024, 4, 1, 0, 30, 0, 0, berlin)
+	want := HabitStreak{Current: 4, Longest: 4, LastCompleted: "2024-03-31"}
+	if got := computeStreak(h, totals, today); got != want {
+		t.Errorf("streak = %+v, want %+v", got, want)
+	}
+}
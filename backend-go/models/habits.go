@@ -0,0 +1,340 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"mindful/backend-go/database"
+	"strings"
+	"time"
+)
+
+// Habit is a recurring self-care activity. It is scheduled either on
+// DaysOfWeek or by an RRULE, or every day if neither is set, and is done for
+// a day once TargetCount completions have been logged.
+type Habit struct {
+	ID           int          `json:"id"`
+	Name         string       `json:"name"`
+	DaysOfWeek   []string     `json:"days_of_week,omitempty"`
+	RRule        string       `json:"rrule,omitempty"`
+	TargetCount  int          `json:"target_count"`
+	StartDate    string       `json:"start_date"`
+	SourceTaskID *int         `json:"source_task_id,omitempty"`
+	CreatedAt    string       `json:"created_at"`
+	UpdatedAt    string       `json:"updated_at,omitempty"`
+	Streak       *HabitStreak `json:"streak,omitempty"`
+}
+
+type HabitStreak struct {
+	Current       int    `json:"current"`
+	Longest       int    `json:"longest"`
+	LastCompleted string `json:"last_completed,omitempty"`
+}
+
+type HabitLog struct {
+	ID        int    `json:"id"`
+	HabitID   int    `json:"habit_id"`
+	Date      string `json:"date"`
+	Count     int    `json:"count"`
+	Note      string `json:"note,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
+
+// HabitDay is a habit's status on one day, as shown by GET /habits/today.
+type HabitDay struct {
+	Habit     Habit  `json:"habit"`
+	Date      string `json:"date"`
+	Due       bool   `json:"due"`
+	Completed int    `json:"completed"`
+	Done      bool   `json:"done"`
+}
+
+var (
+	ErrInvalidHabit        = errors.New("invalid habit")
+	ErrTaskAlreadyPromoted = errors.New("task already promoted to a habit")
+)
+
+// validateHabit checks and normalizes a habit before it is stored.
+func validateHabit(h *Habit) error {
+	h.Name = strings.TrimSpace(h.Name)
+	if h.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidHabit)
+	}
+	if h.TargetCount == 0 {
+		h.TargetCount = 1
+	}
+	if h.TargetCount < 0 {
+		return fmt.Errorf("%w: target_count must be positive", ErrInvalidHabit)
+	}
+	if h.RRule != "" && len(h.DaysOfWeek) > 0 {
+		return fmt.Errorf("%w: set either days_of_week or rrule, not both", ErrInvalidHabit)
+	}
+	if h.RRule != "" {
+		if _, err := parseRRule(h.RRule); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidHabit, err)
+		}
+	}
+	days, err := normalizeDaysOfWeek(h.DaysOfWeek)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidHabit, err)
+	}
+	h.DaysOfWeek = days
+	if h.StartDate == "" {
+		h.StartDate = time.Now().Format(DateLayout)
+	} else if _, err := ParseDate(h.StartDate); err != nil {
+		return fmt.Errorf("%w: start_date must be YYYY-MM-DD", ErrInvalidHabit)
+	}
+	return nil
+}
+
+// CreateHabit validates and stores a habit and returns it.
+func CreateHabit(h Habit) (Habit, error) {
+	if err := validateHabit(&h); err != nil {
+		return Habit{}, err
+	}
+	result, err := database.DB.Exec(`INSERT INTO habits (name, days_of_week, rrule, target_count, start_date, source_task_id)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		h.Name, strings.Join(h.DaysOfWeek, ","), h.RRule, h.TargetCount, h.StartDate, h.SourceTaskID)
+	if err != nil {
+		return Habit{}, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return Habit{}, err
+	}
+	return GetHabit(int(id))
+}
+
+// UpdateHabit replaces a habit's name, schedule and target. Its logs, the
+// task it was promoted from and, unless given, its start date are kept.
+func UpdateHabit(id int, h Habit) (Habit, error) {
+	if h.StartDate == "" {
+		current, err := GetHabit(id)
+		if err != nil {
+			return Habit{}, err
+		}
+		h.StartDate = current.StartDate
+	}
+	if err := validateHabit(&h); err != nil {
+		return Habit{}, err
+	}
+	err := execOne(`UPDATE habits SET name = ?, days_of_week = ?, rrule = ?, target_count = ?, start_date = ?,
+		updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		h.Name, strings.Join(h.DaysOfWeek, ","), h.RRule, h.TargetCount, h.StartDate, id)
+	if err != nil {
+		return Habit{}, err
+	}
+	return GetHabit(id)
+}
+
+const habitColumns = `id, name, days_of_week, rrule, target_count, start_date, source_task_id, created_at, updated_at`
+
+func scanHabit(row rowScanner) (Habit, error) {
+	var h Habit
+	var days string
+	var sourceTask sql.NullInt64
+	var updatedAt sql.NullString
+	err := row.Scan(&h.ID, &h.Name, &days, &h.RRule, &h.TargetCount, &h.StartDate, &sourceTask, &h.CreatedAt, &updatedAt)
+	if err != nil {
+		return Habit{}, err
+	}
+	if days != "" {
+		h.DaysOfWeek = strings.Split(days, ",")
+	}
+	if sourceTask.Valid {
+		id := int(sourceTask.Int64)
+		h.SourceTaskID = &id
+	}
+	h.UpdatedAt = updatedAt.String
+	return h, nil
+}
+
+func GetHabit(id int) (Habit, error) {
+	h, err := scanHabit(database.DB.QueryRow(`SELECT `+habitColumns+` FROM habits WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Habit{}, ErrNotFound
+	}
+	return h, err
+}
+
+func GetAllHabits() ([]Habit, error) {
+	rows, err := database.DB.Query(`SELECT ` + habitColumns + ` FROM habits ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	habits := []Habit{}
+	for rows.Next() {
+		h, err := scanHabit(rows)
+		if err != nil {
+			return nil, err
+		}
+		habits = append(habits, h)
+	}
+	return habits, rows.Err()
+}
+
+// DeleteHabit removes a habit and its logs in one transaction.
+func DeleteHabit(id int) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := execOneIn(tx, `DELETE FROM habits WHERE id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM habit_logs WHERE habit_id = ?`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// LogHabit records completions of a habit on a date (YYYY-MM-DD).
+func LogHabit(habitID int, date string, count int, note string) (HabitLog, error) {
+	if _, err := ParseDate(date); err != nil {
+		return HabitLog{}, fmt.Errorf("%w: date must be YYYY-MM-DD", ErrInvalidHabit)
+	}
+	if count < 1 {
+		return HabitLog{}, fmt.Errorf("%w: count must be positive", ErrInvalidHabit)
+	}
+	if _, err := GetHabit(habitID); err != nil {
+		return HabitLog{}, err
+	}
+
+	result, err := database.DB.Exec(`INSERT INTO habit_logs (habit_id, log_date, count, note) VALUES (?, ?, ?, ?)`,
+		habitID, date, count, note)
+	if err != nil {
+		return HabitLog{}, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return HabitLog{}, err
+	}
+	var l HabitLog
+	err = database.DB.QueryRow(`SELECT id, habit_id, log_date, count, note, created_at FROM habit_logs WHERE id = ?`, id).
+		Scan(&l.ID, &l.HabitID, &l.Date, &l.Count, &l.Note, &l.CreatedAt)
+	return l, err
+}
+
+// GetHabitLogs returns a habit's logs between from and to (inclusive
+// YYYY-MM-DD dates, either may be empty), newest first.
+func GetHabitLogs(habitID int, from, to string) ([]HabitLog, error) {
+	query := `SELECT id, habit_id, log_date, count, note, created_at FROM habit_logs WHERE habit_id = ?`
+	args := []interface{}{habitID}
+	if from != "" {
+		query += ` AND log_date >= ?`
+		args = append(args, from)
+	}
+	if to != "" {
+		query += ` AND log_date <= ?`
+		args = append(args, to)
+	}
+	rows, err := database.DB.Query(query+` ORDER BY log_date DESC, id DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	logs := []HabitLog{}
+	for rows.Next() {
+		var l HabitLog
+		if err := rows.Scan(&l.ID, &l.HabitID, &l.Date, &l.Count, &l.Note, &l.CreatedAt); err != nil {
+			return nil, err
+		}
+		logs = append(logs, l)
+	}
+	return logs, rows.Err()
+}
+
+func DeleteHabitLog(habitID, logID int) error {
+	return execOne(`DELETE FROM habit_logs WHERE id = ? AND habit_id = ?`, logID, habitID)
+}
+
+// habitTotals returns the completions logged per date for every habit.
+func habitTotals() (map[int]map[string]int, error) {
+	rows, err := database.DB.Query(`SELECT habit_id, log_date, SUM(count) FROM habit_logs GROUP BY habit_id, log_date`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	totals := map[int]map[string]int{}
+	for rows.Next() {
+		var habitID, count int
+		var date string
+		if err := rows.Scan(&habitID, &date, &count); err != nil {
+			return nil, err
+		}
+		if totals[habitID] == nil {
+			totals[habitID] = map[string]int{}
+		}
+		totals[habitID][date] = count
+	}
+	return totals, rows.Err()
+}
+
+// WithStreaks fills in the current and longest streak of each habit as of today.
+func WithStreaks(habits []Habit, today time.Time) ([]Habit, error) {
+	totals, err := habitTotals()
+	if err != nil {
+		return nil, err
+	}
+	for i := range habits {
+		streak := computeStreak(habits[i], totals[habits[i].ID], today)
+		habits[i].Streak = &streak
+	}
+	return habits, nil
+}
+
+// GetHabitDay returns every habit's status on day, due habits first.
+func GetHabitDay(day time.Time) ([]HabitDay, error) {
+	habits, err := GetAllHabits()
+	if err != nil {
+		return nil, err
+	}
+	if habits, err = WithStreaks(habits, day); err != nil {
+		return nil, err
+	}
+	totals, err := habitTotals()
+	if err != nil {
+		return nil, err
+	}
+
+	date := day.Format(DateLayout)
+	var due, notDue []HabitDay
+	for _, h := range habits {
+		d := HabitDay{Habit: h, Date: date, Due: h.DueOn(day), Completed: totals[h.ID][date]}
+		d.Done = d.Completed >= h.TargetCount
+		if d.Due {
+			due = append(due, d)
+		} else {
+			notDue = append(notDue, d)
+		}
+	}
+	return append(append([]HabitDay{}, due...), notDue...), nil
+}
+
+// PromoteTaskToHabit turns a game plan task into a recurring habit named
+// after it. A task can only be promoted once.
+func PromoteTaskToHabit(planID, taskID int, h Habit) (Habit, error) {
+	task, err := GetGamePlanTask(planID, taskID)
+	if err != nil {
+		return Habit{}, err
+	}
+	var existing int
+	if err := database.DB.QueryRow(`SELECT COUNT(*) FROM habits WHERE source_task_id = ?`, task.ID).Scan(&existing); err != nil {
+		return Habit{}, err
+	}
+	if existing > 0 {
+		return Habit{}, ErrTaskAlreadyPromoted
+	}
+
+	if strings.TrimSpace(h.Name) == "" {
+		h.Name = task.Description
+	}
+	h.SourceTaskID = &task.ID
+	return CreateHabit(h)
+}
@@ -0,0 +1,123 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"mindful/backend-go/database"
+)
+
+// JournalRevision is a previous version of a journal entry. ValidFrom is when
+// that version was written and ReplacedAt when it was superseded.
+type JournalRevision struct {
+	ID             int    `json:"id"`
+	JournalID      int    `json:"journal_id"`
+	Title          string `json:"title,omitempty"`
+	Content        string `json:"content"`
+	EmotionalState string `json:"emotional_state,omitempty"`
+	ValidFrom      string `json:"valid_from"`
+	ReplacedAt     string `json:"replaced_at"`
+}
+
+// UpdateJournalEntry replaces an entry's content, title, metadata and tags,
+// first saving the current title and content as a revision. The emotional
+// state is cleared until re-analyzed.
+func UpdateJournalEntry(id int, j Journal) (Journal, error) {
+	if err := validateJournal(j); err != nil {
+		return Journal{}, err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return Journal{}, err
+	}
+	defer tx.Rollback()
+
+	current, err := scanJournal(tx.QueryRow(`SELECT `+journalColumns+` FROM journal_entries WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Journal{}, ErrNotFound
+	}
+	if err != nil {
+		return Journal{}, err
+	}
+
+	validFrom := current.UpdatedAt
+	if validFrom == "" {
+		validFrom = current.CreatedAt
+	}
+	_, err = tx.Exec(`INSERT INTO journal_revisions (journal_id, title, content, emotional_state, valid_from) VALUES (?, ?, ?, ?, ?)`,
+		id, nullString(current.Title), current.Content, current.EmotionalState, validFrom)
+	if err != nil {
+		return Journal{}, err
+	}
+
+	_, err = tx.Exec(`UPDATE journal_entries SET title = ?, content = ?, location = ?, mood_intensity = ?,
+		emotional_state = NULL, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		nullString(j.Title), j.Content, nullString(j.Location), j.MoodIntensity, id)
+	if err != nil {
+		return Journal{}, err
+	}
+	if err := setJournalTags(tx, id, j.Tags); err != nil {
+		return Journal{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Journal{}, err
+	}
+
+	updated, err := GetJournalEntry(id)
+	if err != nil {
+		return Journal{}, err
+	}
+	if err := IndexJournal(updated); err != nil {
+		log.Printf("Error indexing journal entry %d: %v", id, err)
+	}
+	return updated, nil
+}
+
+// SetJournalEmotionalState stores the result of emotion analysis of content.
+// It is a no-op if the entry has been edited since content was analyzed.
+func SetJournalEmotionalState(id int, content, emotionalState string) error {
+	_, err := database.DB.Exec(`UPDATE journal_entries SET emotional_state = ? WHERE id = ? AND content = ?`, emotionalState, id, content)
+	return err
+}
+
+// GetJournalRevisions returns an entry's previous versions, newest first.
+func GetJournalRevisions(journalID int) ([]JournalRevision, error) {
+	rows, err := database.DB.Query(`SELECT id, journal_id, COALESCE(title, ''), content, COALESCE(emotional_state, ''), valid_from, replaced_at
+		FROM journal_revisions WHERE journal_id = ? ORDER BY id DESC`, journalID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []JournalRevision{}
+	for rows.Next() {
+		var r JournalRevision
+		var validFrom sql.NullString
+		if err := rows.Scan(&r.ID, &r.JournalID, &r.Title, &r.Content, &r.EmotionalState, &validFrom, &r.ReplacedAt); err != nil {
+			return nil, err
+		}
+		r.ValidFrom = validFrom.String
+		revisions = append(revisions, r)
+	}
+	return revisions, rows.Err()
+}
+
+// RestoreJournalRevision makes a previous title and content current again,
+// keeping the entry's metadata and tags. The version being replaced is itself
+// kept as a new revision.
+func RestoreJournalRevision(journalID, revisionID int) (Journal, error) {
+	current, err := GetJournalEntry(journalID)
+	if err != nil {
+		return Journal{}, err
+	}
+	err = database.DB.QueryRow(`SELECT COALESCE(title, ''), content FROM journal_revisions WHERE id = ? AND journal_id = ?`,
+		revisionID, journalID).Scan(&current.Title, &current.Content)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Journal{}, ErrNotFound
+	}
+	if err != nil {
+		return Journal{}, err
+	}
+	return UpdateJournalEntry(journalID, current)
+}
@@ -1,19 +1,63 @@
 package models
 
 import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"mindful/backend-go/database"
 )
 
+// ErrNotFound is returned when a lookup or delete matches no rows.
+var ErrNotFound = errors.New("record not found")
+
 type Journal struct {
-	ID      int    `json:"id"`
-	Content string `json:"content"`
+	ID             int      `json:"id"`
+	Title          string   `json:"title,omitempty"`
+	Content        string   `json:"content"`
+	Tags           []string `json:"tags"`
+	Location       string   `json:"location,omitempty"`
+	MoodIntensity  *int     `json:"mood_intensity,omitempty"`
+	PromptID       string   `json:"prompt_id,omitempty"`
+	EmotionalState string   `json:"emotional_state,omitempty"`
+	CreatedAt      string   `json:"created_at"`
+	UpdatedAt      string   `json:"updated_at,omitempty"`
+}
+
+// JournalFilter narrows a journal listing. Empty fields match everything;
+// From and To are inclusive YYYY-MM-DD dates.
+type JournalFilter struct {
+	Tag     string
+	From    string
+	To      string
+	Emotion string
+}
+
+// ErrInvalidMoodIntensity is returned when a self-rated mood intensity is
+// outside MinMoodIntensity..MaxMoodIntensity.
+var ErrInvalidMoodIntensity = fmt.Errorf("mood_intensity must be between %d and %d", MinMoodIntensity, MaxMoodIntensity)
+
+const (
+	MinMoodIntensity = 1
+	MaxMoodIntensity = 10
+)
+
+func validateJournal(j Journal) error {
+	if j.MoodIntensity != nil && (*j.MoodIntensity < MinMoodIntensity || *j.MoodIntensity > MaxMoodIntensity) {
+		return ErrInvalidMoodIntensity
+	}
+	return nil
 }
 
 type GamePlan struct {
-	ID        int    `json:"id"`
-	Tasks     string `json:"tasks"`
-	Summary   string `json:"summary"`
-	CreatedAt string `json:"created_at"`
+	ID             int            `json:"id"`
+	Tasks          string         `json:"tasks"`
+	Summary        string         `json:"summary"`
+	EmotionalState string         `json:"emotional_state"`
+	CreatedAt      string         `json:"created_at"`
+	TaskItems      []GamePlanTask `json:"task_items,omitempty"`
+	Citations      []Citation     `json:"citations,omitempty"`
 }
 
 type JournalEntry struct {
@@ -24,20 +68,127 @@ type JournalEntry struct {
 }
 
 type Transcript struct {
-	ID         int    `json:"id"`
-	SessionID  string `json:"session_id"`
-	Transcript string `json:"transcript"`
-	CreatedAt  string `json:"created_at"`
+	ID         int              `json:"id"`
+	SessionID  string           `json:"session_id"`
+	Transcript string           `json:"transcript"`
+	Turns      []TranscriptTurn `json:"turns,omitempty"`
+	CreatedAt  string           `json:"created_at"`
 }
 
-func StoreJournalEntry(content string) error {
-	query := `INSERT INTO journals (content) VALUES (?)`
-	_, err := database.DB.Exec(query, content)
-	return err
+// StoreJournalEntry saves a journal entry with its metadata and tags and
+// returns its ID.
+func StoreJournalEntry(j Journal) (int, error) {
+	if err := validateJournal(j); err != nil {
+		return 0, err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO journal_entries (content, title, location, mood_intensity, prompt_id) VALUES (?, ?, ?, ?, ?)`
+	result, err := tx.Exec(query, j.Content, nullString(j.Title), nullString(j.Location), j.MoodIntensity, nullString(j.PromptID))
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if err := setJournalTags(tx, int(id), j.Tags); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	j.ID = int(id)
+	if err := IndexJournal(j); err != nil {
+		log.Printf("Error indexing journal entry %d: %v", id, err)
+	}
+	return int(id), nil
+}
+
+// nullString stores empty optional text as NULL.
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+const journalColumns = `id, COALESCE(title, ''), content, COALESCE(location, ''), mood_intensity, COALESCE(prompt_id, ''),
+	COALESCE(emotional_state, ''), created_at, updated_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanJournal(row rowScanner) (Journal, error) {
+	var journal Journal
+	var moodIntensity sql.NullInt64
+	var updatedAt sql.NullString
+	err := row.Scan(&journal.ID, &journal.Title, &journal.Content, &journal.Location, &moodIntensity, &journal.PromptID,
+		&journal.EmotionalState, &journal.CreatedAt, &updatedAt)
+	if err != nil {
+		return Journal{}, err
+	}
+	if moodIntensity.Valid {
+		n := int(moodIntensity.Int64)
+		journal.MoodIntensity = &n
+	}
+	journal.UpdatedAt = updatedAt.String
+	journal.Tags = []string{}
+	return journal, nil
+}
+
+func GetJournalEntry(id int) (Journal, error) {
+	journal, err := scanJournal(database.DB.QueryRow(`SELECT `+journalColumns+` FROM journal_entries WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Journal{}, ErrNotFound
+	}
+	if err != nil {
+		return Journal{}, err
+	}
+	tags, err := getJournalTags(`WHERE jt.journal_id = ?`, id)
+	if err != nil {
+		return Journal{}, err
+	}
+	if t, ok := tags[id]; ok {
+		journal.Tags = t
+	}
+	return journal, nil
 }
 
 func GetAllJournalEntries() ([]Journal, error) {
-	rows, err := database.DB.Query(`SELECT id, content FROM journals`)
+	return ListJournalEntries(JournalFilter{})
+}
+
+// ListJournalEntries returns the journal entries matching f, oldest first.
+func ListJournalEntries(f JournalFilter) ([]Journal, error) {
+	where := `WHERE 1 = 1`
+	var args []interface{}
+	if f.Tag != "" {
+		where += ` AND id IN (SELECT jt.journal_id FROM journal_tags jt JOIN tags t ON t.id = jt.tag_id WHERE t.name = ?)`
+		args = append(args, normalizeTag(f.Tag))
+	}
+	if f.From != "" {
+		where += ` AND date(created_at) >= date(?)`
+		args = append(args, f.From)
+	}
+	if f.To != "" {
+		where += ` AND date(created_at) <= date(?)`
+		args = append(args, f.To)
+	}
+	if f.Emotion != "" {
+		where += ` AND LOWER(emotional_state) = LOWER(?)`
+		args = append(args, f.Emotion)
+	}
+
+	rows, err := database.DB.Query(`SELECT `+journalColumns+` FROM journal_entries `+where+` ORDER BY id`, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -45,29 +196,89 @@ func GetAllJournalEntries() ([]Journal, error) {
 
 	var journals []Journal
 	for rows.Next() {
-		var journal Journal
-		if err := rows.Scan(&journal.ID, &journal.Content); err != nil {
+		journal, err := scanJournal(rows)
+		if err != nil {
 			return nil, err
 		}
 		journals = append(journals, journal)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	tags, err := getJournalTags(``)
+	if err != nil {
+		return nil, err
+	}
+	for i := range journals {
+		if t, ok := tags[journals[i].ID]; ok {
+			journals[i].Tags = t
+		}
+	}
 	return journals, nil
 }
 
-func StoreGamePlan(tasks []string, summary string, emotionalState string) error {
+// StoreGamePlan saves a generated plan, its tasks and the records cited while
+// generating it, and returns the new plan's ID.
+func StoreGamePlan(tasks []PlannedTask, summary string, emotionalState string, citations []Citation) (int, error) {
 	// Convert tasks slice to a single string
 	tasksText := ""
 	for _, task := range tasks {
-		tasksText += task + "\n"
+		tasksText += task.Description + "\n"
+	}
+
+	citationsJSON, err := json.Marshal(citations)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO game_plans (tasks, summary, emotional_state, citations) VALUES (?, ?, ?, ?)`
+	result, err := tx.Exec(query, tasksText, summary, emotionalState, string(citationsJSON))
+	if err != nil {
+		return 0, err
+	}
+	planID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	for i, task := range tasks {
+		sources, err := json.Marshal(task.Sources)
+		if err != nil {
+			return 0, err
+		}
+		_, err = tx.Exec(`INSERT INTO gameplan_tasks (game_plan_id, position, description, sources, goal_id) VALUES (?, ?, ?, ?, ?)`,
+			planID, i, task.Description, string(sources), task.GoalID)
+		if err != nil {
+			return 0, err
+		}
 	}
+	return int(planID), tx.Commit()
+}
+
+const gamePlanColumns = `id, tasks, summary, COALESCE(emotional_state, ''), created_at, COALESCE(citations, '')`
 
-	query := `INSERT INTO game_plans (tasks, summary, emotional_state) VALUES (?, ?, ?)`
-	_, err := database.DB.Exec(query, tasksText, summary, emotionalState)
-	return err
+func scanGamePlan(row rowScanner) (GamePlan, error) {
+	var gamePlan GamePlan
+	var citations string
+	if err := row.Scan(&gamePlan.ID, &gamePlan.Tasks, &gamePlan.Summary, &gamePlan.EmotionalState, &gamePlan.CreatedAt, &citations); err != nil {
+		return GamePlan{}, err
+	}
+	if citations != "" {
+		json.Unmarshal([]byte(citations), &gamePlan.Citations)
+	}
+	return gamePlan, nil
 }
 
 func GetAllGamePlans() ([]GamePlan, error) {
-	rows, err := database.DB.Query(`SELECT id, tasks, summary, emotional_state FROM game_plans`)
+	rows, err := database.DB.Query(`SELECT ` + gamePlanColumns + ` FROM game_plans`)
 	if err != nil {
 		return nil, err
 	}
@@ -75,11 +286,20 @@ func GetAllGamePlans() ([]GamePlan, error) {
 
 	var gamePlans []GamePlan
 	for rows.Next() {
-		var gamePlan GamePlan
-		if err := rows.Scan(&gamePlan.ID, &gamePlan.Tasks, &gamePlan.Summary, &gamePlan.CreatedAt); err != nil {
+		gamePlan, err := scanGamePlan(rows)
+		if err != nil {
 			return nil, err
 		}
 		gamePlans = append(gamePlans, gamePlan)
 	}
+	rows.Close()
+
+	tasks, err := getGamePlanTasks(`SELECT ` + gamePlanTaskColumns + ` FROM gameplan_tasks ORDER BY game_plan_id, position`)
+	if err != nil {
+		return nil, err
+	}
+	for i := range gamePlans {
+		gamePlans[i].TaskItems = tasks[gamePlans[i].ID]
+	}
 	return gamePlans, nil
 }
@@ -0,0 +1,143 @@
+package models
+
+import (
+	"errors"
+	"mindful/backend-go/database"
+	"testing"
+	"time"
+)
+
+// openTestDB creates a fresh database in a temporary directory and makes it
+// the working directory for the rest of the test.
+func openTestDB(t *testing.T) {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	database.InitDB()
+	InitDatabase(database.DB)
+	t.Cleanup(func() { database.DB.Close() })
+}
+
+func TestGamePlanDates(t *testing.T) {
+	openTestDB(t)
+	for _, state := range []string{"Anxious", "Calm"} {
+		if _, err := StoreGamePlan([]PlannedTask{{Description: "Take a walk"}}, "Summary", state, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	plans, err := GetAllGamePlans()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plans) != 2 {
+		t.Fatalf("got %d plans, want 2", len(plans))
+	}
+	latest, err := GetLatestGamePlan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range append(plans, latest) {
+		if _, err := time.Parse(time.RFC3339, p.CreatedAt); err != nil {
+			t.Errorf("plan %d created_at = %q: %v", p.ID, p.CreatedAt, err)
+		}
+	}
+	if plans[0].EmotionalState != "Anxious" || plans[1].EmotionalState != "Calm" {
+		t.Errorf("emotional states = %q, %q", plans[0].EmotionalState, plans[1].EmotionalState)
+	}
+	if latest.ID != plans[1].ID || latest.EmotionalState != "Calm" || len(latest.TaskItems) != 1 {
+		t.Errorf("latest plan = %+v", latest)
+	}
+}
+
+func TestDeleteJournalEntry(t *testing.T) {
+	openTestDB(t)
+	id, err := StoreJournalEntry(Journal{Content: "First draft", Tags: []string{"work"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := UpdateJournalEntry(id, Journal{Content: "Second draft", Tags: []string{"work"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := DeleteJournalEntry(id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetJournalEntry(id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("loading the entry: %v, want ErrNotFound", err)
+	}
+	if revisions, err := GetJournalRevisions(id); err != nil || len(revisions) != 0 {
+		t.Errorf("entry has %d revisions left: %v", len(revisions), err)
+	}
+	var tags int
+	if err := database.DB.QueryRow(`SELECT COUNT(*) FROM journal_tags WHERE journal_id = ?`, id).Scan(&tags); err != nil || tags != 0 {
+		t.Errorf("entry has %d tag links left: %v", tags, err)
+	}
+	if err := DeleteJournalEntry(id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("deleting again: %v, want ErrNotFound", err)
+	}
+}
+
+func TestUpdateJournalEntryWhenIndexingFails(t *testing.T) {
+	openTestDB(t)
+	id, err := StoreJournalEntry(Journal{Content: "First draft"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Drop the search index, which only exists in builds with FTS5, so
+	// every index write fails either way.
+	if _, err := database.DB.Exec(`DROP TABLE IF EXISTS search_index`); err != nil {
+		t.Fatal(err)
+	}
+	enabled := database.SearchEnabled
+	database.SearchEnabled = true
+	t.Cleanup(func() { database.SearchEnabled = enabled })
+
+	updated, err := UpdateJournalEntry(id, Journal{Content: "Second draft"})
+	if err != nil {
+		t.Fatalf("updating with a broken search index: %v", err)
+	}
+	if updated.ID != id || updated.Content != "Second draft" {
+		t.Errorf("updated entry = %+v", updated)
+	}
+}
+
+func TestDeleteGamePlan(t *testing.T) {
+	openTestDB(t)
+	id, err := StoreGamePlan([]PlannedTask{{Description: "Take a walk"}, {Description: "Call a friend"}}, "Summary", "Calm", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := DeleteGamePlan(id); err != nil {
+		t.Fatal(err)
+	}
+	var tasks int
+	if err := database.DB.QueryRow(`SELECT COUNT(*) FROM gameplan_tasks WHERE game_plan_id = ?`, id).Scan(&tasks); err != nil || tasks != 0 {
+		t.Errorf("plan has %d tasks left: %v", tasks, err)
+	}
+	if err := DeleteGamePlan(id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("deleting again: %v, want ErrNotFound", err)
+	}
+}
+
+func TestDeleteHabit(t *testing.T) {
+	openTestDB(t)
+	h, err := CreateHabit(Habit{Name: "Walk", StartDate: "2024-03-04"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LogHabit(h.ID, "2024-03-04", 1, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := DeleteHabit(h.ID); err != nil {
+		t.Fatal(err)
+	}
+	var logs int
+	if err := database.DB.QueryRow(`SELECT COUNT(*) FROM habit_logs WHERE habit_id = ?`, h.ID).Scan(&logs); err != nil || logs != 0 {
+		t.Errorf("habit has %d logs left: %v", logs, err)
+	}
+	if err := DeleteHabit(h.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("deleting again: %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,129 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"mindful/backend-go/database"
+)
+
+// Notification is a message sent to the user, for example by a reminder.
+// Only notifications delivered in-app are stored; they form the inbox, and
+// only those have an ID.
+type Notification struct {
+	ID         int    `json:"id,omitempty"`
+	ReminderID *int   `json:"reminder_id,omitempty"`
+	Title      string `json:"title"`
+	Body       string `json:"body"`
+	TargetType string `json:"target_type,omitempty"`
+	TargetID   *int   `json:"target_id,omitempty"`
+	Read       bool   `json:"read"`
+	ReadAt     string `json:"read_at,omitempty"`
+	CreatedAt  string `json:"created_at"`
+}
+
+const notificationColumns = `id, reminder_id, title, body, target_type, target_id, read_at, created_at`
+
+func scanNotification(row rowScanner) (Notification, error) {
+	var n Notification
+	var reminderID, targetID sql.NullInt64
+	var readAt sql.NullString
+	err := row.Scan(&n.ID, &reminderID, &n.Title, &n.Body, &n.TargetType, &targetID, &readAt, &n.CreatedAt)
+	if err != nil {
+		return Notification{}, err
+	}
+	if reminderID.Valid {
+		id := int(reminderID.Int64)
+		n.ReminderID = &id
+	}
+	if targetID.Valid {
+		id := int(targetID.Int64)
+		n.TargetID = &id
+	}
+	n.Read = readAt.Valid
+	n.ReadAt = readAt.String
+	return n, nil
+}
+
+// StoreNotification adds a notification to the inbox, unread, and returns it.
+func StoreNotification(n Notification) (Notification, error) {
+	result, err := database.DB.Exec(`INSERT INTO notifications (reminder_id, title, body, target_type, target_id) VALUES (?, ?, ?, ?, ?)`,
+		n.ReminderID, n.Title, n.Body, n.TargetType, n.TargetID)
+	if err != nil {
+		return Notification{}, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return Notification{}, err
+	}
+	return GetNotification(int(id))
+}
+
+func GetNotification(id int) (Notification, error) {
+	n, err := scanNotification(database.DB.QueryRow(`SELECT `+notificationColumns+` FROM notifications WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Notification{}, ErrNotFound
+	}
+	return n, err
+}
+
+// ListNotifications returns the inbox, newest first. limit <= 0 means no
+// limit.
+func ListNotifications(unreadOnly bool, limit int) ([]Notification, error) {
+	query := `SELECT ` + notificationColumns + ` FROM notifications`
+	if unreadOnly {
+		query += ` WHERE read_at IS NULL`
+	}
+	query += ` ORDER BY id DESC`
+	var args []interface{}
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit)
+	}
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := []Notification{}
+	for rows.Next() {
+		n, err := scanNotification(rows)
+		if err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+func CountUnreadNotifications() (int, error) {
+	var n int
+	err := database.DB.QueryRow(`SELECT COUNT(*) FROM notifications WHERE read_at IS NULL`).Scan(&n)
+	return n, err
+}
+
+// SetNotificationRead marks a notification read or unread.
+func SetNotificationRead(id int, read bool) (Notification, error) {
+	query := `UPDATE notifications SET read_at = NULL WHERE id = ?`
+	if read {
+		query = `UPDATE notifications SET read_at = COALESCE(read_at, CURRENT_TIMESTAMP) WHERE id = ?`
+	}
+	if err := execOne(query, id); err != nil {
+		return Notification{}, err
+	}
+	return GetNotification(id)
+}
+
+// MarkAllNotificationsRead marks every unread notification read and returns
+// how many there were.
+func MarkAllNotificationsRead() (int64, error) {
+	result, err := database.DB.Exec(`UPDATE notifications SET read_at = CURRENT_TIMESTAMP WHERE read_at IS NULL`)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func DeleteNotification(id int) error {
+	return execOne(`DELETE FROM notifications WHERE id = ?`, id)
+}
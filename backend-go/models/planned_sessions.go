@@ -0,0 +1,118 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"mindful/backend-go/database"
+	"strings"
+)
+
+// PlannedSession is an upcoming therapy or coaching session, shown on the
+// calendar feed.
+type PlannedSession struct {
+	ID        int    `json:"id"`
+	Title     string `json:"title"`
+	StartsAt  string `json:"starts_at"`
+	EndsAt    string `json:"ends_at"`
+	Location  string `json:"location,omitempty"`
+	Notes     string `json:"notes,omitempty"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at,omitempty"`
+}
+
+// validatePlannedSession checks a session and normalizes its times to UTC.
+func validatePlannedSession(s *PlannedSession) error {
+	s.Title = strings.TrimSpace(s.Title)
+	if s.Title == "" {
+		s.Title = "Session"
+	}
+	start, err := ParseTimestamp(s.StartsAt)
+	if err != nil {
+		return fmt.Errorf("%w: starts_at must be an RFC 3339 time", ErrInvalidSchedule)
+	}
+	end, err := ParseTimestamp(s.EndsAt)
+	if err != nil {
+		return fmt.Errorf("%w: ends_at must be an RFC 3339 time", ErrInvalidSchedule)
+	}
+	if !end.After(start) {
+		return fmt.Errorf("%w: ends_at must be after starts_at", ErrInvalidSchedule)
+	}
+	s.StartsAt = start.Format(TimestampLayout)
+	s.EndsAt = end.Format(TimestampLayout)
+	return nil
+}
+
+func CreatePlannedSession(s PlannedSession) (PlannedSession, error) {
+	if err := validatePlannedSession(&s); err != nil {
+		return PlannedSession{}, err
+	}
+	result, err := database.DB.Exec(`INSERT INTO planned_sessions (title, starts_at, ends_at, location, notes) VALUES (?, ?, ?, ?, ?)`,
+		s.Title, s.StartsAt, s.EndsAt, s.Location, s.Notes)
+	if err != nil {
+		return PlannedSession{}, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return PlannedSession{}, err
+	}
+	return GetPlannedSession(int(id))
+}
+
+func UpdatePlannedSession(id int, s PlannedSession) (PlannedSession, error) {
+	if err := validatePlannedSession(&s); err != nil {
+		return PlannedSession{}, err
+	}
+	err := execOne(`UPDATE planned_sessions SET title = ?, starts_at = ?, ends_at = ?, location = ?, notes = ?,
+		updated_at = CURRENT_TIMESTAMP WHERE id = ?`, s.Title, s.StartsAt, s.EndsAt, s.Location, s.Notes, id)
+	if err != nil {
+		return PlannedSession{}, err
+	}
+	return GetPlannedSession(id)
+}
+
+const plannedSessionColumns = `id, title, starts_at, ends_at, location, notes, created_at, updated_at`
+
+func scanPlannedSession(row rowScanner) (PlannedSession, error) {
+	var s PlannedSession
+	var updatedAt sql.NullString
+	err := row.Scan(&s.ID, &s.Title, &s.StartsAt, &s.EndsAt, &s.Location, &s.Notes, &s.CreatedAt, &updatedAt)
+	s.UpdatedAt = updatedAt.String
+	return s, err
+}
+
+func GetPlannedSession(id int) (PlannedSession, error) {
+	s, err := scanPlannedSession(database.DB.QueryRow(`SELECT `+plannedSessionColumns+` FROM planned_sessions WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return PlannedSession{}, ErrNotFound
+	}
+	return s, err
+}
+
+// ListPlannedSessions returns sessions in start order; upcomingOnly leaves
+// out those that have ended.
+func ListPlannedSessions(upcomingOnly bool) ([]PlannedSession, error) {
+	query := `SELECT ` + plannedSessionColumns + ` FROM planned_sessions`
+	if upcomingOnly {
+		query += ` WHERE ends_at > strftime('%Y-%m-%dT%H:%M:%SZ', 'now')`
+	}
+	rows, err := database.DB.Query(query + ` ORDER BY starts_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []PlannedSession{}
+	for rows.Next() {
+		s, err := scanPlannedSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+func DeletePlannedSession(id int) error {
+	return execOne(`DELETE FROM planned_sessions WHERE id = ?`, id)
+}
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"mindful/backend-go/database"
+)
+
+// GeneratedPrompt is an AI-written journaling prompt. Library prompts live in
+// data files instead; both are referenced from journal entries by ID.
+type GeneratedPrompt struct {
+	ID        string `json:"id"`
+	Category  string `json:"category"`
+	Text      string `json:"text"`
+	CreatedAt string `json:"created_at"`
+}
+
+// PromptAnswer links a prompt to the journal entry written in response.
+type PromptAnswer struct {
+	PromptID   string `json:"prompt_id"`
+	JournalID  int    `json:"journal_id"`
+	AnsweredAt string `json:"answered_at"`
+}
+
+func StoreGeneratedPrompt(p GeneratedPrompt) error {
+	_, err := database.DB.Exec(`INSERT OR IGNORE INTO generated_prompts (id, category, text) VALUES (?, ?, ?)`, p.ID, p.Category, p.Text)
+	return err
+}
+
+func GetGeneratedPrompt(id string) (GeneratedPrompt, error) {
+	var p GeneratedPrompt
+	err := database.DB.QueryRow(`SELECT id, category, text, created_at FROM generated_prompts WHERE id = ?`, id).
+		Scan(&p.ID, &p.Category, &p.Text, &p.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return GeneratedPrompt{}, ErrNotFound
+	}
+	return p, err
+}
+
+// GetPromptAnswers returns every journal entry written in response to a
+// prompt, newest first.
+func GetPromptAnswers() ([]PromptAnswer, error) {
+	rows, err := database.DB.Query(`SELECT prompt_id, id, created_at FROM journal_entries
+		WHERE prompt_id IS NOT NULL AND prompt_id != '' ORDER BY id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	answers := []PromptAnswer{}
+	for rows.Next() {
+		var a PromptAnswer
+		if err := rows.Scan(&a.PromptID, &a.JournalID, &a.AnsweredAt); err != nil {
+			return nil, err
+		}
+		answers = append(answers, a)
+	}
+	return answers, rows.Err()
+}
+
+// GetRecentEmotionalStates returns the detected emotional states of the most
+// recent analyzed journal entries, newest first.
+func GetRecentEmotionalStates(limit int) ([]string, error) {
+	rows, err := database.DB.Query(`SELECT emotional_state FROM journal_entries
+		WHERE emotional_state IS NOT NULL AND emotional_state != '' ORDER BY id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var states []string
+	for rows.Next() {
+		var state string
+		if err := rows.Scan(&state); err != nil {
+			return nil, err
+		}
+		states = append(states, state)
+	}
+	return states, rows.Err()
+}
@@ -0,0 +1,295 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"mindful/backend-go/database"
+	"os"
+)
+
+// userDataTables lists every table holding user data, including derived data
+// such as export jobs. Tables are purged in this order by DeleteAllUserData.
+// audit_events is deliberately absent: it is append-only, holds no content,
+// and must keep the record of the purge itself.
+var userDataTables = []string{
+	"calendar_busy_blocks",
+	"calendar_tokens",
+	"distortion_findings",
+	"embeddings",
+	"export_jobs",
+	"game_plans",
+	"gameplan_tasks",
+	"generated_prompts",
+	"goal_milestones",
+	"goals",
+	"habit_logs",
+	"habits",
+	"journal_entries",
+	"journal_revisions",
+	"journal_tag_suggestions",
+	"journal_tags",
+	"notifications",
+	"planned_sessions",
+	"reminders",
+	"retention_audit",
+	"retention_policies",
+	"search_index",
+	"session_audio",
+	"session_audio_chunks",
+	"session_summaries",
+	"tags",
+	"thought_records",
+	"transcript_turns",
+	"transcription_jobs",
+	"transcripts",
+	"webhook_deliveries",
+	"webhook_subscriptions",
+}
+
+// PurgeReport describes what DeleteAllUserData removed.
+type PurgeReport struct {
+	Deleted      map[string]int64 `json:"deleted"`
+	FilesRemoved int              `json:"files_removed"`
+	BlobsRemoved int              `json:"blobs_removed"`
+	Vacuumed     bool             `json:"vacuumed"`
+}
+
+// DeleteAllUserData removes every row of user data in a single transaction and
+// then vacuums the database with secure_delete enabled, so freed pages are
+// overwritten rather than left recoverable in the file.
+func DeleteAllUserData(ctx context.Context) (PurgeReport, error) {
+	report := PurgeReport{Deleted: map[string]int64{}}
+
+	conn, err := database.DB.Conn(ctx)
+	if err != nil {
+		return report, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `PRAGMA secure_delete = ON`); err != nil {
+		return report, fmt.Errorf("enabling secure_delete: %w", err)
+	}
+
+	exportFiles, err := exportFilePaths(ctx, conn)
+	if err != nil {
+		return report, err
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return report, err
+	}
+	for _, table := range userDataTables {
+		exists, err := tableExists(ctx, tx, table)
+		if err != nil {
+			tx.Rollback()
+			return report, err
+		}
+		if !exists {
+			continue
+		}
+		result, err := tx.ExecContext(ctx, `DELETE FROM `+table)
+		if err != nil {
+			tx.Rollback()
+			return report, fmt.Errorf("deleting from %s: %w", table, err)
+		}
+		n, _ := result.RowsAffected()
+		report.Deleted[table] = n
+	}
+	if err := tx.Commit(); err != nil {
+		return report, err
+	}
+
+	for _, path := range exportFiles {
+		if err := os.Remove(path); err == nil {
+			report.FilesRemoved++
+		}
+	}
+
+	if _, err := conn.ExecContext(ctx, `VACUUM`); err != nil {
+		return report, fmt.Errorf("vacuuming database: %w", err)
+	}
+	report.Vacuumed = true
+	return report, nil
+}
+
+func exportFilePaths(ctx context.Context, conn *sql.Conn) ([]string, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT file_path FROM export_jobs WHERE file_path IS NOT NULL`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var paths []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, rows.Err()
+}
+
+func tableExists(ctx context.Context, tx *sql.Tx, table string) (bool, error) {
+	var n int
+	err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, table).Scan(&n)
+	return n > 0, err
+}
+
+// execOne runs a statement that must affect at least one row, returning
+// ErrNotFound when it matches nothing.
+func execOne(query string, args ...interface{}) error {
+	return execOneIn(database.DB, query, args...)
+}
+
+// execOneIn is execOne run on ex, such as a transaction.
+func execOneIn(ex execer, query string, args ...interface{}) error {
+	result, err := ex.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// removeDerivedData deletes search index entries, embeddings and distortion
+// findings computed from a journal entry or transcript.
+func removeDerivedData(ex execer, kind string, recordID int) error {
+	if err := removeTextIndexes(ex, kind, recordID); err != nil {
+		return err
+	}
+	_, err := ex.Exec(`DELETE FROM embeddings WHERE kind = ? AND record_id = ?`, kind, recordID)
+	return err
+}
+
+// removeTextIndexes deletes the search index entries and distortion findings
+// of a record, which quote its raw text.
+func removeTextIndexes(ex execer, kind string, recordID int) error {
+	if database.SearchEnabled {
+		if _, err := ex.Exec(`DELETE FROM search_index WHERE kind = ? AND record_id = ?`, kind, recordID); err != nil {
+			return err
+		}
+	}
+	_, err := ex.Exec(`DELETE FROM distortion_findings WHERE kind = ? AND record_id = ?`, kind, recordID)
+	return err
+}
+
+// DeleteTranscript removes everything kept of a session's conversation: its
+// transcripts, the recording they came from and its transcription jobs. It
+// returns the blob keys of the recording's chunks, which the caller deletes
+// from the blob store, and ErrNotFound if the session has none of these.
+func DeleteTranscript(sessionID string) ([]string, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	n, err := deleteSessionTranscripts(tx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := deleteSessionAudio(tx, sessionID)
+	if errors.Is(err, ErrNotFound) {
+		err = nil
+	} else if err == nil {
+		n++
+	}
+	if err != nil {
+		return nil, err
+	}
+	result, err := tx.Exec(`DELETE FROM transcription_jobs WHERE session_id = ?`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	jobs, _ := result.RowsAffected()
+	if n == 0 && jobs == 0 {
+		return nil, ErrNotFound
+	}
+	return keys, tx.Commit()
+}
+
+// deleteSessionTranscripts removes a session's transcripts with their turns,
+// derived data and the session's summary, and returns how many there were.
+func deleteSessionTranscripts(tx *sql.Tx, sessionID string) (int, error) {
+	rows, err := tx.Query(`SELECT id FROM transcripts WHERE session_id = ?`, sessionID)
+	if err != nil {
+		return 0, err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		if _, err := tx.Exec(`DELETE FROM transcripts WHERE id = ?`, id); err != nil {
+			return 0, err
+		}
+		if _, err := tx.Exec(`DELETE FROM transcript_turns WHERE transcript_id = ?`, id); err != nil {
+			return 0, err
+		}
+		if err := removeDerivedData(tx, SearchKindTranscript, id); err != nil {
+			return 0, err
+		}
+	}
+	if _, err := tx.Exec(`DELETE FROM session_summaries WHERE session_id = ?`, sessionID); err != nil {
+		return 0, err
+	}
+	return len(ids), nil
+}
+
+// DeleteJournalEntry removes an entry with its revisions, tags and derived
+// data in one transaction, so a failure leaves the entry whole.
+func DeleteJournalEntry(id int) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := execOneIn(tx, `DELETE FROM journal_entries WHERE id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM journal_revisions WHERE journal_id = ?`, id); err != nil {
+		return err
+	}
+	if err := removeJournalTags(tx, id); err != nil {
+		return err
+	}
+	if err := removeDerivedData(tx, SearchKindJournal, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteGamePlan removes a game plan and its tasks in one transaction.
+func DeleteGamePlan(id int) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := execOneIn(tx, `DELETE FROM game_plans WHERE id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM gameplan_tasks WHERE game_plan_id = ?`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,398 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"mindful/backend-go/database"
+	"os"
+	"strings"
+	"time"
+)
+
+// Notification channels a reminder can be delivered through.
+const (
+	ChannelInApp   = "inapp"
+	ChannelWebhook = "webhook"
+	ChannelEmail   = "email"
+)
+
+// Things a reminder can be about. Reminders without a target are free-form.
+const (
+	ReminderTargetHabit = "habit"
+	ReminderTargetTask  = "task"
+	ReminderTargetGoal  = "goal"
+)
+
+// Reminder nudges the user at TimeOfDay in Timezone on the days its schedule
+// falls on. The schedule uses the same days of week or RRULE subset as
+// habits. A reminder due during quiet hours is held until they end.
+type Reminder struct {
+	ID         int      `json:"id"`
+	Title      string   `json:"title"`
+	Message    string   `json:"message"`
+	TargetType string   `json:"target_type,omitempty"`
+	TargetID   *int     `json:"target_id,omitempty"`
+	TimeOfDay  string   `json:"time_of_day"`
+	Timezone   string   `json:"timezone"`
+	DaysOfWeek []string `json:"days_of_week,omitempty"`
+	RRule      string   `json:"rrule,omitempty"`
+	StartDate  string   `json:"start_date"`
+	QuietHours string   `json:"quiet_hours,omitempty"`
+	Channels   []string `json:"channels"`
+	Paused     bool     `json:"paused"`
+	NextRunAt  string   `json:"next_run_at,omitempty"`
+	LastRunAt  string   `json:"last_run_at,omitempty"`
+	CreatedAt  string   `json:"created_at"`
+	UpdatedAt  string   `json:"updated_at,omitempty"`
+}
+
+var ErrInvalidReminder = errors.New("invalid reminder")
+
+// maxReminderLookahead bounds how many days ahead the next run is searched.
+const maxReminderLookahead = 2 * 366
+
+// parseClock parses an HH:MM time of day into minutes after midnight.
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// parseQuietHours parses a "22:00-07:00" range. The end may be earlier than
+// the start, in which case quiet hours run past midnight.
+func parseQuietHours(s string) (start, end int, err error) {
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("%w: quiet_hours must look like 22:00-07:00", ErrInvalidReminder)
+	}
+	if start, err = parseClock(from); err == nil {
+		end, err = parseClock(to)
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: quiet_hours must look like 22:00-07:00", ErrInvalidReminder)
+	}
+	return start, end, nil
+}
+
+// quietHours returns the reminder's quiet hours, falling back to the
+// server-wide QUIET_HOURS setting.
+func (r Reminder) quietHours() string {
+	if r.QuietHours != "" {
+		return r.QuietHours
+	}
+	return os.Getenv("QUIET_HOURS")
+}
+
+// afterQuietHours moves at to the end of quiet hours if it falls inside them.
+func (r Reminder) afterQuietHours(at time.Time) time.Time {
+	quiet := r.quietHours()
+	if quiet == "" {
+		return at
+	}
+	start, end, err := parseQuietHours(quiet)
+	if err != nil || start == end {
+		return at
+	}
+	m := at.Hour()*60 + at.Minute()
+	y, mo, d := at.Date()
+	switch {
+	case start < end && m >= start && m < end:
+	case start > end && m < end:
+	case start > end && m >= start:
+		d++
+	default:
+		return at
+	}
+	return time.Date(y, mo, d, end/60, end%60, 0, 0, at.Location())
+}
+
+// NextRun returns the first time after the given instant that the reminder
+// should fire, with quiet hours applied. It reports false when the schedule
+// has ended.
+func (r Reminder) NextRun(after time.Time) (time.Time, bool) {
+	loc, err := time.LoadLocation(r.Timezone)
+	if err != nil {
+		return time.Time{}, false
+	}
+	clock, err := parseClock(r.TimeOfDay)
+	if err != nil {
+		return time.Time{}, false
+	}
+	local := after.In(loc)
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC)
+	for i := 0; i <= maxReminderLookahead; i++ {
+		d := day.AddDate(0, 0, i)
+		if !scheduledOn(r.DaysOfWeek, r.RRule, r.StartDate, d) {
+			continue
+		}
+		at := r.afterQuietHours(time.Date(d.Year(), d.Month(), d.Day(), clock/60, clock%60, 0, 0, loc))
+		if at.After(after) {
+			return at.UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
+
+func validChannel(c string) bool {
+	switch c {
+	case ChannelInApp, ChannelWebhook, ChannelEmail:
+		return true
+	}
+	return false
+}
+
+// validateReminder checks and normalizes a reminder, filling in defaults and
+// a title taken from its target.
+func validateReminder(r *Reminder) error {
+	if _, err := parseClock(r.TimeOfDay); err != nil {
+		return fmt.Errorf("%w: time_of_day must be HH:MM", ErrInvalidReminder)
+	}
+	if r.Timezone == "" {
+		r.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(r.Timezone); err != nil {
+		return fmt.Errorf("%w: unknown timezone %q", ErrInvalidReminder, r.Timezone)
+	}
+	if r.RRule != "" && len(r.DaysOfWeek) > 0 {
+		return fmt.Errorf("%w: set either days_of_week or rrule, not both", ErrInvalidReminder)
+	}
+	if r.RRule != "" {
+		if _, err := parseRRule(r.RRule); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidReminder, err)
+		}
+	}
+	days, err := normalizeDaysOfWeek(r.DaysOfWeek)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidReminder, err)
+	}
+	r.DaysOfWeek = days
+	if r.StartDate == "" {
+		loc, _ := time.LoadLocation(r.Timezone)
+		r.StartDate = time.Now().In(loc).Format(DateLayout)
+	} else if _, err := ParseDate(r.StartDate); err != nil {
+		return fmt.Errorf("%w: start_date must be YYYY-MM-DD", ErrInvalidReminder)
+	}
+	if r.QuietHours != "" {
+		if _, _, err := parseQuietHours(r.QuietHours); err != nil {
+			return err
+		}
+	}
+	if len(r.Channels) == 0 {
+		r.Channels = []string{ChannelInApp}
+	}
+	for _, c := range r.Channels {
+		if !validChannel(c) {
+			return fmt.Errorf("%w: channel must be inapp, webhook or email", ErrInvalidReminder)
+		}
+	}
+
+	if r.TargetType == "" {
+		r.TargetID = nil
+	} else {
+		if r.TargetID == nil {
+			return fmt.Errorf("%w: target_id is required with target_type", ErrInvalidReminder)
+		}
+		title, err := reminderTargetTitle(r.TargetType, *r.TargetID)
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(r.Title) == "" {
+			r.Title = title
+		}
+	}
+	r.Title = strings.TrimSpace(r.Title)
+	if r.Title == "" {
+		return fmt.Errorf("%w: title is required", ErrInvalidReminder)
+	}
+	return nil
+}
+
+// reminderTargetTitle checks that a reminder's target exists and returns a
+// title for it.
+func reminderTargetTitle(targetType string, id int) (string, error) {
+	var query string
+	switch targetType {
+	case ReminderTargetHabit:
+		query = `SELECT name FROM habits WHERE id = ?`
+	case ReminderTargetTask:
+		query = `SELECT description FROM gameplan_tasks WHERE id = ?`
+	case ReminderTargetGoal:
+		query = `SELECT title FROM goals WHERE id = ?`
+	default:
+		return "", fmt.Errorf("%w: target_type must be habit, task or goal", ErrInvalidReminder)
+	}
+	var title string
+	err := database.DB.QueryRow(query, id).Scan(&title)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("%w: %s %d does not exist", ErrInvalidReminder, targetType, id)
+	}
+	return title, err
+}
+
+// nextRunValue returns the stored next_run_at for a reminder as of now, or
+// NULL if it is paused or its schedule has ended.
+func nextRunValue(r Reminder, now time.Time) interface{} {
+	if r.Paused {
+		return nil
+	}
+	next, ok := r.NextRun(now)
+	if !ok {
+		return nil
+	}
+	return next.Format(TimestampLayout)
+}
+
+// CreateReminder validates and stores a reminder, scheduling its first run.
+func CreateReminder(r Reminder) (Reminder, error) {
+	if err := validateReminder(&r); err != nil {
+		return Reminder{}, err
+	}
+	result, err := database.DB.Exec(`INSERT INTO reminders (title, message, target_type, target_id, time_of_day, timezone,
+		days_of_week, rrule, start_date, quiet_hours, channels, paused, next_run_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.Title, r.Message, r.TargetType, r.TargetID, r.TimeOfDay, r.Timezone, strings.Join(r.DaysOfWeek, ","), r.RRule,
+		r.StartDate, r.QuietHours, strings.Join(r.Channels, ","), r.Paused, nextRunValue(r, time.Now()))
+	if err != nil {
+		return Reminder{}, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return Reminder{}, err
+	}
+	return GetReminder(int(id))
+}
+
+// UpdateReminder replaces a reminder and reschedules it from now.
+func UpdateReminder(id int, r Reminder) (Reminder, error) {
+	if err := validateReminder(&r); err != nil {
+		return Reminder{}, err
+	}
+	err := execOne(`UPDATE reminders SET title = ?, message = ?, target_type = ?, target_id = ?, time_of_day = ?, timezone = ?,
+		days_of_week = ?, rrule = ?, start_date = ?, quiet_hours = ?, channels = ?, paused = ?, next_run_at = ?,
+		updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		r.Title, r.Message, r.TargetType, r.TargetID, r.TimeOfDay, r.Timezone, strings.Join(r.DaysOfWeek, ","), r.RRule,
+		r.StartDate, r.QuietHours, strings.Join(r.Channels, ","), r.Paused, nextRunValue(r, time.Now()), id)
+	if err != nil {
+		return Reminder{}, err
+	}
+	return GetReminder(id)
+}
+
+const reminderColumns = `id, title, message, target_type, target_id, time_of_day, timezone, days_of_week, rrule, start_date,
+	quiet_hours, channels, paused, COALESCE(next_run_at, ''), COALESCE(last_run_at, ''), created_at, updated_at`
+
+func scanReminder(row rowScanner) (Reminder, error) {
+	var r Reminder
+	var targetID sql.NullInt64
+	var days, channels string
+	var updatedAt sql.NullString
+	err := row.Scan(&r.ID, &r.Title, &r.Message, &r.TargetType, &targetID, &r.TimeOfDay, &r.Timezone, &days, &r.RRule,
+		&r.StartDate, &r.QuietHours, &channels, &r.Paused, &r.NextRunAt, &r.LastRunAt, &r.CreatedAt, &updatedAt)
+	if err != nil {
+		return Reminder{}, err
+	}
+	r.UpdatedAt = updatedAt.String
+	if targetID.Valid {
+		id := int(targetID.Int64)
+		r.TargetID = &id
+	}
+	if days != "" {
+		r.DaysOfWeek = strings.Split(days, ",")
+	}
+	r.Channels = strings.Split(channels, ",")
+	return r, nil
+}
+
+func queryReminders(query string, args ...interface{}) ([]Reminder, error) {
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reminders := []Reminder{}
+	for rows.Next() {
+		r, err := scanReminder(rows)
+		if err != nil {
+			return nil, err
+		}
+		reminders = append(reminders, r)
+	}
+	return reminders, rows.Err()
+}
+
+func GetReminder(id int) (Reminder, error) {
+	r, err := scanReminder(database.DB.QueryRow(`SELECT `+reminderColumns+` FROM reminders WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Reminder{}, ErrNotFound
+	}
+	return r, err
+}
+
+func ListReminders() ([]Reminder, error) {
+	return queryReminders(`SELECT ` + reminderColumns + ` FROM reminders ORDER BY id`)
+}
+
+func DeleteReminder(id int) error {
+	return execOne(`DELETE FROM reminders WHERE id = ?`, id)
+}
+
+// DueReminders returns active reminders whose next run is at or before now.
+func DueReminders(now time.Time) ([]Reminder, error) {
+	return queryReminders(`SELECT `+reminderColumns+` FROM reminders
+		WHERE paused = 0 AND next_run_at IS NOT NULL AND next_run_at <= ? ORDER BY next_run_at`,
+		now.UTC().Format(TimestampLayout))
+}
+
+// AdvanceReminder records that a reminder ran at ranAt and schedules its
+// next run after now.
+func AdvanceReminder(r Reminder, ranAt, now time.Time) error {
+	_, err := database.DB.Exec(`UPDATE reminders SET last_run_at = ?, next_run_at = ? WHERE id = ?`,
+		ranAt.UTC().Format(TimestampLayout), nextRunValue(r, now), r.ID)
+	return err
+}
+
+// ReminderTargetDone reports whether the reminder's target no longer needs
+// a nudge: the habit is already done for the day, the task is completed or
+// the goal is no longer active. It returns ErrNotFound if the target was
+// deleted.
+func ReminderTargetDone(r Reminder, at time.Time) (bool, error) {
+	if r.TargetID == nil {
+		return false, nil
+	}
+	switch r.TargetType {
+	case ReminderTargetHabit:
+		habit, err := GetHabit(*r.TargetID)
+		if err != nil {
+			return false, err
+		}
+		if loc, err := time.LoadLocation(r.Timezone); err == nil {
+			at = at.In(loc)
+		}
+		totals, err := habitTotals()
+		if err != nil {
+			return false, err
+		}
+		return totals[habit.ID][at.Format(DateLayout)] >= habit.TargetCount, nil
+	case ReminderTargetTask:
+		var status string
+		err := database.DB.QueryRow(`SELECT status FROM gameplan_tasks WHERE id = ?`, *r.TargetID).Scan(&status)
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, ErrNotFound
+		}
+		if err != nil {
+			return false, err
+		}
+		return status == TaskStatusCompleted, nil
+	case ReminderTargetGoal:
+		goal, err := GetGoal(*r.TargetID)
+		if err != nil {
+			return false, err
+		}
+		return goal.Status != GoalStatusActive, nil
+	}
+	return false, nil
+}
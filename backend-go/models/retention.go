@@ -0,0 +1,384 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"mindful/backend-go/database"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	RetentionActionDelete = "delete"
+	// RetentionActionRedact clears the raw content of a record but keeps the
+	// row and anything derived from it, such as summaries.
+	RetentionActionRedact = "redact"
+)
+
+// RetentionPolicy says how many days records of a resource are kept and what
+// happens to them afterwards. A MaxAgeDays of zero keeps records forever.
+type RetentionPolicy struct {
+	Resource   string `json:"resource"`
+	MaxAgeDays int    `json:"max_age_days"`
+	Action     string `json:"action"`
+	Source     string `json:"source"`
+}
+
+// RetentionCandidate is a record that a retention sweep would act on.
+type RetentionCandidate struct {
+	Resource  string `json:"resource"`
+	RecordID  int    `json:"record_id"`
+	Action    string `json:"action"`
+	CreatedAt string `json:"created_at"`
+	// BlobKeys are the blob store keys of a deleted record's data, which
+	// the caller removes from the store.
+	BlobKeys []string `json:"-"`
+}
+
+type RetentionAuditEntry struct {
+	ID        int    `json:"id"`
+	Resource  string `json:"resource"`
+	RecordID  int    `json:"record_id"`
+	Action    string `json:"action"`
+	Reason    string `json:"reason"`
+	CreatedAt string `json:"created_at"`
+}
+
+type retentionResource struct {
+	table string
+	// contentColumn is cleared by the redact action; resources without one
+	// can only be deleted.
+	contentColumn string
+	// derivedKind is set for resources with search index entries and
+	// embeddings, which are removed along with the raw content.
+	derivedKind string
+	// embedsSummary is set for resources embedded by their session summary
+	// rather than their content, so redaction keeps the embedding.
+	embedsSummary bool
+	// dependents are statements run with the record ID before it is
+	// deleted, removing rows that belong to it.
+	dependents []string
+	// redactions are statements run with the record ID when it is redacted,
+	// clearing copies of the content kept elsewhere.
+	redactions []string
+	// blobQuery selects the blob store keys of a record by its ID, so they
+	// can be removed from the store once the record is deleted.
+	blobQuery string
+	defaults  RetentionPolicy
+}
+
+// deleteTranscriptSummary removes the summary of a transcript's session
+// when the transcript is the last one the session has left.
+const deleteTranscriptSummary = `DELETE FROM session_summaries WHERE session_id = (SELECT session_id FROM transcripts WHERE id = ?1)
+	AND NOT EXISTS (SELECT 1 FROM transcripts WHERE session_id = session_summaries.session_id AND id != ?1)`
+
+var retentionResources = map[string]retentionResource{
+	"transcripts": {
+		table:         "transcripts",
+		contentColumn: "transcript",
+		derivedKind:   SearchKindTranscript,
+		embedsSummary: true,
+		dependents: []string{
+			`DELETE FROM transcript_turns WHERE transcript_id = ?`,
+			deleteTranscriptSummary,
+		},
+		redactions: []string{`UPDATE transcript_turns SET text = '' WHERE transcript_id = ?`},
+		defaults:   RetentionPolicy{MaxAgeDays: 90, Action: RetentionActionRedact},
+	},
+	"session_audio": {
+		table:      "session_audio",
+		dependents: []string{`DELETE FROM session_audio_chunks WHERE audio_id = ?`},
+		blobQuery:  `SELECT blob_key FROM session_audio_chunks WHERE audio_id = ? ORDER BY chunk_index`,
+		defaults:   RetentionPolicy{MaxAgeDays: 90, Action: RetentionActionDelete},
+	},
+	"journals": {
+		table:         "journal_entries",
+		contentColumn: "content",
+		derivedKind:   SearchKindJournal,
+		dependents: []string{
+			`DELETE FROM journal_revisions WHERE journal_id = ?`,
+			`DELETE FROM journal_tags WHERE journal_id = ?`,
+			`DELETE FROM journal_tag_suggestions WHERE journal_id = ?`,
+		},
+		defaults: RetentionPolicy{MaxAgeDays: 0, Action: RetentionActionDelete},
+	},
+	"game_plans": {
+		table:      "game_plans",
+		dependents: []string{`DELETE FROM gameplan_tasks WHERE game_plan_id = ?`},
+		defaults:   RetentionPolicy{MaxAgeDays: 0, Action: RetentionActionDelete},
+	},
+	"thought_records": {
+		table:    "thought_records",
+		defaults: RetentionPolicy{MaxAgeDays: 0, Action: RetentionActionDelete},
+	},
+	"notifications": {
+		table:    "notifications",
+		defaults: RetentionPolicy{MaxAgeDays: 90, Action: RetentionActionDelete},
+	},
+	"webhook_deliveries": {
+		table:    "webhook_deliveries",
+		defaults: RetentionPolicy{MaxAgeDays: 30, Action: RetentionActionDelete},
+	},
+	"export_jobs": {
+		table:    "export_jobs",
+		defaults: RetentionPolicy{MaxAgeDays: 7, Action: RetentionActionDelete},
+	},
+}
+
+var ErrInvalidRetentionPolicy = errors.New("invalid retention policy")
+
+// globalRetentionPolicy returns the server-wide policy for a resource. The
+// built-in defaults can be overridden with RETENTION_<RESOURCE>_DAYS and
+// RETENTION_<RESOURCE>_ACTION environment variables.
+func globalRetentionPolicy(resource string) RetentionPolicy {
+	policy := retentionResources[resource].defaults
+	policy.Resource = resource
+	policy.Source = "global"
+
+	prefix := "RETENTION_" + strings.ToUpper(resource)
+	if days, err := strconv.Atoi(os.Getenv(prefix + "_DAYS")); err == nil && days >= 0 {
+		policy.MaxAgeDays = days
+	}
+	if action := os.Getenv(prefix + "_ACTION"); action != "" {
+		policy.Action = action
+	}
+	return policy
+}
+
+// GetRetentionPolicies returns the effective policy for every resource. User
+// settings take precedence over the global policy.
+func GetRetentionPolicies() ([]RetentionPolicy, error) {
+	userPolicies := map[string]RetentionPolicy{}
+	rows, err := database.DB.Query(`SELECT resource, max_age_days, action FROM retention_policies`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var p RetentionPolicy
+		if err := rows.Scan(&p.Resource, &p.MaxAgeDays, &p.Action); err != nil {
+			return nil, err
+		}
+		p.Source = "user"
+		userPolicies[p.Resource] = p
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var policies []RetentionPolicy
+	for resource := range retentionResources {
+		if p, ok := userPolicies[resource]; ok {
+			policies = append(policies, p)
+		} else {
+			policies = append(policies, globalRetentionPolicy(resource))
+		}
+	}
+	sort.Slice(policies, func(i, j int) bool { return policies[i].Resource < policies[j].Resource })
+	return policies, nil
+}
+
+func validateRetentionPolicy(p RetentionPolicy) error {
+	res, ok := retentionResources[p.Resource]
+	if !ok {
+		return fmt.Errorf("%w: unknown resource %q", ErrInvalidRetentionPolicy, p.Resource)
+	}
+	if p.MaxAgeDays < 0 {
+		return fmt.Errorf("%w: max_age_days must not be negative", ErrInvalidRetentionPolicy)
+	}
+	switch p.Action {
+	case RetentionActionDelete:
+	case RetentionActionRedact:
+		if res.contentColumn == "" {
+			return fmt.Errorf("%w: %s cannot be redacted", ErrInvalidRetentionPolicy, p.Resource)
+		}
+	default:
+		return fmt.Errorf("%w: unknown action %q", ErrInvalidRetentionPolicy, p.Action)
+	}
+	return nil
+}
+
+func SetRetentionPolicy(p RetentionPolicy) error {
+	if err := validateRetentionPolicy(p); err != nil {
+		return err
+	}
+	query := `INSERT INTO retention_policies (resource, max_age_days, action) VALUES (?, ?, ?)
+		ON CONFLICT(resource) DO UPDATE SET max_age_days = excluded.max_age_days, action = excluded.action, updated_at = CURRENT_TIMESTAMP`
+	_, err := database.DB.Exec(query, p.Resource, p.MaxAgeDays, p.Action)
+	return err
+}
+
+// ClearRetentionPolicy removes the user's setting so the global policy applies.
+func ClearRetentionPolicy(resource string) error {
+	return execOne(`DELETE FROM retention_policies WHERE resource = ?`, resource)
+}
+
+func retentionCandidates(q interface {
+	Query(string, ...interface{}) (*sql.Rows, error)
+}, p RetentionPolicy) ([]RetentionCandidate, error) {
+	res := retentionResources[p.Resource]
+	query := fmt.Sprintf(`SELECT id, created_at FROM %s WHERE created_at < datetime('now', ?)`, res.table)
+	if p.Action == RetentionActionRedact {
+		query += fmt.Sprintf(` AND %s != ''`, res.contentColumn)
+	}
+	rows, err := q.Query(query, fmt.Sprintf("-%d days", p.MaxAgeDays))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var candidates []RetentionCandidate
+	for rows.Next() {
+		c := RetentionCandidate{Resource: p.Resource, Action: p.Action}
+		if err := rows.Scan(&c.RecordID, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, c)
+	}
+	return candidates, rows.Err()
+}
+
+// ApplyRetention finds every record older than its effective policy allows.
+// With dryRun set it only reports them; otherwise each record is deleted or
+// redacted and the action is written to the retention audit trail.
+func ApplyRetention(dryRun bool) ([]RetentionCandidate, error) {
+	policies, err := GetRetentionPolicies()
+	if err != nil {
+		return nil, err
+	}
+
+	all := []RetentionCandidate{}
+	for _, p := range policies {
+		if p.MaxAgeDays == 0 {
+			continue
+		}
+		if err := validateRetentionPolicy(p); err != nil {
+			return nil, err
+		}
+		candidates, err := applyRetentionPolicy(p, dryRun)
+		if err != nil {
+			return nil, fmt.Errorf("applying %s retention: %w", p.Resource, err)
+		}
+		all = append(all, candidates...)
+	}
+	return all, nil
+}
+
+func applyRetentionPolicy(p RetentionPolicy, dryRun bool) ([]RetentionCandidate, error) {
+	if dryRun {
+		return retentionCandidates(database.DB, p)
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	candidates, err := retentionCandidates(tx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	res := retentionResources[p.Resource]
+	var files []string
+	for i, c := range candidates {
+		if p.Resource == "export_jobs" {
+			var path sql.NullString
+			if err := tx.QueryRow(`SELECT file_path FROM export_jobs WHERE id = ?`, c.RecordID).Scan(&path); err != nil {
+				return nil, err
+			}
+			if path.Valid {
+				files = append(files, path.String)
+			}
+		}
+
+		switch p.Action {
+		case RetentionActionDelete:
+			if res.blobQuery != "" {
+				candidates[i].BlobKeys, err = blobKeys(tx, res.blobQuery, c.RecordID)
+			}
+			for _, stmt := range res.dependents {
+				if err == nil {
+					_, err = tx.Exec(stmt, c.RecordID)
+				}
+			}
+			if err == nil {
+				_, err = tx.Exec(fmt.Sprintf(`DELETE FROM %s WHERE id = ?`, res.table), c.RecordID)
+			}
+		case RetentionActionRedact:
+			_, err = tx.Exec(fmt.Sprintf(`UPDATE %s SET %s = '' WHERE id = ?`, res.table, res.contentColumn), c.RecordID)
+			for _, stmt := range res.redactions {
+				if err == nil {
+					_, err = tx.Exec(stmt, c.RecordID)
+				}
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		if res.derivedKind != "" {
+			remove := removeDerivedData
+			if p.Action == RetentionActionRedact && res.embedsSummary {
+				remove = removeTextIndexes
+			}
+			if err := remove(tx, res.derivedKind, c.RecordID); err != nil {
+				return nil, err
+			}
+		}
+
+		reason := fmt.Sprintf("older than %d days (%s policy)", p.MaxAgeDays, p.Source)
+		_, err = tx.Exec(`INSERT INTO retention_audit (resource, record_id, action, reason) VALUES (?, ?, ?, ?)`,
+			c.Resource, c.RecordID, c.Action, reason)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	for _, path := range files {
+		os.Remove(path)
+	}
+	return candidates, nil
+}
+
+func blobKeys(tx *sql.Tx, query string, recordID int) ([]string, error) {
+	rows, err := tx.Query(query, recordID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func GetRetentionAudit(limit int) ([]RetentionAuditEntry, error) {
+	rows, err := database.DB.Query(`SELECT id, resource, record_id, action, reason, created_at FROM retention_audit ORDER BY id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []RetentionAuditEntry{}
+	for rows.Next() {
+		var e RetentionAuditEntry
+		if err := rows.Scan(&e.ID, &e.Resource, &e.RecordID, &e.Action, &e.Reason, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
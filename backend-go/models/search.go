@@ -0,0 +1,244 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"html"
+	"mindful/backend-go/database"
+	"strings"
+	"time"
+)
+
+const (
+	SearchKindJournal    = "journal"
+	SearchKindTranscript = "transcript"
+)
+
+var ErrSearchUnavailable = errors.New("full-text search is not available")
+
+type SearchQuery struct {
+	Text  string
+	Kind  string
+	From  string
+	To    string
+	Page  int
+	Limit int
+}
+
+// SearchResult is one match. Snippet is HTML: the matched text, escaped,
+// with the matching terms wrapped in <mark>.
+type SearchResult struct {
+	Kind      string  `json:"type"`
+	RecordID  int     `json:"id"`
+	SessionID string  `json:"session_id,omitempty"`
+	Turn      *int    `json:"turn,omitempty"`
+	Speaker   string  `json:"speaker,omitempty"`
+	Snippet   string  `json:"snippet"`
+	Link      string  `json:"link"`
+	CreatedAt string  `json:"created_at,omitempty"`
+	Score     float64 `json:"score"`
+}
+
+type SearchPage struct {
+	Query   string         `json:"query"`
+	Total   int            `json:"total"`
+	Page    int            `json:"page"`
+	Limit   int            `json:"limit"`
+	Results []SearchResult `json:"results"`
+}
+
+type execer interface {
+	Exec(string, ...interface{}) (sql.Result, error)
+}
+
+func indexTimestamp(createdAt string) string {
+	if createdAt == "" {
+		return time.Now().UTC().Format(time.RFC3339)
+	}
+	return createdAt
+}
+
+func indexTranscript(ex execer, t Transcript) error {
+	if _, err := ex.Exec(`DELETE FROM search_index WHERE kind = ? AND record_id = ?`, SearchKindTranscript, t.ID); err != nil {
+		return err
+	}
+	createdAt := indexTimestamp(t.CreatedAt)
+	for _, turn := range SplitTranscriptTurns(t.Transcript) {
+		_, err := ex.Exec(`INSERT INTO search_index (body, kind, record_id, session_id, turn, speaker, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			turn.Text, SearchKindTranscript, t.ID, t.SessionID, turn.Index, turn.Speaker, createdAt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func indexJournal(ex execer, j Journal) error {
+	if _, err := ex.Exec(`DELETE FROM search_index WHERE kind = ? AND record_id = ?`, SearchKindJournal, j.ID); err != nil {
+		return err
+	}
+	_, err := ex.Exec(`INSERT INTO search_index (body, kind, record_id, created_at) VALUES (?, ?, ?, ?)`,
+		strings.TrimSpace(j.Title+"\n"+j.Content), SearchKindJournal, j.ID, indexTimestamp(j.CreatedAt))
+	return err
+}
+
+// IndexTranscript (re)indexes every turn of a transcript for full-text search.
+func IndexTranscript(t Transcript) error {
+	if !database.SearchEnabled {
+		return nil
+	}
+	return indexTranscript(database.DB, t)
+}
+
+// IndexJournal (re)indexes a journal entry for full-text search.
+func IndexJournal(j Journal) error {
+	if !database.SearchEnabled {
+		return nil
+	}
+	return indexJournal(database.DB, j)
+}
+
+// RemoveFromSearchIndex drops a record from the search index.
+func RemoveFromSearchIndex(kind string, recordID int) error {
+	if !database.SearchEnabled {
+		return nil
+	}
+	_, err := database.DB.Exec(`DELETE FROM search_index WHERE kind = ? AND record_id = ?`, kind, recordID)
+	return err
+}
+
+// RebuildSearchIndex clears the index and repopulates it from the journal and
+// transcript tables in one transaction. It returns the number of indexed records.
+func RebuildSearchIndex() (int, error) {
+	if !database.SearchEnabled {
+		return 0, ErrSearchUnavailable
+	}
+
+	transcripts, err := GetAllTranscripts()
+	if err != nil {
+		return 0, err
+	}
+	journals, err := GetAllJournalEntries()
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM search_index`); err != nil {
+		return 0, err
+	}
+	for _, t := range transcripts {
+		if err := indexTranscript(tx, t); err != nil {
+			return 0, fmt.Errorf("indexing transcript %d: %w", t.ID, err)
+		}
+	}
+	for _, j := range journals {
+		if err := indexJournal(tx, j); err != nil {
+			return 0, fmt.Errorf("indexing journal %d: %w", j.ID, err)
+		}
+	}
+	if _, err := tx.Exec(`INSERT INTO search_index (search_index) VALUES ('optimize')`); err != nil {
+		return 0, err
+	}
+	return len(transcripts) + len(journals), tx.Commit()
+}
+
+// ftsQuery turns free text into an FTS5 query that matches all terms. Each
+// term is quoted so user input cannot inject FTS5 syntax.
+func ftsQuery(text string) string {
+	var terms []string
+	for _, term := range strings.Fields(text) {
+		terms = append(terms, `"`+strings.ReplaceAll(term, `"`, `""`)+`"`)
+	}
+	return strings.Join(terms, " ")
+}
+
+// Snippets mark matches with control characters, which can't be confused
+// with markup, so the text can be escaped before the marks become <mark>.
+const (
+	snippetMatchStart = "\x02"
+	snippetMatchEnd   = "\x03"
+)
+
+var snippetMarks = strings.NewReplacer(snippetMatchStart, "<mark>", snippetMatchEnd, "</mark>")
+
+// highlightSnippet turns a snippet of user text into safe HTML.
+func highlightSnippet(snippet string) string {
+	return snippetMarks.Replace(html.EscapeString(snippet))
+}
+
+// endOfDay widens a bare YYYY-MM-DD upper bound to include that whole day.
+func endOfDay(to string) string {
+	if len(to) == len("2006-01-02") {
+		return to + "T23:59:59Z"
+	}
+	return to
+}
+
+// Search runs a ranked full-text query over journals and transcript turns.
+func Search(q SearchQuery) (SearchPage, error) {
+	page := SearchPage{Query: q.Text, Page: q.Page, Limit: q.Limit, Results: []SearchResult{}}
+	if !database.SearchEnabled {
+		return page, ErrSearchUnavailable
+	}
+	match := ftsQuery(q.Text)
+	if match == "" {
+		return page, nil
+	}
+
+	where := `search_index MATCH ?`
+	args := []interface{}{match}
+	if q.Kind != "" {
+		where += ` AND kind = ?`
+		args = append(args, q.Kind)
+	}
+	if q.From != "" {
+		where += ` AND created_at >= ?`
+		args = append(args, q.From)
+	}
+	if q.To != "" {
+		where += ` AND created_at <= ?`
+		args = append(args, endOfDay(q.To))
+	}
+
+	if err := database.DB.QueryRow(`SELECT COUNT(*) FROM search_index WHERE `+where, args...).Scan(&page.Total); err != nil {
+		return page, err
+	}
+
+	query := `SELECT kind, record_id, COALESCE(session_id, ''), turn, COALESCE(speaker, ''), created_at,
+		snippet(search_index, 0, char(2), char(3), '…', 16), bm25(search_index)
+		FROM search_index WHERE ` + where + ` ORDER BY rank LIMIT ? OFFSET ?`
+	args = append(args, q.Limit, (q.Page-1)*q.Limit)
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return page, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r SearchResult
+		var turn sql.NullInt64
+		if err := rows.Scan(&r.Kind, &r.RecordID, &r.SessionID, &turn, &r.Speaker, &r.CreatedAt, &r.Snippet, &r.Score); err != nil {
+			return page, err
+		}
+		r.Snippet = highlightSnippet(r.Snippet)
+		// bm25 scores are negative, with more relevant matches further below zero.
+		r.Score = -r.Score
+		switch r.Kind {
+		case SearchKindTranscript:
+			t := int(turn.Int64)
+			r.Turn = &t
+			r.Link = fmt.Sprintf("/transcripts/%s#turn-%d", r.SessionID, t)
+		case SearchKindJournal:
+			r.Link = fmt.Sprintf("/journals/%d", r.RecordID)
+		}
+		page.Results = append(page.Results, r)
+	}
+	return page, rows.Err()
+}
@@ -0,0 +1,17 @@
+package models
+
+import "testing"
+
+func TestHighlightSnippet(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"felt \x02anxious\x03 today", "felt <mark>anxious</mark> today"},
+		{"<img src=x onerror=\"alert(1)\"> \x02anxious\x03", `&lt;img src=x onerror=&#34;alert(1)&#34;&gt; <mark>anxious</mark>`},
+		{"\x02<b>\x03 & \x02</mark>\x03", "<mark>&lt;b&gt;</mark> &amp; <mark>&lt;/mark&gt;</mark>"},
+		{"…no match here", "…no match here"},
+	}
+	for _, tt := range tests {
+		if got := highlightSnippet(tt.in); got != tt.want {
+			t.Errorf("highlightSnippet(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"mindful/backend-go/database"
+	"time"
+)
+
+const (
+	AudioStatusUploading = "uploading"
+	AudioStatusComplete  = "complete"
+)
+
+var (
+	ErrInvalidAudio = errors.New("invalid audio upload")
+	// ErrAudioComplete is returned for chunks sent after an upload was
+	// completed; delete the recording to upload it again.
+	ErrAudioComplete = errors.New("audio upload is already complete")
+	// ErrAudioIncomplete is returned when streaming a recording whose upload
+	// has not been completed.
+	ErrAudioIncomplete = errors.New("audio upload is not complete")
+)
+
+// AudioChunk is one uploaded piece of a recording, stored as its own blob.
+type AudioChunk struct {
+	Index     int    `json:"index"`
+	Size      int64  `json:"size"`
+	SHA256    string `json:"sha256"`
+	BlobKey   string `json:"-"`
+	CreatedAt string `json:"created_at"`
+}
+
+// SessionAudio is the recording of a session. Size is the sum of its
+// chunks; SHA256 covers the whole recording and is set on completion.
+type SessionAudio struct {
+	ID          int          `json:"id"`
+	SessionID   string       `json:"session_id"`
+	ContentType string       `json:"content_type"`
+	Status      string       `json:"status"`
+	Size        int64        `json:"size"`
+	SHA256      string       `json:"sha256,omitempty"`
+	Chunks      []AudioChunk `json:"chunks"`
+	CreatedAt   string       `json:"created_at"`
+	CompletedAt string       `json:"completed_at,omitempty"`
+}
+
+const sessionAudioColumns = `id, session_id, content_type, status, size, sha256, created_at, COALESCE(completed_at, '')`
+
+func scanSessionAudio(row rowScanner) (SessionAudio, error) {
+	var a SessionAudio
+	err := row.Scan(&a.ID, &a.SessionID, &a.ContentType, &a.Status, &a.Size, &a.SHA256, &a.CreatedAt, &a.CompletedAt)
+	return a, err
+}
+
+// GetSessionAudio returns a session's recording with its chunks in order.
+func GetSessionAudio(sessionID string) (SessionAudio, error) {
+	a, err := scanSessionAudio(database.DB.QueryRow(`SELECT `+sessionAudioColumns+` FROM session_audio WHERE session_id = ?`, sessionID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return SessionAudio{}, ErrNotFound
+	}
+	if err != nil {
+		return SessionAudio{}, err
+	}
+	a.Chunks, err = audioChunks(a.ID)
+	return a, err
+}
+
+func audioChunks(audioID int) ([]AudioChunk, error) {
+	rows, err := database.DB.Query(`SELECT chunk_index, size, sha256, blob_key, created_at FROM session_audio_chunks WHERE audio_id = ? ORDER BY chunk_index`, audioID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	chunks := []AudioChunk{}
+	for rows.Next() {
+		var c AudioChunk
+		if err := rows.Scan(&c.Index, &c.Size, &c.SHA256, &c.BlobKey, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, c)
+	}
+	return chunks, rows.Err()
+}
+
+// ListSessionAudio returns every recording with its chunks, newest first.
+func ListSessionAudio() ([]SessionAudio, error) {
+	rows, err := database.DB.Query(`SELECT ` + sessionAudioColumns + ` FROM session_audio ORDER BY created_at DESC, id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	var recordings []SessionAudio
+	for rows.Next() {
+		a, err := scanSessionAudio(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		recordings = append(recordings, a)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := range recordings {
+		if recordings[i].Chunks, err = audioChunks(recordings[i].ID); err != nil {
+			return nil, err
+		}
+	}
+	return recordings, nil
+}
+
+// CreateSessionAudio starts the recording of a session, or returns the one
+// already started, whose content type then wins.
+func CreateSessionAudio(sessionID, contentType string) (SessionAudio, error) {
+	_, err := database.DB.Exec(`INSERT INTO session_audio (session_id, content_type) VALUES (?, ?) ON CONFLICT (session_id) DO NOTHING`,
+		sessionID, contentType)
+	if err != nil {
+		return SessionAudio{}, err
+	}
+	return GetSessionAudio(sessionID)
+}
+
+// SaveAudioChunk records a stored chunk, replacing an earlier upload of the
+// same index, and returns the blob key it replaced so the caller can remove
+// that blob.
+func SaveAudioChunk(audioID int, c AudioChunk) (string, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var status string
+	if err := tx.QueryRow(`SELECT status FROM session_audio WHERE id = ?`, audioID).Scan(&status); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrNotFound
+		}
+		return "", err
+	}
+	if status != AudioStatusUploading {
+		return "", ErrAudioComplete
+	}
+
+	var replaced string
+	err = tx.QueryRow(`SELECT blob_key FROM session_audio_chunks WHERE audio_id = ? AND chunk_index = ?`, audioID, c.Index).Scan(&replaced)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+	_, err = tx.Exec(`INSERT INTO session_audio_chunks (audio_id, chunk_index, size, sha256, blob_key) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (audio_id, chunk_index) DO UPDATE SET size = excluded.size, sha256 = excluded.sha256,
+		blob_key = excluded.blob_key, created_at = CURRENT_TIMESTAMP`,
+		audioID, c.Index, c.Size, c.SHA256, c.BlobKey)
+	if err != nil {
+		return "", err
+	}
+	_, err = tx.Exec(`UPDATE session_audio SET size = (SELECT COALESCE(SUM(size), 0) FROM session_audio_chunks WHERE audio_id = ?) WHERE id = ?`,
+		audioID, audioID)
+	if err != nil {
+		return "", err
+	}
+	return replaced, tx.Commit()
+}
+
+// CompleteSessionAudio marks an upload complete with the checksum of the
+// whole recording.
+func CompleteSessionAudio(audioID int, sha256 string, now time.Time) error {
+	err := execOne(`UPDATE session_audio SET status = ?, sha256 = ?, completed_at = ? WHERE id = ? AND status = ?`,
+		AudioStatusComplete, sha256, now.UTC().Format(TimestampLayout), audioID, AudioStatusUploading)
+	if errors.Is(err, ErrNotFound) {
+		return ErrAudioComplete
+	}
+	return err
+}
+
+// DeleteSessionAudio removes a session's recording and returns the blob
+// keys of its chunks, which the caller deletes from the blob store.
+func DeleteSessionAudio(sessionID string) ([]string, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	keys, err := deleteSessionAudio(tx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return keys, tx.Commit()
+}
+
+// deleteSessionAudio removes a session's recording and its chunk rows in tx
+// and returns the chunks' blob keys, or ErrNotFound if there is none.
+func deleteSessionAudio(tx *sql.Tx, sessionID string) ([]string, error) {
+	var audioID int
+	err := tx.QueryRow(`SELECT id FROM session_audio WHERE session_id = ?`, sessionID).Scan(&audioID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(`SELECT blob_key FROM session_audio_chunks WHERE audio_id = ? ORDER BY chunk_index`, audioID)
+	if err != nil {
+		return nil, err
+	}
+	keys := []string{}
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM session_audio_chunks WHERE audio_id = ?`, audioID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`DELETE FROM session_audio WHERE id = ?`, audioID); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// AudioBlobKeys returns the blob keys of every stored audio chunk, so they
+// can be removed from the blob store along with the rows.
+func AudioBlobKeys() ([]string, error) {
+	rows, err := database.DB.Query(`SELECT blob_key FROM session_audio_chunks`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
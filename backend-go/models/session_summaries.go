@@ -0,0 +1,163 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"mindful/backend-go/database"
+)
+
+const (
+	SummaryStatusPending   = "pending"
+	SummaryStatusCompleted = "completed"
+	SummaryStatusFailed    = "failed"
+)
+
+// KeyMomentLabels are the kinds of key moment a session summary marks.
+var KeyMomentLabels = []string{"breakthrough", "insight", "distress", "avoidance", "progress", "setback"}
+
+// IsKeyMomentLabel reports whether label is one of KeyMomentLabels.
+func IsKeyMomentLabel(label string) bool {
+	for _, l := range KeyMomentLabels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
+
+// KeyMoment marks the turns from StartTurn to EndTurn, inclusive, as a
+// moment worth coming back to. Turns are counted across the session's
+// transcripts in order.
+type KeyMoment struct {
+	StartTurn   int    `json:"start_turn"`
+	EndTurn     int    `json:"end_turn"`
+	Label       string `json:"label"`
+	Description string `json:"description"`
+}
+
+// Commitment is something the user said they would do, with the turn they
+// said it in when known.
+type Commitment struct {
+	Text string `json:"text"`
+	Turn *int   `json:"turn,omitempty"`
+}
+
+// SessionSummary is the AI summary of a session, made from its transcripts
+// up to TranscriptID. While a summary is regenerated its status is pending
+// and the previous content is kept; a failed run keeps it as well.
+type SessionSummary struct {
+	SessionID    string       `json:"session_id"`
+	TranscriptID int          `json:"transcript_id"`
+	Status       string       `json:"status"`
+	Summary      string       `json:"summary"`
+	KeyMoments   []KeyMoment  `json:"key_moments"`
+	Topics       []string     `json:"topics"`
+	Commitments  []Commitment `json:"commitments"`
+	Error        string       `json:"error,omitempty"`
+	CreatedAt    string       `json:"created_at"`
+	UpdatedAt    string       `json:"updated_at"`
+}
+
+const sessionSummaryColumns = `session_id, transcript_id, status, summary, key_moments, topics, commitments, error,
+	created_at, updated_at`
+
+func scanSessionSummary(row rowScanner) (SessionSummary, error) {
+	var s SessionSummary
+	var moments, topics, commitments string
+	err := row.Scan(&s.SessionID, &s.TranscriptID, &s.Status, &s.Summary, &moments, &topics, &commitments, &s.Error,
+		&s.CreatedAt, &s.UpdatedAt)
+	if err != nil {
+		return SessionSummary{}, err
+	}
+	if err := json.Unmarshal([]byte(moments), &s.KeyMoments); err != nil {
+		return SessionSummary{}, err
+	}
+	if err := json.Unmarshal([]byte(topics), &s.Topics); err != nil {
+		return SessionSummary{}, err
+	}
+	if err := json.Unmarshal([]byte(commitments), &s.Commitments); err != nil {
+		return SessionSummary{}, err
+	}
+	return s, nil
+}
+
+func GetSessionSummary(sessionID string) (SessionSummary, error) {
+	s, err := scanSessionSummary(database.DB.QueryRow(`SELECT `+sessionSummaryColumns+` FROM session_summaries WHERE session_id = ?`, sessionID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return SessionSummary{}, ErrNotFound
+	}
+	return s, err
+}
+
+// ListSessionSummaries returns up to limit completed summaries, most recent
+// session first. A negative limit returns all of them.
+func ListSessionSummaries(limit int) ([]SessionSummary, error) {
+	rows, err := database.DB.Query(`SELECT `+sessionSummaryColumns+` FROM session_summaries WHERE status = ?
+		ORDER BY transcript_id DESC LIMIT ?`, SummaryStatusCompleted, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summaries := []SessionSummary{}
+	for rows.Next() {
+		s, err := scanSessionSummary(rows)
+		if err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, s)
+	}
+	return summaries, rows.Err()
+}
+
+// StartSessionSummary marks a session's summary as being generated from its
+// transcripts up to transcriptID.
+func StartSessionSummary(sessionID string, transcriptID int) error {
+	_, err := database.DB.Exec(`INSERT INTO session_summaries (session_id, transcript_id, status) VALUES (?, ?, ?)
+		ON CONFLICT (session_id) DO UPDATE SET transcript_id = excluded.transcript_id, status = excluded.status,
+		error = '', updated_at = CURRENT_TIMESTAMP`, sessionID, transcriptID, SummaryStatusPending)
+	return err
+}
+
+// CompleteSessionSummary stores a generated summary.
+func CompleteSessionSummary(s SessionSummary) (SessionSummary, error) {
+	if s.KeyMoments == nil {
+		s.KeyMoments = []KeyMoment{}
+	}
+	if s.Topics == nil {
+		s.Topics = []string{}
+	}
+	if s.Commitments == nil {
+		s.Commitments = []Commitment{}
+	}
+	moments, err := json.Marshal(s.KeyMoments)
+	if err != nil {
+		return SessionSummary{}, err
+	}
+	topics, err := json.Marshal(s.Topics)
+	if err != nil {
+		return SessionSummary{}, err
+	}
+	commitments, err := json.Marshal(s.Commitments)
+	if err != nil {
+		return SessionSummary{}, err
+	}
+	_, err = database.DB.Exec(`INSERT INTO session_summaries (session_id, transcript_id, status, summary, key_moments, topics, commitments)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (session_id) DO UPDATE SET transcript_id = excluded.transcript_id, status = excluded.status,
+		summary = excluded.summary, key_moments = excluded.key_moments, topics = excluded.topics,
+		commitments = excluded.commitments, error = '', updated_at = CURRENT_TIMESTAMP`,
+		s.SessionID, s.TranscriptID, SummaryStatusCompleted, s.Summary, string(moments), string(topics), string(commitments))
+	if err != nil {
+		return SessionSummary{}, err
+	}
+	return GetSessionSummary(s.SessionID)
+}
+
+// FailSessionSummary records why generating a session's summary failed.
+func FailSessionSummary(sessionID, message string) error {
+	_, err := database.DB.Exec(`UPDATE session_summaries SET status = ?, error = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE session_id = ?`, SummaryStatusFailed, message, sessionID)
+	return err
+}
@@ -39,4 +39,71 @@ func GetTranscripts() ([]Transcript, error) {
 	}
 
 	return transcripts, nil
-}
\ No newline at end of file
+}
+
+// GetAllTranscripts returns every stored transcript, oldest first. Unlike
+// GetTranscripts it returns an empty slice rather than an error when none exist.
+func GetAllTranscripts() ([]Transcript, error) {
+	rows, err := db.Query(`SELECT id, session_id, transcript, created_at FROM transcripts ORDER BY created_at ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying transcripts: %w", err)
+	}
+	defer rows.Close()
+
+	transcripts := []Transcript{}
+	for rows.Next() {
+		var t Transcript
+		if err := rows.Scan(&t.ID, &t.SessionID, &t.Transcript, &t.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning transcript row: %w", err)
+		}
+		transcripts = append(transcripts, t)
+	}
+	return transcripts, rows.Err()
+}
+
+func GetTranscriptByID(id int) (Transcript, error) {
+	var t Transcript
+	err := db.QueryRow(`SELECT id, session_id, transcript, created_at FROM transcripts WHERE id = ?`, id).
+		Scan(&t.ID, &t.SessionID, &t.Transcript, &t.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Transcript{}, ErrNotFound
+	}
+	return t, err
+}
+
+// GetLatestTranscript returns the most recently stored session transcript.
+func GetLatestTranscript() (Transcript, error) {
+	var t Transcript
+	err := db.QueryRow(`SELECT id, session_id, transcript, created_at FROM transcripts ORDER BY id DESC LIMIT 1`).
+		Scan(&t.ID, &t.SessionID, &t.Transcript, &t.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Transcript{}, ErrNotFound
+	}
+	return t, err
+}
+
+// GetTranscriptsBySessionID returns every transcript stored for a session,
+// oldest first, or ErrNotFound if there are none.
+func GetTranscriptsBySessionID(sessionID string) ([]Transcript, error) {
+	rows, err := db.Query(`SELECT id, session_id, transcript, created_at FROM transcripts WHERE session_id = ? ORDER BY id`, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying transcripts: %w", err)
+	}
+	defer rows.Close()
+
+	var transcripts []Transcript
+	for rows.Next() {
+		var t Transcript
+		if err := rows.Scan(&t.ID, &t.SessionID, &t.Transcript, &t.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning transcript row: %w", err)
+		}
+		transcripts = append(transcripts, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(transcripts) == 0 {
+		return nil, ErrNotFound
+	}
+	return transcripts, nil
+}
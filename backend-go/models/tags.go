@@ -0,0 +1,223 @@
+package models
+
+import (
+	"mindful/backend-go/database"
+	"strings"
+)
+
+const (
+	TagSuggestionPending  = "pending"
+	TagSuggestionAccepted = "accepted"
+	TagSuggestionRejected = "rejected"
+)
+
+// maxTagLength bounds a single tag after normalization, in characters.
+const maxTagLength = 40
+
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// TagSuggestion is a tag the model proposed for a journal entry. It is only
+// applied to the entry once the user accepts it.
+type TagSuggestion struct {
+	JournalID int    `json:"journal_id"`
+	Tag       string `json:"tag"`
+	Status    string `json:"status"`
+	CreatedAt string `json:"created_at"`
+}
+
+// normalizeTag lowercases a tag, drops a leading '#' and joins words with
+// hyphens, so "#Work Stress" and "work-stress" are the same tag. Slashes
+// separate words too, since tags are used in URL paths. Long tags are cut
+// to maxTagLength characters.
+func normalizeTag(tag string) string {
+	tag = strings.TrimPrefix(strings.TrimSpace(tag), "#")
+	tag = strings.ReplaceAll(tag, "/", " ")
+	tag = strings.ToLower(strings.Join(strings.Fields(tag), "-"))
+	if runes := []rune(tag); len(runes) > maxTagLength {
+		tag = strings.TrimRight(string(runes[:maxTagLength]), "-")
+	}
+	return tag
+}
+
+// NormalizeTags normalizes tags and removes blanks and duplicates, keeping
+// the original order.
+func NormalizeTags(tags []string) []string {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, tag := range tags {
+		tag = normalizeTag(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		out = append(out, tag)
+	}
+	return out
+}
+
+// setJournalTags replaces the tags of a journal entry, creating any tags
+// that do not exist yet.
+func setJournalTags(ex execer, journalID int, tags []string) error {
+	if _, err := ex.Exec(`DELETE FROM journal_tags WHERE journal_id = ?`, journalID); err != nil {
+		return err
+	}
+	for _, tag := range NormalizeTags(tags) {
+		if err := addJournalTag(ex, journalID, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addJournalTag(ex execer, journalID int, tag string) error {
+	if _, err := ex.Exec(`INSERT OR IGNORE INTO tags (name) VALUES (?)`, tag); err != nil {
+		return err
+	}
+	_, err := ex.Exec(`INSERT OR IGNORE INTO journal_tags (journal_id, tag_id) SELECT ?, id FROM tags WHERE name = ?`, journalID, tag)
+	return err
+}
+
+// getJournalTags returns tag names keyed by journal ID for the journal_tags
+// rows (aliased jt) matching where.
+func getJournalTags(where string, args ...interface{}) (map[int][]string, error) {
+	rows, err := database.DB.Query(`SELECT jt.journal_id, t.name FROM journal_tags jt
+		JOIN tags t ON t.id = jt.tag_id `+where+` ORDER BY jt.journal_id, t.name`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := map[int][]string{}
+	for rows.Next() {
+		var journalID int
+		var name string
+		if err := rows.Scan(&journalID, &name); err != nil {
+			return nil, err
+		}
+		tags[journalID] = append(tags[journalID], name)
+	}
+	return tags, rows.Err()
+}
+
+// GetTagCounts returns every tag in use with the number of journal entries
+// carrying it, most used first.
+func GetTagCounts() ([]TagCount, error) {
+	rows, err := database.DB.Query(`SELECT t.name, COUNT(*) FROM tags t
+		JOIN journal_tags jt ON jt.tag_id = t.id
+		GROUP BY t.id ORDER BY COUNT(*) DESC, t.name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []TagCount{}
+	for rows.Next() {
+		var c TagCount
+		if err := rows.Scan(&c.Tag, &c.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+// StoreTagSuggestions records the model's suggested tags for content as
+// pending. It is a no-op if the entry has been edited since content was
+// analyzed. Tags already on the entry, or suggested before and rejected,
+// are skipped.
+func StoreTagSuggestions(journalID int, content string, tags []string) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var current int
+	err = tx.QueryRow(`SELECT COUNT(*) FROM journal_entries WHERE id = ? AND content = ?`, journalID, content).Scan(&current)
+	if err != nil || current == 0 {
+		return err
+	}
+
+	for _, tag := range NormalizeTags(tags) {
+		_, err := tx.Exec(`INSERT OR IGNORE INTO journal_tag_suggestions (journal_id, tag)
+			SELECT ?, ? WHERE NOT EXISTS (
+				SELECT 1 FROM journal_tags jt JOIN tags t ON t.id = jt.tag_id WHERE jt.journal_id = ? AND t.name = ?)`,
+			journalID, tag, journalID, tag)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetTagSuggestions returns the suggestions for a journal entry. With
+// pendingOnly set, accepted and rejected suggestions are left out.
+func GetTagSuggestions(journalID int, pendingOnly bool) ([]TagSuggestion, error) {
+	query := `SELECT journal_id, tag, status, created_at FROM journal_tag_suggestions WHERE journal_id = ?`
+	if pendingOnly {
+		query += ` AND status = '` + TagSuggestionPending + `'`
+	}
+	rows, err := database.DB.Query(query+` ORDER BY tag`, journalID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suggestions := []TagSuggestion{}
+	for rows.Next() {
+		var s TagSuggestion
+		if err := rows.Scan(&s.JournalID, &s.Tag, &s.Status, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		suggestions = append(suggestions, s)
+	}
+	return suggestions, rows.Err()
+}
+
+// ResolveTagSuggestion accepts or rejects a pending suggestion. Accepting it
+// adds the tag to the entry. It returns ErrNotFound if there is no pending
+// suggestion for that tag.
+func ResolveTagSuggestion(journalID int, tag string, accept bool) error {
+	tag = normalizeTag(tag)
+	status := TagSuggestionRejected
+	if accept {
+		status = TagSuggestionAccepted
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`UPDATE journal_tag_suggestions SET status = ? WHERE journal_id = ? AND tag = ? AND status = ?`,
+		status, journalID, tag, TagSuggestionPending)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+
+	if accept {
+		if err := addJournalTag(tx, journalID, tag); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// removeJournalTags deletes an entry's tag links and suggestions. Tags that
+// are no longer used are kept; GetTagCounts only reports tags in use.
+func removeJournalTags(ex execer, journalID int) error {
+	if _, err := ex.Exec(`DELETE FROM journal_tags WHERE journal_id = ?`, journalID); err != nil {
+		return err
+	}
+	_, err := ex.Exec(`DELETE FROM journal_tag_suggestions WHERE journal_id = ?`, journalID)
+	return err
+}
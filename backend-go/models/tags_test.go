@@ -0,0 +1,38 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestNormalizeTag(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"#Work Stress", "work-stress"},
+		{"  work   stress ", "work-stress"},
+		{"work/life", "work-life"},
+		{"work / life/", "work-life"},
+		{"/", ""},
+		{strings.Repeat("a", 45), strings.Repeat("a", 40)},
+		{strings.Repeat("a", 39) + " b", strings.Repeat("a", 39)},
+		{strings.Repeat("ü", 45), strings.Repeat("ü", 40)},
+		{strings.Repeat("a", 39) + "日本", strings.Repeat("a", 39) + "日"},
+	}
+	for _, tt := range tests {
+		got := normalizeTag(tt.in)
+		if got != tt.want {
+			t.Errorf("normalizeTag(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("normalizeTag(%q) = %q is not valid UTF-8", tt.in, got)
+		}
+	}
+}
+
+func TestNormalizeTags(t *testing.T) {
+	got := NormalizeTags([]string{"Work", "#work", "", "sleep/rest", "sleep rest"})
+	want := []string{"work", "sleep-rest"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("NormalizeTags = %q, want %q", got, want)
+	}
+}
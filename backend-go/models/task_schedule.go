@@ -0,0 +1,562 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"mindful/backend-go/database"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	ChronotypeMorning = "morning"
+	ChronotypeEvening = "evening"
+	ChronotypeNeutral = "neutral"
+)
+
+// slotGranularity is the grid proposed start times are aligned to.
+const slotGranularity = 15 * time.Minute
+
+// maxScheduleDays bounds how far ahead a proposal looks.
+const maxScheduleDays = 31
+
+// ErrScheduleConflict is returned when an accepted slot overlaps something
+// the user committed to after it was proposed.
+var ErrScheduleConflict = errors.New("slot is no longer free")
+
+// SchedulePreferences shape where proposed task slots go. Morning people get
+// the earliest free time of a day, evening people the latest, and everyone
+// else the time closest to the middle of their day.
+type SchedulePreferences struct {
+	Chronotype      string   `json:"chronotype"`
+	MaxTasksPerDay  int      `json:"max_tasks_per_day"`
+	DayStart        string   `json:"day_start"`
+	DayEnd          string   `json:"day_end"`
+	DaysOfWeek      []string `json:"days_of_week,omitempty"`
+	BufferMinutes   *int     `json:"buffer_minutes,omitempty"`
+	DefaultDuration int      `json:"default_duration_minutes"`
+}
+
+// FreeBusyInterval is a span of time given as RFC 3339 start and end times,
+// the shape used by free/busy APIs.
+type FreeBusyInterval struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// ScheduleRequest asks for time slots for a game plan's tasks. Busy times
+// come from imported calendars (unless IgnoreImported is set), other
+// scheduled tasks, planned sessions and Busy. When Free is given, tasks are
+// only placed inside it.
+type ScheduleRequest struct {
+	Timezone       string              `json:"timezone"`
+	StartDate      string              `json:"start_date"`
+	Days           int                 `json:"days"`
+	TaskIDs        []int               `json:"task_ids,omitempty"`
+	Busy           []FreeBusyInterval  `json:"busy,omitempty"`
+	Free           []FreeBusyInterval  `json:"free,omitempty"`
+	IgnoreImported bool                `json:"ignore_imported"`
+	Preferences    SchedulePreferences `json:"preferences"`
+}
+
+// ScheduledSlot is a proposed time for a task. Accepting a proposal stores
+// DueAt and Duration on the task.
+type ScheduledSlot struct {
+	TaskID      int    `json:"task_id"`
+	Description string `json:"description,omitempty"`
+	DueAt       string `json:"due_at"`
+	Duration    int    `json:"duration_minutes"`
+}
+
+type UnscheduledTask struct {
+	TaskID      int    `json:"task_id"`
+	Description string `json:"description"`
+	Reason      string `json:"reason"`
+}
+
+type ScheduleProposal struct {
+	GamePlanID  int                 `json:"game_plan_id"`
+	Timezone    string              `json:"timezone"`
+	StartDate   string              `json:"start_date"`
+	Days        int                 `json:"days"`
+	Preferences SchedulePreferences `json:"preferences"`
+	Slots       []ScheduledSlot     `json:"slots"`
+	Unscheduled []UnscheduledTask   `json:"unscheduled"`
+}
+
+type timeRange struct {
+	start, end time.Time
+}
+
+// subtractRange removes b from every range in ranges.
+func subtractRange(ranges []timeRange, b timeRange) []timeRange {
+	var out []timeRange
+	for _, r := range ranges {
+		if !b.start.Before(r.end) || !b.end.After(r.start) {
+			out = append(out, r)
+			continue
+		}
+		if r.start.Before(b.start) {
+			out = append(out, timeRange{r.start, b.start})
+		}
+		if b.end.Before(r.end) {
+			out = append(out, timeRange{b.end, r.end})
+		}
+	}
+	return out
+}
+
+// intersectRanges returns the parts of ranges that lie inside one of within.
+func intersectRanges(ranges, within []timeRange) []timeRange {
+	var out []timeRange
+	for _, r := range ranges {
+		for _, w := range within {
+			start, end := r.start, r.end
+			if w.start.After(start) {
+				start = w.start
+			}
+			if w.end.Before(end) {
+				end = w.end
+			}
+			if start.Before(end) {
+				out = append(out, timeRange{start, end})
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].start.Before(out[j].start) })
+	return out
+}
+
+func ceilToSlot(t time.Time) time.Time {
+	c := t.Truncate(slotGranularity)
+	if c.Before(t) {
+		c = c.Add(slotGranularity)
+	}
+	return c
+}
+
+// pickSlot finds a start time for a task of length d in the free ranges of
+// one day, following the chronotype. ok is false when nothing fits.
+func pickSlot(free []timeRange, d time.Duration, chronotype string, dayStart, dayEnd time.Time) (time.Time, bool) {
+	switch chronotype {
+	case ChronotypeMorning:
+		for _, r := range free {
+			if s := ceilToSlot(r.start); !s.Add(d).After(r.end) {
+				return s, true
+			}
+		}
+	case ChronotypeEvening:
+		for i := len(free) - 1; i >= 0; i-- {
+			r := free[i]
+			if s := r.end.Add(-d).Truncate(slotGranularity); !s.Before(r.start) {
+				return s, true
+			}
+		}
+	default:
+		ideal := dayStart.Add(dayEnd.Sub(dayStart) / 2).Add(-d / 2).Truncate(slotGranularity)
+		var best time.Time
+		var bestDistance time.Duration
+		found := false
+		for _, r := range free {
+			earliest, latest := ceilToSlot(r.start), r.end.Add(-d).Truncate(slotGranularity)
+			if latest.Before(earliest) {
+				continue
+			}
+			s := ideal
+			if s.Before(earliest) {
+				s = earliest
+			}
+			if s.After(latest) {
+				s = latest
+			}
+			distance := s.Sub(ideal)
+			if distance < 0 {
+				distance = -distance
+			}
+			if !found || distance < bestDistance {
+				best, bestDistance, found = s, distance, true
+			}
+		}
+		return best, found
+	}
+	return time.Time{}, false
+}
+
+// validateSchedulePreferences fills in defaults and returns the day window
+// in minutes after midnight.
+func validateSchedulePreferences(p *SchedulePreferences) (dayStart, dayEnd int, err error) {
+	p.Chronotype = strings.ToLower(strings.TrimSpace(p.Chronotype))
+	switch p.Chronotype {
+	case "":
+		p.Chronotype = ChronotypeNeutral
+	case ChronotypeMorning, ChronotypeEvening, ChronotypeNeutral:
+	default:
+		return 0, 0, fmt.Errorf("%w: chronotype must be morning, evening or neutral", ErrInvalidSchedule)
+	}
+	if p.MaxTasksPerDay < 0 {
+		return 0, 0, fmt.Errorf("%w: max_tasks_per_day must not be negative", ErrInvalidSchedule)
+	}
+	if p.MaxTasksPerDay == 0 {
+		p.MaxTasksPerDay = 3
+	}
+	if p.DayStart == "" {
+		p.DayStart = "09:00"
+	}
+	if p.DayEnd == "" {
+		p.DayEnd = "18:00"
+	}
+	if dayStart, err = parseClock(p.DayStart); err == nil {
+		dayEnd, err = parseClock(p.DayEnd)
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: day_start and day_end must look like 09:00", ErrInvalidSchedule)
+	}
+	if dayEnd <= dayStart {
+		return 0, 0, fmt.Errorf("%w: day_end must be after day_start", ErrInvalidSchedule)
+	}
+	if p.DaysOfWeek, err = normalizeDaysOfWeek(p.DaysOfWeek); err != nil {
+		return 0, 0, fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+	}
+	if p.BufferMinutes == nil {
+		buffer := 10
+		p.BufferMinutes = &buffer
+	}
+	if *p.BufferMinutes < 0 {
+		return 0, 0, fmt.Errorf("%w: buffer_minutes must not be negative", ErrInvalidSchedule)
+	}
+	if p.DefaultDuration < 0 {
+		return 0, 0, fmt.Errorf("%w: default_duration_minutes must not be negative", ErrInvalidSchedule)
+	}
+	if p.DefaultDuration == 0 {
+		p.DefaultDuration = DefaultTaskDuration
+	}
+	return dayStart, dayEnd, nil
+}
+
+func parseIntervals(name string, intervals []FreeBusyInterval) ([]timeRange, error) {
+	var ranges []timeRange
+	for _, iv := range intervals {
+		start, err := ParseTimestamp(iv.Start)
+		if err == nil {
+			var end time.Time
+			if end, err = ParseTimestamp(iv.End); err == nil && end.After(start) {
+				ranges = append(ranges, timeRange{start, end})
+				continue
+			}
+		}
+		return nil, fmt.Errorf("%w: %s intervals need RFC 3339 start and end times, end after start", ErrInvalidSchedule, name)
+	}
+	return ranges, nil
+}
+
+func parseStoredRange(start, end string, minutes int) (timeRange, bool) {
+	s, err := time.Parse(TimestampLayout, start)
+	if err != nil {
+		return timeRange{}, false
+	}
+	if end != "" {
+		e, err := time.Parse(TimestampLayout, end)
+		return timeRange{s, e}, err == nil
+	}
+	if minutes <= 0 {
+		minutes = DefaultTaskDuration
+	}
+	return timeRange{s, s.Add(time.Duration(minutes) * time.Minute)}, true
+}
+
+// committedRanges returns the times the user is already committed to:
+// imported busy blocks overlapping [from, to) unless ignoreImported is set,
+// scheduled tasks other than those in skip, and upcoming planned sessions.
+// openTasks holds the ranges of the tasks that are not completed, which
+// count towards the daily limit.
+func committedRanges(from, to time.Time, ignoreImported bool, skip map[int]bool) (busy, openTasks []timeRange, err error) {
+	if !ignoreImported {
+		blocks, err := GetBusyBlocks(from, to)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, b := range blocks {
+			if r, ok := parseStoredRange(b.StartsAt, b.EndsAt, 0); ok {
+				busy = append(busy, r)
+			}
+		}
+	}
+	allTasks, err := GetAllGamePlanTasks()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, t := range allTasks {
+		if t.DueAt == "" || skip[t.ID] {
+			continue
+		}
+		if r, ok := parseStoredRange(t.DueAt, "", t.Duration); ok {
+			busy = append(busy, r)
+			if t.Status != TaskStatusCompleted {
+				openTasks = append(openTasks, r)
+			}
+		}
+	}
+	sessions, err := ListPlannedSessions(true)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, s := range sessions {
+		if r, ok := parseStoredRange(s.StartsAt, s.EndsAt, 0); ok {
+			busy = append(busy, r)
+		}
+	}
+	return busy, openTasks, nil
+}
+
+// ProposeSchedule assigns time slots to a game plan's open tasks that have
+// no due time yet (or to TaskIDs), without storing anything. Tasks are
+// placed in plan order on the first day with room for them.
+func ProposeSchedule(planID int, req ScheduleRequest, now time.Time) (ScheduleProposal, error) {
+	prefs := req.Preferences
+	dayStartMin, dayEndMin, err := validateSchedulePreferences(&prefs)
+	if err != nil {
+		return ScheduleProposal{}, err
+	}
+	if req.Timezone == "" {
+		req.Timezone = "UTC"
+	}
+	loc, err := time.LoadLocation(req.Timezone)
+	if err != nil {
+		return ScheduleProposal{}, fmt.Errorf("%w: unknown timezone %q", ErrInvalidSchedule, req.Timezone)
+	}
+	if req.Days < 0 || req.Days > maxScheduleDays {
+		return ScheduleProposal{}, fmt.Errorf("%w: days must be between 1 and %d", ErrInvalidSchedule, maxScheduleDays)
+	}
+	if req.Days == 0 {
+		req.Days = 7
+	}
+	first := civilDate(now.In(loc))
+	if req.StartDate != "" {
+		if first, err = ParseDate(req.StartDate); err != nil {
+			return ScheduleProposal{}, fmt.Errorf("%w: start_date must be a YYYY-MM-DD date", ErrInvalidSchedule)
+		}
+	}
+	busy, err := parseIntervals("busy", req.Busy)
+	if err != nil {
+		return ScheduleProposal{}, err
+	}
+	free, err := parseIntervals("free", req.Free)
+	if err != nil {
+		return ScheduleProposal{}, err
+	}
+
+	var exists int
+	if err := database.DB.QueryRow(`SELECT COUNT(*) FROM game_plans WHERE id = ?`, planID).Scan(&exists); err != nil {
+		return ScheduleProposal{}, err
+	}
+	if exists == 0 {
+		return ScheduleProposal{}, ErrNotFound
+	}
+	byPlan, err := getGamePlanTasks(`SELECT `+gamePlanTaskColumns+` FROM gameplan_tasks WHERE game_plan_id = ? ORDER BY position`, planID)
+	if err != nil {
+		return ScheduleProposal{}, err
+	}
+	planTasks := byPlan[planID]
+
+	proposal := ScheduleProposal{
+		GamePlanID:  planID,
+		Timezone:    req.Timezone,
+		StartDate:   first.Format(DateLayout),
+		Days:        req.Days,
+		Preferences: prefs,
+		Slots:       []ScheduledSlot{},
+		Unscheduled: []UnscheduledTask{},
+	}
+
+	var tasks []GamePlanTask
+	selected := map[int]bool{}
+	if len(req.TaskIDs) > 0 {
+		byID := map[int]GamePlanTask{}
+		for _, t := range planTasks {
+			byID[t.ID] = t
+		}
+		for _, id := range req.TaskIDs {
+			t, ok := byID[id]
+			if !ok {
+				return ScheduleProposal{}, fmt.Errorf("%w: task %d is not in this game plan", ErrInvalidSchedule, id)
+			}
+			if selected[id] {
+				continue
+			}
+			selected[id] = true
+			if t.Status == TaskStatusCompleted {
+				proposal.Unscheduled = append(proposal.Unscheduled, UnscheduledTask{t.ID, t.Description, "task is already completed"})
+				continue
+			}
+			tasks = append(tasks, t)
+		}
+	} else {
+		for _, t := range planTasks {
+			if t.Status != TaskStatusCompleted && t.DueAt == "" {
+				tasks = append(tasks, t)
+				selected[t.ID] = true
+			}
+		}
+	}
+
+	windowStart := time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, loc)
+	windowEnd := windowStart.AddDate(0, 0, req.Days)
+
+	// Everything the user is already committed to counts as busy. Other
+	// scheduled tasks also count towards the daily limit.
+	committed, openTasks, err := committedRanges(windowStart, windowEnd, req.IgnoreImported, selected)
+	if err != nil {
+		return ScheduleProposal{}, err
+	}
+	busy = append(busy, committed...)
+	perDay := map[string]int{}
+	for _, r := range openTasks {
+		perDay[r.start.In(loc).Format(DateLayout)]++
+	}
+
+	buffer := time.Duration(*prefs.BufferMinutes) * time.Minute
+	earliest := ceilToSlot(now)
+	type scheduleDay struct {
+		date       string
+		start, end time.Time
+		free       []timeRange
+	}
+	var days []*scheduleDay
+	for i := 0; i < req.Days; i++ {
+		date := first.AddDate(0, 0, i)
+		if len(prefs.DaysOfWeek) > 0 && !scheduledOn(prefs.DaysOfWeek, "", "", date) {
+			continue
+		}
+		day := &scheduleDay{
+			date:  date.Format(DateLayout),
+			start: time.Date(date.Year(), date.Month(), date.Day(), dayStartMin/60, dayStartMin%60, 0, 0, loc),
+			end:   time.Date(date.Year(), date.Month(), date.Day(), dayEndMin/60, dayEndMin%60, 0, 0, loc),
+		}
+		open := day.start
+		if earliest.After(open) {
+			open = earliest
+		}
+		if !open.Before(day.end) {
+			continue
+		}
+		day.free = []timeRange{{open, day.end}}
+		if len(free) > 0 {
+			day.free = intersectRanges(day.free, free)
+		}
+		for _, b := range busy {
+			day.free = subtractRange(day.free, timeRange{b.start.Add(-buffer), b.end.Add(buffer)})
+		}
+		days = append(days, day)
+	}
+
+	for _, t := range tasks {
+		minutes := t.Duration
+		if minutes <= 0 {
+			minutes = prefs.DefaultDuration
+		}
+		d := time.Duration(minutes) * time.Minute
+		placed := false
+		for _, day := range days {
+			if perDay[day.date] >= prefs.MaxTasksPerDay {
+				continue
+			}
+			start, ok := pickSlot(day.free, d, prefs.Chronotype, day.start, day.end)
+			if !ok {
+				continue
+			}
+			proposal.Slots = append(proposal.Slots, ScheduledSlot{
+				TaskID:      t.ID,
+				Description: t.Description,
+				DueAt:       start.In(loc).Format(time.RFC3339),
+				Duration:    minutes,
+			})
+			day.free = subtractRange(day.free, timeRange{start.Add(-buffer), start.Add(d + buffer)})
+			perDay[day.date]++
+			placed = true
+			break
+		}
+		if !placed {
+			reason := fmt.Sprintf("no free %d-minute slot within %d day(s) from %s", minutes, req.Days, proposal.StartDate)
+			proposal.Unscheduled = append(proposal.Unscheduled, UnscheduledTask{t.ID, t.Description, reason})
+		}
+	}
+	return proposal, nil
+}
+
+// AcceptSchedule stores the slots of a proposal as the due times of the
+// plan's tasks, all or nothing. A slot that now overlaps an imported busy
+// block (unless ignoreImported is set), another scheduled task or a planned
+// session fails with ErrScheduleConflict.
+func AcceptSchedule(planID int, slots []ScheduledSlot, ignoreImported bool) ([]GamePlanTask, error) {
+	if len(slots) == 0 {
+		return nil, fmt.Errorf("%w: no slots to accept", ErrInvalidSchedule)
+	}
+	dues := make([]interface{}, len(slots))
+	ranges := make([]timeRange, len(slots))
+	accepting := map[int]bool{}
+	var from, to time.Time
+	for i, s := range slots {
+		due, err := taskDueValue(s.DueAt, s.Duration)
+		if err != nil {
+			return nil, err
+		}
+		if due == nil {
+			return nil, fmt.Errorf("%w: every slot needs a due_at", ErrInvalidSchedule)
+		}
+		dues[i] = due
+		ranges[i], _ = parseStoredRange(due.(string), "", s.Duration)
+		accepting[s.TaskID] = true
+		if from.IsZero() || ranges[i].start.Before(from) {
+			from = ranges[i].start
+		}
+		if ranges[i].end.After(to) {
+			to = ranges[i].end
+		}
+	}
+
+	busy, _, err := committedRanges(from, to, ignoreImported, accepting)
+	if err != nil {
+		return nil, err
+	}
+	for i, r := range ranges {
+		for _, b := range busy {
+			if r.start.Before(b.end) && r.end.After(b.start) {
+				return nil, fmt.Errorf("%w: task %d at %s", ErrScheduleConflict, slots[i].TaskID, slots[i].DueAt)
+			}
+		}
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	for i, s := range slots {
+		due := dues[i]
+		result, err := tx.Exec(`UPDATE gameplan_tasks SET due_at = ?, duration_minutes = ? WHERE game_plan_id = ? AND id = ?`,
+			due, s.Duration, planID, s.TaskID)
+		if err != nil {
+			return nil, err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return nil, err
+		} else if n == 0 {
+			return nil, ErrNotFound
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	tasks := make([]GamePlanTask, 0, len(slots))
+	for _, s := range slots {
+		t, err := GetGamePlanTask(planID, s.TaskID)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, t)
+	}
+	return tasks, nil
+}
@@ -0,0 +1,243 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// storeTestPlan stores a game plan with one task per description and
+// returns its ID and tasks.
+func storeTestPlan(t *testing.T, descriptions ...string) (int, []GamePlanTask) {
+	t.Helper()
+	tasks := make([]PlannedTask, len(descriptions))
+	for i, d := range descriptions {
+		tasks[i] = PlannedTask{Description: d}
+	}
+	id, err := StoreGamePlan(tasks, "Plan", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := GetLatestGamePlan()
+	if err != nil || plan.ID != id {
+		t.Fatalf("loading plan %d: %+v, %v", id, plan, err)
+	}
+	return id, plan.TaskItems
+}
+
+func slotTimes(slots []ScheduledSlot) string {
+	times := make([]string, len(slots))
+	for i, s := range slots {
+		times[i] = s.DueAt
+	}
+	return strings.Join(times, " ")
+}
+
+func intPtr(n int) *int { return &n }
+
+// scheduleNow is before every proposal window, so the current time never
+// limits the slots.
+var scheduleNow = time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+func TestProposeScheduleAvoidsBusyBlocks(t *testing.T) {
+	openTestDB(t)
+	planID, _ := storeTestPlan(t, "Walk", "Call a friend")
+	err := ReplaceBusyBlocks("work", []BusyBlock{{UID: "meeting", StartsAt: "2024-03-25T09:00:00Z", EndsAt: "2024-03-25T10:30:00Z"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		req  ScheduleRequest
+		want string
+	}{
+		{
+			name: "imported block without buffer",
+			req:  ScheduleRequest{Preferences: SchedulePreferences{Chronotype: ChronotypeMorning, BufferMinutes: intPtr(0)}},
+			want: "2024-03-25T10:30:00Z 2024-03-25T11:00:00Z",
+		},
+		{
+			name: "imported block with the default buffer",
+			req:  ScheduleRequest{Preferences: SchedulePreferences{Chronotype: ChronotypeMorning}},
+			want: "2024-03-25T10:45:00Z 2024-03-25T11:30:00Z",
+		},
+		{
+			name: "imported blocks ignored",
+			req:  ScheduleRequest{IgnoreImported: true, Preferences: SchedulePreferences{Chronotype: ChronotypeMorning, BufferMinutes: intPtr(0)}},
+			want: "2024-03-25T09:00:00Z 2024-03-25T09:30:00Z",
+		},
+		{
+			name: "busy intervals from the request",
+			req: ScheduleRequest{
+				Busy:        []FreeBusyInterval{{Start: "2024-03-25T11:00:00+01:00", End: "2024-03-25T11:45:00+01:00"}},
+				Preferences: SchedulePreferences{Chronotype: ChronotypeMorning, BufferMinutes: intPtr(0)},
+			},
+			want: "2024-03-25T10:45:00Z 2024-03-25T11:15:00Z",
+		},
+		{
+			name: "only inside free intervals",
+			req: ScheduleRequest{
+				Free:        []FreeBusyInterval{{Start: "2024-03-25T14:10:00Z", End: "2024-03-25T15:00:00Z"}},
+				Preferences: SchedulePreferences{Chronotype: ChronotypeMorning, BufferMinutes: intPtr(0)},
+			},
+			want: "2024-03-25T14:15:00Z",
+		},
+		{
+			name: "evening chronotype",
+			req:  ScheduleRequest{Preferences: SchedulePreferences{Chronotype: ChronotypeEvening}},
+			want: "2024-03-25T17:30:00Z 2024-03-25T16:45:00Z",
+		},
+	}
+	for _, tt := range tests {
+		tt.req.StartDate, tt.req.Days = "2024-03-25", 1
+		proposal, err := ProposeSchedule(planID, tt.req, scheduleNow)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := slotTimes(proposal.Slots); got != tt.want {
+			t.Errorf("%s: slots %s, want %s (unscheduled %+v)", tt.name, got, tt.want, proposal.Unscheduled)
+		}
+	}
+}
+
+func TestProposeScheduleWorkingHoursInTimezone(t *testing.T) {
+	openTestDB(t)
+	planID, tasks := storeTestPlan(t, "Stretch", "Read", "Journal")
+
+	// Berlin moves to summer time overnight on 30-31 March, so 09:00 local
+	// is 08:00Z on the first day and 07:00Z on the second.
+	proposal, err := ProposeSchedule(planID, ScheduleRequest{
+		Timezone:  "Europe/Berlin",
+		StartDate: "2024-03-30",
+		Days:      2,
+		Preferences: SchedulePreferences{
+			Chronotype:     ChronotypeMorning,
+			MaxTasksPerDay: 1,
+			DayStart:       "09:00",
+			DayEnd:         "10:00",
+		},
+	}, scheduleNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := slotTimes(proposal.Slots), "2024-03-30T09:00:00+01:00 2024-03-31T09:00:00+02:00"; got != want {
+		t.Errorf("slots %s, want %s", got, want)
+	}
+	if len(proposal.Unscheduled) != 1 || proposal.Unscheduled[0].TaskID != tasks[2].ID {
+		t.Errorf("unscheduled = %+v, want the third task", proposal.Unscheduled)
+	}
+
+	// Busy times in UTC are compared with working hours in New York, which
+	// moved to summer time on 10 March.
+	proposal, err = ProposeSchedule(planID, ScheduleRequest{
+		Timezone:  "America/New_York",
+		StartDate: "2024-03-11",
+		Days:      1,
+		TaskIDs:   []int{tasks[0].ID},
+		Busy:      []FreeBusyInterval{{Start: "2024-03-11T13:00:00Z", End: "2024-03-11T14:00:00Z"}},
+		Preferences: SchedulePreferences{
+			Chronotype:    ChronotypeMorning,
+			DayStart:      "09:00",
+			DayEnd:        "10:30",
+			BufferMinutes: intPtr(0),
+		},
+	}, scheduleNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := slotTimes(proposal.Slots), "2024-03-11T10:00:00-04:00"; got != want {
+		t.Errorf("slots %s, want %s", got, want)
+	}
+
+	// A task must end by day_end.
+	proposal, err = ProposeSchedule(planID, ScheduleRequest{
+		Timezone:    "America/New_York",
+		StartDate:   "2024-03-11",
+		Days:        1,
+		TaskIDs:     []int{tasks[0].ID},
+		Busy:        []FreeBusyInterval{{Start: "2024-03-11T13:00:00Z", End: "2024-03-11T14:00:00Z"}},
+		Preferences: SchedulePreferences{DayStart: "09:00", DayEnd: "10:30"},
+	}, scheduleNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(proposal.Slots) != 0 || len(proposal.Unscheduled) != 1 {
+		t.Errorf("proposal = %+v, want the task unscheduled", proposal)
+	}
+}
+
+func TestProposeScheduleCountsScheduledTasks(t *testing.T) {
+	openTestDB(t)
+	_, other := storeTestPlan(t, "Existing")
+	if _, err := SetGamePlanTaskDue(other[0].GamePlanID, other[0].ID, "2024-03-25T09:00:00Z", 60); err != nil {
+		t.Fatal(err)
+	}
+	planID, _ := storeTestPlan(t, "Walk", "Read")
+
+	proposal, err := ProposeSchedule(planID, ScheduleRequest{
+		StartDate:   "2024-03-25",
+		Days:        2,
+		Preferences: SchedulePreferences{Chronotype: ChronotypeMorning, MaxTasksPerDay: 2, BufferMinutes: intPtr(0)},
+	}, scheduleNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := slotTimes(proposal.Slots), "2024-03-25T10:00:00Z 2024-03-26T09:00:00Z"; got != want {
+		t.Errorf("slots %s, want %s", got, want)
+	}
+}
+
+func TestAcceptScheduleRejectsSlotThatBecameBusy(t *testing.T) {
+	openTestDB(t)
+	planID, tasks := storeTestPlan(t, "Walk", "Read")
+	proposal, err := ProposeSchedule(planID, ScheduleRequest{
+		StartDate:   "2024-03-25",
+		Days:        1,
+		Preferences: SchedulePreferences{Chronotype: ChronotypeMorning, BufferMinutes: intPtr(0)},
+	}, scheduleNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := slotTimes(proposal.Slots), "2024-03-25T09:00:00Z 2024-03-25T09:30:00Z"; got != want {
+		t.Fatalf("slots %s, want %s", got, want)
+	}
+
+	// A meeting is imported over the second slot after the proposal.
+	err = ReplaceBusyBlocks("work", []BusyBlock{{UID: "meeting", StartsAt: "2024-03-25T09:45:00Z", EndsAt: "2024-03-25T10:00:00Z"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AcceptSchedule(planID, proposal.Slots, false); !errors.Is(err, ErrScheduleConflict) {
+		t.Fatalf("AcceptSchedule = %v, want ErrScheduleConflict", err)
+	}
+	for _, task := range tasks {
+		stored, err := GetGamePlanTask(planID, task.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored.DueAt != "" {
+			t.Errorf("task %d was scheduled at %s despite the conflict", task.ID, stored.DueAt)
+		}
+	}
+
+	accepted, err := AcceptSchedule(planID, proposal.Slots, true)
+	if err != nil {
+		t.Fatalf("AcceptSchedule ignoring imported blocks: %v", err)
+	}
+	if len(accepted) != 2 || accepted[1].DueAt != "2024-03-25T09:30:00Z" {
+		t.Errorf("accepted = %+v", accepted)
+	}
+
+	// Moving a task within its own old slot is not a conflict, but moving it
+	// onto another task is.
+	moved := []ScheduledSlot{{TaskID: tasks[0].ID, DueAt: "2024-03-25T09:15:00Z", Duration: 15}}
+	if _, err := AcceptSchedule(planID, moved, true); err != nil {
+		t.Errorf("moving a task within its own slot: %v", err)
+	}
+	moved[0].DueAt = "2024-03-25T09:30:00Z"
+	if _, err := AcceptSchedule(planID, moved, true); !errors.Is(err, ErrScheduleConflict) {
+		t.Errorf("moving a task onto another: %v, want ErrScheduleConflict", err)
+	}
+}
@@ -0,0 +1,133 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mindful/backend-go/database"
+)
+
+const (
+	TaskStatusOpen      = "open"
+	TaskStatusCompleted = "completed"
+)
+
+// Citation identifies a record that was given to the model when generating a
+// game plan, so the UI can explain where a suggestion came from.
+type Citation struct {
+	Type      string `json:"type"`
+	ID        int    `json:"id"`
+	SessionID string `json:"session_id,omitempty"`
+	CreatedAt string `json:"created_at,omitempty"`
+}
+
+// Key returns the "type:id" reference used for the citation in prompts.
+func (c Citation) Key() string {
+	return fmt.Sprintf("%s:%d", c.Type, c.ID)
+}
+
+// PlannedTask is a task produced by the generator before it is stored.
+// GoalID is set when the task works towards one of the user's goals.
+type PlannedTask struct {
+	Description string
+	Sources     []Citation
+	GoalID      *int
+}
+
+type GamePlanTask struct {
+	ID          int        `json:"id"`
+	GamePlanID  int        `json:"game_plan_id"`
+	Position    int        `json:"position"`
+	Description string     `json:"description"`
+	Status      string     `json:"status"`
+	Sources     []Citation `json:"sources,omitempty"`
+	GoalID      *int       `json:"goal_id,omitempty"`
+	DueAt       string     `json:"due_at,omitempty"`
+	Duration    int        `json:"duration_minutes,omitempty"`
+	CompletedAt string     `json:"completed_at,omitempty"`
+	CreatedAt   string     `json:"created_at"`
+}
+
+const gamePlanTaskColumns = `id, game_plan_id, position, description, status, COALESCE(sources, ''), goal_id, COALESCE(due_at, ''), duration_minutes,
+	completed_at, created_at`
+
+// getGamePlanTasks runs a task query and groups the results by game plan ID.
+func getGamePlanTasks(query string, args ...interface{}) (map[int][]GamePlanTask, error) {
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tasks := map[int][]GamePlanTask{}
+	for rows.Next() {
+		var t GamePlanTask
+		var sources string
+		var goalID, duration sql.NullInt64
+		var completedAt sql.NullString
+		if err := rows.Scan(&t.ID, &t.GamePlanID, &t.Position, &t.Description, &t.Status, &sources, &goalID, &t.DueAt, &duration,
+			&completedAt, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		if goalID.Valid {
+			id := int(goalID.Int64)
+			t.GoalID = &id
+		}
+		t.Duration = int(duration.Int64)
+		t.CompletedAt = completedAt.String
+		if sources != "" {
+			json.Unmarshal([]byte(sources), &t.Sources)
+		}
+		tasks[t.GamePlanID] = append(tasks[t.GamePlanID], t)
+	}
+	return tasks, rows.Err()
+}
+
+// GetLatestGamePlan returns the most recently generated plan with its tasks.
+func GetLatestGamePlan() (GamePlan, error) {
+	plan, err := scanGamePlan(database.DB.QueryRow(`SELECT ` + gamePlanColumns + ` FROM game_plans ORDER BY id DESC LIMIT 1`))
+	if errors.Is(err, sql.ErrNoRows) {
+		return GamePlan{}, ErrNotFound
+	}
+	if err != nil {
+		return GamePlan{}, err
+	}
+
+	tasks, err := getGamePlanTasks(`SELECT `+gamePlanTaskColumns+` FROM gameplan_tasks WHERE game_plan_id = ? ORDER BY position`, plan.ID)
+	if err != nil {
+		return GamePlan{}, err
+	}
+	plan.TaskItems = tasks[plan.ID]
+	return plan, nil
+}
+
+func GetGamePlanTask(planID, taskID int) (GamePlanTask, error) {
+	tasks, err := getGamePlanTasks(`SELECT `+gamePlanTaskColumns+` FROM gameplan_tasks WHERE game_plan_id = ? AND id = ?`, planID, taskID)
+	if err != nil {
+		return GamePlanTask{}, err
+	}
+	if len(tasks[planID]) == 0 {
+		return GamePlanTask{}, ErrNotFound
+	}
+	return tasks[planID][0], nil
+}
+
+var ErrInvalidTaskStatus = errors.New("invalid task status")
+
+// SetGamePlanTaskStatus marks a task open or completed.
+func SetGamePlanTaskStatus(planID, taskID int, status string) (GamePlanTask, error) {
+	var query string
+	switch status {
+	case TaskStatusOpen:
+		query = `UPDATE gameplan_tasks SET status = ?, completed_at = NULL WHERE game_plan_id = ? AND id = ?`
+	case TaskStatusCompleted:
+		query = `UPDATE gameplan_tasks SET status = ?, completed_at = COALESCE(completed_at, CURRENT_TIMESTAMP) WHERE game_plan_id = ? AND id = ?`
+	default:
+		return GamePlanTask{}, ErrInvalidTaskStatus
+	}
+	if err := execOne(query, status, planID, taskID); err != nil {
+		return GamePlanTask{}, err
+	}
+	return GetGamePlanTask(planID, taskID)
+}
@@ -0,0 +1,212 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mindful/backend-go/database"
+	"strings"
+)
+
+// MaxRatingScale is the top of the 0–100 scale used for emotion intensity
+// and outcome ratings in thought records.
+const MaxRatingScale = 100
+
+// EmotionRating is an emotion felt in a situation and how strongly, 0–100.
+type EmotionRating struct {
+	Name      string `json:"name"`
+	Intensity int    `json:"intensity"`
+}
+
+// ThoughtRecord is a CBT thought record: a situation, the automatic thought
+// it triggered, and the work of examining that thought. It is complete once
+// a balanced thought and an outcome rating have been filled in.
+type ThoughtRecord struct {
+	ID               int             `json:"id"`
+	Situation        string          `json:"situation"`
+	AutomaticThought string          `json:"automatic_thought"`
+	Emotions         []EmotionRating `json:"emotions"`
+	Distortions      []string        `json:"distortions"`
+	EvidenceFor      string          `json:"evidence_for"`
+	EvidenceAgainst  string          `json:"evidence_against"`
+	BalancedThought  string          `json:"balanced_thought"`
+	OutcomeRating    *int            `json:"outcome_rating,omitempty"`
+	Completed        bool            `json:"completed"`
+	CompletedAt      string          `json:"completed_at,omitempty"`
+	CreatedAt        string          `json:"created_at"`
+	UpdatedAt        string          `json:"updated_at,omitempty"`
+}
+
+var ErrInvalidThoughtRecord = errors.New("invalid thought record")
+
+func (t ThoughtRecord) complete() bool {
+	return strings.TrimSpace(t.BalancedThought) != "" && t.OutcomeRating != nil
+}
+
+func validateThoughtRecord(t ThoughtRecord) error {
+	if strings.TrimSpace(t.Situation) == "" || strings.TrimSpace(t.AutomaticThought) == "" {
+		return fmt.Errorf("%w: situation and automatic_thought are required", ErrInvalidThoughtRecord)
+	}
+	for _, e := range t.Emotions {
+		if strings.TrimSpace(e.Name) == "" {
+			return fmt.Errorf("%w: every emotion needs a name", ErrInvalidThoughtRecord)
+		}
+		if e.Intensity < 0 || e.Intensity > MaxRatingScale {
+			return fmt.Errorf("%w: emotion intensity must be between 0 and %d", ErrInvalidThoughtRecord, MaxRatingScale)
+		}
+	}
+	for _, d := range t.Distortions {
+		if _, ok := GetDistortion(d); !ok {
+			return fmt.Errorf("%w: unknown distortion %q", ErrInvalidThoughtRecord, d)
+		}
+	}
+	if t.OutcomeRating != nil && (*t.OutcomeRating < 0 || *t.OutcomeRating > MaxRatingScale) {
+		return fmt.Errorf("%w: outcome_rating must be between 0 and %d", ErrInvalidThoughtRecord, MaxRatingScale)
+	}
+	return nil
+}
+
+// thoughtRecordJSON encodes the list columns, storing nil slices as empty
+// arrays so records always read back the same shape.
+func thoughtRecordJSON(t ThoughtRecord) (string, string, error) {
+	if t.Emotions == nil {
+		t.Emotions = []EmotionRating{}
+	}
+	if t.Distortions == nil {
+		t.Distortions = []string{}
+	}
+	emotions, err := json.Marshal(t.Emotions)
+	if err != nil {
+		return "", "", err
+	}
+	distortions, err := json.Marshal(t.Distortions)
+	if err != nil {
+		return "", "", err
+	}
+	return string(emotions), string(distortions), nil
+}
+
+// CreateThoughtRecord validates and stores a thought record and returns it.
+func CreateThoughtRecord(t ThoughtRecord) (ThoughtRecord, error) {
+	if err := validateThoughtRecord(t); err != nil {
+		return ThoughtRecord{}, err
+	}
+	emotions, distortions, err := thoughtRecordJSON(t)
+	if err != nil {
+		return ThoughtRecord{}, err
+	}
+
+	completedAt := "NULL"
+	if t.complete() {
+		completedAt = "CURRENT_TIMESTAMP"
+	}
+	result, err := database.DB.Exec(`INSERT INTO thought_records (situation, automatic_thought, emotions, distortions,
+		evidence_for, evidence_against, balanced_thought, outcome_rating, completed_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, `+completedAt+`)`,
+		t.Situation, t.AutomaticThought, emotions, distortions, t.EvidenceFor, t.EvidenceAgainst, t.BalancedThought, t.OutcomeRating)
+	if err != nil {
+		return ThoughtRecord{}, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return ThoughtRecord{}, err
+	}
+	return GetThoughtRecord(int(id))
+}
+
+// UpdateThoughtRecord replaces a thought record's fields. CompletedAt is set
+// the first time the record becomes complete and cleared if it no longer is.
+func UpdateThoughtRecord(id int, t ThoughtRecord) (ThoughtRecord, error) {
+	if err := validateThoughtRecord(t); err != nil {
+		return ThoughtRecord{}, err
+	}
+	emotions, distortions, err := thoughtRecordJSON(t)
+	if err != nil {
+		return ThoughtRecord{}, err
+	}
+
+	completedAt := "NULL"
+	if t.complete() {
+		completedAt = "COALESCE(completed_at, CURRENT_TIMESTAMP)"
+	}
+	err = execOne(`UPDATE thought_records SET situation = ?, automatic_thought = ?, emotions = ?, distortions = ?,
+		evidence_for = ?, evidence_against = ?, balanced_thought = ?, outcome_rating = ?,
+		completed_at = `+completedAt+`, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		t.Situation, t.AutomaticThought, emotions, distortions, t.EvidenceFor, t.EvidenceAgainst, t.BalancedThought, t.OutcomeRating, id)
+	if err != nil {
+		return ThoughtRecord{}, err
+	}
+	return GetThoughtRecord(id)
+}
+
+const thoughtRecordColumns = `id, situation, automatic_thought, emotions, distortions, evidence_for, evidence_against,
+	balanced_thought, outcome_rating, completed_at, created_at, updated_at`
+
+func scanThoughtRecord(row rowScanner) (ThoughtRecord, error) {
+	var t ThoughtRecord
+	var emotions, distortions string
+	var outcome sql.NullInt64
+	var completedAt, updatedAt sql.NullString
+	err := row.Scan(&t.ID, &t.Situation, &t.AutomaticThought, &emotions, &distortions, &t.EvidenceFor, &t.EvidenceAgainst,
+		&t.BalancedThought, &outcome, &completedAt, &t.CreatedAt, &updatedAt)
+	if err != nil {
+		return ThoughtRecord{}, err
+	}
+	if err := json.Unmarshal([]byte(emotions), &t.Emotions); err != nil {
+		return ThoughtRecord{}, err
+	}
+	if err := json.Unmarshal([]byte(distortions), &t.Distortions); err != nil {
+		return ThoughtRecord{}, err
+	}
+	if outcome.Valid {
+		n := int(outcome.Int64)
+		t.OutcomeRating = &n
+	}
+	t.CompletedAt = completedAt.String
+	t.Completed = completedAt.Valid
+	t.UpdatedAt = updatedAt.String
+	return t, nil
+}
+
+func GetThoughtRecord(id int) (ThoughtRecord, error) {
+	t, err := scanThoughtRecord(database.DB.QueryRow(`SELECT `+thoughtRecordColumns+` FROM thought_records WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return ThoughtRecord{}, ErrNotFound
+	}
+	return t, err
+}
+
+// ListThoughtRecords returns thought records newest first. With
+// completedOnly set, records still in progress are left out. A limit of
+// zero returns every record.
+func ListThoughtRecords(completedOnly bool, limit int) ([]ThoughtRecord, error) {
+	query := `SELECT ` + thoughtRecordColumns + ` FROM thought_records`
+	if completedOnly {
+		query += ` WHERE completed_at IS NOT NULL`
+	}
+	query += ` ORDER BY id DESC`
+	if limit > 0 {
+		query += fmt.Sprintf(` LIMIT %d`, limit)
+	}
+
+	rows, err := database.DB.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []ThoughtRecord{}
+	for rows.Next() {
+		t, err := scanThoughtRecord(rows)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, t)
+	}
+	return records, rows.Err()
+}
+
+func DeleteThoughtRecord(id int) error {
+	return execOne(`DELETE FROM thought_records WHERE id = ?`, id)
+}
@@ -0,0 +1,128 @@
+package models
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestThoughtRecordDistortions(t *testing.T) {
+	openTestDB(t)
+	record := ThoughtRecord{
+		Situation:        "Presentation at work",
+		AutomaticThought: "Everyone thinks I'm useless",
+		Emotions:         []EmotionRating{{Name: "Anxious", Intensity: 80}},
+		Distortions:      []string{"mind-reading", "labeling"},
+	}
+	created, err := CreateThoughtRecord(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(created.Distortions, []string{"mind-reading", "labeling"}) {
+		t.Errorf("distortions = %q, want mind-reading and labeling", created.Distortions)
+	}
+	for _, id := range created.Distortions {
+		if d, ok := GetDistortion(id); !ok || d.Name == "" {
+			t.Errorf("distortion %q is not in the catalog", id)
+		}
+	}
+
+	// Updating replaces the linked distortions.
+	record.Distortions = []string{"catastrophizing"}
+	updated, err := UpdateThoughtRecord(created.ID, record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(updated.Distortions, []string{"catastrophizing"}) {
+		t.Errorf("distortions after update = %q, want catastrophizing", updated.Distortions)
+	}
+
+	// No distortions reads back as an empty list, not null.
+	record.Distortions = nil
+	updated, err = UpdateThoughtRecord(created.ID, record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Distortions == nil || len(updated.Distortions) != 0 {
+		t.Errorf("distortions after clearing = %#v, want an empty list", updated.Distortions)
+	}
+}
+
+func TestThoughtRecordRejectsUnknownDistortion(t *testing.T) {
+	openTestDB(t)
+	record := ThoughtRecord{
+		Situation:        "Missed the bus",
+		AutomaticThought: "Nothing ever works out",
+		Distortions:      []string{"overgeneralization", "doom-spiral"},
+	}
+	if _, err := CreateThoughtRecord(record); !errors.Is(err, ErrInvalidThoughtRecord) {
+		t.Errorf("CreateThoughtRecord = %v, want ErrInvalidThoughtRecord", err)
+	}
+	records, err := ListThoughtRecords(false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 0 {
+		t.Errorf("stored %+v despite the unknown distortion", records)
+	}
+
+	record.Distortions = []string{"overgeneralization"}
+	created, err := CreateThoughtRecord(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record.Distortions = []string{"Overgeneralization"}
+	if _, err := UpdateThoughtRecord(created.ID, record); !errors.Is(err, ErrInvalidThoughtRecord) {
+		t.Errorf("UpdateThoughtRecord = %v, want ErrInvalidThoughtRecord", err)
+	}
+	stored, err := GetThoughtRecord(created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(stored.Distortions, []string{"overgeneralization"}) {
+		t.Errorf("distortions after a rejected update = %q", stored.Distortions)
+	}
+}
+
+func TestThoughtRecordCompletion(t *testing.T) {
+	openTestDB(t)
+	draft, err := CreateThoughtRecord(ThoughtRecord{Situation: "Argument", AutomaticThought: "It's all my fault", Distortions: []string{"personalization"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if draft.Completed || draft.CompletedAt != "" {
+		t.Errorf("draft = %+v, want it incomplete", draft)
+	}
+
+	done := draft
+	done.BalancedThought = "We both had a part in it."
+	done.OutcomeRating = intPtr(30)
+	done, err = UpdateThoughtRecord(draft.ID, done)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !done.Completed || done.CompletedAt == "" {
+		t.Errorf("record = %+v, want it completed", done)
+	}
+
+	records, err := ListThoughtRecords(true, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].ID != draft.ID || !reflect.DeepEqual(records[0].Distortions, []string{"personalization"}) {
+		t.Errorf("completed records = %+v", records)
+	}
+
+	// Removing the outcome rating makes the record a draft again.
+	done.OutcomeRating = nil
+	reopened, err := UpdateThoughtRecord(draft.ID, done)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.Completed || reopened.CompletedAt != "" {
+		t.Errorf("record = %+v, want it incomplete again", reopened)
+	}
+	if records, err := ListThoughtRecords(true, 0); err != nil || len(records) != 0 {
+		t.Errorf("completed records = %+v, %v, want none", records, err)
+	}
+}
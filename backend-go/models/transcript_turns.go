@@ -0,0 +1,141 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"mindful/backend-go/database"
+	"strings"
+)
+
+// SpeakerLabel turns a speaker name into the single-word label transcripts
+// use, so "Dr Smith" becomes "Dr_Smith".
+func SpeakerLabel(name string) string {
+	label := strings.Join(strings.Fields(strings.ReplaceAll(name, ":", "")), "_")
+	if len(label) > 32 {
+		label = label[:32]
+	}
+	return label
+}
+
+// RenderTranscript writes turns as "Speaker: text" lines, the form
+// transcripts are stored and analyzed in.
+func RenderTranscript(turns []TranscriptTurn) string {
+	lines := make([]string, 0, len(turns))
+	for _, t := range turns {
+		text := strings.Join(strings.Fields(t.Text), " ")
+		if t.Speaker != "" {
+			text = t.Speaker + ": " + text
+		}
+		lines = append(lines, text)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// TranscriptSessionExists reports whether a transcript with the session ID
+// is stored.
+func TranscriptSessionExists(sessionID string) (bool, error) {
+	var n int
+	err := database.DB.QueryRow(`SELECT COUNT(*) FROM transcripts WHERE session_id = ?`, sessionID).Scan(&n)
+	return n > 0, err
+}
+
+// ImportTranscript stores a transcript with its timed turns. source names
+// the format it was imported from. Only the ProsodyTopEmotions highest
+// prosody scores of each turn are kept.
+func ImportTranscript(sessionID, source string, turns []TranscriptTurn) (Transcript, error) {
+	return importTranscript(sessionID, source, turns, false)
+}
+
+// ReplaceTranscript stores a transcript like ImportTranscript, removing the
+// session's earlier transcripts in the same transaction.
+func ReplaceTranscript(sessionID, source string, turns []TranscriptTurn) (Transcript, error) {
+	return importTranscript(sessionID, source, turns, true)
+}
+
+func importTranscript(sessionID, source string, turns []TranscriptTurn, replace bool) (Transcript, error) {
+	for i := range turns {
+		turns[i].Index = i
+		turns[i].Prosody = trimProsody(turns[i].Prosody, ProsodyTopEmotions)
+	}
+	t := Transcript{SessionID: sessionID, Transcript: RenderTranscript(turns), Turns: turns}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return Transcript{}, err
+	}
+	defer tx.Rollback()
+
+	if replace {
+		if _, err := deleteSessionTranscripts(tx, sessionID); err != nil {
+			return Transcript{}, err
+		}
+	}
+	result, err := tx.Exec(`INSERT INTO transcripts (session_id, transcript, source) VALUES (?, ?, ?)`, t.SessionID, t.Transcript, source)
+	if err != nil {
+		return Transcript{}, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return Transcript{}, err
+	}
+	t.ID = int(id)
+	for _, turn := range turns {
+		var prosody interface{}
+		if len(turn.Prosody) > 0 {
+			data, err := json.Marshal(turn.Prosody)
+			if err != nil {
+				return Transcript{}, err
+			}
+			prosody = string(data)
+		}
+		_, err := tx.Exec(`INSERT INTO transcript_turns (transcript_id, turn_index, speaker, text, start_ms, end_ms, prosody) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			t.ID, turn.Index, turn.Speaker, turn.Text, turn.StartMs, turn.EndMs, prosody)
+		if err != nil {
+			return Transcript{}, err
+		}
+	}
+	if database.SearchEnabled {
+		if err := indexTranscript(tx, t); err != nil {
+			return Transcript{}, err
+		}
+	}
+	if err := tx.QueryRow(`SELECT created_at FROM transcripts WHERE id = ?`, t.ID).Scan(&t.CreatedAt); err != nil {
+		return Transcript{}, err
+	}
+	return t, tx.Commit()
+}
+
+// GetTranscriptTurns returns the stored timed turns of a transcript, with
+// their prosody scores, or none for transcripts that were added as plain
+// text.
+func GetTranscriptTurns(transcriptID int) ([]TranscriptTurn, error) {
+	rows, err := database.DB.Query(`SELECT turn_index, speaker, text, start_ms, end_ms, prosody FROM transcript_turns WHERE transcript_id = ? ORDER BY turn_index`,
+		transcriptID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var turns []TranscriptTurn
+	for rows.Next() {
+		var t TranscriptTurn
+		var start, end sql.NullInt64
+		var prosody sql.NullString
+		if err := rows.Scan(&t.Index, &t.Speaker, &t.Text, &start, &end, &prosody); err != nil {
+			return nil, err
+		}
+		if prosody.String != "" {
+			if err := json.Unmarshal([]byte(prosody.String), &t.Prosody); err != nil {
+				return nil, err
+			}
+		}
+		if start.Valid {
+			t.StartMs = &start.Int64
+		}
+		if end.Valid {
+			t.EndMs = &end.Int64
+		}
+		turns = append(turns, t)
+	}
+	return turns, rows.Err()
+}
@@ -0,0 +1,148 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"mindful/backend-go/database"
+	"time"
+)
+
+const (
+	TranscriptionStatusPending   = "pending"
+	TranscriptionStatusRunning   = "running"
+	TranscriptionStatusCompleted = "completed"
+	TranscriptionStatusFailed    = "failed"
+)
+
+// TranscriptionJob turns a session's recording into its transcript. With
+// Diarize the transcriber labels speakers, and turns of UserSpeaker are
+// stored as the user's. Replace allows overwriting an existing transcript.
+type TranscriptionJob struct {
+	ID            int    `json:"id"`
+	SessionID     string `json:"session_id"`
+	Status        string `json:"status"`
+	Diarize       bool   `json:"diarize"`
+	Language      string `json:"language,omitempty"`
+	UserSpeaker   string `json:"user_speaker,omitempty"`
+	Replace       bool   `json:"replace"`
+	Attempts      int    `json:"attempts"`
+	NextAttemptAt string `json:"next_attempt_at,omitempty"`
+	TranscriptID  *int   `json:"transcript_id,omitempty"`
+	Error         string `json:"error,omitempty"`
+	CreatedAt     string `json:"created_at"`
+	FinishedAt    string `json:"finished_at,omitempty"`
+}
+
+const transcriptionJobColumns = `id, session_id, status, diarize, language, user_speaker, replace_existing, attempts,
+	COALESCE(next_attempt_at, ''), transcript_id, error, created_at, COALESCE(finished_at, '')`
+
+func scanTranscriptionJob(row rowScanner) (TranscriptionJob, error) {
+	var j TranscriptionJob
+	var transcriptID sql.NullInt64
+	err := row.Scan(&j.ID, &j.SessionID, &j.Status, &j.Diarize, &j.Language, &j.UserSpeaker, &j.Replace, &j.Attempts,
+		&j.NextAttemptAt, &transcriptID, &j.Error, &j.CreatedAt, &j.FinishedAt)
+	if err != nil {
+		return TranscriptionJob{}, err
+	}
+	if transcriptID.Valid {
+		id := int(transcriptID.Int64)
+		j.TranscriptID = &id
+	}
+	return j, nil
+}
+
+func queryTranscriptionJobs(query string, args ...interface{}) ([]TranscriptionJob, error) {
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []TranscriptionJob{}
+	for rows.Next() {
+		j, err := scanTranscriptionJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+func GetTranscriptionJob(id int) (TranscriptionJob, error) {
+	j, err := scanTranscriptionJob(database.DB.QueryRow(`SELECT `+transcriptionJobColumns+` FROM transcription_jobs WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return TranscriptionJob{}, ErrNotFound
+	}
+	return j, err
+}
+
+// ListTranscriptionJobs returns a session's transcription jobs, newest first.
+func ListTranscriptionJobs(sessionID string) ([]TranscriptionJob, error) {
+	return queryTranscriptionJobs(`SELECT `+transcriptionJobColumns+` FROM transcription_jobs WHERE session_id = ? ORDER BY id DESC`, sessionID)
+}
+
+// QueueTranscriptionJob queues a job due immediately. A session's pending or
+// running job is returned instead of queueing a second one.
+func QueueTranscriptionJob(j TranscriptionJob, now time.Time) (TranscriptionJob, error) {
+	active, err := scanTranscriptionJob(database.DB.QueryRow(`SELECT `+transcriptionJobColumns+` FROM transcription_jobs
+		WHERE session_id = ? AND status IN (?, ?) ORDER BY id LIMIT 1`, j.SessionID, TranscriptionStatusPending, TranscriptionStatusRunning))
+	if err == nil {
+		return active, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return TranscriptionJob{}, err
+	}
+
+	result, err := database.DB.Exec(`INSERT INTO transcription_jobs (session_id, status, diarize, language, user_speaker, replace_existing, next_attempt_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		j.SessionID, TranscriptionStatusPending, j.Diarize, j.Language, j.UserSpeaker, j.Replace, now.UTC().Format(TimestampLayout))
+	if err != nil {
+		return TranscriptionJob{}, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return TranscriptionJob{}, err
+	}
+	return GetTranscriptionJob(int(id))
+}
+
+// DueTranscriptionJobs returns pending jobs whose next attempt is due and
+// running jobs whose lease has run out.
+func DueTranscriptionJobs(now time.Time, limit int) ([]TranscriptionJob, error) {
+	return queryTranscriptionJobs(`SELECT `+transcriptionJobColumns+` FROM transcription_jobs WHERE status IN (?, ?) AND next_attempt_at <= ?
+		ORDER BY next_attempt_at, id LIMIT ?`,
+		TranscriptionStatusPending, TranscriptionStatusRunning, now.UTC().Format(TimestampLayout), limit)
+}
+
+// ClaimTranscriptionJob marks a due job running for the length of the lease
+// and counts the attempt. It returns false if another worker got there
+// first. A job whose worker dies is retried once the lease runs out.
+func ClaimTranscriptionJob(id int, now time.Time, lease time.Duration) (bool, error) {
+	result, err := database.DB.Exec(`UPDATE transcription_jobs SET status = ?, attempts = attempts + 1, next_attempt_at = ?
+		WHERE id = ? AND status IN (?, ?) AND next_attempt_at <= ?`,
+		TranscriptionStatusRunning, now.Add(lease).UTC().Format(TimestampLayout), id,
+		TranscriptionStatusPending, TranscriptionStatusRunning, now.UTC().Format(TimestampLayout))
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+// CompleteTranscriptionJob records the transcript a job produced.
+func CompleteTranscriptionJob(id, transcriptID int, now time.Time) error {
+	return execOne(`UPDATE transcription_jobs SET status = ?, transcript_id = ?, error = '', next_attempt_at = NULL, finished_at = ? WHERE id = ?`,
+		TranscriptionStatusCompleted, transcriptID, now.UTC().Format(TimestampLayout), id)
+}
+
+// FailTranscriptionJob records a failed attempt. A zero retryAt means no
+// more attempts will be made.
+func FailTranscriptionJob(id int, jobErr string, retryAt, now time.Time) error {
+	if retryAt.IsZero() {
+		return execOne(`UPDATE transcription_jobs SET status = ?, error = ?, next_attempt_at = NULL, finished_at = ? WHERE id = ?`,
+			TranscriptionStatusFailed, jobErr, now.UTC().Format(TimestampLayout), id)
+	}
+	return execOne(`UPDATE transcription_jobs SET status = ?, error = ?, next_attempt_at = ? WHERE id = ?`,
+		TranscriptionStatusPending, jobErr, retryAt.UTC().Format(TimestampLayout), id)
+}
@@ -0,0 +1,50 @@
+package models
+
+import "strings"
+
+// TranscriptTurn is a single speaker turn within a transcript. Transcripts are
+// stored as one "Speaker: text" line per turn. Imported transcripts also keep
+// their turns with start and end offsets in milliseconds from the start of
+// the session. Turns captured from a voice session carry the strongest
+// prosody (vocal emotion) scores the voice service measured, from 0 to 1.
+type TranscriptTurn struct {
+	Index   int                `json:"index"`
+	Speaker string             `json:"speaker"`
+	Text    string             `json:"text"`
+	StartMs *int64             `json:"start_ms,omitempty"`
+	EndMs   *int64             `json:"end_ms,omitempty"`
+	Prosody map[string]float64 `json:"prosody,omitempty"`
+}
+
+// SplitTranscriptTurns parses a stored transcript into turns. Lines without a
+// speaker prefix are treated as continuations of the previous turn.
+func SplitTranscriptTurns(transcript string) []TranscriptTurn {
+	var turns []TranscriptTurn
+	for _, line := range strings.Split(transcript, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		speaker, text, ok := strings.Cut(line, ":")
+		if ok && isSpeakerLabel(speaker) {
+			turns = append(turns, TranscriptTurn{
+				Index:   len(turns),
+				Speaker: strings.TrimSpace(speaker),
+				Text:    strings.TrimSpace(text),
+			})
+			continue
+		}
+		if len(turns) == 0 {
+			turns = append(turns, TranscriptTurn{Text: line})
+			continue
+		}
+		turns[len(turns)-1].Text += " " + line
+	}
+	return turns
+}
+
+// isSpeakerLabel accepts short single-word prefixes such as "user" or
+// "assistant", so a colon inside ordinary speech does not start a new turn.
+func isSpeakerLabel(s string) bool {
+	return s != "" && len(s) <= 32 && !strings.ContainsAny(s, " \t")
+}
@@ -0,0 +1,421 @@
+package models
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mindful/backend-go/database"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Domain events that webhooks can subscribe to. EventPing is only sent by
+// the ping endpoint, to check a receiver.
+const (
+	EventSessionCompleted  = "session.completed"
+	EventJournalCreated    = "journal.created"
+	EventGamePlanGenerated = "gameplan.generated"
+	EventTaskCompleted     = "task.completed"
+	EventSafetyFlagged     = "safety.flagged"
+	EventPing              = "ping"
+)
+
+// WebhookEventTypes lists the events a subscription may name. "*"
+// subscribes to all of them.
+var WebhookEventTypes = []string{EventSessionCompleted, EventJournalCreated, EventGamePlanGenerated, EventTaskCompleted, EventSafetyFlagged}
+
+const (
+	DeliveryStatusPending   = "pending"
+	DeliveryStatusSucceeded = "succeeded"
+	DeliveryStatusFailed    = "failed"
+)
+
+var ErrInvalidWebhook = errors.New("invalid webhook")
+
+// WebhookSubscription sends the listed events to URL. Secret signs each
+// delivery; it is only returned when the subscription is created or the
+// secret is rotated.
+type WebhookSubscription struct {
+	ID          int      `json:"id"`
+	URL         string   `json:"url"`
+	Secret      string   `json:"secret,omitempty"`
+	EventTypes  []string `json:"event_types"`
+	Description string   `json:"description,omitempty"`
+	Active      *bool    `json:"active,omitempty"`
+	CreatedAt   string   `json:"created_at"`
+	UpdatedAt   string   `json:"updated_at,omitempty"`
+}
+
+// Subscribed reports whether the subscription wants events of a type.
+func (s WebhookSubscription) Subscribed(eventType string) bool {
+	for _, t := range s.EventTypes {
+		if t == "*" || t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery is one event queued for one subscription, with the
+// outcome of its latest attempt. Redeliveries are new rows pointing at the
+// delivery they repeat.
+type WebhookDelivery struct {
+	ID             int             `json:"id"`
+	SubscriptionID int             `json:"subscription_id"`
+	EventID        string          `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  string          `json:"next_attempt_at,omitempty"`
+	LastStatusCode int             `json:"last_status_code,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	RedeliveryOf   *int            `json:"redelivery_of,omitempty"`
+	CreatedAt      string          `json:"created_at"`
+	DeliveredAt    string          `json:"delivered_at,omitempty"`
+}
+
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+func validateWebhook(s *WebhookSubscription) error {
+	s.URL = strings.TrimSpace(s.URL)
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: url must be an http or https URL", ErrInvalidWebhook)
+	}
+	if len(s.EventTypes) == 0 {
+		return fmt.Errorf("%w: event_types must not be empty", ErrInvalidWebhook)
+	}
+	seen := map[string]bool{}
+	var types []string
+	for _, t := range s.EventTypes {
+		t = strings.ToLower(strings.TrimSpace(t))
+		known := t == "*"
+		for _, et := range WebhookEventTypes {
+			known = known || t == et
+		}
+		if !known {
+			return fmt.Errorf("%w: unknown event type %q", ErrInvalidWebhook, t)
+		}
+		if !seen[t] {
+			seen[t] = true
+			types = append(types, t)
+		}
+	}
+	s.EventTypes = types
+	if s.Active == nil {
+		active := true
+		s.Active = &active
+	}
+	return nil
+}
+
+// CreateWebhook stores a subscription, generating a secret unless one is
+// given, and returns it with the secret.
+func CreateWebhook(s WebhookSubscription) (WebhookSubscription, error) {
+	if err := validateWebhook(&s); err != nil {
+		return WebhookSubscription{}, err
+	}
+	if s.Secret == "" {
+		secret, err := newWebhookSecret()
+		if err != nil {
+			return WebhookSubscription{}, err
+		}
+		s.Secret = secret
+	}
+	result, err := database.DB.Exec(`INSERT INTO webhook_subscriptions (url, secret, event_types, description, active) VALUES (?, ?, ?, ?, ?)`,
+		s.URL, s.Secret, strings.Join(s.EventTypes, ","), s.Description, *s.Active)
+	if err != nil {
+		return WebhookSubscription{}, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return WebhookSubscription{}, err
+	}
+	created, err := GetWebhook(int(id))
+	created.Secret = s.Secret
+	return created, err
+}
+
+// UpdateWebhook changes a subscription's URL, events, description and
+// active flag. The secret is kept unless a new one is given.
+func UpdateWebhook(id int, s WebhookSubscription) (WebhookSubscription, error) {
+	if err := validateWebhook(&s); err != nil {
+		return WebhookSubscription{}, err
+	}
+	err := execOne(`UPDATE webhook_subscriptions SET url = ?, secret = COALESCE(?, secret), event_types = ?, description = ?, active = ?,
+		updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		s.URL, nullString(s.Secret), strings.Join(s.EventTypes, ","), s.Description, *s.Active, id)
+	if err != nil {
+		return WebhookSubscription{}, err
+	}
+	return GetWebhook(id)
+}
+
+// RotateWebhookSecret replaces a subscription's secret and returns the
+// subscription with the new one.
+func RotateWebhookSecret(id int) (WebhookSubscription, error) {
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return WebhookSubscription{}, err
+	}
+	if err := execOne(`UPDATE webhook_subscriptions SET secret = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, secret, id); err != nil {
+		return WebhookSubscription{}, err
+	}
+	s, err := GetWebhook(id)
+	s.Secret = secret
+	return s, err
+}
+
+const webhookColumns = `id, url, event_types, description, active, created_at, updated_at`
+
+func scanWebhook(row rowScanner) (WebhookSubscription, error) {
+	var s WebhookSubscription
+	var types string
+	var active bool
+	var updatedAt sql.NullString
+	if err := row.Scan(&s.ID, &s.URL, &types, &s.Description, &active, &s.CreatedAt, &updatedAt); err != nil {
+		return WebhookSubscription{}, err
+	}
+	s.EventTypes = strings.Split(types, ",")
+	s.Active = &active
+	s.UpdatedAt = updatedAt.String
+	return s, nil
+}
+
+func GetWebhook(id int) (WebhookSubscription, error) {
+	s, err := scanWebhook(database.DB.QueryRow(`SELECT `+webhookColumns+` FROM webhook_subscriptions WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return WebhookSubscription{}, ErrNotFound
+	}
+	return s, err
+}
+
+// GetWebhookSecret returns the secret deliveries to a subscription are
+// signed with.
+func GetWebhookSecret(id int) (string, error) {
+	var secret string
+	err := database.DB.QueryRow(`SELECT secret FROM webhook_subscriptions WHERE id = ?`, id).Scan(&secret)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	return secret, err
+}
+
+func ListWebhooks() ([]WebhookSubscription, error) {
+	rows, err := database.DB.Query(`SELECT ` + webhookColumns + ` FROM webhook_subscriptions ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := []WebhookSubscription{}
+	for rows.Next() {
+		s, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, s)
+	}
+	return subs, rows.Err()
+}
+
+// DeleteWebhook removes a subscription and its delivery log.
+func DeleteWebhook(id int) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM webhook_subscriptions WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	if _, err := tx.Exec(`DELETE FROM webhook_deliveries WHERE subscription_id = ?`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// QueueWebhookDeliveries queues an event for every active subscription
+// that wants it, due immediately, and returns the new deliveries. With
+// subscriptionID set, only that subscription gets it, whatever its events.
+func QueueWebhookDeliveries(eventID, eventType string, payload []byte, subscriptionID int, now time.Time) ([]WebhookDelivery, error) {
+	subs, err := ListWebhooks()
+	if err != nil {
+		return nil, err
+	}
+	var deliveries []WebhookDelivery
+	for _, s := range subs {
+		if subscriptionID != 0 {
+			if s.ID != subscriptionID {
+				continue
+			}
+		} else if !*s.Active || !s.Subscribed(eventType) {
+			continue
+		}
+		d, err := insertDelivery(WebhookDelivery{
+			SubscriptionID: s.ID,
+			EventID:        eventID,
+			EventType:      eventType,
+			Payload:        payload,
+		}, now)
+		if err != nil {
+			return deliveries, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, nil
+}
+
+func insertDelivery(d WebhookDelivery, now time.Time) (WebhookDelivery, error) {
+	result, err := database.DB.Exec(`INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload, status, next_attempt_at, redelivery_of)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		d.SubscriptionID, d.EventID, d.EventType, string(d.Payload), DeliveryStatusPending, now.UTC().Format(TimestampLayout), d.RedeliveryOf)
+	if err != nil {
+		return WebhookDelivery{}, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return WebhookDelivery{}, err
+	}
+	return GetWebhookDelivery(int(id))
+}
+
+// RedeliverWebhook queues a delivery's event again as a new delivery, due
+// immediately, leaving the original in the log.
+func RedeliverWebhook(id int, now time.Time) (WebhookDelivery, error) {
+	d, err := GetWebhookDelivery(id)
+	if err != nil {
+		return WebhookDelivery{}, err
+	}
+	if _, err := GetWebhook(d.SubscriptionID); err != nil {
+		return WebhookDelivery{}, err
+	}
+	return insertDelivery(WebhookDelivery{
+		SubscriptionID: d.SubscriptionID,
+		EventID:        d.EventID,
+		EventType:      d.EventType,
+		Payload:        d.Payload,
+		RedeliveryOf:   &d.ID,
+	}, now)
+}
+
+const deliveryColumns = `id, subscription_id, event_id, event_type, payload, status, attempts, COALESCE(next_attempt_at, ''),
+	last_status_code, last_error, redelivery_of, created_at, COALESCE(delivered_at, '')`
+
+func scanDelivery(row rowScanner) (WebhookDelivery, error) {
+	var d WebhookDelivery
+	var payload string
+	var statusCode, redeliveryOf sql.NullInt64
+	err := row.Scan(&d.ID, &d.SubscriptionID, &d.EventID, &d.EventType, &payload, &d.Status, &d.Attempts, &d.NextAttemptAt,
+		&statusCode, &d.LastError, &redeliveryOf, &d.CreatedAt, &d.DeliveredAt)
+	if err != nil {
+		return WebhookDelivery{}, err
+	}
+	d.Payload = json.RawMessage(payload)
+	d.LastStatusCode = int(statusCode.Int64)
+	if redeliveryOf.Valid {
+		id := int(redeliveryOf.Int64)
+		d.RedeliveryOf = &id
+	}
+	return d, nil
+}
+
+func queryDeliveries(query string, args ...interface{}) ([]WebhookDelivery, error) {
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+func GetWebhookDelivery(id int) (WebhookDelivery, error) {
+	d, err := scanDelivery(database.DB.QueryRow(`SELECT `+deliveryColumns+` FROM webhook_deliveries WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return WebhookDelivery{}, ErrNotFound
+	}
+	return d, err
+}
+
+// ListWebhookDeliveries returns a subscription's delivery log, newest
+// first, optionally only deliveries with a status.
+func ListWebhookDeliveries(subscriptionID int, status string, limit int) ([]WebhookDelivery, error) {
+	if _, err := GetWebhook(subscriptionID); err != nil {
+		return nil, err
+	}
+	query := `SELECT ` + deliveryColumns + ` FROM webhook_deliveries WHERE subscription_id = ?`
+	args := []interface{}{subscriptionID}
+	if status != "" {
+		query += ` AND status = ?`
+		args = append(args, status)
+	}
+	return queryDeliveries(query+` ORDER BY id DESC LIMIT ?`, append(args, limit)...)
+}
+
+// DueWebhookDeliveries returns pending deliveries whose next attempt is due.
+func DueWebhookDeliveries(now time.Time, limit int) ([]WebhookDelivery, error) {
+	return queryDeliveries(`SELECT `+deliveryColumns+` FROM webhook_deliveries WHERE status = ? AND next_attempt_at <= ?
+		ORDER BY next_attempt_at, id LIMIT ?`, DeliveryStatusPending, now.UTC().Format(TimestampLayout), limit)
+}
+
+// ClaimWebhookDelivery reserves a due delivery for one attempt by moving
+// its next attempt past the lease. It returns false if another worker got
+// there first. A worker that dies mid-attempt leaves the delivery to be
+// retried once the lease runs out.
+func ClaimWebhookDelivery(id int, now time.Time, lease time.Duration) (bool, error) {
+	result, err := database.DB.Exec(`UPDATE webhook_deliveries SET next_attempt_at = ? WHERE id = ? AND status = ? AND next_attempt_at <= ?`,
+		now.Add(lease).UTC().Format(TimestampLayout), id, DeliveryStatusPending, now.UTC().Format(TimestampLayout))
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+// RecordWebhookAttempt stores the outcome of an attempt. A zero retryAt
+// with a failure means no more attempts will be made.
+func RecordWebhookAttempt(id int, statusCode int, attemptErr string, succeeded bool, retryAt, now time.Time) error {
+	status, next, delivered := DeliveryStatusPending, interface{}(nil), interface{}(nil)
+	switch {
+	case succeeded:
+		status = DeliveryStatusSucceeded
+		delivered = now.UTC().Format(TimestampLayout)
+	case retryAt.IsZero():
+		status = DeliveryStatusFailed
+	default:
+		next = retryAt.UTC().Format(TimestampLayout)
+	}
+	var code interface{}
+	if statusCode != 0 {
+		code = statusCode
+	}
+	return execOne(`UPDATE webhook_deliveries SET status = ?, attempts = attempts + 1, next_attempt_at = ?, last_status_code = ?,
+		last_error = ?, delivered_at = ? WHERE id = ?`, status, next, code, attemptErr, delivered, id)
+}
@@ -10,11 +10,11 @@ import (
 	"google.golang.org/genai"
 	"log"
 	"os"
-	"github.com/google/generative-ai-go/genai"
-	"google.golang.org/api/option"
 )
 
-func GenerateGamePlan(transcripts []string, journals []string) (tasks []string, summary string, err error) {
+// GenerateGamePlan asks Gemini for a new game plan based on the retrieved
+// context and stores it. Each task cites the context records it was based on.
+func GenerateGamePlan(planContext GamePlanContext) (tasks []models.PlannedTask, summary string, err error) {
     log.Println("Initializing Gemini API client...")
     ctx := context.Background()
 	apiKey := os.Getenv("GEMINI_API_KEY")
@@ -31,26 +31,20 @@ func GenerateGamePlan(transcripts []string, journals []string) (tasks []string,
         return nil, "", errors.New("failed to initialize Gemini API client")
     }
 
-    log.Println("Combining transcripts and journals into a single prompt...")
-    var combinedData string
-    for _, transcript := range transcripts {
-        combinedData += transcript + "\n"
-    }
-    for _, journal := range journals {
-        combinedData += journal + "\n"
-    }
-
-    prompt := `You are a supportive AI therapist. Based on these conversations and journal entries, generate 3 specific wellness tasks and summarize the user's current emotional state. 
+    log.Printf("Building prompt from %d retrieved records...", len(planContext.Citations))
+    prompt := `You are a supportive AI therapist. Based on the user's most recent session, their previous game plan and related past entries below, generate 3 specific wellness tasks and summarize the user's current emotional state.
+    Build on completed tasks rather than repeating them, and help the user follow through on commitments they made in their sessions. Each record is labelled with a reference such as [journal:4]; for each task, list the references of the records that led you to suggest it.
+    If the user has active goals, prefer tasks that move them towards their next open milestone, and set "goal" to the goal's reference.
     Respond in the following JSON format:
     {
       "tasks": [
-        "Task 1",
-        "Task 2",
-        "Task 3"
+        {"task": "Task 1", "sources": ["transcript:12"], "goal": "goal:2"},
+        {"task": "Task 2", "sources": ["journal:4"]},
+        {"task": "Task 3", "sources": []}
       ],
       "summary": "Summary of the user's emotional state"
     }
-    ` + combinedData
+    ` + planContext.Text
 
     log.Println("Sending request to Gemini API...")
     result, err := client.Models.GenerateContent(
@@ -71,42 +65,100 @@ func GenerateGamePlan(transcripts []string, journals []string) (tasks []string,
     // Log the raw response
     log.Printf("Raw response from Gemini API: %s", result.Text())
 
-    // Extract the actual JSON content from the response
-    rawResponse := result.Text()
-    rawResponse = strings.TrimPrefix(rawResponse, "```json\n")
-    rawResponse = strings.TrimSuffix(rawResponse, "\n```")
-
     log.Println("Parsing the response...")
-    var gamePlanResp struct {
-        Tasks   []string `json:"tasks"`
-        Summary string   `json:"summary"`
-    }
-    if err := json.Unmarshal([]byte(rawResponse), &gamePlanResp); err != nil {
+    tasks, summary, err = parseGamePlanResponse(result.Text(), planContext.Citations)
+    if err != nil {
         log.Printf("Error parsing Gemini API response: %v", err)
         return nil, "", errors.New("failed to parse Gemini API response")
     }
 
     // Log parsed tasks and summary
-    log.Printf("Parsed tasks: %v", gamePlanResp.Tasks)
-    log.Printf("Parsed summary: %s", gamePlanResp.Summary)
-
-    tasks = gamePlanResp.Tasks
-    summary = gamePlanResp.Summary
+    log.Printf("Parsed tasks: %v", tasks)
+    log.Printf("Parsed summary: %s", summary)
 
     log.Println("Categorizing emotional state...")
-    emotionalState := CategorizeEmotionalState(summary)
+    emotionalState, ok := "", false
+    if planContext.Emotions != nil {
+        emotionalState, ok = EmotionalStateFromProsody(planContext.Emotions.Dominant)
+    }
+    if !ok {
+        emotionalState = CategorizeEmotionalState(summary)
+    }
 
     log.Println("Storing the game plan in the database...")
-    err = models.StoreGamePlan(tasks, summary, emotionalState)
+    planID, err := models.StoreGamePlan(tasks, summary, emotionalState, planContext.Citations)
     if err != nil {
         log.Printf("Error storing game plan in the database: %v", err)
         return nil, "", errors.New("failed to store game plan in the database")
     }
 
+    descriptions := make([]string, len(tasks))
+    for i, t := range tasks {
+        descriptions[i] = t.Description
+    }
+    EmitEvent(models.EventGamePlanGenerated, map[string]interface{}{
+        "game_plan_id": planID,
+        "tasks":        descriptions,
+    })
+
     log.Println("Game plan generated successfully.")
     return tasks, summary, nil
 }
 
+// parseGamePlanResponse extracts tasks and summary from the model's JSON.
+// Tasks may be plain strings or objects with sources and a goal; references
+// that do not match a record given to the model are dropped.
+func parseGamePlanResponse(raw string, citations []models.Citation) ([]models.PlannedTask, string, error) {
+    // Extract the actual JSON content from the response
+    raw = strings.TrimSpace(raw)
+    raw = strings.TrimPrefix(raw, "```json")
+    raw = strings.TrimSuffix(raw, "```")
+
+    var resp struct {
+        Tasks   []json.RawMessage `json:"tasks"`
+        Summary string            `json:"summary"`
+    }
+    if err := json.Unmarshal([]byte(strings.TrimSpace(raw)), &resp); err != nil {
+        return nil, "", err
+    }
+
+    byKey := map[string]models.Citation{}
+    for _, c := range citations {
+        byKey[c.Key()] = c
+    }
+
+    var tasks []models.PlannedTask
+    for _, rawTask := range resp.Tasks {
+        var task struct {
+            Task    string   `json:"task"`
+            Sources []string `json:"sources"`
+            Goal    string   `json:"goal"`
+        }
+        if err := json.Unmarshal(rawTask, &task.Task); err != nil {
+            if err := json.Unmarshal(rawTask, &task); err != nil {
+                return nil, "", err
+            }
+        }
+        if strings.TrimSpace(task.Task) == "" {
+            continue
+        }
+
+        planned := models.PlannedTask{Description: task.Task}
+        for _, ref := range task.Sources {
+            ref = strings.Trim(strings.TrimSpace(ref), "[]")
+            if c, ok := byKey[ref]; ok {
+                planned.Sources = append(planned.Sources, c)
+            }
+        }
+        if c, ok := byKey[strings.Trim(strings.TrimSpace(task.Goal), "[]")]; ok && c.Type == "goal" {
+            goalID := c.ID
+            planned.GoalID = &goalID
+        }
+        tasks = append(tasks, planned)
+    }
+    return tasks, resp.Summary, nil
+}
+
 // Categorize emotional state into predefined categories
 func CategorizeEmotionalState(summary string) string {
 	if containsWord(summary, []string{"happy", "joyful", "content"}) {
@@ -123,6 +175,33 @@ func CategorizeEmotionalState(summary string) string {
 	return "neutral"
 }
 
+// prosodyStates maps the emotions the voice service measures to the
+// emotional states game plans are tagged with.
+var prosodyStates = map[string]string{
+	"Joy": "happy", "Amusement": "happy", "Contentment": "happy", "Satisfaction": "happy",
+	"Excitement": "happy", "Ecstasy": "happy", "Pride": "happy", "Relief": "happy",
+	"Triumph": "happy", "Love": "happy", "Gratitude": "happy",
+	"Sadness": "sad", "Disappointment": "sad", "Tiredness": "sad", "Pain": "sad",
+	"Empathic Pain": "sad", "Guilt": "sad", "Shame": "sad",
+	"Anxiety": "nervous", "Distress": "nervous", "Awkwardness": "nervous",
+	"Embarrassment": "nervous", "Doubt": "nervous",
+	"Anger": "angry", "Annoyance": "angry", "Contempt": "angry", "Disgust": "angry",
+	"Fear": "fearful", "Horror": "fearful",
+	"Calmness": "neutral", "Concentration": "neutral", "Contemplation": "neutral",
+}
+
+// EmotionalStateFromProsody picks the emotional state of the strongest
+// dominant vocal emotion that maps to one. It reports false when none does,
+// so the caller can fall back to the summary.
+func EmotionalStateFromProsody(dominant []models.EmotionScore) (string, bool) {
+	for _, e := range dominant {
+		if state, ok := prosodyStates[e.Name]; ok {
+			return state, true
+		}
+	}
+	return "", false
+}
+
 // Helper function to check if a word exists in the summary
 func containsWord(summary string, words []string) bool {
 	for _, word := range words {
@@ -135,29 +214,13 @@ func containsWord(summary string, words []string) bool {
 
 // AnalyzeEmotion analyzes the emotion of a given text content.
 func AnalyzeEmotion(content string) (string, error) {
-	apiKey := os.Getenv("GEMINI_API_KEY")
-	if apiKey == "" {
-		return "", fmt.Errorf("GEMINI_API_KEY is not set")
-	}
-
-	client, err := genai.NewClient(context.Background(), option.WithAPIKey(apiKey))
-	if err != nil {
-		return "", fmt.Errorf("failed to create gemini client: %w", err)
-	}
-	defer client.Close()
-
-	model := client.GenerativeModel("gemini-pro")
 	prompt := fmt.Sprintf("Analyze the following journal entry and identify the primary emotion. Respond with only a single word (e.g., Happy, Sad, Anxious, Reflective, Grateful, etc.). Journal Entry: %s", content)
-	resp, err := model.GenerateContent(context.Background(), genai.Text(prompt))
+	text, err := generateText(context.Background(), prompt)
 	if err != nil {
-		return "", fmt.Errorf("failed to generate content: %w", err)
+		return "", err
 	}
-
-	if len(resp.Candidates) > 0 && len(resp.Candidates[0].Content.Parts) > 0 {
-		if part, ok := resp.Candidates[0].Content.Parts[0].(genai.Text); ok {
-			return string(part), nil
-		}
+	if emotion := strings.Trim(text, " \t\r\n.*\""); emotion != "" {
+		return emotion, nil
 	}
-
 	return "Neutral", nil
-}
\ No newline at end of file
+}
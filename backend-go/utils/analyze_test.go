@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"math"
+	"mindful/backend-go/models"
+	"testing"
+)
+
+func TestEmotionalStateFromProsody(t *testing.T) {
+	tests := []struct {
+		dominant []models.EmotionScore
+		want     string
+		ok       bool
+	}{
+		{[]models.EmotionScore{{Name: "Joy", Score: 0.6}}, "happy", true},
+		{[]models.EmotionScore{{Name: "Anxiety", Score: 0.5}, {Name: "Joy", Score: 0.4}}, "nervous", true},
+		// Emotions without a state are skipped for the next strongest.
+		{[]models.EmotionScore{{Name: "Interest", Score: 0.7}, {Name: "Sadness", Score: 0.4}}, "sad", true},
+		{[]models.EmotionScore{{Name: "Calmness", Score: 0.3}, {Name: "Anger", Score: 0.2}}, "neutral", true},
+		{[]models.EmotionScore{{Name: "Interest", Score: 0.7}, {Name: "Boredom", Score: 0.2}}, "", false},
+		{nil, "", false},
+	}
+	for _, tt := range tests {
+		if got, ok := EmotionalStateFromProsody(tt.dominant); got != tt.want || ok != tt.ok {
+			t.Errorf("EmotionalStateFromProsody(%+v) = %q, %v, want %q, %v", tt.dominant, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func emotionNames(scores []models.EmotionScore) []string {
+	names := make([]string, len(scores))
+	for i, s := range scores {
+		names[i] = s.Name
+	}
+	return names
+}
+
+func TestSessionEmotionsTrimAndAggregate(t *testing.T) {
+	openTestDB(t)
+	turns := []models.TranscriptTurn{
+		{Speaker: "user", Text: "I can't stop worrying.", Prosody: map[string]float64{
+			"Anxiety": 0.8, "Distress": 0.6, "Fear": 0.5, "Sadness": 0.4, "Doubt": 0.3, "Joy": 0.2, "Calmness": 0.1,
+		}},
+		// The assistant's voice and unscored turns are left out.
+		{Speaker: "assistant", Text: "Let's breathe together.", Prosody: map[string]float64{"Joy": 0.9}},
+		{Speaker: "user", Text: "Okay."},
+		{Speaker: "user", Text: "That helped.", Prosody: map[string]float64{
+			"Calmness": 0.6, "Joy": 0.5, "Relief": 0.4, "Anxiety": 0.2,
+		}},
+	}
+	transcript, err := models.ImportTranscript("s1", "test", turns)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the top scores of each turn are stored.
+	stored, err := models.GetTranscriptTurns(transcript.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := stored[0].Prosody
+	if len(first) != models.ProsodyTopEmotions {
+		t.Errorf("first turn keeps %d scores, want %d: %v", len(first), models.ProsodyTopEmotions, first)
+	}
+	if _, ok := first["Joy"]; ok {
+		t.Errorf("first turn kept a score below its top %d: %v", models.ProsodyTopEmotions, first)
+	}
+	if len(stored[3].Prosody) != 4 {
+		t.Errorf("last turn = %v, want all four scores", stored[3].Prosody)
+	}
+
+	emotions, err := models.GetSessionEmotions("s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if emotions.ScoredTurns != 2 || len(emotions.Arc) != 2 {
+		t.Fatalf("emotions = %+v, want two scored user turns", emotions)
+	}
+
+	// Dominant emotions are means over the scored turns, with a score
+	// missing from a turn counting as zero and ties broken by name.
+	want := []models.EmotionScore{
+		{Name: "Anxiety", Score: 0.5},
+		{Name: "Calmness", Score: 0.3},
+		{Name: "Distress", Score: 0.3},
+		{Name: "Fear", Score: 0.25},
+		{Name: "Joy", Score: 0.25},
+	}
+	if len(emotions.Dominant) != len(want) {
+		t.Fatalf("dominant = %+v, want %+v", emotions.Dominant, want)
+	}
+	for i, d := range emotions.Dominant {
+		if d.Name != want[i].Name || math.Abs(d.Score-want[i].Score) > 1e-9 {
+			t.Errorf("dominant = %v, want %v", emotionNames(emotions.Dominant), emotionNames(want))
+			break
+		}
+	}
+
+	// The trimmed first turn holds only unpleasant emotions.
+	if emotions.Arc[0].Valence != -1 {
+		t.Errorf("first turn valence = %v, want -1", emotions.Arc[0].Valence)
+	}
+	if v := emotions.Arc[1].Valence; math.Abs(v-1.3/1.7) > 1e-9 {
+		t.Errorf("last turn valence = %v, want %v", v, 1.3/1.7)
+	}
+	if emotions.Trend != models.EmotionTrendImproving {
+		t.Errorf("trend = %q, want improving", emotions.Trend)
+	}
+
+	if state, ok := EmotionalStateFromProsody(emotions.Dominant); !ok || state != "nervous" {
+		t.Errorf("state = %q, %v, want nervous", state, ok)
+	}
+}
+
+func TestSessionEmotionsWithoutScores(t *testing.T) {
+	openTestDB(t)
+	turns := []models.TranscriptTurn{{Speaker: "user", Text: "Hello."}, {Speaker: "assistant", Text: "Hi."}}
+	if _, err := models.ImportTranscript("s1", "test", turns); err != nil {
+		t.Fatal(err)
+	}
+	emotions, err := models.GetSessionEmotions("s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if emotions.ScoredTurns != 0 || len(emotions.Dominant) != 0 || emotions.Trend != "" || emotions.Dominant == nil {
+		t.Errorf("emotions = %+v, want an empty summary", emotions)
+	}
+	if _, ok := EmotionalStateFromProsody(emotions.Dominant); ok {
+		t.Error("an unscored session gave an emotional state")
+	}
+}
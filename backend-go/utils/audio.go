@@ -0,0 +1,335 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"mime"
+	"mindful/backend-go/models"
+	"strings"
+	"time"
+)
+
+const (
+	// MaxAudioChunkSize bounds a single uploaded chunk.
+	MaxAudioChunkSize = 16 << 20
+	// maxAudioSize bounds a whole recording, about 18 hours of 16 kHz mono
+	// WAV and far more of Opus.
+	maxAudioSize = 2 << 30
+)
+
+// audioContentTypes maps accepted media types to the type recordings are
+// stored and served as.
+var audioContentTypes = map[string]string{
+	"audio/wav":      "audio/wav",
+	"audio/wave":     "audio/wav",
+	"audio/x-wav":    "audio/wav",
+	"audio/vnd.wave": "audio/wav",
+	"audio/webm":     "audio/webm",
+	"audio/ogg":      "audio/ogg",
+	"audio/opus":     "audio/ogg",
+}
+
+// audioExtensions names files of each stored audio type.
+var audioExtensions = map[string]string{
+	"audio/wav":  ".wav",
+	"audio/webm": ".webm",
+	"audio/ogg":  ".opus",
+}
+
+// sniffAudio recognizes the start of a WAV, WebM or Ogg Opus file.
+func sniffAudio(data []byte) string {
+	switch {
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WAVE":
+		return "audio/wav"
+	case bytes.HasPrefix(data, []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		return "audio/webm"
+	case bytes.HasPrefix(data, []byte("OggS")) && bytes.Contains(data[:min(len(data), 512)], []byte("OpusHead")):
+		return "audio/ogg"
+	}
+	return ""
+}
+
+// audioContentType resolves a request's Content-Type, ignoring parameters
+// such as codecs=opus. Generic or missing types return "".
+func audioContentType(header string) (string, error) {
+	if header == "" {
+		return "", nil
+	}
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return "", fmt.Errorf("%w: malformed Content-Type", models.ErrInvalidAudio)
+	}
+	if mediaType == "application/octet-stream" {
+		return "", nil
+	}
+	if t, ok := audioContentTypes[mediaType]; ok {
+		return t, nil
+	}
+	return "", fmt.Errorf("%w: Content-Type must be audio/wav, audio/webm or audio/ogg", models.ErrInvalidAudio)
+}
+
+// AudioChunkUpload is one chunk of a session recording. Index -1 appends
+// after the highest chunk so far; SHA256, when given, must match the data.
+type AudioChunkUpload struct {
+	Index       int
+	Data        []byte
+	ContentType string
+	SHA256      string
+}
+
+// UploadAudioChunk stores a chunk of a session's recording, starting the
+// recording with the first chunk received. The first chunk (index 0) must
+// start with a WAV, WebM or Ogg Opus header. Sending a chunk again with the
+// same content is a no-op, so clients can retry safely.
+func UploadAudioChunk(ctx context.Context, store BlobStore, sessionID string, chunk AudioChunkUpload) (models.SessionAudio, error) {
+	if len(chunk.Data) == 0 {
+		return models.SessionAudio{}, fmt.Errorf("%w: empty chunk", models.ErrInvalidAudio)
+	}
+	sum := sha256.Sum256(chunk.Data)
+	digest := hex.EncodeToString(sum[:])
+	if chunk.SHA256 != "" && !strings.EqualFold(chunk.SHA256, digest) {
+		return models.SessionAudio{}, fmt.Errorf("%w: chunk checksum mismatch, got sha256 %s", models.ErrInvalidAudio, digest)
+	}
+
+	contentType, err := audioContentType(chunk.ContentType)
+	if err != nil {
+		return models.SessionAudio{}, err
+	}
+	if chunk.Index == 0 {
+		sniffed := sniffAudio(chunk.Data)
+		if sniffed == "" {
+			return models.SessionAudio{}, fmt.Errorf("%w: the first chunk is not WAV, WebM or Ogg Opus audio", models.ErrInvalidAudio)
+		}
+		if contentType != "" && contentType != sniffed {
+			return models.SessionAudio{}, fmt.Errorf("%w: Content-Type %s does not match %s data", models.ErrInvalidAudio, contentType, sniffed)
+		}
+		contentType = sniffed
+	}
+
+	audio, err := models.GetSessionAudio(sessionID)
+	if errors.Is(err, models.ErrNotFound) {
+		if contentType == "" {
+			return models.SessionAudio{}, fmt.Errorf("%w: Content-Type is required until the first chunk is uploaded", models.ErrInvalidAudio)
+		}
+		audio, err = models.CreateSessionAudio(sessionID, contentType)
+	}
+	if err != nil {
+		return models.SessionAudio{}, err
+	}
+	if audio.Status != models.AudioStatusUploading {
+		return models.SessionAudio{}, models.ErrAudioComplete
+	}
+	if contentType != "" && contentType != audio.ContentType {
+		return models.SessionAudio{}, fmt.Errorf("%w: recording is %s, not %s", models.ErrInvalidAudio, audio.ContentType, contentType)
+	}
+
+	size := audio.Size + int64(len(chunk.Data))
+	if chunk.Index < 0 {
+		chunk.Index = 0
+		if n := len(audio.Chunks); n > 0 {
+			chunk.Index = audio.Chunks[n-1].Index + 1
+		}
+	}
+	for _, c := range audio.Chunks {
+		if c.Index != chunk.Index {
+			continue
+		}
+		if c.SHA256 == digest {
+			return audio, nil
+		}
+		size -= c.Size
+	}
+	if size > maxAudioSize {
+		return models.SessionAudio{}, fmt.Errorf("%w: recording would exceed %d bytes", models.ErrInvalidAudio, int64(maxAudioSize))
+	}
+
+	key := fmt.Sprintf("audio/%d/%06d-%s", audio.ID, chunk.Index, digest[:16])
+	if err := store.Put(ctx, key, chunk.Data, audio.ContentType); err != nil {
+		return models.SessionAudio{}, fmt.Errorf("storing chunk %d: %w", chunk.Index, err)
+	}
+	replaced, err := models.SaveAudioChunk(audio.ID, models.AudioChunk{Index: chunk.Index, Size: int64(len(chunk.Data)), SHA256: digest, BlobKey: key})
+	if err != nil {
+		DeleteBlobs(ctx, store, []string{key})
+		return models.SessionAudio{}, err
+	}
+	if replaced != "" && replaced != key {
+		DeleteBlobs(ctx, store, []string{replaced})
+	}
+	return models.GetSessionAudio(sessionID)
+}
+
+// CompleteAudioUpload checks that chunks 0..n-1 are all present, reads each
+// back from the store to verify its size and checksum, and marks the
+// recording complete with the checksum of the whole file, which expected
+// must match when given.
+func CompleteAudioUpload(ctx context.Context, store BlobStore, sessionID, expected string) (models.SessionAudio, error) {
+	audio, err := models.GetSessionAudio(sessionID)
+	if err != nil {
+		return models.SessionAudio{}, err
+	}
+	if audio.Status == models.AudioStatusComplete {
+		if expected != "" && !strings.EqualFold(expected, audio.SHA256) {
+			return models.SessionAudio{}, fmt.Errorf("%w: recording checksum mismatch, got sha256 %s", models.ErrInvalidAudio, audio.SHA256)
+		}
+		return audio, nil
+	}
+	if len(audio.Chunks) == 0 {
+		return models.SessionAudio{}, fmt.Errorf("%w: no chunks uploaded", models.ErrInvalidAudio)
+	}
+	for i, c := range audio.Chunks {
+		if c.Index != i {
+			return models.SessionAudio{}, fmt.Errorf("%w: chunk %d is missing", models.ErrInvalidAudio, i)
+		}
+	}
+
+	whole := sha256.New()
+	for _, c := range audio.Chunks {
+		if err := verifyAudioChunk(ctx, store, c, whole); err != nil {
+			return models.SessionAudio{}, err
+		}
+	}
+	digest := hex.EncodeToString(whole.Sum(nil))
+	if expected != "" && !strings.EqualFold(expected, digest) {
+		return models.SessionAudio{}, fmt.Errorf("%w: recording checksum mismatch, got sha256 %s", models.ErrInvalidAudio, digest)
+	}
+	if err := models.CompleteSessionAudio(audio.ID, digest, time.Now()); err != nil {
+		return models.SessionAudio{}, err
+	}
+	return models.GetSessionAudio(sessionID)
+}
+
+func verifyAudioChunk(ctx context.Context, store BlobStore, c models.AudioChunk, whole hash.Hash) error {
+	r, err := store.GetRange(ctx, c.BlobKey, 0, -1)
+	if err != nil {
+		return fmt.Errorf("reading chunk %d: %w", c.Index, err)
+	}
+	defer r.Close()
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(h, whole), r)
+	if err != nil {
+		return fmt.Errorf("reading chunk %d: %w", c.Index, err)
+	}
+	if n != c.Size || hex.EncodeToString(h.Sum(nil)) != c.SHA256 {
+		return fmt.Errorf("chunk %d does not match its checksum in the blob store", c.Index)
+	}
+	return nil
+}
+
+// DeleteAudio removes a session's recording and its blobs.
+func DeleteAudio(ctx context.Context, store BlobStore, sessionID string) error {
+	keys, err := models.DeleteSessionAudio(sessionID)
+	if err != nil {
+		return err
+	}
+	DeleteBlobs(ctx, store, keys)
+	return nil
+}
+
+// DeleteTranscript removes a session's transcripts, its recording and the
+// recording's blobs, and its transcription jobs.
+func DeleteTranscript(ctx context.Context, store BlobStore, sessionID string) error {
+	keys, err := models.DeleteTranscript(sessionID)
+	if err != nil {
+		return err
+	}
+	DeleteBlobs(ctx, store, keys)
+	return nil
+}
+
+// OpenSessionAudio returns a completed recording and a reader over it that
+// supports seeking, as http.ServeContent needs for Range requests.
+func OpenSessionAudio(ctx context.Context, store BlobStore, sessionID string) (models.SessionAudio, io.ReadSeekCloser, error) {
+	audio, err := models.GetSessionAudio(sessionID)
+	if err != nil {
+		return models.SessionAudio{}, nil, err
+	}
+	if audio.Status != models.AudioStatusComplete {
+		return models.SessionAudio{}, nil, models.ErrAudioIncomplete
+	}
+	return audio, &chunkReader{ctx: ctx, store: store, chunks: audio.Chunks, size: audio.Size}, nil
+}
+
+// chunkReader reads a recording's chunks as one stream. Only the chunk
+// under the current offset is open, from that offset on, so a Range request
+// fetches just the chunks it covers.
+type chunkReader struct {
+	ctx    context.Context
+	store  BlobStore
+	chunks []models.AudioChunk
+	size   int64
+	offset int64
+	cur    io.ReadCloser
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if r.offset >= r.size {
+			return 0, io.EOF
+		}
+		opened := false
+		if r.cur == nil {
+			var start int64
+			for _, c := range r.chunks {
+				if r.offset < start+c.Size {
+					cur, err := r.store.GetRange(r.ctx, c.BlobKey, r.offset-start, start+c.Size-r.offset)
+					if err != nil {
+						return 0, err
+					}
+					r.cur, opened = cur, true
+					break
+				}
+				start += c.Size
+			}
+			if r.cur == nil {
+				return 0, io.ErrUnexpectedEOF
+			}
+		}
+		n, err := r.cur.Read(p)
+		r.offset += int64(n)
+		if err == io.EOF {
+			r.cur.Close()
+			r.cur = nil
+			// A chunk that ends before its recorded size was truncated in
+			// the store.
+			if n == 0 && opened {
+				return 0, io.ErrUnexpectedEOF
+			}
+			err = nil
+			if n == 0 {
+				continue
+			}
+		}
+		return n, err
+	}
+}
+
+func (r *chunkReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	if offset != r.offset && r.cur != nil {
+		r.cur.Close()
+		r.cur = nil
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+func (r *chunkReader) Close() error {
+	if r.cur != nil {
+		return r.cur.Close()
+	}
+	return nil
+}
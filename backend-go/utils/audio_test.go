@@ -0,0 +1,237 @@
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mindful/backend-go/models"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testRecording is a 48-byte "WAV file" uploaded in three 16-byte chunks.
+var testRecording = []string{"RIFF\x28\x00\x00\x00WAVEfmt ", "0123456789abcdef", "ghijklmnopqrstuv"}
+
+func uploadTestRecording(t *testing.T, store BlobStore, sessionID string) models.SessionAudio {
+	t.Helper()
+	ctx := context.Background()
+	for i, chunk := range testRecording {
+		upload := AudioChunkUpload{Index: i, Data: []byte(chunk)}
+		if i == 0 {
+			upload.ContentType = "audio/wav"
+		}
+		if _, err := UploadAudioChunk(ctx, store, sessionID, upload); err != nil {
+			t.Fatalf("chunk %d: %v", i, err)
+		}
+	}
+	whole := sha256.Sum256([]byte(strings.Join(testRecording, "")))
+	audio, err := CompleteAudioUpload(ctx, store, sessionID, hex.EncodeToString(whole[:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return audio
+}
+
+func TestUploadAudioChunkRejectsChecksumMismatch(t *testing.T) {
+	openTestDB(t)
+	store := LocalBlobStore{Dir: t.TempDir()}
+
+	_, err := UploadAudioChunk(context.Background(), store, "s1", AudioChunkUpload{
+		Index:       0,
+		Data:        []byte(testRecording[0]),
+		ContentType: "audio/wav",
+		SHA256:      strings.Repeat("0", 64),
+	})
+	if !errors.Is(err, models.ErrInvalidAudio) || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("err = %v, want a checksum mismatch", err)
+	}
+	if _, err := models.GetSessionAudio("s1"); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("recording started from a rejected chunk: %v", err)
+	}
+	if entries, _ := os.ReadDir(store.Dir); len(entries) != 0 {
+		t.Errorf("rejected chunk was stored")
+	}
+
+	sum := sha256.Sum256([]byte(testRecording[0]))
+	_, err = UploadAudioChunk(context.Background(), store, "s1", AudioChunkUpload{
+		Index:       0,
+		Data:        []byte(testRecording[0]),
+		ContentType: "audio/wav",
+		SHA256:      strings.ToUpper(hex.EncodeToString(sum[:])),
+	})
+	if err != nil {
+		t.Errorf("matching checksum rejected: %v", err)
+	}
+}
+
+func TestCompleteAudioUploadDetectsCorruptedChunk(t *testing.T) {
+	openTestDB(t)
+	store := LocalBlobStore{Dir: t.TempDir()}
+	ctx := context.Background()
+	for i, chunk := range testRecording {
+		if _, err := UploadAudioChunk(ctx, store, "s1", AudioChunkUpload{Index: i, Data: []byte(chunk), ContentType: "audio/wav"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	audio, err := models.GetSessionAudio("s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(store.Dir, filepath.FromSlash(audio.Chunks[1].BlobKey))
+	if err := os.WriteFile(path, []byte("0123456789abcdeX"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = CompleteAudioUpload(ctx, store, "s1", "")
+	if err == nil || !strings.Contains(err.Error(), "chunk 1 does not match") {
+		t.Fatalf("err = %v, want chunk 1 to fail its checksum", err)
+	}
+	if audio, _ := models.GetSessionAudio("s1"); audio.Status != models.AudioStatusUploading {
+		t.Errorf("status = %s after a failed check", audio.Status)
+	}
+}
+
+// serveAudio serves a session's recording the way the audio endpoint does.
+func serveAudio(store BlobStore, sessionID string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		audio, content, err := OpenSessionAudio(r.Context(), store, sessionID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer content.Close()
+		w.Header().Set("Content-Type", audio.ContentType)
+		http.ServeContent(w, r, "", time.Time{}, content)
+	}
+}
+
+func TestSessionAudioRanges(t *testing.T) {
+	whole := strings.Join(testRecording, "")
+	tests := []struct {
+		name, rangeHeader string
+		status            int
+		contentRange      string
+		body              string
+		fetched           []string // ranges read from the S3 stand-in
+	}{
+		{"whole", "", http.StatusOK, "", whole,
+			[]string{"bytes=0-15", "bytes=0-15", "bytes=0-15"}},
+		{"within a chunk", "bytes=2-5", http.StatusPartialContent, "bytes 2-5/48", whole[2:6],
+			[]string{"bytes=2-15"}},
+		{"across a boundary", "bytes=10-20", http.StatusPartialContent, "bytes 10-20/48", whole[10:21],
+			[]string{"bytes=10-15", "bytes=0-15"}},
+		{"across every chunk", "bytes=15-32", http.StatusPartialContent, "bytes 15-32/48", whole[15:33],
+			[]string{"bytes=15-15", "bytes=0-15", "bytes=0-15"}},
+		{"open ended", "bytes=40-", http.StatusPartialContent, "bytes 40-47/48", whole[40:],
+			[]string{"bytes=8-15"}},
+		{"suffix across a boundary", "bytes=-20", http.StatusPartialContent, "bytes 28-47/48", whole[28:],
+			[]string{"bytes=12-15", "bytes=0-15"}},
+		{"suffix longer than the file", "bytes=-100", http.StatusPartialContent, "bytes 0-47/48", whole,
+			[]string{"bytes=0-15", "bytes=0-15", "bytes=0-15"}},
+		{"past the end", "bytes=48-60", http.StatusRequestedRangeNotSatisfiable, "bytes */48", "",
+			nil},
+	}
+
+	openTestDB(t)
+	fake, s3 := newFakeS3(t)
+	stores := map[string]BlobStore{"local": LocalBlobStore{Dir: t.TempDir()}, "s3": s3}
+	for name, store := range stores {
+		uploadTestRecording(t, store, "session-"+name)
+		srv := httptest.NewServer(serveAudio(store, "session-"+name))
+		defer srv.Close()
+		fake.ranges()
+
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+				if tt.rangeHeader != "" {
+					req.Header.Set("Range", tt.rangeHeader)
+				}
+				resp, err := http.DefaultClient.Do(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer resp.Body.Close()
+				body, _ := io.ReadAll(resp.Body)
+
+				if resp.StatusCode != tt.status {
+					t.Fatalf("status = %d, want %d", resp.StatusCode, tt.status)
+				}
+				if got := resp.Header.Get("Content-Range"); got != tt.contentRange {
+					t.Errorf("Content-Range = %q, want %q", got, tt.contentRange)
+				}
+				if tt.status != http.StatusRequestedRangeNotSatisfiable && string(body) != tt.body {
+					t.Errorf("body = %q, want %q", body, tt.body)
+				}
+				if name == "s3" {
+					if got := fake.ranges(); fmt.Sprint(got) != fmt.Sprint(tt.fetched) {
+						t.Errorf("fetched %q from the store, want %q", got, tt.fetched)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestSessionAudioTruncatedChunk(t *testing.T) {
+	openTestDB(t)
+	store := LocalBlobStore{Dir: t.TempDir()}
+	audio := uploadTestRecording(t, store, "s1")
+	path := filepath.Join(store.Dir, filepath.FromSlash(audio.Chunks[1].BlobKey))
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	_, content, err := OpenSessionAudio(context.Background(), store, "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer content.Close()
+	if _, err := io.ReadAll(content); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("reading a truncated recording: %v, want io.ErrUnexpectedEOF", err)
+	}
+}
+
+func TestDeleteTranscriptRemovesRecording(t *testing.T) {
+	openTestDB(t)
+	store := LocalBlobStore{Dir: t.TempDir()}
+	job := queueTestTranscription(t, store, models.TranscriptionJob{SessionID: "s1"})
+	RunDueTranscriptionJobs(context.Background(), store, FakeTranscriber{Segments: testSegments}, time.Now())
+	storedTurns(t, getJob(t, job.ID))
+	audio, err := models.GetSessionAudio("s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := DeleteTranscript(context.Background(), store, "s1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := models.GetTranscriptsBySessionID("s1"); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("loading the transcripts: %v, want ErrNotFound", err)
+	}
+	if _, err := models.GetSessionAudio("s1"); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("loading the recording: %v, want ErrNotFound", err)
+	}
+	if _, err := models.GetTranscriptionJob(job.ID); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("loading the transcription job: %v, want ErrNotFound", err)
+	}
+	for _, c := range audio.Chunks {
+		path := filepath.Join(store.Dir, filepath.FromSlash(c.BlobKey))
+		if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("chunk %d blob: %v, want it removed", c.Index, err)
+		}
+	}
+
+	if err := DeleteTranscript(context.Background(), store, "s1"); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("deleting again: %v, want ErrNotFound", err)
+	}
+}
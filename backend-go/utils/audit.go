@@ -0,0 +1,22 @@
+package utils
+
+import (
+	"log"
+	"mindful/backend-go/models"
+	"strconv"
+)
+
+// auditSystemWrite records a write made by a background worker, which the
+// audit middleware never sees. The actor is "system:" followed by the
+// worker's name.
+func auditSystemWrite(worker, action, resourceType string, resourceID int) {
+	event := models.AuditEvent{
+		Actor:        "system:" + worker,
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   strconv.Itoa(resourceID),
+	}
+	if err := models.AppendAuditEvent(event); err != nil {
+		log.Printf("Error writing audit event for %s: %v", worker, err)
+	}
+}
@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"mindful/backend-go/models"
+	"strconv"
+	"testing"
+)
+
+// assertSystemAudit checks that a worker recorded exactly one audit event,
+// for the given write.
+func assertSystemAudit(t *testing.T, worker, action, resourceType string, resourceID int) {
+	t.Helper()
+	events, err := models.GetAuditEvents(models.AuditFilter{Actor: "system:" + worker})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("%s recorded %d audit events, want 1: %+v", worker, len(events), events)
+	}
+	e := events[0]
+	if e.Action != action || e.ResourceType != resourceType || e.ResourceID != strconv.Itoa(resourceID) {
+		t.Errorf("audit event = %s %s %s, want %s %s %d", e.Action, e.ResourceType, e.ResourceID, action, resourceType, resourceID)
+	}
+}
+
+func TestSaveVoiceChatAudits(t *testing.T) {
+	openTestDB(t)
+	t.Setenv("GEMINI_API_KEY", "")
+	earlier := []models.TranscriptTurn{{Speaker: "user", Text: "Hello."}}
+	if _, err := models.ImportTranscript("s1", SourceVoice, earlier); err != nil {
+		t.Fatal(err)
+	}
+
+	chat := VoiceChat{Turns: []models.TranscriptTurn{{Speaker: "user", Text: "I always mess up at work."}}}
+	saved, err := SaveVoiceChat("s1", chat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForSessionProcessing(t, "s1", saved.ID)
+	assertSystemAudit(t, "voice", "update", "transcript", saved.ID)
+}
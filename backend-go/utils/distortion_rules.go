@@ -0,0 +1,271 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mindful/backend-go/models"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// distortionRule flags a phrase pattern as a likely distortion. Confidence
+// reflects how often the phrase is a distortion rather than plain speech;
+// "should" is often innocent, "I'm such an idiot" rarely is.
+type distortionRule struct {
+	distortion string
+	pattern    *regexp.Regexp
+	confidence float64
+}
+
+// rule compiles a case-insensitive, word-bounded pattern. Apostrophes in
+// pattern also match typographic ones, as typed on phones.
+func rule(distortion string, confidence float64, pattern string) distortionRule {
+	pattern = strings.ReplaceAll(pattern, "'", "['’]")
+	return distortionRule{distortion, regexp.MustCompile(`(?i)\b(?:` + pattern + `)\b`), confidence}
+}
+
+var distortionRules = []distortionRule{
+	rule("catastrophizing", 0.6, `(?:a |an |total |complete )?disaster|catastroph\w*|ruined|the worst|unbearable|end of the world|falling apart|can'?t (?:handle|cope with|stand) (?:it|this|anything)`),
+	rule("catastrophizing", 0.4, `terrible|awful|horrible`),
+	rule("all-or-nothing", 0.6, `(?:total|complete|utter) (?:failure|waste|mess)|all or nothing|completely (?:useless|worthless|ruined|failed)|nothing (?:ever )?goes right`),
+	rule("all-or-nothing", 0.4, `perfect(?:ly)?|totally|completely`),
+	rule("overgeneralization", 0.55, `every (?:single )?time|always happens|never (?:works|goes right|changes)|this always|i always|i never|nobody ever|no one ever|everyone always`),
+	rule("overgeneralization", 0.35, `always|never|everyone|nobody|no one`),
+	rule("mind-reading", 0.6, `(?:they|he|she|everyone|people|you) (?:must|probably|definitely|all) (?:think|thinks|believe|believes|hate|hates)|(?:is|are) judging me|(?:hates|doesn'?t like|don'?t like) me|thinks? i'?m`),
+	rule("fortune-telling", 0.6, `(?:(?:i|it|this|that|things|they)(?:'ll| will)|i'?m going to|it'?s going to|going to) (?:never|fail|go wrong|be a disaster|end badly|mess (?:it|this) up)|won'?t (?:ever )?work|bound to (?:fail|go wrong)|no point (?:in )?trying|never going to`),
+	rule("should-statements", 0.6, `i (?:should|shouldn'?t|must|mustn'?t|ought to) have|i (?:really )?(?:should|shouldn'?t|must|ought to)`),
+	rule("should-statements", 0.35, `should(?:n'?t)?|must|ought to|supposed to`),
+	rule("labeling", 0.75, `i'?m (?:such )?(?:an? )?(?:idiot|failure|loser|stupid|worthless|useless|pathetic|mess|disappointment|fraud|burden)|i am (?:such )?(?:an? )?(?:idiot|failure|loser|stupid|worthless|useless|pathetic|mess|disappointment|fraud|burden)`),
+	rule("personalization", 0.6, `(?:it'?s|it was|it is) (?:all )?my fault|because of me|i ruined|i caused|i (?:always )?blame myself|i'?m to blame`),
+	rule("emotional-reasoning", 0.55, `i feel (?:like )?(?:an? )?(?:failure|idiot|fraud|burden|stupid|worthless|useless)(?:,)? so (?:i|it) (?:must|am|is)|i feel it,? so it'?s true|feels? true so`),
+	rule("emotional-reasoning", 0.4, `i feel (?:like )?(?:an? )?(?:failure|fraud|burden|worthless|useless)`),
+	rule("discounting-positive", 0.6, `(?:it )?(?:doesn'?t|didn'?t) (?:really )?count|(?:was|it'?s) (?:just|only) luck|anyone could (?:have )?(?:done|do) (?:it|that)|doesn'?t mean anything|they were just being (?:nice|polite)`),
+	rule("mental-filter", 0.5, `all i can think about|the only thing i (?:can )?(?:remember|notice|think about)|can'?t stop thinking about`),
+	rule("blaming", 0.55, `(?:it'?s|it was|it is) (?:all )?(?:their|his|her|your) fault|(?:they|he|she|you) made me|because of (?:them|him|her|you)`),
+}
+
+// negation matches a negation right before a phrase, allowing one filler
+// word, as in "not always" or "isn't the worst".
+var negation = regexp.MustCompile(`(?i)(?:\bnot|\bcannot|n['’]t|\bhardly|\bno longer)\s+(?:(?:the|a|an|that|really)\s+)?$`)
+
+// negated reports whether the phrase starting at byte i of text is negated.
+// Only the few words before it are looked at.
+func negated(text string, i int) bool {
+	return negation.MatchString(text[max(0, i-32):i])
+}
+
+// DetectDistortionSpans tags phrases in text that suggest cognitive
+// distortions using phrase rules. It needs no network access. Negated
+// phrases ("not always") are ignored. When rules for the same distortion
+// overlap, the most confident span is kept.
+func DetectDistortionSpans(text string) []models.DistortionFinding {
+	var findings []models.DistortionFinding
+	for _, r := range distortionRules {
+		for _, loc := range r.pattern.FindAllStringIndex(text, -1) {
+			if negated(text, loc[0]) {
+				continue
+			}
+			findings = append(findings, models.DistortionFinding{
+				Distortion: r.distortion,
+				Start:      utf8.RuneCountInString(text[:loc[0]]),
+				End:        utf8.RuneCountInString(text[:loc[1]]),
+				Excerpt:    text[loc[0]:loc[1]],
+				Confidence: r.confidence,
+				Source:     models.DistortionSourceRules,
+			})
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool { return findings[i].Confidence > findings[j].Confidence })
+	var kept []models.DistortionFinding
+	for _, f := range findings {
+		overlaps := false
+		for _, k := range kept {
+			if k.Distortion == f.Distortion && f.Start < k.End && k.Start < f.End {
+				overlaps = true
+				break
+			}
+		}
+		if !overlaps {
+			kept = append(kept, f)
+		}
+	}
+	sort.SliceStable(kept, func(i, j int) bool { return kept[i].Start < kept[j].Start })
+	return kept
+}
+
+// RefineDistortionSpans asks the model to review the rule-based findings for
+// text: it confirms or drops them, adjusts confidence and adds spans the
+// rules missed. Spans the model quotes that cannot be found in text are
+// dropped, so offsets always point into the original.
+func RefineDistortionSpans(ctx context.Context, text string, candidates []models.DistortionFinding) ([]models.DistortionFinding, error) {
+	var catalog strings.Builder
+	for _, d := range models.CognitiveDistortions {
+		fmt.Fprintf(&catalog, "- %s: %s\n", d.ID, d.Description)
+	}
+	var found strings.Builder
+	for _, c := range candidates {
+		fmt.Fprintf(&found, "- %s: %q\n", c.Distortion, c.Excerpt)
+	}
+
+	prompt := fmt.Sprintf(`You are a CBT coach reviewing text for cognitive distortions. A keyword pass flagged the candidate phrases below; many may be false positives.
+Return the final list of distortions actually present, each with the exact phrase from the text (copied verbatim), a confidence between 0 and 1 and a one-sentence explanation. Drop false positives and add any that were missed.
+Respond with only a JSON array such as [{"distortion": "catastrophizing", "quote": "exact phrase", "confidence": 0.8, "explanation": "..."}]
+
+Distortions:
+%s
+Candidates:
+%s
+Text:
+%s`, catalog.String(), found.String(), text)
+
+	raw, err := generateText(ctx, prompt)
+	if err != nil {
+		return nil, err
+	}
+	var resp []struct {
+		Distortion  string  `json:"distortion"`
+		Quote       string  `json:"quote"`
+		Confidence  float64 `json:"confidence"`
+		Explanation string  `json:"explanation"`
+	}
+	if err := json.Unmarshal([]byte(stripCodeFence(raw)), &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse distortion review: %w", err)
+	}
+
+	refined := []models.DistortionFinding{}
+	for _, r := range resp {
+		if _, ok := models.GetDistortion(r.Distortion); !ok || strings.TrimSpace(r.Quote) == "" {
+			continue
+		}
+		loc := regexp.MustCompile(`(?i)` + regexp.QuoteMeta(r.Quote)).FindStringIndex(text)
+		if loc == nil {
+			continue
+		}
+		i, end := loc[0], loc[1]
+		refined = append(refined, models.DistortionFinding{
+			Distortion:  r.Distortion,
+			Start:       utf8.RuneCountInString(text[:i]),
+			End:         utf8.RuneCountInString(text[:end]),
+			Excerpt:     text[i:end],
+			Confidence:  clampConfidence(r.Confidence),
+			Source:      models.DistortionSourceLLM,
+			Explanation: r.Explanation,
+		})
+	}
+	sort.SliceStable(refined, func(i, j int) bool { return refined[i].Start < refined[j].Start })
+	return refined, nil
+}
+
+func clampConfidence(c float64) float64 {
+	if c < 0 {
+		return 0
+	}
+	if c > 1 {
+		return 1
+	}
+	return c
+}
+
+// DetectDistortionFindings runs the rule-based detector and, if refine is set,
+// has the model review the result. If refinement fails the rule-based
+// findings are returned.
+func DetectDistortionFindings(ctx context.Context, text string, refine bool) []models.DistortionFinding {
+	findings := DetectDistortionSpans(text)
+	if !refine || strings.TrimSpace(text) == "" {
+		return findings
+	}
+	refined, err := RefineDistortionSpans(ctx, text, findings)
+	if err != nil {
+		log.Printf("Error refining distortions, keeping rule-based results: %v", err)
+		return findings
+	}
+	return refined
+}
+
+// refineDistortionsByDefault reports whether stored analyses use the model,
+// set with DISTORTIONS_LLM_REFINE=true.
+func refineDistortionsByDefault() bool {
+	return os.Getenv("DISTORTIONS_LLM_REFINE") == "true"
+}
+
+// isUserSpeaker reports whether a transcript turn was spoken by the user
+// rather than the assistant.
+func isUserSpeaker(speaker string) bool {
+	switch strings.ToLower(speaker) {
+	case "user", "client", "me", "you":
+		return true
+	}
+	return false
+}
+
+// AnalyzeJournalDistortions detects distortions in a journal entry and
+// stores them, replacing earlier findings.
+func AnalyzeJournalDistortions(ctx context.Context, id int, content string) error {
+	findings := DetectDistortionFindings(ctx, content, refineDistortionsByDefault())
+	// Refinement can be slow; skip storing if the entry was edited meanwhile
+	// and a newer analysis is on its way.
+	current, err := models.GetJournalEntry(id)
+	if err != nil || current.Content != content {
+		return err
+	}
+	return models.ReplaceDistortionFindings(models.SearchKindJournal, id, findings)
+}
+
+// AnalyzeTranscriptDistortions detects distortions in each of the user's
+// turns of a transcript and stores them, replacing earlier findings.
+func AnalyzeTranscriptDistortions(ctx context.Context, t models.Transcript) error {
+	refine := refineDistortionsByDefault()
+	var findings []models.DistortionFinding
+	for _, turn := range models.SplitTranscriptTurns(t.Transcript) {
+		if !isUserSpeaker(turn.Speaker) {
+			continue
+		}
+		for _, f := range DetectDistortionFindings(ctx, turn.Text, refine) {
+			index := turn.Index
+			f.Turn = &index
+			findings = append(findings, f)
+		}
+	}
+	return models.ReplaceDistortionFindings(models.SearchKindTranscript, t.ID, findings)
+}
+
+// AnalyzeTranscriptDistortionsAsync runs AnalyzeTranscriptDistortions in the
+// background, logging failures.
+func AnalyzeTranscriptDistortionsAsync(t models.Transcript) {
+	go func() {
+		if err := AnalyzeTranscriptDistortions(context.Background(), t); err != nil {
+			log.Printf("Error analyzing distortions for transcript %d: %v", t.ID, err)
+		}
+	}()
+}
+
+// ReanalyzeDistortions re-runs distortion detection over every journal entry
+// and transcript, for example after the rules change. It returns the number
+// of records analyzed.
+func ReanalyzeDistortions(ctx context.Context) (int, error) {
+	journals, err := models.GetAllJournalEntries()
+	if err != nil {
+		return 0, err
+	}
+	for _, j := range journals {
+		if err := AnalyzeJournalDistortions(ctx, j.ID, j.Content); err != nil {
+			return 0, fmt.Errorf("journal %d: %w", j.ID, err)
+		}
+	}
+	transcripts, err := models.GetAllTranscripts()
+	if err != nil {
+		return 0, err
+	}
+	for _, t := range transcripts {
+		if err := AnalyzeTranscriptDistortions(ctx, t); err != nil {
+			return 0, fmt.Errorf("transcript %d: %w", t.ID, err)
+		}
+	}
+	return len(journals) + len(transcripts), nil
+}
@@ -0,0 +1,106 @@
+package utils
+
+import (
+	"mindful/backend-go/models"
+	"testing"
+)
+
+// findDistortion returns the finding for distortion in findings.
+func findDistortion(findings []models.DistortionFinding, distortion string) (models.DistortionFinding, bool) {
+	for _, f := range findings {
+		if f.Distortion == distortion {
+			return f, true
+		}
+	}
+	return models.DistortionFinding{}, false
+}
+
+func TestDistortionRules(t *testing.T) {
+	tests := []struct {
+		distortion string
+		positive   string
+		excerpt    string
+		confidence float64
+		negative   string
+	}{
+		{"catastrophizing", "If I miss the deadline it's the end of the world.", "end of the world", 0.6, "I handled it fine."},
+		{"catastrophizing", "The meeting was awful.", "awful", 0.4, "The meeting was awfully long."},
+		{"all-or-nothing", "The presentation was a complete failure.", "complete failure", 0.6, "I completed most of the tasks."},
+		{"all-or-nothing", "It has to be perfect.", "perfect", 0.4, "It was a perfectionist's dream job."},
+		{"overgeneralization", "Every time I try, it falls apart.", "Every time", 0.55, "Sometimes it works, sometimes not."},
+		{"overgeneralization", "I'm always late.", "always", 0.35, "I'm usually on time."},
+		{"mind-reading", "They probably think I'm boring.", "They probably think", 0.6, "I think they liked the talk."},
+		{"fortune-telling", "This is never going to get better.", "never going to", 0.6, "It will probably work out."},
+		{"should-statements", "I should have known better.", "I should have", 0.6, "My shoulder hurt all night."},
+		{"should-statements", "We were supposed to meet.", "supposed to", 0.35, "I supposed it was fine."},
+		{"labeling", "I’m such an idiot.", "I’m such an idiot", 0.75, "I'm such a fan of this idea."},
+		{"personalization", "It's all my fault that they argued.", "It's all my fault", 0.6, "It was an honest mistake by the bank."},
+		{"emotional-reasoning", "I feel like a failure, so I must be one.", "I feel like a failure, so I must", 0.55, "I feel tired today."},
+		{"emotional-reasoning", "I feel worthless.", "I feel worthless", 0.4, "I feel worn out."},
+		{"discounting-positive", "They were just being nice.", "They were just being nice", 0.6, "They were nice to me."},
+		{"mental-filter", "All I can think about is the mistake.", "All I can think about", 0.5, "I can think about other things too."},
+		{"blaming", "You made me late again.", "You made me", 0.55, "They made dinner for me."},
+	}
+	for _, tt := range tests {
+		f, ok := findDistortion(DetectDistortionSpans(tt.positive), tt.distortion)
+		if !ok {
+			t.Errorf("%q: no %s found", tt.positive, tt.distortion)
+		} else if f.Excerpt != tt.excerpt || f.Confidence != tt.confidence || f.Source != models.DistortionSourceRules {
+			t.Errorf("%q: %s = %q at %v from %s, want %q at %v", tt.positive, tt.distortion, f.Excerpt, f.Confidence, f.Source, tt.excerpt, tt.confidence)
+		}
+		if f, ok := findDistortion(DetectDistortionSpans(tt.negative), tt.distortion); ok {
+			t.Errorf("%q: found %s in %q", tt.negative, tt.distortion, f.Excerpt)
+		}
+	}
+}
+
+func TestDistortionRulesIgnoreNegation(t *testing.T) {
+	tests := []struct{ text, distortion string }{
+		{"I'm not always late.", "overgeneralization"},
+		{"I don’t always get it wrong.", "overgeneralization"},
+		{"Not everyone left early.", "overgeneralization"},
+		{"It isn't the worst thing that could happen.", "catastrophizing"},
+		{"It's not a disaster.", "catastrophizing"},
+		{"It's not really terrible.", "catastrophizing"},
+		{"The plan isn't perfect.", "all-or-nothing"},
+		{"I cannot always be there.", "overgeneralization"},
+	}
+	for _, tt := range tests {
+		if f, ok := findDistortion(DetectDistortionSpans(tt.text), tt.distortion); ok {
+			t.Errorf("%q: found %s in negated %q", tt.text, tt.distortion, f.Excerpt)
+		}
+	}
+	// A negation elsewhere in the sentence doesn't hide a phrase.
+	if _, ok := findDistortion(DetectDistortionSpans("I'm not sure why I always mess up."), "overgeneralization"); !ok {
+		t.Error("overgeneralization after an unrelated negation was not found")
+	}
+}
+
+func TestDistortionSpansKeepMostConfidentOverlap(t *testing.T) {
+	findings := DetectDistortionSpans("I'm completely useless.")
+	if len(findings) != 1 {
+		t.Fatalf("findings = %+v, want one", findings)
+	}
+	if f := findings[0]; f.Distortion != "all-or-nothing" || f.Excerpt != "completely useless" || f.Confidence != 0.6 {
+		t.Errorf("finding = %+v, want the 0.6 all-or-nothing span", f)
+	}
+}
+
+func TestDistortionSpanOffsetsCountCharacters(t *testing.T) {
+	text := "Ça va 😀 — I’m such an idiot, c’est un désastre, it's the worst."
+	findings := DetectDistortionSpans(text)
+	runes := []rune(text)
+	for _, f := range findings {
+		if f.Start < 0 || f.End > len(runes) || string(runes[f.Start:f.End]) != f.Excerpt {
+			t.Errorf("%s: offsets %d-%d don't select %q", f.Distortion, f.Start, f.End, f.Excerpt)
+		}
+	}
+	labeling, ok := findDistortion(findings, "labeling")
+	if !ok || labeling.Start != 10 || labeling.End != 27 {
+		t.Errorf("labeling = %+v, want characters 10-27", labeling)
+	}
+	catastrophizing, ok := findDistortion(findings, "catastrophizing")
+	if !ok || catastrophizing.Excerpt != "the worst" || catastrophizing.Start != 53 {
+		t.Errorf("catastrophizing = %+v, want \"the worst\" at 53", catastrophizing)
+	}
+}
@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"mindful/backend-go/models"
+	"strings"
+)
+
+// DistortionMatch is a cognitive distortion found in a thought, with why it
+// was flagged.
+type DistortionMatch struct {
+	Distortion  string `json:"distortion"`
+	Name        string `json:"name"`
+	Explanation string `json:"explanation"`
+}
+
+// DetectDistortions asks the model which catalogued cognitive distortions a
+// thought likely shows. Suggestions outside the catalog are dropped.
+func DetectDistortions(ctx context.Context, situation, thought string) ([]DistortionMatch, error) {
+	var catalog strings.Builder
+	for _, d := range models.CognitiveDistortions {
+		fmt.Fprintf(&catalog, "- %s: %s. %s\n", d.ID, d.Name, d.Description)
+	}
+
+	prompt := fmt.Sprintf(`You are a CBT coach. Identify which of the cognitive distortions below are likely present in the user's automatic thought. Only list distortions that clearly apply; an empty list is fine.
+Respond with only a JSON array such as [{"distortion": "catastrophizing", "explanation": "One short sentence addressed to the user."}]
+
+Distortions:
+%s
+Situation: %s
+Automatic thought: %s`, catalog.String(), situation, thought)
+
+	raw, err := generateText(ctx, prompt)
+	if err != nil {
+		return nil, err
+	}
+	var found []DistortionMatch
+	if err := json.Unmarshal([]byte(stripCodeFence(raw)), &found); err != nil {
+		return nil, fmt.Errorf("failed to parse distortions: %w", err)
+	}
+
+	matches := []DistortionMatch{}
+	seen := map[string]bool{}
+	for _, m := range found {
+		d, ok := models.GetDistortion(strings.TrimSpace(m.Distortion))
+		if !ok || seen[d.ID] {
+			continue
+		}
+		seen[d.ID] = true
+		matches = append(matches, DistortionMatch{Distortion: d.ID, Name: d.Name, Explanation: strings.TrimSpace(m.Explanation)})
+	}
+	return matches, nil
+}
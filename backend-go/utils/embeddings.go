@@ -0,0 +1,361 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math"
+	"mindful/backend-go/models"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+
+	"google.golang.org/genai"
+)
+
+// Embedder turns text into fixed-length vectors. Name identifies the model so
+// vectors from different embedders are never compared with each other.
+type Embedder interface {
+	Name() string
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// LocalEmbedder is a deterministic, offline embedder based on feature hashing
+// of word unigrams and bigrams. It needs no network access, which makes it the
+// default and the embedder to use in tests.
+type LocalEmbedder struct {
+	Dim int
+}
+
+func (e LocalEmbedder) Name() string {
+	return fmt.Sprintf("local-hash-%d", e.Dim)
+}
+
+func (e LocalEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = e.embed(text)
+	}
+	return vectors, nil
+}
+
+func (e LocalEmbedder) embed(text string) []float32 {
+	v := make([]float32, e.Dim)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '\''
+	})
+	add := func(feature string, weight float32) {
+		h := fnv.New32a()
+		h.Write([]byte(feature))
+		sum := h.Sum32()
+		// The top bit picks the sign so collisions tend to cancel out.
+		if sum&(1<<31) != 0 {
+			weight = -weight
+		}
+		v[int(sum%uint32(e.Dim))] += weight
+	}
+	for i, w := range words {
+		w = strings.TrimSuffix(w, "'s")
+		if len(w) > 3 {
+			w = strings.TrimSuffix(w, "s")
+		}
+		add(w, 1)
+		if i > 0 {
+			add(words[i-1]+" "+w, 0.5)
+		}
+	}
+	normalize(v)
+	return v
+}
+
+// GeminiEmbedder calls the Gemini embeddings API.
+type GeminiEmbedder struct {
+	Model string
+}
+
+func (e GeminiEmbedder) Name() string {
+	return "gemini-" + e.Model
+}
+
+func (e GeminiEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	apiKey := os.Getenv("GEMINI_API_KEY")
+	if apiKey == "" {
+		return nil, errors.New("GEMINI_API_KEY is not set")
+	}
+	client, err := genai.NewClient(ctx, &genai.ClientConfig{
+		APIKey:  apiKey,
+		Backend: genai.BackendGeminiAPI,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gemini client: %w", err)
+	}
+
+	var contents []*genai.Content
+	for _, text := range texts {
+		contents = append(contents, genai.NewContentFromText(text, genai.RoleUser))
+	}
+	resp, err := client.Models.EmbedContent(ctx, e.Model, contents, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed content: %w", err)
+	}
+	if len(resp.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(texts), len(resp.Embeddings))
+	}
+
+	vectors := make([][]float32, len(texts))
+	for i, emb := range resp.Embeddings {
+		vectors[i] = emb.Values
+		normalize(vectors[i])
+	}
+	return vectors, nil
+}
+
+// DefaultEmbedder returns the embedder selected by EMBEDDINGS_PROVIDER:
+// "gemini" for the model-backed embedder, otherwise the local one.
+func DefaultEmbedder() Embedder {
+	if os.Getenv("EMBEDDINGS_PROVIDER") == "gemini" {
+		model := os.Getenv("EMBEDDINGS_MODEL")
+		if model == "" {
+			model = "text-embedding-004"
+		}
+		return GeminiEmbedder{Model: model}
+	}
+	return LocalEmbedder{Dim: 256}
+}
+
+func normalize(v []float32) {
+	var sum float64
+	for _, f := range v {
+		sum += float64(f) * float64(f)
+	}
+	if sum == 0 {
+		return
+	}
+	norm := float32(math.Sqrt(sum))
+	for i := range v {
+		v[i] /= norm
+	}
+}
+
+// cosine assumes both vectors are already normalized.
+func cosine(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+	}
+	return dot
+}
+
+// EmbedRecord computes and stores the embedding for a journal entry or a
+// session summary.
+func EmbedRecord(ctx context.Context, embedder Embedder, kind string, recordID int, text string) error {
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+	vectors, err := embedder.Embed(ctx, []string{text})
+	if err != nil {
+		return err
+	}
+	return models.StoreEmbedding(models.Embedding{
+		Kind:     kind,
+		RecordID: recordID,
+		Model:    embedder.Name(),
+		Vector:   vectors[0],
+	})
+}
+
+// EmbedRecordAsync embeds a record in the background so slow embedding
+// providers do not hold up the request that created it.
+func EmbedRecordAsync(kind string, recordID int, text string) {
+	go func() {
+		if err := EmbedRecord(context.Background(), DefaultEmbedder(), kind, recordID, text); err != nil {
+			log.Printf("Error embedding %s %d: %v", kind, recordID, err)
+		}
+	}()
+}
+
+// sessionSummaryText is what a session is embedded and shown as in
+// semantic search: its summary and topics.
+func sessionSummaryText(s models.SessionSummary) string {
+	text := s.Summary
+	if len(s.Topics) > 0 {
+		text += "\nTopics: " + strings.Join(s.Topics, ", ")
+	}
+	return text
+}
+
+// EmbedSessionSummary embeds a session by its summary rather than its raw
+// transcripts, which are long and mostly small talk. The vector is stored
+// under the transcript the summary was made up to, replacing those of the
+// session's other transcripts.
+func EmbedSessionSummary(ctx context.Context, embedder Embedder, s models.SessionSummary) error {
+	if err := EmbedRecord(ctx, embedder, models.SearchKindTranscript, s.TranscriptID, sessionSummaryText(s)); err != nil {
+		return err
+	}
+	return models.DeleteSessionEmbeddings(s.SessionID, s.TranscriptID)
+}
+
+// ReindexEmbeddings recomputes embeddings for every journal entry and
+// session summary. Sessions that have not been summarized are left out.
+func ReindexEmbeddings(ctx context.Context, embedder Embedder) (int, error) {
+	count := 0
+	journals, err := models.GetAllJournalEntries()
+	if err != nil {
+		return 0, err
+	}
+	for _, j := range journals {
+		if err := EmbedRecord(ctx, embedder, models.SearchKindJournal, j.ID, j.Content); err != nil {
+			return count, fmt.Errorf("embedding journal %d: %w", j.ID, err)
+		}
+		count++
+	}
+
+	summaries, err := models.ListSessionSummaries(-1)
+	if err != nil {
+		return count, err
+	}
+	if err := models.DeleteEmbeddings(models.SearchKindTranscript); err != nil {
+		return count, err
+	}
+	for _, s := range summaries {
+		if err := EmbedSessionSummary(ctx, embedder, s); err != nil {
+			return count, fmt.Errorf("embedding summary of session %s: %w", s.SessionID, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+type SemanticResult struct {
+	Kind      string  `json:"type"`
+	RecordID  int     `json:"id"`
+	SessionID string  `json:"session_id,omitempty"`
+	Score     float64 `json:"score"`
+	Preview   string  `json:"preview"`
+	Link      string  `json:"link"`
+	CreatedAt string  `json:"created_at,omitempty"`
+	// Content is the full text, used when building prompts from results.
+	Content string `json:"-"`
+}
+
+// rankBySimilarity scores stored embeddings against query and returns the
+// top limit matches, skipping the record identified by exclude.
+func rankBySimilarity(embedder Embedder, query []float32, kind string, exclude *models.Embedding, limit int) ([]SemanticResult, error) {
+	stored, err := models.GetEmbeddings(embedder.Name(), kind)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []SemanticResult
+	for _, e := range stored {
+		if exclude != nil && e.Kind == exclude.Kind && e.RecordID == exclude.RecordID {
+			continue
+		}
+		results = append(results, SemanticResult{Kind: e.Kind, RecordID: e.RecordID, Score: cosine(query, e.Vector)})
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	out := []SemanticResult{}
+	for _, r := range results {
+		if err := fillSemanticResult(&r); err != nil {
+			if errors.Is(err, models.ErrNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+func fillSemanticResult(r *SemanticResult) error {
+	switch r.Kind {
+	case models.SearchKindJournal:
+		j, err := models.GetJournalEntry(r.RecordID)
+		if err != nil {
+			return err
+		}
+		r.Content = j.Content
+		r.CreatedAt = j.CreatedAt
+		r.Link = fmt.Sprintf("/journals/%d", j.ID)
+	case models.SearchKindTranscript:
+		t, err := models.GetTranscriptByID(r.RecordID)
+		if err != nil {
+			return err
+		}
+		// Sessions are matched by their summary, so that is what is shown.
+		r.Content = t.Transcript
+		if s, err := models.GetSessionSummary(t.SessionID); err == nil && s.Summary != "" {
+			r.Content = sessionSummaryText(s)
+		}
+		r.SessionID = t.SessionID
+		r.CreatedAt = t.CreatedAt
+		r.Link = "/transcripts/" + t.SessionID
+	}
+	r.Preview = preview(r.Content, 200)
+	return nil
+}
+
+func preview(text string, max int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	runes := []rune(text)
+	if len(runes) <= max {
+		return text
+	}
+	return string(runes[:max]) + "…"
+}
+
+// SemanticSearch ranks stored journals and sessions by cosine similarity to query.
+func SemanticSearch(ctx context.Context, embedder Embedder, query, kind string, limit int) ([]SemanticResult, error) {
+	vectors, err := embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	return rankBySimilarity(embedder, vectors[0], kind, nil, limit)
+}
+
+// RelatedRecords returns the records most similar to an already embedded one.
+func RelatedRecords(ctx context.Context, embedder Embedder, kind string, recordID int, limit int) ([]SemanticResult, error) {
+	source, err := models.GetEmbedding(kind, recordID)
+	if errors.Is(err, models.ErrNotFound) || err == nil && source.Model != embedder.Name() {
+		// Not embedded yet, or embedded by a different provider: embed it now.
+		var text string
+		switch kind {
+		case models.SearchKindJournal:
+			j, err := models.GetJournalEntry(recordID)
+			if err != nil {
+				return nil, err
+			}
+			text = j.Content
+		case models.SearchKindTranscript:
+			t, err := models.GetTranscriptByID(recordID)
+			if err != nil {
+				return nil, err
+			}
+			// Sessions are embedded by their summary, under the transcript
+			// it was made up to.
+			s, err := models.GetSessionSummary(t.SessionID)
+			if err != nil {
+				return nil, err
+			}
+			text, recordID = sessionSummaryText(s), s.TranscriptID
+		}
+		if err := EmbedRecord(ctx, embedder, kind, recordID, text); err != nil {
+			return nil, err
+		}
+		source, err = models.GetEmbedding(kind, recordID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rankBySimilarity(embedder, source.Vector, "", &source, limit)
+}
@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"mindful/backend-go/database"
+	"mindful/backend-go/models"
+	"testing"
+)
+
+func importTestTranscript(t *testing.T, sessionID, text string) models.Transcript {
+	t.Helper()
+	tr, err := models.ImportTranscript(sessionID, "test", []models.TranscriptTurn{{Speaker: "user", Text: text}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tr
+}
+
+func TestSessionsAreEmbeddedBySummary(t *testing.T) {
+	openTestDB(t)
+	ctx := context.Background()
+	embedder := DefaultEmbedder()
+	first := importTestTranscript(t, "s1", "Hi, can you hear me? Okay, good.")
+	latest := importTestTranscript(t, "s1", "I keep waking up at four and can't get back to sleep.")
+	other := importTestTranscript(t, "s2", "Work has been fine this week.")
+	for _, tr := range []models.Transcript{first, other} {
+		if err := EmbedRecord(ctx, embedder, models.SearchKindTranscript, tr.ID, tr.Transcript); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	summary, err := models.CompleteSessionSummary(models.SessionSummary{
+		SessionID:    "s1",
+		TranscriptID: latest.ID,
+		Summary:      "The user talked about waking up early and poor sleep.",
+		Topics:       []string{"sleep"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := EmbedSessionSummary(ctx, embedder, summary); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := models.GetEmbedding(models.SearchKindTranscript, latest.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := embedder.Embed(ctx, []string{"The user talked about waking up early and poor sleep.\nTopics: sleep"})
+	if cosine(stored.Vector, want[0]) < 0.9999 {
+		t.Error("session is not embedded by its summary")
+	}
+	if _, err := models.GetEmbedding(models.SearchKindTranscript, first.ID); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("earlier transcript of the session still embedded: %v", err)
+	}
+	if _, err := models.GetEmbedding(models.SearchKindTranscript, other.ID); err != nil {
+		t.Errorf("other session's embedding removed: %v", err)
+	}
+
+	n, err := ReindexEmbeddings(ctx, embedder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("reindexed %d records, want 1", n)
+	}
+	if _, err := models.GetEmbedding(models.SearchKindTranscript, other.ID); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("raw transcript of an unsummarized session still embedded after reindex: %v", err)
+	}
+
+	results, err := SemanticSearch(ctx, embedder, "poor sleep", models.SearchKindTranscript, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].RecordID != latest.ID || results[0].SessionID != "s1" {
+		t.Fatalf("results = %+v, want the summarized session", results)
+	}
+	if results[0].Preview != "The user talked about waking up early and poor sleep. Topics: sleep" {
+		t.Errorf("preview = %q, want the summary", results[0].Preview)
+	}
+}
+
+func TestRedactionKeepsSummaryEmbedding(t *testing.T) {
+	openTestDB(t)
+	ctx := context.Background()
+	embedder := DefaultEmbedder()
+	tr := importTestTranscript(t, "s1", "I keep waking up at four and can't get back to sleep.")
+	summary, err := models.CompleteSessionSummary(models.SessionSummary{
+		SessionID:    "s1",
+		TranscriptID: tr.ID,
+		Summary:      "The user talked about poor sleep.",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := EmbedSessionSummary(ctx, embedder, summary); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.DB.Exec(`UPDATE transcripts SET created_at = datetime('now', '-100 days') WHERE id = ?`, tr.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	purged, err := models.ApplyRetention(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(purged) != 1 || purged[0].RecordID != tr.ID || purged[0].Action != models.RetentionActionRedact {
+		t.Fatalf("retention acted on %+v, want the transcript redacted", purged)
+	}
+	if _, err := models.GetEmbedding(models.SearchKindTranscript, tr.ID); err != nil {
+		t.Errorf("summary embedding removed by redaction: %v", err)
+	}
+	results, err := SemanticSearch(ctx, embedder, "poor sleep", models.SearchKindTranscript, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].RecordID != tr.ID {
+		t.Errorf("results = %+v, want the redacted session", results)
+	}
+}
@@ -0,0 +1,525 @@
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"mindful/backend-go/models"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ExportLinkTTL is how long a background export's download link stays valid.
+const ExportLinkTTL = 24 * time.Hour
+
+type ExportManifestFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+type ExportManifest struct {
+	GeneratedAt string               `json:"generated_at"`
+	Counts      map[string]int       `json:"counts"`
+	Files       []ExportManifestFile `json:"files"`
+}
+
+// exportArchive streams files into a zip and records a checksum for each one.
+type exportArchive struct {
+	zw       *zip.Writer
+	manifest ExportManifest
+}
+
+// archiveFile is a file being written into the archive. Close records its
+// size and checksum in the manifest.
+type archiveFile struct {
+	archive *exportArchive
+	path    string
+	w       io.Writer
+	hash    hash.Hash
+	size    int64
+}
+
+func (f *archiveFile) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	f.hash.Write(p[:n])
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *archiveFile) Close() error {
+	f.archive.manifest.Files = append(f.archive.manifest.Files, ExportManifestFile{
+		Path:   f.path,
+		Size:   f.size,
+		SHA256: hex.EncodeToString(f.hash.Sum(nil)),
+	})
+	return nil
+}
+
+func (a *exportArchive) create(path string) (*archiveFile, error) {
+	w, err := a.zw.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &archiveFile{archive: a, path: path, w: w, hash: sha256.New()}, nil
+}
+
+func (a *exportArchive) add(path string, data []byte) error {
+	return a.addReader(path, bytes.NewReader(data))
+}
+
+// addReader streams a file into the archive, for content such as audio that
+// is too large to hold in memory.
+func (a *exportArchive) addReader(path string, r io.Reader) error {
+	f, err := a.create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func (a *exportArchive) addJSON(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return a.add(path, data)
+}
+
+// addJSONArray writes a JSON array to path one element at a time. each is
+// called with a function that appends an element, and returns how many it
+// appended.
+func (a *exportArchive) addJSONArray(path string, each func(add func(v interface{}) error) error) (int, error) {
+	f, err := a.create(path)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	if _, err := io.WriteString(f, "["); err != nil {
+		return 0, err
+	}
+	err = each(func(v interface{}) error {
+		data, err := json.MarshalIndent(v, "  ", "  ")
+		if err != nil {
+			return err
+		}
+		sep := ",\n  "
+		if n == 0 {
+			sep = "\n  "
+		}
+		n++
+		if _, err := io.WriteString(f, sep); err != nil {
+			return err
+		}
+		_, err = f.Write(data)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	end := "\n]\n"
+	if n == 0 {
+		end = "]\n"
+	}
+	if _, err := io.WriteString(f, end); err != nil {
+		return 0, err
+	}
+	return n, f.Close()
+}
+
+// CountExportRecords returns how many records an export would contain, used to
+// decide whether to stream the archive or hand it off to a background job.
+func CountExportRecords() (int, error) {
+	return models.CountRecords("transcripts", "journal_entries", "game_plans", "thought_records")
+}
+
+// WriteExport writes a zip archive of all stored data to w. Every record is
+// written as JSON and as Markdown, followed by a manifest of SHA-256 checksums.
+// Records are read from the database a page at a time as they are written.
+func WriteExport(w io.Writer) error {
+	archive := &exportArchive{
+		zw: zip.NewWriter(w),
+		manifest: ExportManifest{
+			GeneratedAt: time.Now().UTC().Format(time.RFC3339),
+			Counts:      map[string]int{},
+		},
+	}
+
+	transcripts, turns := 0, 0
+	err := models.EachTranscript(func(t models.Transcript) error {
+		transcripts++
+		turns += len(t.Turns)
+		base := fmt.Sprintf("transcripts/%d-%s", t.ID, safeFileName(t.SessionID))
+		if err := archive.addJSON(base+".json", t); err != nil {
+			return err
+		}
+		return archive.add(base+".md", []byte(transcriptMarkdown(t)))
+	})
+	if err != nil {
+		return err
+	}
+	archive.manifest.Counts["transcripts"] = transcripts
+	archive.manifest.Counts["transcript_turns"] = turns
+
+	journals := 0
+	err = models.EachJournalEntry(func(j models.Journal) error {
+		journals++
+		base := fmt.Sprintf("journals/%d", j.ID)
+		if err := archive.addJSON(base+".json", j); err != nil {
+			return err
+		}
+		if err := archive.add(base+".md", []byte(journalMarkdown(j))); err != nil {
+			return err
+		}
+
+		revisions, err := models.GetJournalRevisions(j.ID)
+		if err != nil {
+			return err
+		}
+		if len(revisions) > 0 {
+			return archive.addJSON(base+"-revisions.json", revisions)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	archive.manifest.Counts["journals"] = journals
+
+	moods, err := archive.addJSONArray("mood-check-ins.json", func(add func(v interface{}) error) error {
+		return models.EachMoodCheckIn(func(m models.MoodCheckIn) error { return add(m) })
+	})
+	if err != nil {
+		return err
+	}
+	archive.manifest.Counts["mood_check_ins"] = moods
+
+	records := 0
+	err = models.EachThoughtRecord(func(t models.ThoughtRecord) error {
+		records++
+		base := fmt.Sprintf("thought-records/%d", t.ID)
+		if err := archive.addJSON(base+".json", t); err != nil {
+			return err
+		}
+		return archive.add(base+".md", []byte(thoughtRecordMarkdown(t)))
+	})
+	if err != nil {
+		return err
+	}
+	archive.manifest.Counts["thought_records"] = records
+
+	habits, err := models.GetAllHabits()
+	if err != nil {
+		return err
+	}
+	for _, h := range habits {
+		logs, err := models.GetHabitLogs(h.ID, "", "")
+		if err != nil {
+			return err
+		}
+		record := struct {
+			models.Habit
+			Logs []models.HabitLog `json:"logs"`
+		}{h, logs}
+		if err := archive.addJSON(fmt.Sprintf("habits/%d.json", h.ID), record); err != nil {
+			return err
+		}
+	}
+	archive.manifest.Counts["habits"] = len(habits)
+
+	goals, err := models.ListGoals("")
+	if err != nil {
+		return err
+	}
+	for _, g := range goals {
+		tasks, err := models.GetGoalTasks(g.ID)
+		if err != nil {
+			return err
+		}
+		record := struct {
+			models.Goal
+			Tasks []models.GamePlanTask `json:"tasks"`
+		}{g, tasks}
+		if err := archive.addJSON(fmt.Sprintf("goals/%d.json", g.ID), record); err != nil {
+			return err
+		}
+	}
+	archive.manifest.Counts["goals"] = len(goals)
+
+	reminders, err := models.ListReminders()
+	if err != nil {
+		return err
+	}
+	if err := archive.addJSON("reminders.json", reminders); err != nil {
+		return err
+	}
+	archive.manifest.Counts["reminders"] = len(reminders)
+
+	sessions, err := models.ListPlannedSessions(false)
+	if err != nil {
+		return err
+	}
+	if err := archive.addJSON("planned-sessions.json", sessions); err != nil {
+		return err
+	}
+	archive.manifest.Counts["planned_sessions"] = len(sessions)
+
+	webhooks, err := models.ListWebhooks()
+	if err != nil {
+		return err
+	}
+	if err := archive.addJSON("webhooks.json", webhooks); err != nil {
+		return err
+	}
+	archive.manifest.Counts["webhooks"] = len(webhooks)
+
+	recordings, err := models.ListSessionAudio()
+	if err != nil {
+		return err
+	}
+	if err := archive.addJSON("audio/recordings.json", recordings); err != nil {
+		return err
+	}
+	store := DefaultBlobStore()
+	for _, rec := range recordings {
+		if rec.Status != models.AudioStatusComplete {
+			continue
+		}
+		_, content, err := OpenSessionAudio(context.Background(), store, rec.SessionID)
+		if err != nil {
+			return err
+		}
+		err = archive.addReader(fmt.Sprintf("audio/%d%s", rec.ID, audioExtensions[rec.ContentType]), content)
+		content.Close()
+		if err != nil {
+			return err
+		}
+	}
+	archive.manifest.Counts["audio_recordings"] = len(recordings)
+
+	notifications, err := archive.addJSONArray("notifications.json", func(add func(v interface{}) error) error {
+		return models.EachNotification(func(n models.Notification) error { return add(n) })
+	})
+	if err != nil {
+		return err
+	}
+	archive.manifest.Counts["notifications"] = notifications
+
+	gamePlans, taskCount := 0, 0
+	err = models.EachGamePlan(func(g models.GamePlan) error {
+		gamePlans++
+		tasks := splitTasks(g.Tasks)
+		taskCount += len(tasks)
+		base := fmt.Sprintf("gameplans/%d", g.ID)
+		record := struct {
+			models.GamePlan
+			TaskList []string `json:"task_list"`
+		}{g, tasks}
+		if err := archive.addJSON(base+".json", record); err != nil {
+			return err
+		}
+		return archive.add(base+".md", []byte(gamePlanMarkdown(g, tasks)))
+	})
+	if err != nil {
+		return err
+	}
+	archive.manifest.Counts["gameplans"] = gamePlans
+	archive.manifest.Counts["tasks"] = taskCount
+
+	manifest, err := json.MarshalIndent(archive.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := archive.zw.Create("manifest.json")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(manifest); err != nil {
+		return err
+	}
+	return archive.zw.Close()
+}
+
+// StartExportJob creates an export job and builds its archive in the background.
+func StartExportJob(dir string) (models.ExportJob, error) {
+	token, err := NewToken()
+	if err != nil {
+		return models.ExportJob{}, err
+	}
+	job, err := models.CreateExportJob(token)
+	if err != nil {
+		return models.ExportJob{}, err
+	}
+	go runExportJob(job, dir)
+	return job, nil
+}
+
+func runExportJob(job models.ExportJob, dir string) {
+	log.Printf("Running export job %d", job.ID)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		log.Printf("Error creating export directory: %v", err)
+		models.FailExportJob(job.ID, "failed to create export directory")
+		return
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf("export-%d.zip", job.ID))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		log.Printf("Error creating export file: %v", err)
+		models.FailExportJob(job.ID, "failed to create export file")
+		return
+	}
+	err = WriteExport(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.Printf("Error writing export %d: %v", job.ID, err)
+		os.Remove(path)
+		models.FailExportJob(job.ID, "failed to write export")
+		return
+	}
+
+	expiresAt := time.Now().Add(ExportLinkTTL)
+	if err := models.CompleteExportJob(job.ID, path, expiresAt); err != nil {
+		log.Printf("Error completing export job %d: %v", job.ID, err)
+		return
+	}
+	log.Printf("Export job %d completed", job.ID)
+	// The retention sweeper catches files whose timer was lost to a restart.
+	time.AfterFunc(time.Until(expiresAt)+time.Second, func() {
+		RemoveExpiredExports(time.Now())
+	})
+}
+
+// RemoveExpiredExports deletes the files of exports whose download link has
+// expired.
+func RemoveExpiredExports(now time.Time) {
+	jobs, err := models.ListExpiredExportFiles(now)
+	if err != nil {
+		log.Printf("Error listing expired exports: %v", err)
+		return
+	}
+	for _, job := range jobs {
+		if err := os.Remove(job.FilePath); err != nil && !os.IsNotExist(err) {
+			log.Printf("Error removing expired export %d: %v", job.ID, err)
+			continue
+		}
+		if err := models.ClearExportFile(job.ID); err != nil {
+			log.Printf("Error clearing expired export %d: %v", job.ID, err)
+		}
+	}
+}
+
+// NewToken returns a random hex token suitable for unguessable links.
+func NewToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func splitTasks(tasks string) []string {
+	var out []string
+	for _, task := range strings.Split(tasks, "\n") {
+		if task = strings.TrimSpace(task); task != "" {
+			out = append(out, task)
+		}
+	}
+	return out
+}
+
+func transcriptMarkdown(t models.Transcript) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Session %s\n\n", t.SessionID)
+	if t.CreatedAt != "" {
+		fmt.Fprintf(&b, "_Recorded %s_\n\n", t.CreatedAt)
+	}
+	for _, line := range strings.Split(t.Transcript, "\n") {
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		if speaker, text, ok := strings.Cut(line, ":"); ok {
+			fmt.Fprintf(&b, "**%s:** %s\n\n", strings.TrimSpace(speaker), strings.TrimSpace(text))
+		} else {
+			fmt.Fprintf(&b, "%s\n\n", line)
+		}
+	}
+	return b.String()
+}
+
+func journalMarkdown(j models.Journal) string {
+	var b strings.Builder
+	title := j.Title
+	if title == "" {
+		title = fmt.Sprintf("Journal entry %d", j.ID)
+	}
+	fmt.Fprintf(&b, "# %s\n\n_Written %s_\n\n", title, j.CreatedAt)
+	if len(j.Tags) > 0 {
+		fmt.Fprintf(&b, "Tags: %s\n\n", strings.Join(j.Tags, ", "))
+	}
+	if j.Location != "" {
+		fmt.Fprintf(&b, "Location: %s\n\n", j.Location)
+	}
+	if j.MoodIntensity != nil {
+		fmt.Fprintf(&b, "Mood intensity: %d/%d\n\n", *j.MoodIntensity, models.MaxMoodIntensity)
+	}
+	fmt.Fprintf(&b, "%s\n", j.Content)
+	return b.String()
+}
+
+func thoughtRecordMarkdown(t models.ThoughtRecord) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Thought record %d\n\n_Written %s_\n\n", t.ID, t.CreatedAt)
+	fmt.Fprintf(&b, "## Situation\n\n%s\n\n## Automatic thought\n\n%s\n\n", t.Situation, t.AutomaticThought)
+	if len(t.Emotions) > 0 {
+		b.WriteString("## Emotions\n\n")
+		for _, e := range t.Emotions {
+			fmt.Fprintf(&b, "- %s: %d/%d\n", e.Name, e.Intensity, models.MaxRatingScale)
+		}
+		b.WriteString("\n")
+	}
+	if len(t.Distortions) > 0 {
+		fmt.Fprintf(&b, "## Distortions\n\n%s\n\n", strings.Join(t.Distortions, ", "))
+	}
+	fmt.Fprintf(&b, "## Evidence for\n\n%s\n\n## Evidence against\n\n%s\n\n", t.EvidenceFor, t.EvidenceAgainst)
+	fmt.Fprintf(&b, "## Balanced thought\n\n%s\n", t.BalancedThought)
+	if t.OutcomeRating != nil {
+		fmt.Fprintf(&b, "\nOutcome rating: %d/%d\n", *t.OutcomeRating, models.MaxRatingScale)
+	}
+	return b.String()
+}
+
+func gamePlanMarkdown(g models.GamePlan, tasks []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Game plan %d\n\n_Generated %s_\n\n", g.ID, g.CreatedAt)
+	fmt.Fprintf(&b, "## Summary\n\n%s\n\n## Tasks\n\n", g.Summary)
+	for _, task := range tasks {
+		fmt.Fprintf(&b, "- [ ] %s\n", task)
+	}
+	return b.String()
+}
+
+func safeFileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, name)
+}
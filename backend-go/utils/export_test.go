@@ -0,0 +1,157 @@
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mindful/backend-go/database"
+	"mindful/backend-go/models"
+	"testing"
+)
+
+func readArchive(t *testing.T, data []byte) map[string][]byte {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string][]byte)
+	for _, f := range zr.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name] = content
+	}
+	return files
+}
+
+func TestWriteExportReadsBack(t *testing.T) {
+	openTestDB(t)
+	// More journals than fit in one page, so the export crosses a page
+	// boundary.
+	const journals = 130
+	for i := 0; i < journals; i++ {
+		j := models.Journal{Content: fmt.Sprintf("Entry %d", i)}
+		if i%2 == 0 {
+			mood := i%10 + 1
+			j.MoodIntensity = &mood
+		}
+		if _, err := models.StoreJournalEntry(j); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := database.DB.Exec(`UPDATE journal_entries SET emotional_state = 'Calm' WHERE id = 2`); err != nil {
+		t.Fatal(err)
+	}
+	tr := importTestTranscript(t, "s1", "I slept badly again.")
+	if _, err := models.StoreGamePlan([]models.PlannedTask{{Description: "Go to bed by eleven"}, {Description: "No screens after ten"}}, "Sleep", "Tired", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := models.CreateThoughtRecord(models.ThoughtRecord{Situation: "Woke at four", AutomaticThought: "I'll never sleep properly"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := models.StoreNotification(models.Notification{Title: "Reminder", Body: "Journal tonight"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteExport(&buf); err != nil {
+		t.Fatal(err)
+	}
+	files := readArchive(t, buf.Bytes())
+
+	var manifest ExportManifest
+	if err := json.Unmarshal(files["manifest.json"], &manifest); err != nil {
+		t.Fatalf("reading manifest: %v", err)
+	}
+	if len(manifest.Files) != len(files)-1 {
+		t.Errorf("manifest lists %d files, archive has %d besides the manifest", len(manifest.Files), len(files)-1)
+	}
+	for _, f := range manifest.Files {
+		content, ok := files[f.Path]
+		if !ok {
+			t.Errorf("%s is in the manifest but not the archive", f.Path)
+			continue
+		}
+		sum := sha256.Sum256(content)
+		if f.Size != int64(len(content)) || f.SHA256 != hex.EncodeToString(sum[:]) {
+			t.Errorf("%s: manifest has size %d sha256 %s, archive has %d %x", f.Path, f.Size, f.SHA256, len(content), sum)
+		}
+	}
+
+	want := map[string]int{
+		"transcripts":      1,
+		"transcript_turns": 1,
+		"journals":         journals,
+		"mood_check_ins":   journals/2 + 1,
+		"thought_records":  1,
+		"gameplans":        1,
+		"tasks":            2,
+		"notifications":    1,
+	}
+	for name, n := range want {
+		if manifest.Counts[name] != n {
+			t.Errorf("count %s = %d, want %d", name, manifest.Counts[name], n)
+		}
+	}
+	for i := 1; i <= journals; i++ {
+		if _, ok := files[fmt.Sprintf("journals/%d.json", i)]; !ok {
+			t.Errorf("journal %d missing from the archive", i)
+		}
+	}
+
+	var moods []models.MoodCheckIn
+	if err := json.Unmarshal(files["mood-check-ins.json"], &moods); err != nil {
+		t.Fatalf("reading mood check-ins: %v", err)
+	}
+	if len(moods) != journals/2+1 {
+		t.Fatalf("got %d mood check-ins, want %d", len(moods), journals/2+1)
+	}
+	if m := moods[0]; m.JournalID != 1 || m.MoodIntensity == nil || *m.MoodIntensity != 1 {
+		t.Errorf("first check-in = %+v, want journal 1 rated 1", m)
+	}
+	if m := moods[1]; m.JournalID != 2 || m.MoodIntensity != nil || m.EmotionalState != "Calm" {
+		t.Errorf("second check-in = %+v, want journal 2 analyzed as Calm", m)
+	}
+
+	var notifications []models.Notification
+	if err := json.Unmarshal(files["notifications.json"], &notifications); err != nil {
+		t.Fatalf("reading notifications: %v", err)
+	}
+	if len(notifications) != 1 || notifications[0].Title != "Reminder" {
+		t.Errorf("notifications = %+v", notifications)
+	}
+
+	var transcript models.Transcript
+	if err := json.Unmarshal(files[fmt.Sprintf("transcripts/%d-s1.json", tr.ID)], &transcript); err != nil {
+		t.Fatalf("reading transcript: %v", err)
+	}
+	if len(transcript.Turns) != 1 || transcript.Turns[0].Text != "I slept badly again." {
+		t.Errorf("transcript turns = %+v", transcript.Turns)
+	}
+}
+
+func TestWriteExportWithNoRecords(t *testing.T) {
+	openTestDB(t)
+	var buf bytes.Buffer
+	if err := WriteExport(&buf); err != nil {
+		t.Fatal(err)
+	}
+	files := readArchive(t, buf.Bytes())
+	for _, name := range []string{"mood-check-ins.json", "notifications.json"} {
+		var records []json.RawMessage
+		if err := json.Unmarshal(files[name], &records); err != nil || len(records) != 0 {
+			t.Errorf("%s = %q, want an empty array", name, files[name])
+		}
+	}
+}
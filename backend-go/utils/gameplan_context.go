@@ -0,0 +1,297 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mindful/backend-go/models"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// minRelatedScore is the cosine similarity below which a past entry is not
+// considered related enough to include.
+const minRelatedScore = 0.1
+
+// defaultGamePlanTokenBudget bounds the context sent to the model when
+// GAMEPLAN_TOKEN_BUDGET is not set.
+const defaultGamePlanTokenBudget = 6000
+
+// GamePlanContext is the retrieved material a game plan is generated from.
+// Every record in Text is labelled with its citation key, e.g. [journal:4].
+// Emotions is the vocal emotion of the most recent session, when its turns
+// carry prosody scores.
+type GamePlanContext struct {
+	Text      string
+	Citations []models.Citation
+	Emotions  *models.SessionEmotions
+}
+
+// estimateTokens approximates a token count at four characters per token.
+func estimateTokens(s string) int {
+	return len(s)/4 + 1
+}
+
+// truncateToTokens keeps the end of s, where a session's conclusions are,
+// when it is longer than the token limit.
+func truncateToTokens(s string, tokens int) string {
+	max := tokens * 4
+	if len(s) <= max {
+		return s
+	}
+	cut := len(s) - max
+	for cut < len(s) && (s[cut]&0xC0) == 0x80 {
+		cut++
+	}
+	return "…" + s[cut:]
+}
+
+func gamePlanTokenBudget() int {
+	if n, err := strconv.Atoi(os.Getenv("GAMEPLAN_TOKEN_BUDGET")); err == nil && n > 0 {
+		return n
+	}
+	return defaultGamePlanTokenBudget
+}
+
+type contextBuilder struct {
+	b         strings.Builder
+	remaining int
+	citations []models.Citation
+	seen      map[string]bool
+}
+
+// add appends a section if it fits in the remaining budget.
+func (cb *contextBuilder) add(section string, cite *models.Citation) bool {
+	cost := estimateTokens(section)
+	if cost > cb.remaining {
+		return false
+	}
+	cb.b.WriteString(section)
+	cb.b.WriteString("\n")
+	cb.remaining -= cost
+	if cite != nil && !cb.seen[cite.Key()] {
+		cb.seen[cite.Key()] = true
+		cb.citations = append(cb.citations, *cite)
+	}
+	return true
+}
+
+// contextGroup is a run of sections under a shared header.
+type contextGroup struct {
+	header  string
+	started bool
+}
+
+// addTo appends a section to a group if it fits in the remaining budget,
+// writing the group's header first when this is its first section, so a
+// header is never left without anything under it.
+func (cb *contextBuilder) addTo(g *contextGroup, section string, cite *models.Citation) bool {
+	if !g.started {
+		if estimateTokens(g.header)+estimateTokens(section) > cb.remaining {
+			return false
+		}
+		cb.add(g.header, nil)
+		g.started = true
+	}
+	return cb.add(section, cite)
+}
+
+// recentThoughtRecords is how many completed thought records are included.
+const recentThoughtRecords = 3
+
+// recentSessionSummaries is how many session summaries are included,
+// counting the latest session's.
+const recentSessionSummaries = 4
+
+// BuildGamePlanContext retrieves what a new game plan should be based on: the
+// most recent session with its vocal emotion and summaries of recent
+// sessions, the previous plan with its open and completed tasks, the user's
+// active goals, recently completed CBT thought records, and past entries
+// semantically related to the latest session, in that order of priority and
+// within the token budget.
+func BuildGamePlanContext(ctx context.Context, embedder Embedder) (GamePlanContext, error) {
+	budget := gamePlanTokenBudget()
+	cb := &contextBuilder{remaining: budget, seen: map[string]bool{}}
+
+	anchor := ""
+	var vocal *models.SessionEmotions
+	latest, err := models.GetLatestTranscript()
+	if err != nil && !errors.Is(err, models.ErrNotFound) {
+		return GamePlanContext{}, err
+	}
+	if err == nil {
+		cite := models.Citation{Type: models.SearchKindTranscript, ID: latest.ID, SessionID: latest.SessionID, CreatedAt: latest.CreatedAt}
+		body := truncateToTokens(latest.Transcript, budget/2)
+		cb.add(fmt.Sprintf("## Most recent session [%s] %s\n%s\n", cite.Key(), latest.CreatedAt, body), &cite)
+		anchor = latest.Transcript
+
+		emotions, err := models.GetSessionEmotions(latest.SessionID)
+		if err != nil {
+			return GamePlanContext{}, err
+		}
+		if emotions.ScoredTurns > 0 {
+			vocal = &emotions
+			cb.add(emotionSection(emotions), nil)
+		}
+	}
+
+	// Summaries carry the key moments and commitments of the latest session
+	// and earlier ones, which their truncated transcripts may have lost.
+	summaries, err := models.ListSessionSummaries(recentSessionSummaries)
+	if err != nil {
+		return GamePlanContext{}, err
+	}
+	earlier := &contextGroup{header: "## Earlier session summaries"}
+	for _, s := range summaries {
+		cite := models.Citation{Type: models.SearchKindTranscript, ID: s.TranscriptID, SessionID: s.SessionID, CreatedAt: s.CreatedAt}
+		if s.SessionID == latest.SessionID {
+			cb.add(summarySection(cite, s, true), &cite)
+		} else {
+			cb.addTo(earlier, summarySection(cite, s, false), &cite)
+		}
+	}
+
+	plan, err := models.GetLatestGamePlan()
+	if err != nil && !errors.Is(err, models.ErrNotFound) {
+		return GamePlanContext{}, err
+	}
+	if err == nil {
+		var section strings.Builder
+		cite := models.Citation{Type: "gameplan", ID: plan.ID, CreatedAt: plan.CreatedAt}
+		fmt.Fprintf(&section, "## Previous game plan [%s]\nSummary: %s\nTasks:\n", cite.Key(), plan.Summary)
+		if len(plan.TaskItems) == 0 {
+			for _, task := range splitTasks(plan.Tasks) {
+				fmt.Fprintf(&section, "- %s\n", task)
+			}
+		}
+		for _, task := range plan.TaskItems {
+			fmt.Fprintf(&section, "- (%s) %s\n", task.Status, task.Description)
+		}
+		cb.add(section.String(), &cite)
+	}
+
+	goals, err := models.ListGoals(models.GoalStatusActive)
+	if err != nil {
+		return GamePlanContext{}, err
+	}
+	goalGroup := &contextGroup{header: "## Active goals"}
+	for _, g := range goals {
+		cite := models.Citation{Type: "goal", ID: g.ID, CreatedAt: g.CreatedAt}
+		cb.addTo(goalGroup, goalSection(cite, g), &cite)
+	}
+
+	records, err := models.ListThoughtRecords(true, recentThoughtRecords)
+	if err != nil {
+		return GamePlanContext{}, err
+	}
+	recordGroup := &contextGroup{header: "## Recent CBT thought records"}
+	for _, t := range records {
+		cite := models.Citation{Type: "thought_record", ID: t.ID, CreatedAt: t.CreatedAt}
+		cb.addTo(recordGroup, thoughtRecordSection(cite, t), &cite)
+	}
+
+	if anchor == "" {
+		// No sessions yet: anchor retrieval on the newest journal entry instead.
+		journals, err := models.GetAllJournalEntries()
+		if err != nil {
+			return GamePlanContext{}, err
+		}
+		if len(journals) > 0 {
+			anchor = journals[len(journals)-1].Content
+		}
+	}
+
+	if anchor != "" {
+		related, err := SemanticSearch(ctx, embedder, anchor, "", 10)
+		if err != nil {
+			return GamePlanContext{}, err
+		}
+		relatedGroup := &contextGroup{header: "## Related past entries"}
+		for _, r := range related {
+			cite := models.Citation{Type: r.Kind, ID: r.RecordID, SessionID: r.SessionID, CreatedAt: r.CreatedAt}
+			if cb.seen[cite.Key()] || r.Score < minRelatedScore {
+				continue
+			}
+			body := truncateToTokens(r.Content, budget/5)
+			cb.addTo(relatedGroup, fmt.Sprintf("### [%s] %s\n%s\n", cite.Key(), r.CreatedAt, body), &cite)
+		}
+	}
+
+	return GamePlanContext{Text: cb.b.String(), Citations: cb.citations, Emotions: vocal}, nil
+}
+
+func emotionSection(e models.SessionEmotions) string {
+	var b strings.Builder
+	b.WriteString("## Vocal emotion in the most recent session\n")
+	names := make([]string, len(e.Dominant))
+	for i, d := range e.Dominant {
+		names[i] = fmt.Sprintf("%s (%.2f)", d.Name, d.Score)
+	}
+	fmt.Fprintf(&b, "Dominant emotions over %d turns: %s\n", e.ScoredTurns, strings.Join(names, ", "))
+	if e.Trend != "" {
+		fmt.Fprintf(&b, "Emotional tone over the session: %s\n", e.Trend)
+	}
+	return b.String()
+}
+
+// summarySection writes a session summary; the latest session's lists its
+// key moments as well.
+func summarySection(cite models.Citation, s models.SessionSummary, latest bool) string {
+	var b strings.Builder
+	if latest {
+		fmt.Fprintf(&b, "## Summary of the most recent session [%s]\n%s\n", cite.Key(), s.Summary)
+		for _, m := range s.KeyMoments {
+			turns := fmt.Sprintf("turns %d-%d", m.StartTurn, m.EndTurn)
+			if m.StartTurn == m.EndTurn {
+				turns = fmt.Sprintf("turn %d", m.StartTurn)
+			}
+			fmt.Fprintf(&b, "Key moment (%s, %s): %s\n", m.Label, turns, m.Description)
+		}
+	} else {
+		fmt.Fprintf(&b, "### [%s] %s\n%s\n", cite.Key(), s.CreatedAt, s.Summary)
+	}
+	if len(s.Topics) > 0 {
+		fmt.Fprintf(&b, "Topics: %s\n", strings.Join(s.Topics, ", "))
+	}
+	for _, c := range s.Commitments {
+		fmt.Fprintf(&b, "Commitment: %s\n", c.Text)
+	}
+	return b.String()
+}
+
+func thoughtRecordSection(cite models.Citation, t models.ThoughtRecord) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "### [%s] %s\nSituation: %s\nAutomatic thought: %s\n", cite.Key(), t.CreatedAt, t.Situation, t.AutomaticThought)
+	for _, e := range t.Emotions {
+		fmt.Fprintf(&b, "Emotion: %s (%d/%d)\n", e.Name, e.Intensity, models.MaxRatingScale)
+	}
+	if len(t.Distortions) > 0 {
+		fmt.Fprintf(&b, "Distortions: %s\n", strings.Join(t.Distortions, ", "))
+	}
+	fmt.Fprintf(&b, "Balanced thought: %s\n", t.BalancedThought)
+	if t.OutcomeRating != nil {
+		fmt.Fprintf(&b, "Outcome rating: %d/%d\n", *t.OutcomeRating, models.MaxRatingScale)
+	}
+	return b.String()
+}
+
+func goalSection(cite models.Citation, g models.Goal) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "### [%s] %s\n", cite.Key(), g.Title)
+	if g.Why != "" {
+		fmt.Fprintf(&b, "Why: %s\n", g.Why)
+	}
+	if g.TargetDate != "" {
+		fmt.Fprintf(&b, "Target date: %s\n", g.TargetDate)
+	}
+	fmt.Fprintf(&b, "Progress: %d of %d linked tasks completed\n", g.Progress.CompletedTasks, g.Progress.LinkedTasks)
+	for _, m := range g.Milestones {
+		status := "open"
+		if m.Completed {
+			status = "done"
+		}
+		fmt.Fprintf(&b, "- Milestone (%s): %s\n", status, m.Title)
+	}
+	return b.String()
+}
@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"context"
+	"mindful/backend-go/models"
+	"strings"
+	"testing"
+)
+
+func TestBuildGamePlanContextOmitsEmptyHeaders(t *testing.T) {
+	openTestDB(t)
+	t.Setenv("GAMEPLAN_TOKEN_BUDGET", "100")
+	if _, err := models.CreateGoal(models.Goal{Title: "Run a marathon", Why: strings.Repeat("Because I want to. ", 40)}); err != nil {
+		t.Fatal(err)
+	}
+
+	pc, err := BuildGamePlanContext(context.Background(), DefaultEmbedder())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pc.Text != "" || len(pc.Citations) != 0 {
+		t.Errorf("context = %q with %d citations, want nothing when no goal fits", pc.Text, len(pc.Citations))
+	}
+
+	short, err := models.CreateGoal(models.Goal{Title: "Sleep by eleven"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc, err = BuildGamePlanContext(context.Background(), DefaultEmbedder())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(pc.Text, "## Active goals") != 1 || !strings.Contains(pc.Text, "Sleep by eleven") {
+		t.Errorf("context = %q, want the header with the goal that fits", pc.Text)
+	}
+	if strings.Contains(pc.Text, "Run a marathon") {
+		t.Errorf("context = %q includes the goal over budget", pc.Text)
+	}
+	if len(pc.Citations) != 1 || pc.Citations[0].ID != short.ID {
+		t.Errorf("citations = %+v", pc.Citations)
+	}
+}
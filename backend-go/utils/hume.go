@@ -0,0 +1,170 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var ErrVoiceNotConfigured = errors.New("voice service is not configured")
+
+// HumeClient talks to Hume's Empathic Voice Interface (EVI). The API and
+// secret keys stay on the server: browsers get short-lived access tokens,
+// or go through the relay, which connects with one.
+type HumeClient struct {
+	APIKey    string
+	SecretKey string
+	// ConfigID selects the EVI configuration (voice, prompt, model) used
+	// when a chat doesn't name one.
+	ConfigID string
+	BaseURL  string
+	Client   *http.Client
+}
+
+// DefaultHumeClient returns a client for the keys in HUME_API_KEY and
+// HUME_SECRET_KEY, using the EVI configuration in HUME_CONFIG_ID and the
+// API at HUME_API_URL (default https://api.hume.ai).
+func DefaultHumeClient() HumeClient {
+	baseURL := os.Getenv("HUME_API_URL")
+	if baseURL == "" {
+		baseURL = "https://api.hume.ai"
+	}
+	return HumeClient{
+		APIKey:    os.Getenv("HUME_API_KEY"),
+		SecretKey: os.Getenv("HUME_SECRET_KEY"),
+		ConfigID:  os.Getenv("HUME_CONFIG_ID"),
+		BaseURL:   strings.TrimRight(baseURL, "/"),
+	}
+}
+
+// HumeToken is an access token for EVI. It is safe to hand to a browser:
+// it expires after about half an hour and can't be used to mint more.
+type HumeToken struct {
+	AccessToken string    `json:"access_token"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	ConfigID    string    `json:"config_id,omitempty"`
+}
+
+var humeHTTPClient = &http.Client{Timeout: 15 * time.Second}
+
+// humeTokens caches the current token per API key, so every chat and token
+// request doesn't mint a new one.
+var humeTokens = struct {
+	sync.Mutex
+	byKey map[string]HumeToken
+}{byKey: map[string]HumeToken{}}
+
+// humeTokenMargin is how long before expiry a cached token is replaced, so
+// a token handed out is good for at least that long.
+const humeTokenMargin = 5 * time.Minute
+
+// AccessToken returns a cached access token, or mints one with the client
+// credentials grant.
+func (c HumeClient) AccessToken(ctx context.Context) (HumeToken, error) {
+	if c.APIKey == "" || c.SecretKey == "" {
+		return HumeToken{}, ErrVoiceNotConfigured
+	}
+	humeTokens.Lock()
+	defer humeTokens.Unlock()
+	if t, ok := humeTokens.byKey[c.APIKey]; ok && time.Until(t.ExpiresAt) > humeTokenMargin {
+		t.ConfigID = c.ConfigID
+		return t, nil
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+"/oauth2-cc/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return HumeToken{}, err
+	}
+	req.SetBasicAuth(c.APIKey, c.SecretKey)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	client := c.Client
+	if client == nil {
+		client = humeHTTPClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return HumeToken{}, fmt.Errorf("requesting voice access token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return HumeToken{}, fmt.Errorf("voice token endpoint returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	var result struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return HumeToken{}, fmt.Errorf("decoding voice access token: %w", err)
+	}
+	if result.AccessToken == "" {
+		return HumeToken{}, errors.New("voice token endpoint returned no access token")
+	}
+	if result.ExpiresIn <= 0 {
+		result.ExpiresIn = 1800
+	}
+	t := HumeToken{AccessToken: result.AccessToken, ExpiresAt: time.Now().Add(time.Duration(result.ExpiresIn) * time.Second)}
+	humeTokens.byKey[c.APIKey] = t
+	t.ConfigID = c.ConfigID
+	return t, nil
+}
+
+// ChatOptions are the EVI chat parameters a client may choose. ConfigID
+// overrides the server's default configuration; ResumedChatGroupID continues
+// an earlier chat with its context.
+type ChatOptions struct {
+	ConfigID           string
+	ResumedChatGroupID string
+}
+
+// DialChat opens an EVI chat WebSocket authenticated with an access token.
+func (c HumeClient) DialChat(ctx context.Context, opts ChatOptions) (*websocket.Conn, error) {
+	token, err := c.AccessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(c.BaseURL + "/v0/evi/chat")
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "http" {
+		u.Scheme = "ws"
+	} else {
+		u.Scheme = "wss"
+	}
+	q := url.Values{"access_token": {token.AccessToken}}
+	configID := opts.ConfigID
+	if configID == "" {
+		configID = c.ConfigID
+	}
+	if configID != "" {
+		q.Set("config_id", configID)
+	}
+	if opts.ResumedChatGroupID != "" {
+		q.Set("resumed_chat_group_id", opts.ResumedChatGroupID)
+	}
+	u.RawQuery = q.Encode()
+
+	dialer := websocket.Dialer{HandshakeTimeout: 15 * time.Second, Proxy: http.ProxyFromEnvironment}
+	conn, resp, err := dialer.DialContext(ctx, u.String(), nil)
+	if err != nil {
+		if resp != nil {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+			resp.Body.Close()
+			return nil, fmt.Errorf("voice chat handshake returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+		}
+		return nil, fmt.Errorf("connecting to voice chat: %w", err)
+	}
+	return conn, nil
+}
@@ -0,0 +1,459 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"mindful/backend-go/models"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// iCalendar (RFC 5545) feed and import.
+
+const (
+	icsDateTime = "20060102T150405Z"
+	icsDate     = "20060102"
+	icsUIDHost  = "mindful"
+)
+
+// icsWriter writes content lines with CRLF endings, folded at 75 octets.
+type icsWriter struct {
+	b strings.Builder
+}
+
+func (w *icsWriter) line(name, value string) {
+	s := name + ":" + value
+	// Continuation lines start with a space, which counts towards the 75.
+	limit := 75
+	for len(s) > limit {
+		cut := limit
+		for !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		w.b.WriteString(s[:cut] + "\r\n ")
+		s = s[cut:]
+		limit = 74
+	}
+	w.b.WriteString(s + "\r\n")
+}
+
+// escapeICSText escapes a TEXT value.
+func escapeICSText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+func icsTime(t time.Time) string {
+	return t.UTC().Format(icsDateTime)
+}
+
+// icsStamp converts a stored timestamp to iCalendar form, or "" if it can't
+// be parsed.
+func icsStamp(s string) string {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return ""
+	}
+	return icsTime(t)
+}
+
+// habitRRule returns the RRULE for a habit's schedule. Rules are stored in
+// a subset of RFC 5545; UNTIL is trimmed to a date to match the all-day
+// DTSTART.
+func habitRRule(h models.Habit) string {
+	if h.RRule == "" {
+		if len(h.DaysOfWeek) == 0 {
+			return "FREQ=DAILY"
+		}
+		days := make([]string, len(h.DaysOfWeek))
+		for i, d := range h.DaysOfWeek {
+			days[i] = strings.ToUpper(d[:2])
+		}
+		return "FREQ=WEEKLY;BYDAY=" + strings.Join(days, ",")
+	}
+	parts := strings.Split(strings.TrimPrefix(strings.ToUpper(h.RRule), "RRULE:"), ";")
+	for i, p := range parts {
+		if strings.HasPrefix(p, "UNTIL=") && len(p) > len("UNTIL=")+8 {
+			parts[i] = p[:len("UNTIL=")+8]
+		}
+	}
+	return strings.Join(parts, ";")
+}
+
+// BuildCalendar renders scheduled game plan tasks and planned sessions as
+// events, unscheduled tasks as to-dos, and habits as recurring all-day
+// events. Habits are marked transparent so they don't show the user as busy.
+func BuildCalendar(now time.Time) (string, error) {
+	tasks, err := models.GetAllGamePlanTasks()
+	if err != nil {
+		return "", err
+	}
+	habits, err := models.GetAllHabits()
+	if err != nil {
+		return "", err
+	}
+	sessions, err := models.ListPlannedSessions(false)
+	if err != nil {
+		return "", err
+	}
+
+	w := &icsWriter{}
+	stamp := icsTime(now)
+	w.line("BEGIN", "VCALENDAR")
+	w.line("VERSION", "2.0")
+	w.line("PRODID", "-//Mindful//Mindful Backend//EN")
+	w.line("CALSCALE", "GREGORIAN")
+	w.line("METHOD", "PUBLISH")
+	w.line("X-WR-CALNAME", "Mindful")
+
+	for _, t := range tasks {
+		completed := t.Status == models.TaskStatusCompleted
+		if due, err := models.ParseTimestamp(t.DueAt); err == nil && t.DueAt != "" {
+			duration := t.Duration
+			if duration == 0 {
+				duration = models.DefaultTaskDuration
+			}
+			w.line("BEGIN", "VEVENT")
+			w.line("UID", fmt.Sprintf("task-%d@%s", t.ID, icsUIDHost))
+			w.line("DTSTAMP", stamp)
+			w.line("DTSTART", icsTime(due))
+			w.line("DTEND", icsTime(due.Add(time.Duration(duration)*time.Minute)))
+			w.line("SUMMARY", escapeICSText(t.Description))
+			description := "Game plan task"
+			if completed {
+				description += " (completed)"
+			}
+			w.line("DESCRIPTION", escapeICSText(description))
+			w.line("CATEGORIES", "Game plan")
+			w.line("END", "VEVENT")
+			continue
+		}
+		w.line("BEGIN", "VTODO")
+		w.line("UID", fmt.Sprintf("task-%d@%s", t.ID, icsUIDHost))
+		w.line("DTSTAMP", stamp)
+		if created := icsStamp(t.CreatedAt); created != "" {
+			w.line("CREATED", created)
+		}
+		w.line("SUMMARY", escapeICSText(t.Description))
+		w.line("CATEGORIES", "Game plan")
+		if completed {
+			w.line("STATUS", "COMPLETED")
+			if done := icsStamp(t.CompletedAt); done != "" {
+				w.line("COMPLETED", done)
+			}
+		} else {
+			w.line("STATUS", "NEEDS-ACTION")
+		}
+		w.line("END", "VTODO")
+	}
+
+	for _, h := range habits {
+		start, err := models.ParseDate(h.StartDate)
+		if err != nil {
+			continue
+		}
+		w.line("BEGIN", "VEVENT")
+		w.line("UID", fmt.Sprintf("habit-%d@%s", h.ID, icsUIDHost))
+		w.line("DTSTAMP", stamp)
+		w.line("DTSTART;VALUE=DATE", start.Format(icsDate))
+		w.line("RRULE", habitRRule(h))
+		w.line("SUMMARY", escapeICSText(h.Name))
+		if h.TargetCount > 1 {
+			w.line("DESCRIPTION", escapeICSText(fmt.Sprintf("Habit, %d times", h.TargetCount)))
+		} else {
+			w.line("DESCRIPTION", "Habit")
+		}
+		w.line("TRANSP", "TRANSPARENT")
+		w.line("CATEGORIES", "Habit")
+		w.line("END", "VEVENT")
+	}
+
+	for _, s := range sessions {
+		start, err1 := models.ParseTimestamp(s.StartsAt)
+		end, err2 := models.ParseTimestamp(s.EndsAt)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		w.line("BEGIN", "VEVENT")
+		w.line("UID", fmt.Sprintf("session-%d@%s", s.ID, icsUIDHost))
+		w.line("DTSTAMP", stamp)
+		w.line("DTSTART", icsTime(start))
+		w.line("DTEND", icsTime(end))
+		w.line("SUMMARY", escapeICSText(s.Title))
+		if s.Location != "" {
+			w.line("LOCATION", escapeICSText(s.Location))
+		}
+		if s.Notes != "" {
+			w.line("DESCRIPTION", escapeICSText(s.Notes))
+		}
+		w.line("CATEGORIES", "Session")
+		w.line("END", "VEVENT")
+	}
+
+	w.line("END", "VCALENDAR")
+	return w.b.String(), nil
+}
+
+// icsProperty is one unfolded content line.
+type icsProperty struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// parseICSLine splits "NAME;PARAM=x:value", allowing quoted parameter values
+// that contain colons.
+func parseICSLine(line string) (icsProperty, bool) {
+	quoted := false
+	colon := -1
+	for i, c := range line {
+		if c == '"' {
+			quoted = !quoted
+		} else if c == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return icsProperty{}, false
+	}
+	head := strings.Split(line[:colon], ";")
+	p := icsProperty{name: strings.ToUpper(head[0]), params: map[string]string{}, value: line[colon+1:]}
+	for _, param := range head[1:] {
+		k, v, _ := strings.Cut(param, "=")
+		p.params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+	}
+	return p, true
+}
+
+func unescapeICSText(s string) string {
+	return strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(s)
+}
+
+// parseICSTime parses a DATE or DATE-TIME value. Floating times and unknown
+// TZIDs are read in loc.
+func parseICSTime(p icsProperty, loc *time.Location) (t time.Time, allDay bool, err error) {
+	value := strings.TrimSpace(p.value)
+	if p.params["VALUE"] == "DATE" || len(value) == len(icsDate) {
+		t, err = time.ParseInLocation(icsDate, value, loc)
+		return t, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err = time.Parse(icsDateTime, value)
+		return t, false, err
+	}
+	if tzid := p.params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			loc = l
+		}
+	}
+	t, err = time.ParseInLocation("20060102T150405", value, loc)
+	return t, false, err
+}
+
+var icsDurationPattern = regexp.MustCompile(`^([+-])?P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+func parseICSDuration(s string) (time.Duration, error) {
+	m := icsDurationPattern.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	units := []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second}
+	var d time.Duration
+	for i, unit := range units {
+		if m[i+2] != "" {
+			n, _ := strconv.Atoi(m[i+2])
+			d += time.Duration(n) * unit
+		}
+	}
+	if m[1] == "-" {
+		d = -d
+	}
+	return d, nil
+}
+
+// icsEvent is a VEVENT as far as busy times are concerned.
+type icsEvent struct {
+	uid, summary, rrule string
+	start, end          time.Time
+	allDay              bool
+	duration            time.Duration
+	hasEnd, hasDuration bool
+	free                bool
+	recurrenceID        time.Time
+	exdates             []time.Time
+}
+
+// ICSImportReport says what an import did with the events it found.
+type ICSImportReport struct {
+	Events int `json:"events"`
+	Blocks int `json:"blocks"`
+	// Skipped counts free, cancelled or malformed events.
+	Skipped int `json:"skipped"`
+	// Unsupported counts recurring events whose rule is outside the supported
+	// subset; only their first occurrence is imported.
+	Unsupported int `json:"unsupported_recurrences"`
+}
+
+var ErrInvalidICS = errors.New("invalid iCalendar data")
+
+// ParseBusyBlocks reads the VEVENTs of an iCalendar file as busy blocks
+// overlapping [from, to). Transparent and cancelled events are skipped,
+// recurring events are expanded, and modified instances (RECURRENCE-ID)
+// replace the occurrence they override. Floating times are read in loc.
+func ParseBusyBlocks(data string, loc *time.Location, from, to time.Time) ([]models.BusyBlock, ICSImportReport, error) {
+	var report ICSImportReport
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	data = strings.NewReplacer("\n ", "", "\n\t", "").Replace(data)
+	if !strings.Contains(strings.ToUpper(data), "BEGIN:VCALENDAR") {
+		return nil, report, fmt.Errorf("%w: missing BEGIN:VCALENDAR", ErrInvalidICS)
+	}
+
+	var events []icsEvent
+	var cur *icsEvent
+	nested := 0
+	bad := false
+	for _, raw := range strings.Split(data, "\n") {
+		p, ok := parseICSLine(strings.TrimRight(raw, "\r"))
+		if !ok {
+			continue
+		}
+		value := strings.ToUpper(strings.TrimSpace(p.value))
+		switch {
+		case p.name == "BEGIN" && value == "VEVENT":
+			cur, bad, nested = &icsEvent{}, false, 0
+			continue
+		case cur == nil:
+			continue
+		case p.name == "BEGIN":
+			nested++
+			continue
+		case p.name == "END" && value == "VEVENT":
+			report.Events++
+			if bad || cur.start.IsZero() || cur.free {
+				report.Skipped++
+			} else {
+				events = append(events, *cur)
+			}
+			cur = nil
+			continue
+		case p.name == "END":
+			nested--
+			continue
+		case nested > 0:
+			continue
+		}
+
+		var err error
+		switch p.name {
+		case "UID":
+			cur.uid = strings.TrimSpace(p.value)
+		case "SUMMARY":
+			cur.summary = unescapeICSText(p.value)
+		case "DTSTART":
+			cur.start, cur.allDay, err = parseICSTime(p, loc)
+		case "DTEND":
+			cur.end, _, err = parseICSTime(p, loc)
+			cur.hasEnd = true
+		case "DURATION":
+			cur.duration, err = parseICSDuration(p.value)
+			cur.hasDuration = true
+		case "TRANSP":
+			cur.free = cur.free || value == "TRANSPARENT"
+		case "STATUS":
+			cur.free = cur.free || value == "CANCELLED"
+		case "RRULE":
+			cur.rrule = strings.TrimSpace(p.value)
+		case "RECURRENCE-ID":
+			cur.recurrenceID, _, err = parseICSTime(p, loc)
+		case "EXDATE":
+			for _, v := range strings.Split(p.value, ",") {
+				p.value = v
+				t, _, perr := parseICSTime(p, loc)
+				if perr == nil {
+					cur.exdates = append(cur.exdates, t)
+				}
+			}
+		}
+		if err != nil {
+			bad = true
+		}
+	}
+
+	// Instances moved by a RECURRENCE-ID override are dropped from the
+	// master event's expansion.
+	overridden := map[string][]time.Time{}
+	for _, e := range events {
+		if !e.recurrenceID.IsZero() {
+			overridden[e.uid] = append(overridden[e.uid], e.recurrenceID)
+		}
+	}
+
+	var blocks []models.BusyBlock
+	for _, e := range events {
+		length := eventLength(e)
+		if length <= 0 {
+			report.Skipped++
+			continue
+		}
+		starts := []time.Time{e.start}
+		if e.rrule != "" && e.recurrenceID.IsZero() {
+			dates, err := models.RecurrenceDates(e.rrule, e.start, from.In(e.start.Location()).AddDate(0, 0, -1), to.In(e.start.Location()))
+			if err != nil {
+				report.Unsupported++
+			} else {
+				starts = starts[:0]
+				for _, d := range dates {
+					s := time.Date(d.Year(), d.Month(), d.Day(), e.start.Hour(), e.start.Minute(), e.start.Second(), 0, e.start.Location())
+					if !containsTime(e.exdates, s) && !containsTime(overridden[e.uid], s) {
+						starts = append(starts, s)
+					}
+				}
+			}
+		}
+		for _, s := range starts {
+			end := s.Add(length)
+			if e.allDay {
+				// Keep all-day events aligned to local midnights across DST.
+				end = s.AddDate(0, 0, int(math.Round(length.Hours()/24)))
+			}
+			if !end.After(from) || !s.Before(to) {
+				continue
+			}
+			blocks = append(blocks, models.BusyBlock{
+				UID:      e.uid,
+				Summary:  e.summary,
+				StartsAt: s.UTC().Format(models.TimestampLayout),
+				EndsAt:   end.UTC().Format(models.TimestampLayout),
+			})
+		}
+	}
+	report.Blocks = len(blocks)
+	return blocks, report, nil
+}
+
+// eventLength returns how long each occurrence of an event lasts. All-day
+// events without an end last one day; timed events without one take no time.
+func eventLength(e icsEvent) time.Duration {
+	switch {
+	case e.hasEnd:
+		return e.end.Sub(e.start)
+	case e.hasDuration:
+		return e.duration
+	case e.allDay:
+		return 24 * time.Hour
+	}
+	return 0
+}
+
+func containsTime(times []time.Time, t time.Time) bool {
+	for _, x := range times {
+		if x.Equal(t) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,272 @@
+package utils
+
+import (
+	"errors"
+	"mindful/backend-go/models"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestICSLineFolding(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		lines int
+	}{
+		{"short", "Hello", 1},
+		{"exactly 75 octets", strings.Repeat("a", 75-len("SUMMARY:")), 1},
+		{"one octet over", strings.Repeat("a", 76-len("SUMMARY:")), 2},
+		{"long", strings.Repeat("abcdefghij", 20), 3},
+		{"multi-byte", strings.Repeat("é", 100), 3},
+		{"multi-byte at the fold", "a" + strings.Repeat("日", 60), 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &icsWriter{}
+			w.line("SUMMARY", tt.value)
+			out := w.b.String()
+			if !strings.HasSuffix(out, "\r\n") {
+				t.Fatalf("%q does not end with CRLF", out)
+			}
+			lines := strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n")
+			if len(lines) != tt.lines {
+				t.Errorf("got %d lines, want %d: %q", len(lines), tt.lines, lines)
+			}
+			for i, line := range lines {
+				if len(line) > 75 {
+					t.Errorf("line %d is %d octets: %q", i, len(line), line)
+				}
+				if i > 0 && !strings.HasPrefix(line, " ") {
+					t.Errorf("continuation line %d doesn't start with a space: %q", i, line)
+				}
+				if !utf8.ValidString(line) {
+					t.Errorf("line %d splits a character: %q", i, line)
+				}
+			}
+			if got := strings.ReplaceAll(strings.TrimSuffix(out, "\r\n"), "\r\n ", ""); got != "SUMMARY:"+tt.value {
+				t.Errorf("unfolded to %q", got)
+			}
+		})
+	}
+}
+
+func TestEscapeICSText(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"plain", "plain"},
+		{"Call Sam, then rest; early night", `Call Sam\, then rest\; early night`},
+		{`C:\new folder`, `C:\\new folder`},
+		{"line one\nline two\r\nline three", `line one\nline two\nline three`},
+	}
+	for _, tt := range tests {
+		if got := escapeICSText(tt.in); got != tt.want {
+			t.Errorf("escapeICSText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+	for _, s := range []string{"a,b;c", `C:\new\nfolder`, "one\ntwo", `trailing\`} {
+		if got := unescapeICSText(escapeICSText(s)); got != s {
+			t.Errorf("unescapeICSText(escapeICSText(%q)) = %q", s, got)
+		}
+	}
+	if got := unescapeICSText(`one\Ntwo`); got != "one\ntwo" {
+		t.Errorf(`unescapeICSText("one\\Ntwo") = %q`, got)
+	}
+}
+
+func TestParseICSTime(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	tests := []struct {
+		line   string
+		want   string
+		allDay bool
+	}{
+		{"DTSTART;VALUE=DATE:20240329", "2024-03-29T04:00:00Z", true},
+		{"DTSTART:20240329", "2024-03-29T04:00:00Z", true},
+		{"DTSTART:20240329T120000Z", "2024-03-29T12:00:00Z", false},
+		{"DTSTART:20240329T120000", "2024-03-29T16:00:00Z", false},
+		// Berlin moves to summer time on 31 March.
+		{"DTSTART;TZID=Europe/Berlin:20240330T120000", "2024-03-30T11:00:00Z", false},
+		{"DTSTART;TZID=Europe/Berlin:20240331T120000", "2024-03-31T10:00:00Z", false},
+		{`DTSTART;TZID="Europe/Berlin":20240331T120000`, "2024-03-31T10:00:00Z", false},
+		{"DTSTART;TZID=Mars/Olympus_Mons:20240329T120000", "2024-03-29T16:00:00Z", false},
+	}
+	for _, tt := range tests {
+		p, ok := parseICSLine(tt.line)
+		if !ok {
+			t.Fatalf("parseICSLine(%q) failed", tt.line)
+		}
+		got, allDay, err := parseICSTime(p, newYork)
+		if err != nil {
+			t.Errorf("%s: %v", tt.line, err)
+			continue
+		}
+		if s := got.UTC().Format(time.RFC3339); s != tt.want || allDay != tt.allDay {
+			t.Errorf("%s = %s, all day %v, want %s, all day %v", tt.line, s, allDay, tt.want, tt.allDay)
+		}
+	}
+	p, _ := parseICSLine("DTSTART:2024-03-29 12:00")
+	if _, _, err := parseICSTime(p, newYork); err == nil {
+		t.Error("parseICSTime accepted a malformed time")
+	}
+}
+
+func TestParseBusyBlocks(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	data := strings.ReplaceAll(`BEGIN:VCALENDAR
+VERSION:2.0
+BEGIN:VEVENT
+UID:standup
+SUMMARY:Team stand
+ up\, twice a week
+DTSTART;TZID=Europe/Berlin:20240325T090000
+DTEND;TZID=Europe/Berlin:20240325T093000
+RRULE:FREQ=WEEKLY;BYDAY=MO,WE
+EXDATE;TZID=Europe/Berlin:20240327T090000
+BEGIN:VALARM
+TRIGGER:-PT5M
+DTSTART:20200101T000000Z
+END:VALARM
+END:VEVENT
+BEGIN:VEVENT
+UID:standup
+SUMMARY:Moved standup
+RECURRENCE-ID;TZID=Europe/Berlin:20240401T090000
+DTSTART;TZID=Europe/Berlin:20240401T110000
+DTEND;TZID=Europe/Berlin:20240401T113000
+END:VEVENT
+BEGIN:VEVENT
+UID:lunch
+DTSTART:20240326T120000Z
+DURATION:PT1H
+TRANSP:TRANSPARENT
+END:VEVENT
+BEGIN:VEVENT
+UID:cancelled
+DTSTART:20240326T150000Z
+DURATION:PT1H
+STATUS:CANCELLED
+END:VEVENT
+BEGIN:VEVENT
+UID:holiday
+SUMMARY:Holiday
+DTSTART;VALUE=DATE:20240329
+END:VEVENT
+BEGIN:VEVENT
+UID:birthday
+SUMMARY:Birthday
+DTSTART:20240402T180000Z
+DURATION:PT2H
+RRULE:FREQ=YEARLY
+END:VEVENT
+BEGIN:VEVENT
+UID:old
+DTSTART:20240301T090000Z
+DURATION:PT1H
+END:VEVENT
+END:VCALENDAR
+`, "\n", "\r\n")
+
+	from := time.Date(2024, 3, 25, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 4, 5, 0, 0, 0, 0, time.UTC)
+	blocks, report, err := ParseBusyBlocks(data, newYork, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []models.BusyBlock{
+		// Berlin is on winter time before 31 March and summer time after.
+		{UID: "standup", Summary: "Team standup, twice a week", StartsAt: "2024-03-25T08:00:00Z", EndsAt: "2024-03-25T08:30:00Z"},
+		{UID: "standup", Summary: "Team standup, twice a week", StartsAt: "2024-04-03T07:00:00Z", EndsAt: "2024-04-03T07:30:00Z"},
+		{UID: "standup", Summary: "Moved standup", StartsAt: "2024-04-01T09:00:00Z", EndsAt: "2024-04-01T09:30:00Z"},
+		{UID: "holiday", Summary: "Holiday", StartsAt: "2024-03-29T04:00:00Z", EndsAt: "2024-03-30T04:00:00Z"},
+		{UID: "birthday", Summary: "Birthday", StartsAt: "2024-04-02T18:00:00Z", EndsAt: "2024-04-02T20:00:00Z"},
+	}
+	if len(blocks) != len(want) {
+		t.Fatalf("got %d blocks, want %d: %+v", len(blocks), len(want), blocks)
+	}
+	for i := range want {
+		if blocks[i] != want[i] {
+			t.Errorf("block %d = %+v, want %+v", i, blocks[i], want[i])
+		}
+	}
+	wantReport := ICSImportReport{Events: 7, Blocks: 5, Skipped: 2, Unsupported: 1}
+	if report != wantReport {
+		t.Errorf("report = %+v, want %+v", report, wantReport)
+	}
+}
+
+func TestParseBusyBlocksExpandsAllDayRecurrencesAcrossDaylightSaving(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+	data := "BEGIN:VCALENDAR\nBEGIN:VEVENT\nUID:rest\nDTSTART;VALUE=DATE:20240330\nDTEND;VALUE=DATE:20240331\nRRULE:FREQ=DAILY;INTERVAL=2\nEND:VEVENT\nEND:VCALENDAR\n"
+	from := time.Date(2024, 3, 29, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 4, 4, 0, 0, 0, 0, time.UTC)
+	blocks, _, err := ParseBusyBlocks(data, berlin, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, b := range blocks {
+		got = append(got, b.StartsAt+"/"+b.EndsAt)
+	}
+	want := []string{
+		"2024-03-29T23:00:00Z/2024-03-30T23:00:00Z",
+		"2024-03-31T22:00:00Z/2024-04-01T22:00:00Z",
+		"2024-04-02T22:00:00Z/2024-04-03T22:00:00Z",
+	}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("blocks = %q, want %q", got, want)
+	}
+}
+
+func TestParseBusyBlocksRejectsNonCalendar(t *testing.T) {
+	_, _, err := ParseBusyBlocks("BEGIN:VCARD\nEND:VCARD\n", time.UTC, time.Time{}, time.Now())
+	if !errors.Is(err, ErrInvalidICS) {
+		t.Errorf("err = %v, want ErrInvalidICS", err)
+	}
+}
+
+func TestBuildCalendarFoldsAndEscapes(t *testing.T) {
+	openTestDB(t)
+	description := "Write down three things that went well today, then read; no screens after ten"
+	planID, err := models.StoreGamePlan([]models.PlannedTask{{Description: description}}, "Evening", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := models.GetLatestGamePlan()
+	if err != nil || plan.ID != planID {
+		t.Fatal(err)
+	}
+	if _, err := models.SetGamePlanTaskDue(planID, plan.TaskItems[0].ID, "2024-03-29T20:00:00+01:00", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	feed, err := BuildCalendar(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(feed, "\r\n"), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("line is %d octets: %q", len(line), line)
+		}
+	}
+	unfolded := strings.ReplaceAll(feed, "\r\n ", "")
+	for _, want := range []string{
+		"SUMMARY:" + escapeICSText(description) + "\r\n",
+		"DTSTART:20240329T190000Z\r\n",
+		"DTEND:20240329T193000Z\r\n",
+	} {
+		if !strings.Contains(unfolded, want) {
+			t.Errorf("feed is missing %q:\n%s", want, unfolded)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"context"
+	"log"
+	"mindful/backend-go/models"
+	"strings"
+)
+
+// AnalyzeJournalAsync runs emotion analysis, tag suggestion, distortion
+// detection and embedding for a new or edited journal entry in the background
+// and stores the results.
+func AnalyzeJournalAsync(id int, content string) {
+	EmbedRecordAsync(models.SearchKindJournal, id, content)
+	FlagJournalSafety(id, content)
+	go func() {
+		emotion, err := AnalyzeEmotion(content)
+		if err != nil {
+			log.Printf("Error analyzing emotion for journal %d: %v", id, err)
+			return
+		}
+		emotion = strings.ToLower(strings.TrimSpace(emotion))
+		if err := models.SetJournalEmotionalState(id, content, emotion); err != nil {
+			log.Printf("Error storing emotional state for journal %d: %v", id, err)
+		}
+	}()
+	go func() {
+		if err := AnalyzeJournalDistortions(context.Background(), id, content); err != nil {
+			log.Printf("Error analyzing distortions for journal %d: %v", id, err)
+		}
+	}()
+	go func() {
+		if err := suggestJournalTags(id, content); err != nil {
+			log.Printf("Error suggesting tags for journal %d: %v", id, err)
+		}
+	}()
+}
@@ -0,0 +1,144 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"mindful/backend-go/models"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// NotificationSink delivers notifications through one channel. Sinks are
+// looked up by the channel names reminders list, such as "inapp".
+type NotificationSink interface {
+	Send(ctx context.Context, n models.Notification) error
+}
+
+// InboxSink stores notifications in the in-app inbox served at
+// /notifications.
+type InboxSink struct{}
+
+func (InboxSink) Send(ctx context.Context, n models.Notification) error {
+	_, err := models.StoreNotification(n)
+	return err
+}
+
+// WebhookSink POSTs each notification as JSON to URL and expects a 2xx
+// response.
+type WebhookSink struct {
+	URL    string
+	Client *http.Client
+}
+
+func (s WebhookSink) Send(ctx context.Context, n models.Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// SMTPSink emails each notification as plain text. Auth is used only when a
+// username is set; net/smtp refuses plain auth over unencrypted connections
+// except to localhost.
+type SMTPSink struct {
+	Addr     string
+	From     string
+	To       string
+	Username string
+	Password string
+}
+
+// headerValue strips line breaks so user text cannot add mail headers.
+func headerValue(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
+
+func (s SMTPSink) Send(ctx context.Context, n models.Notification) error {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", headerValue(s.From))
+	fmt.Fprintf(&msg, "To: %s\r\n", headerValue(s.To))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", headerValue(n.Title)))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	body := n.Body
+	if body == "" {
+		body = n.Title
+	}
+	msg.WriteString(strings.NewReplacer("\r\n", "\r\n", "\r", "\r\n", "\n", "\r\n").Replace(body) + "\r\n")
+
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, _ := strings.Cut(s.Addr, ":")
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+	return smtp.SendMail(s.Addr, auth, s.From, []string{s.To}, msg.Bytes())
+}
+
+// NotificationSinksFromEnv returns the configured sinks by channel. The
+// in-app inbox is always available; the webhook needs NOTIFY_WEBHOOK_URL and
+// email needs SMTP_ADDR, SMTP_FROM and SMTP_TO (SMTP_USERNAME and
+// SMTP_PASSWORD are optional).
+func NotificationSinksFromEnv() map[string]NotificationSink {
+	sinks := map[string]NotificationSink{models.ChannelInApp: InboxSink{}}
+	if url := os.Getenv("NOTIFY_WEBHOOK_URL"); url != "" {
+		sinks[models.ChannelWebhook] = WebhookSink{URL: url}
+	}
+	if addr := os.Getenv("SMTP_ADDR"); addr != "" {
+		sinks[models.ChannelEmail] = SMTPSink{
+			Addr:     addr,
+			From:     os.Getenv("SMTP_FROM"),
+			To:       os.Getenv("SMTP_TO"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+		}
+	}
+	return sinks
+}
+
+// Notify sends a notification through each of the given channels. A failing
+// or unconfigured channel does not stop the others; their errors are joined.
+func Notify(ctx context.Context, sinks map[string]NotificationSink, channels []string, n models.Notification) error {
+	var errs []error
+	for _, channel := range channels {
+		sink, ok := sinks[channel]
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: channel not configured", channel))
+			continue
+		}
+		if err := sink.Send(ctx, n); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", channel, err))
+		}
+	}
+	err := errors.Join(errs...)
+	if err != nil {
+		log.Printf("Error delivering notification %q: %v", n.Title, err)
+	}
+	return err
+}
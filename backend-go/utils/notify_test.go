@@ -0,0 +1,166 @@
+package utils
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"mindful/backend-go/models"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSMTP accepts mail on a local port and passes each message's data, with
+// the terminating dot removed, to the returned channel.
+func fakeSMTP(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	messages := make(chan string, 4)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, messages)
+		}
+	}()
+	return ln.Addr().String(), messages
+}
+
+func serveSMTP(conn net.Conn, messages chan<- string) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	fmt.Fprint(conn, "220 localhost ESMTP\r\n")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			fmt.Fprint(conn, "250 localhost\r\n")
+		case cmd == "DATA":
+			fmt.Fprint(conn, "354 End data with <CR><LF>.<CR><LF>\r\n")
+			var data strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+			messages <- data.String()
+			fmt.Fprint(conn, "250 OK\r\n")
+		case cmd == "QUIT":
+			fmt.Fprint(conn, "221 Bye\r\n")
+			return
+		default:
+			fmt.Fprint(conn, "250 OK\r\n")
+		}
+	}
+}
+
+func receive(t *testing.T, messages <-chan string) string {
+	t.Helper()
+	select {
+	case msg := <-messages:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("no mail received")
+		return ""
+	}
+}
+
+// splitMail splits a message into its header lines and its body.
+func splitMail(t *testing.T, msg string) ([]string, string) {
+	t.Helper()
+	header, body, ok := strings.Cut(msg, "\r\n\r\n")
+	if !ok {
+		t.Fatalf("message has no header/body separator: %q", msg)
+	}
+	return strings.Split(header, "\r\n"), body
+}
+
+func TestSMTPSinkSend(t *testing.T) {
+	addr, messages := fakeSMTP(t)
+	sink := SMTPSink{Addr: addr, From: "mindful@example.com", To: "user@example.com"}
+
+	n := models.Notification{Title: "Evening walk", Body: "Time for a walk.\nEnjoy it."}
+	if err := sink.Send(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+	header, body := splitMail(t, receive(t, messages))
+
+	for _, want := range []string{
+		"From: mindful@example.com",
+		"To: user@example.com",
+		"Subject: Evening walk",
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=utf-8",
+	} {
+		if !containsLine(header, want) {
+			t.Errorf("header %q missing from %q", want, header)
+		}
+	}
+	if want := "Time for a walk.\r\nEnjoy it.\r\n"; body != want {
+		t.Errorf("body = %q, want %q", body, want)
+	}
+}
+
+func TestSMTPSinkStripsHeaderInjection(t *testing.T) {
+	addr, messages := fakeSMTP(t)
+	sink := SMTPSink{Addr: addr, From: "mindful@example.com", To: "user@example.com"}
+
+	n := models.Notification{Title: "Hello\r\nBcc: victim@example.com\nX-Injected: yes"}
+	if err := sink.Send(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+	header, body := splitMail(t, receive(t, messages))
+
+	for _, line := range header {
+		if strings.HasPrefix(line, "Bcc:") || strings.HasPrefix(line, "X-Injected:") {
+			t.Errorf("injected header line %q", line)
+		}
+	}
+	if !containsLine(header, "Subject: Hello  Bcc: victim@example.com X-Injected: yes") {
+		t.Errorf("subject not kept on one line: %q", header)
+	}
+	// Without a body the title is sent as the body, where line breaks are
+	// harmless.
+	if want := "Hello\r\nBcc: victim@example.com\r\nX-Injected: yes\r\n"; body != want {
+		t.Errorf("body = %q, want %q", body, want)
+	}
+}
+
+func TestSMTPSinkEncodesSubject(t *testing.T) {
+	addr, messages := fakeSMTP(t)
+	sink := SMTPSink{Addr: addr, From: "mindful@example.com", To: "user@example.com"}
+
+	if err := sink.Send(context.Background(), models.Notification{Title: "Café break", Body: "Rest."}); err != nil {
+		t.Fatal(err)
+	}
+	header, _ := splitMail(t, receive(t, messages))
+	if !containsLine(header, "Subject: =?utf-8?q?Caf=C3=A9_break?=") {
+		t.Errorf("subject not Q-encoded: %q", header)
+	}
+}
+
+func containsLine(lines []string, want string) bool {
+	for _, l := range lines {
+		if l == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,348 @@
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"mindful/backend-go/models"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// promptFiles holds the built-in prompt library, one JSON file per category.
+//
+//go:embed prompts/*.json
+var promptFiles embed.FS
+
+const (
+	PromptSourceLibrary   = "library"
+	PromptSourceGenerated = "generated"
+)
+
+// JournalPrompt is a question offered to the user to start a journal entry.
+// TimesOfDay limits when a library prompt fits; empty means any time.
+type JournalPrompt struct {
+	ID         string   `json:"id"`
+	Category   string   `json:"category"`
+	Text       string   `json:"text"`
+	TimesOfDay []string `json:"times_of_day,omitempty"`
+	Source     string   `json:"source"`
+}
+
+// PromptSelection is a prompt chosen for the user with the signals that led
+// to it.
+type PromptSelection struct {
+	Prompt    JournalPrompt `json:"prompt"`
+	Emotion   string        `json:"emotion,omitempty"`
+	TimeOfDay string        `json:"time_of_day"`
+	Answered  bool          `json:"previously_answered"`
+}
+
+// PromptOptions controls NextPrompt. Category, if set, restricts the choice
+// to one category; Personalized asks the model to write a new prompt.
+type PromptOptions struct {
+	Now          time.Time
+	Category     string
+	Personalized bool
+}
+
+// AnsweredPrompt is a prompt together with the journal entry answering it.
+type AnsweredPrompt struct {
+	Prompt     JournalPrompt `json:"prompt"`
+	JournalID  int           `json:"journal_id"`
+	AnsweredAt string        `json:"answered_at"`
+	Link       string        `json:"link"`
+}
+
+var ErrUnknownPrompt = errors.New("unknown journal prompt")
+
+// promptLibrary is loaded once from the embedded data files.
+var promptLibrary = loadPromptLibrary()
+
+func loadPromptLibrary() []JournalPrompt {
+	files, err := promptFiles.ReadDir("prompts")
+	if err != nil {
+		log.Fatalf("could not read prompt library: %v", err)
+	}
+
+	var prompts []JournalPrompt
+	for _, f := range files {
+		data, err := promptFiles.ReadFile(path.Join("prompts", f.Name()))
+		if err != nil {
+			log.Fatalf("could not read prompt file %s: %v", f.Name(), err)
+		}
+		var file struct {
+			Category string          `json:"category"`
+			Prompts  []JournalPrompt `json:"prompts"`
+		}
+		if err := json.Unmarshal(data, &file); err != nil {
+			log.Fatalf("could not parse prompt file %s: %v", f.Name(), err)
+		}
+		for _, p := range file.Prompts {
+			p.Category = file.Category
+			p.Source = PromptSourceLibrary
+			prompts = append(prompts, p)
+		}
+	}
+	return prompts
+}
+
+// PromptLibrary returns the built-in prompts, optionally of one category.
+func PromptLibrary(category string) []JournalPrompt {
+	prompts := []JournalPrompt{}
+	for _, p := range promptLibrary {
+		if category == "" || p.Category == category {
+			prompts = append(prompts, p)
+		}
+	}
+	return prompts
+}
+
+// PromptCategories returns the categories in the library, sorted.
+func PromptCategories() []string {
+	seen := map[string]bool{}
+	var categories []string
+	for _, p := range promptLibrary {
+		if !seen[p.Category] {
+			seen[p.Category] = true
+			categories = append(categories, p.Category)
+		}
+	}
+	sort.Strings(categories)
+	return categories
+}
+
+// LookupPrompt finds a library or previously generated prompt by ID.
+func LookupPrompt(id string) (JournalPrompt, error) {
+	for _, p := range promptLibrary {
+		if p.ID == id {
+			return p, nil
+		}
+	}
+	g, err := models.GetGeneratedPrompt(id)
+	if errors.Is(err, models.ErrNotFound) {
+		return JournalPrompt{}, ErrUnknownPrompt
+	}
+	if err != nil {
+		return JournalPrompt{}, err
+	}
+	return JournalPrompt{ID: g.ID, Category: g.Category, Text: g.Text, Source: PromptSourceGenerated}, nil
+}
+
+// TimeOfDay buckets a time into morning, afternoon, evening or night.
+func TimeOfDay(t time.Time) string {
+	switch h := t.Hour(); {
+	case h >= 5 && h < 12:
+		return "morning"
+	case h >= 12 && h < 17:
+		return "afternoon"
+	case h >= 17 && h < 22:
+		return "evening"
+	}
+	return "night"
+}
+
+// emotionCategories maps detected emotions to the prompt categories that
+// suit them, best fit first.
+var emotionCategories = []struct {
+	emotions   []string
+	categories []string
+}{
+	{[]string{"anxious", "nervous", "worried", "fearful", "scared", "stressed", "overwhelmed"}, []string{"anxiety", "cbt"}},
+	{[]string{"sad", "down", "depressed", "angry", "frustrated", "guilty", "ashamed", "hopeless", "lonely"}, []string{"cbt", "reflection"}},
+	{[]string{"happy", "joyful", "grateful", "content", "calm", "hopeful", "excited"}, []string{"gratitude", "reflection"}},
+}
+
+func categoriesForEmotion(emotion string) []string {
+	for _, group := range emotionCategories {
+		if containsWord(emotion, group.emotions) {
+			return group.categories
+		}
+	}
+	return []string{"reflection", "gratitude"}
+}
+
+// recentEmotion returns the most common emotional state among the latest
+// journal entries, preferring the newest on ties.
+func recentEmotion() (string, error) {
+	states, err := models.GetRecentEmotionalStates(3)
+	if err != nil {
+		return "", err
+	}
+	best, bestCount := "", 0
+	for _, s := range states {
+		count := 0
+		for _, other := range states {
+			if other == s {
+				count++
+			}
+		}
+		if count > bestCount {
+			best, bestCount = s, count
+		}
+	}
+	return best, nil
+}
+
+// scorePrompt rates how well a prompt fits the user's emotion categories and
+// the time of day.
+func scorePrompt(p JournalPrompt, categories []string, timeOfDay string) int {
+	score := 0
+	for i, c := range categories {
+		if p.Category == c {
+			score += 2 * (len(categories) - i)
+		}
+	}
+	if len(p.TimesOfDay) == 0 {
+		score++
+	}
+	for _, t := range p.TimesOfDay {
+		if t == timeOfDay {
+			score += 2
+		}
+	}
+	return score
+}
+
+// NextPrompt picks the prompt that best fits the user's recent emotional
+// state and the time of day, skipping prompts that were already answered
+// until every candidate has been. With Personalized set it asks the model
+// for a new prompt and falls back to the library if that fails.
+func NextPrompt(ctx context.Context, opts PromptOptions) (PromptSelection, error) {
+	emotion, err := recentEmotion()
+	if err != nil {
+		return PromptSelection{}, err
+	}
+	sel := PromptSelection{Emotion: emotion, TimeOfDay: TimeOfDay(opts.Now)}
+
+	categories := categoriesForEmotion(emotion)
+	if opts.Category != "" {
+		categories = []string{opts.Category}
+	}
+
+	if opts.Personalized {
+		prompt, err := generatePrompt(ctx, categories[0], emotion, sel.TimeOfDay)
+		if err == nil {
+			sel.Prompt = prompt
+			return sel, nil
+		}
+		log.Printf("Error generating personalized prompt, using library: %v", err)
+	}
+
+	answers, err := models.GetPromptAnswers()
+	if err != nil {
+		return PromptSelection{}, err
+	}
+	// Answers are newest first, so a lower index means answered more recently.
+	lastAnswered := map[string]int{}
+	for i := len(answers) - 1; i >= 0; i-- {
+		lastAnswered[answers[i].PromptID] = i
+	}
+
+	candidates := PromptLibrary(opts.Category)
+	if len(candidates) == 0 {
+		return PromptSelection{}, ErrUnknownPrompt
+	}
+	var unanswered []JournalPrompt
+	for _, p := range candidates {
+		if _, ok := lastAnswered[p.ID]; !ok {
+			unanswered = append(unanswered, p)
+		}
+	}
+
+	if len(unanswered) == 0 {
+		// Everything has been answered: repeat the one answered longest ago.
+		sort.SliceStable(candidates, func(i, j int) bool { return lastAnswered[candidates[i].ID] > lastAnswered[candidates[j].ID] })
+		sel.Prompt = candidates[0]
+		sel.Answered = true
+		return sel, nil
+	}
+
+	var best []JournalPrompt
+	bestScore := -1
+	for _, p := range unanswered {
+		score := scorePrompt(p, categories, sel.TimeOfDay)
+		if score > bestScore {
+			best, bestScore = nil, score
+		}
+		if score == bestScore {
+			best = append(best, p)
+		}
+	}
+	sel.Prompt = best[rand.Intn(len(best))]
+	return sel, nil
+}
+
+// generatePrompt asks the model for a journaling prompt in the given category
+// that builds on the user's recent entries, and stores it so entries can link
+// to it.
+func generatePrompt(ctx context.Context, category, emotion, timeOfDay string) (JournalPrompt, error) {
+	journals, err := models.GetAllJournalEntries()
+	if err != nil {
+		return JournalPrompt{}, err
+	}
+	if len(journals) > 3 {
+		journals = journals[len(journals)-3:]
+	}
+	var recent strings.Builder
+	for _, j := range journals {
+		fmt.Fprintf(&recent, "- %s\n", truncateToTokens(j.Content, 150))
+	}
+
+	prompt := fmt.Sprintf(`You are a supportive journaling coach. Write one short, open-ended journaling prompt in the %q style for the user to answer now.
+It is %s and the user's recent emotional state is %q. Build gently on their recent entries below without quoting them.
+Respond with only the prompt text.
+
+Recent entries:
+%s`, category, timeOfDay, emotion, recent.String())
+
+	text, err := generateText(ctx, prompt)
+	if err != nil {
+		return JournalPrompt{}, err
+	}
+	text = strings.Trim(strings.TrimSpace(text), `"`)
+	if text == "" {
+		return JournalPrompt{}, errors.New("model returned an empty prompt")
+	}
+
+	sum := sha256.Sum256([]byte(category + "\x1f" + text))
+	p := JournalPrompt{ID: "ai-" + hex.EncodeToString(sum[:6]), Category: category, Text: text, Source: PromptSourceGenerated}
+	if err := models.StoreGeneratedPrompt(models.GeneratedPrompt{ID: p.ID, Category: p.Category, Text: p.Text}); err != nil {
+		return JournalPrompt{}, err
+	}
+	return p, nil
+}
+
+// AnsweredPrompts lists the prompts the user has answered with links to the
+// resulting journal entries, newest first.
+func AnsweredPrompts() ([]AnsweredPrompt, error) {
+	answers, err := models.GetPromptAnswers()
+	if err != nil {
+		return nil, err
+	}
+	answered := []AnsweredPrompt{}
+	for _, a := range answers {
+		prompt, err := LookupPrompt(a.PromptID)
+		if errors.Is(err, ErrUnknownPrompt) {
+			// The prompt was removed from the library; keep the link.
+			prompt = JournalPrompt{ID: a.PromptID}
+		} else if err != nil {
+			return nil, err
+		}
+		answered = append(answered, AnsweredPrompt{
+			Prompt:     prompt,
+			JournalID:  a.JournalID,
+			AnsweredAt: a.AnsweredAt,
+			Link:       fmt.Sprintf("/journals/%d", a.JournalID),
+		})
+	}
+	return answered, nil
+}
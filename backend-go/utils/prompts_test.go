@@ -0,0 +1,152 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"mindful/backend-go/models"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// answerPrompt stores a journal entry written in response to a prompt.
+func answerPrompt(t *testing.T, promptID string) int {
+	t.Helper()
+	id, err := models.StoreJournalEntry(models.Journal{Content: "Answer to " + promptID, PromptID: promptID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// storeEmotion stores a journal entry analyzed as emotion.
+func storeEmotion(t *testing.T, emotion string) {
+	t.Helper()
+	id, err := models.StoreJournalEntry(models.Journal{Content: "Feeling " + emotion})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := models.SetJournalEmotionalState(id, "Feeling "+emotion, emotion); err != nil {
+		t.Fatal(err)
+	}
+}
+
+var (
+	promptMorning = time.Date(2024, 3, 25, 8, 0, 0, 0, time.UTC)
+	promptEvening = time.Date(2024, 3, 25, 19, 0, 0, 0, time.UTC)
+	promptNight   = time.Date(2024, 3, 25, 23, 30, 0, 0, time.UTC)
+)
+
+func TestNextPromptRotatesThroughCategory(t *testing.T) {
+	openTestDB(t)
+	ctx := context.Background()
+	opts := PromptOptions{Now: promptMorning, Category: "anxiety"}
+	library := PromptLibrary("anxiety")
+
+	// Every prompt is offered once before any is repeated, starting with
+	// the one meant for the morning.
+	var order []string
+	seen := map[string]bool{}
+	for range library {
+		sel, err := NextPrompt(ctx, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sel.Prompt.Category != "anxiety" || sel.Answered || seen[sel.Prompt.ID] {
+			t.Fatalf("after answering %v got %+v", order, sel)
+		}
+		seen[sel.Prompt.ID] = true
+		order = append(order, sel.Prompt.ID)
+		answerPrompt(t, sel.Prompt.ID)
+	}
+	if order[0] != "anxiety-morning-plan" {
+		t.Errorf("first prompt in the morning = %s, want anxiety-morning-plan", order[0])
+	}
+	if order[len(order)-1] != "anxiety-night" {
+		t.Errorf("last prompt in the morning = %s, want anxiety-night", order[len(order)-1])
+	}
+
+	// Once all are answered, the one answered longest ago comes back.
+	for _, want := range order[:2] {
+		sel, err := NextPrompt(ctx, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sel.Prompt.ID != want || !sel.Answered {
+			t.Errorf("repeat = %s (answered %v), want %s", sel.Prompt.ID, sel.Answered, want)
+		}
+		answerPrompt(t, sel.Prompt.ID)
+	}
+}
+
+func TestNextPromptFollowsRecentEmotion(t *testing.T) {
+	openTestDB(t)
+	ctx := context.Background()
+	storeEmotion(t, "Anxious")
+	storeEmotion(t, "Anxious")
+	storeEmotion(t, "Calm")
+
+	sel, err := NextPrompt(ctx, PromptOptions{Now: promptNight})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sel.Emotion != "Anxious" || sel.TimeOfDay != "night" || sel.Prompt.ID != "anxiety-night" {
+		t.Errorf("selection = %+v, want anxiety-night for an anxious night", sel)
+	}
+
+	// Answered prompts are left out even when they fit best.
+	answerPrompt(t, "anxiety-night")
+	sel, err = NextPrompt(ctx, PromptOptions{Now: promptNight})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sel.Prompt.ID == "anxiety-night" || sel.Prompt.Category != "anxiety" {
+		t.Errorf("after answering anxiety-night got %+v", sel.Prompt)
+	}
+
+	// A category given by the user wins over the emotion.
+	sel, err = NextPrompt(ctx, PromptOptions{Now: promptNight, Category: "cbt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sel.Prompt.Category != "cbt" || sel.Prompt.ID != "cbt-behaviour" {
+		t.Errorf("cbt prompt at night = %+v, want cbt-behaviour", sel.Prompt)
+	}
+
+	storeEmotion(t, "Grateful")
+	storeEmotion(t, "Grateful")
+	sel, err = NextPrompt(ctx, PromptOptions{Now: promptEvening})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sel.Emotion != "Grateful" || sel.Prompt.ID != "gratitude-three-things" {
+		t.Errorf("selection = %+v, want gratitude-three-things for a grateful evening", sel)
+	}
+}
+
+func TestNextPromptUnknownCategory(t *testing.T) {
+	openTestDB(t)
+	if _, err := NextPrompt(context.Background(), PromptOptions{Now: promptMorning, Category: "astrology"}); !errors.Is(err, ErrUnknownPrompt) {
+		t.Errorf("err = %v, want ErrUnknownPrompt", err)
+	}
+}
+
+func TestAnsweredPromptsLinkEntries(t *testing.T) {
+	openTestDB(t)
+	first := answerPrompt(t, "gratitude-person")
+	second := answerPrompt(t, "retired-prompt")
+
+	answered, err := AnsweredPrompts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(answered) != 2 {
+		t.Fatalf("answered = %+v, want two", answered)
+	}
+	if a := answered[0]; a.JournalID != second || a.Prompt.ID != "retired-prompt" || a.Prompt.Text != "" || a.Link != "/journals/"+strconv.Itoa(second) {
+		t.Errorf("newest answer = %+v", a)
+	}
+	if a := answered[1]; a.JournalID != first || a.Prompt.Category != "gratitude" || a.Prompt.Text == "" || a.Link != "/journals/"+strconv.Itoa(first) {
+		t.Errorf("oldest answer = %+v", a)
+	}
+}
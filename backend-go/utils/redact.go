@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"fmt"
+	"mindful/backend-go/models"
+	"regexp"
+	"strings"
+)
+
+// redactionRules mask personal details that commonly come up in sessions.
+// Order matters: URLs and emails go before numbers so their digits aren't
+// matched separately.
+var redactionRules = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`(?i)\b(?:https?://|www\.)\S+`), "[url]"},
+	{regexp.MustCompile(`(?i)\b[\w.%+-]+@[\w-]+(?:\.[\w-]+)+\b`), "[email]"},
+	{regexp.MustCompile(`(?:\+\d{1,3}[\s.-]?)?\(?\d{2,4}\)?[\s./-]?\d{3,4}[\s./-]?\d{3,5}\b`), "[phone]"},
+	{regexp.MustCompile(`\b\d(?:[\s-]?\d){5,}\b`), "[number]"},
+}
+
+// RedactText masks URLs, email addresses, phone numbers and long digit
+// sequences such as account or ID numbers.
+func RedactText(s string) string {
+	for _, rule := range redactionRules {
+		s = rule.pattern.ReplaceAllString(s, rule.replacement)
+	}
+	return s
+}
+
+// RedactTurns masks personal details in turn text and replaces speaker
+// names other than "user" and "assistant" with "Speaker 1", "Speaker 2" and
+// so on, in order of first appearance.
+func RedactTurns(turns []models.TranscriptTurn) []models.TranscriptTurn {
+	names := map[string]string{}
+	redacted := make([]models.TranscriptTurn, len(turns))
+	for i, t := range turns {
+		t.Text = RedactText(t.Text)
+		switch speaker := strings.ToLower(t.Speaker); {
+		case speaker == "" || speaker == "user" || speaker == "assistant":
+		case names[t.Speaker] != "":
+			t.Speaker = names[t.Speaker]
+		default:
+			names[t.Speaker] = fmt.Sprintf("Speaker_%d", len(names)+1)
+			t.Speaker = names[t.Speaker]
+		}
+		redacted[i] = t
+	}
+	return redacted
+}
@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"log"
+	"mindful/backend-go/models"
+	"time"
+)
+
+// staleReminderAfter is how late a reminder may fire, for example after the
+// server was down. Older runs are skipped rather than sent out of context.
+const staleReminderAfter = 12 * time.Hour
+
+// StartReminderScheduler checks for due reminders every interval until the
+// process exits. Schedules live in the database, so reminders that came due
+// while the server was down are sent on the first check.
+func StartReminderScheduler(interval time.Duration, sinks map[string]NotificationSink) {
+	go func() {
+		for {
+			RunDueReminders(context.Background(), sinks, time.Now())
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// RunDueReminders sends every reminder due at now and schedules its next
+// run. Reminders whose habit is already done, task completed or goal closed
+// are skipped.
+func RunDueReminders(ctx context.Context, sinks map[string]NotificationSink, now time.Time) {
+	due, err := models.DueReminders(now)
+	if err != nil {
+		log.Printf("Error loading due reminders: %v", err)
+		return
+	}
+	for _, r := range due {
+		if send, reason := shouldSendReminder(r, now); send {
+			n := models.Notification{
+				ReminderID: &r.ID,
+				Title:      r.Title,
+				Body:       r.Message,
+				TargetType: r.TargetType,
+				TargetID:   r.TargetID,
+				CreatedAt:  now.UTC().Format(time.RFC3339),
+			}
+			Notify(ctx, sinks, r.Channels, n)
+		} else {
+			log.Printf("Skipping reminder %d: %s", r.ID, reason)
+		}
+		if err := models.AdvanceReminder(r, now, now); err != nil {
+			log.Printf("Error scheduling reminder %d: %v", r.ID, err)
+		}
+	}
+}
+
+func shouldSendReminder(r models.Reminder, now time.Time) (bool, string) {
+	if due, err := time.Parse(time.RFC3339, r.NextRunAt); err == nil && now.Sub(due) > staleReminderAfter {
+		return false, "missed by more than " + staleReminderAfter.String()
+	}
+	done, err := models.ReminderTargetDone(r, now)
+	if errors.Is(err, models.ErrNotFound) {
+		return false, r.TargetType + " no longer exists"
+	}
+	if err != nil {
+		log.Printf("Error checking target of reminder %d: %v", r.ID, err)
+		return true, ""
+	}
+	if done {
+		return false, r.TargetType + " already done"
+	}
+	return true, ""
+}
@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"context"
+	"mindful/backend-go/models"
+	"testing"
+	"time"
+)
+
+func TestRunDueRemindersDefersQuietHours(t *testing.T) {
+	openTestDB(t)
+	addr, messages := fakeSMTP(t)
+	sinks := map[string]NotificationSink{
+		models.ChannelEmail: SMTPSink{Addr: addr, From: "mindful@example.com", To: "user@example.com"},
+	}
+
+	r, err := models.CreateReminder(models.Reminder{
+		Title:      "Wind down",
+		Message:    "Put the phone away.",
+		TimeOfDay:  "23:00",
+		Timezone:   "Europe/Berlin",
+		StartDate:  "2024-01-01",
+		QuietHours: "22:00-07:00",
+		Channels:   []string{models.ChannelEmail},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, err := time.Parse(time.RFC3339, r.NextRunAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loc, _ := time.LoadLocation("Europe/Berlin")
+	if local := next.In(loc); local.Hour() != 7 || local.Minute() != 0 {
+		t.Fatalf("next run at %s, want 07:00 after quiet hours", local)
+	}
+
+	// At the scheduled 23:00 the reminder is held back.
+	scheduled := next.Add(-8 * time.Hour)
+	RunDueReminders(context.Background(), sinks, scheduled)
+	select {
+	case msg := <-messages:
+		t.Fatalf("reminder sent during quiet hours: %q", msg)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	RunDueReminders(context.Background(), sinks, next)
+	header, body := splitMail(t, receive(t, messages))
+	if !containsLine(header, "Subject: Wind down") {
+		t.Errorf("subject missing from %q", header)
+	}
+	if body != "Put the phone away.\r\n" {
+		t.Errorf("body = %q", body)
+	}
+
+	r, err = models.GetReminder(r.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := next.Format(time.RFC3339); r.LastRunAt != want {
+		t.Errorf("last run at %s, want %s", r.LastRunAt, want)
+	}
+	if want := next.AddDate(0, 0, 1).Format(time.RFC3339); r.NextRunAt != want {
+		t.Errorf("next run at %s, want %s", r.NextRunAt, want)
+	}
+}
+
+func TestReminderNextRunAfterQuietHours(t *testing.T) {
+	loc, _ := time.LoadLocation("Europe/Berlin")
+	tests := []struct {
+		name, timeOfDay, quiet string
+		want                   time.Time
+	}{
+		{"outside", "20:00", "22:00-07:00", time.Date(2024, 3, 5, 20, 0, 0, 0, loc)},
+		{"before midnight", "23:30", "22:00-07:00", time.Date(2024, 3, 6, 7, 0, 0, 0, loc)},
+		{"after midnight", "05:00", "22:00-07:00", time.Date(2024, 3, 5, 7, 0, 0, 0, loc)},
+		{"same day", "13:15", "12:00-14:00", time.Date(2024, 3, 5, 14, 0, 0, 0, loc)},
+	}
+	after := time.Date(2024, 3, 5, 0, 0, 0, 0, loc)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := models.Reminder{TimeOfDay: tt.timeOfDay, Timezone: "Europe/Berlin", StartDate: "2024-01-01", QuietHours: tt.quiet}
+			got, ok := r.NextRun(after)
+			if !ok {
+				t.Fatal("no next run")
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("NextRun = %s, want %s", got.In(loc), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"context"
+	"log"
+	"mindful/backend-go/models"
+	"time"
+)
+
+// StartRetentionSweeper enforces retention policies and removes expired
+// export files every interval until the process exits. It runs once
+// immediately so a restart does not delay purges.
+func StartRetentionSweeper(interval time.Duration) {
+	store := DefaultBlobStore()
+	go func() {
+		for {
+			sweepRetention(store)
+			RemoveExpiredExports(time.Now())
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// sweepRetention applies the retention policies and removes the blobs of
+// deleted recordings from store.
+func sweepRetention(store BlobStore) {
+	purged, err := models.ApplyRetention(false)
+	if err != nil {
+		log.Printf("Error enforcing retention policies: %v", err)
+		return
+	}
+	for _, c := range purged {
+		log.Printf("Retention: %s %s record %d created at %s", c.Action, c.Resource, c.RecordID, c.CreatedAt)
+		auditSystemWrite("retention", c.Action, c.Resource, c.RecordID)
+		DeleteBlobs(context.Background(), store, c.BlobKeys)
+	}
+}
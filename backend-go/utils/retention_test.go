@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"errors"
+	"mindful/backend-go/database"
+	"mindful/backend-go/models"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSweepRetentionDeletesOldRecordings(t *testing.T) {
+	openTestDB(t)
+	store := LocalBlobStore{Dir: t.TempDir()}
+	old := uploadTestRecording(t, store, "s1")
+	recent := uploadTestRecording(t, store, "s2")
+	if _, err := database.DB.Exec(`UPDATE session_audio SET created_at = datetime('now', '-100 days') WHERE id = ?`, old.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	preview, err := models.ApplyRetention(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(preview) != 1 || preview[0].Resource != "session_audio" || preview[0].RecordID != old.ID || preview[0].Action != models.RetentionActionDelete {
+		t.Fatalf("preview = %+v, want the old recording deleted", preview)
+	}
+	if _, err := models.GetSessionAudio("s1"); err != nil {
+		t.Fatalf("dry run removed the recording: %v", err)
+	}
+
+	sweepRetention(store)
+
+	if _, err := models.GetSessionAudio("s1"); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("loading the old recording: %v, want ErrNotFound", err)
+	}
+	for _, c := range old.Chunks {
+		if _, err := os.Stat(filepath.Join(store.Dir, filepath.FromSlash(c.BlobKey))); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("chunk %d blob: %v, want it removed", c.Index, err)
+		}
+	}
+	if _, err := models.GetSessionAudio("s2"); err != nil {
+		t.Errorf("recent recording removed: %v", err)
+	}
+	for _, c := range recent.Chunks {
+		if _, err := os.Stat(filepath.Join(store.Dir, filepath.FromSlash(c.BlobKey))); err != nil {
+			t.Errorf("recent chunk %d blob: %v", c.Index, err)
+		}
+	}
+	assertSystemAudit(t, "retention", models.RetentionActionDelete, "session_audio", old.ID)
+}
@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"mindful/backend-go/models"
+	"regexp"
+	"strings"
+)
+
+// safetyRule flags language suggesting the user may be at risk. The rules
+// favour recall over precision: a false flag costs a glance from whoever
+// receives safety.flagged, a missed one costs more.
+type safetyRule struct {
+	category string
+	pattern  *regexp.Regexp
+}
+
+func safety(category, pattern string) safetyRule {
+	pattern = strings.ReplaceAll(pattern, "'", "['’]")
+	return safetyRule{category, regexp.MustCompile(`(?i)\b(?:` + pattern + `)\b`)}
+}
+
+var safetyRules = []safetyRule{
+	safety("suicidal-ideation", `suicid\w*|kill(?:ing)? myself|end(?:ing)? (?:it all|my life)|take my (?:own )?life|(?:don'?t|do not) want to (?:live|be alive|wake up)|better off (?:dead|without me)|no reason to live|wish i (?:was|were) dead`),
+	safety("self-harm", `self[- ]harm\w*|hurt(?:ing)? myself|cut(?:ting)? myself|harm(?:ing)? myself|burn(?:ing)? myself`),
+	safety("harm-to-others", `(?:kill|hurt|harm) (?:him|her|them|someone|somebody|people)|going to (?:kill|hurt) (?:him|her|them|someone|somebody)`),
+}
+
+// DetectSafetyConcerns returns the categories of risk language in text, in
+// rule order.
+func DetectSafetyConcerns(text string) []string {
+	var categories []string
+	for _, r := range safetyRules {
+		if r.pattern.MatchString(text) {
+			categories = append(categories, r.category)
+		}
+	}
+	return categories
+}
+
+// FlagJournalSafety emits safety.flagged when a journal entry contains risk
+// language. The event names the categories, never the text.
+func FlagJournalSafety(id int, content string) {
+	if categories := DetectSafetyConcerns(content); len(categories) > 0 {
+		EmitEvent(models.EventSafetyFlagged, map[string]interface{}{
+			"record_type": models.SearchKindJournal,
+			"record_id":   id,
+			"categories":  categories,
+		})
+	}
+}
+
+// FlagTranscriptSafety emits safety.flagged when any of the user's turns in
+// a transcript contains risk language.
+func FlagTranscriptSafety(t models.Transcript) {
+	seen := map[string]bool{}
+	var categories []string
+	var turns []int
+	for _, turn := range models.SplitTranscriptTurns(t.Transcript) {
+		if !isUserSpeaker(turn.Speaker) {
+			continue
+		}
+		found := DetectSafetyConcerns(turn.Text)
+		if len(found) > 0 {
+			turns = append(turns, turn.Index)
+		}
+		for _, c := range found {
+			if !seen[c] {
+				seen[c] = true
+				categories = append(categories, c)
+			}
+		}
+	}
+	if len(categories) > 0 {
+		EmitEvent(models.EventSafetyFlagged, map[string]interface{}{
+			"record_type": models.SearchKindTranscript,
+			"record_id":   t.ID,
+			"session_id":  t.SessionID,
+			"categories":  categories,
+			"turns":       turns,
+		})
+	}
+}
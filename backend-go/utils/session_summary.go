@@ -0,0 +1,175 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mindful/backend-go/models"
+	"sort"
+	"strings"
+)
+
+const (
+	// maxSessionTopics caps how many topics a summary lists.
+	maxSessionTopics = 8
+	// sessionSummaryTokens bounds the transcript sent to the model; longer
+	// sessions lose their earliest turns.
+	sessionSummaryTokens = 12000
+)
+
+var (
+	errNoSummary = errors.New("model returned no summary")
+	// ErrTranscriptRedacted is returned for sessions whose turns have all
+	// been redacted, leaving nothing to summarize.
+	ErrTranscriptRedacted = errors.New("session transcript has been redacted")
+)
+
+// SummarizeSessionAsync runs SummarizeSession in the background, logging
+// failures.
+func SummarizeSessionAsync(sessionID string) {
+	go func() {
+		if _, err := SummarizeSession(context.Background(), sessionID); err != nil {
+			log.Printf("Error summarizing session %s: %v", sessionID, err)
+		}
+	}()
+}
+
+// SummarizeSession asks the model for a summary of a session's transcripts,
+// its key moments, the topics discussed and the user's commitments, and
+// stores the result, replacing an earlier one. A failure is recorded on the
+// stored summary as well as returned. It returns ErrNotFound if the session
+// has no transcript, and ErrTranscriptRedacted, leaving the stored summary
+// alone, if retention has cleared the text of every turn.
+func SummarizeSession(ctx context.Context, sessionID string) (models.SessionSummary, error) {
+	turns, transcriptID, err := sessionTurns(sessionID)
+	if err != nil {
+		return models.SessionSummary{}, err
+	}
+	if redacted(turns) {
+		return models.SessionSummary{}, ErrTranscriptRedacted
+	}
+	if err := models.StartSessionSummary(sessionID, transcriptID); err != nil {
+		return models.SessionSummary{}, err
+	}
+
+	s, err := generateSessionSummary(ctx, turns)
+	if err != nil {
+		if err := models.FailSessionSummary(sessionID, err.Error()); err != nil {
+			log.Printf("Error recording failed summary for session %s: %v", sessionID, err)
+		}
+		return models.SessionSummary{}, err
+	}
+	s.SessionID, s.TranscriptID = sessionID, transcriptID
+	s, err = models.CompleteSessionSummary(s)
+	if err != nil {
+		return models.SessionSummary{}, err
+	}
+	if err := EmbedSessionSummary(ctx, DefaultEmbedder(), s); err != nil {
+		log.Printf("Error embedding summary of session %s: %v", sessionID, err)
+	}
+	return s, nil
+}
+
+// redacted reports whether no turn has any text left.
+func redacted(turns []models.TranscriptTurn) bool {
+	for _, t := range turns {
+		if strings.TrimSpace(t.Text) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// sessionTurns returns the turns of every transcript of a session in order,
+// and the ID of the latest transcript. Transcripts stored without turns are
+// split into them.
+func sessionTurns(sessionID string) ([]models.TranscriptTurn, int, error) {
+	transcripts, err := models.GetTranscriptsBySessionID(sessionID)
+	if err != nil {
+		return nil, 0, err
+	}
+	var turns []models.TranscriptTurn
+	for _, t := range transcripts {
+		stored, err := models.GetTranscriptTurns(t.ID)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(stored) == 0 {
+			stored = models.SplitTranscriptTurns(t.Transcript)
+		}
+		turns = append(turns, stored...)
+	}
+	return turns, transcripts[len(transcripts)-1].ID, nil
+}
+
+func generateSessionSummary(ctx context.Context, turns []models.TranscriptTurn) (models.SessionSummary, error) {
+	var numbered strings.Builder
+	for i, t := range turns {
+		fmt.Fprintf(&numbered, "[%d] %s\n", i, models.RenderTranscript([]models.TranscriptTurn{t}))
+	}
+
+	prompt := fmt.Sprintf(`You are a supportive therapist reviewing a session between a user and an AI companion. The turns of the session are numbered below.
+Summarize the session in 3 to 5 sentences: what the user talked about and how they felt. Mark its key moments as ranges of turns, each labelled with one of: %s. List up to %d topics discussed (one to three words each) and every commitment the user made, that is something they said they would do, with the turn they said it in.
+Respond with only a JSON object in this format:
+{
+  "summary": "Summary of the session",
+  "key_moments": [{"start_turn": 3, "end_turn": 5, "label": "breakthrough", "description": "One sentence."}],
+  "topics": ["work", "sleep"],
+  "commitments": [{"text": "Go for a walk before work", "turn": 7}]
+}
+
+Session:
+%s`, strings.Join(models.KeyMomentLabels, ", "), maxSessionTopics, truncateToTokens(numbered.String(), sessionSummaryTokens))
+
+	raw, err := generateText(ctx, prompt)
+	if err != nil {
+		return models.SessionSummary{}, err
+	}
+	var resp struct {
+		Summary     string             `json:"summary"`
+		KeyMoments  []models.KeyMoment `json:"key_moments"`
+		Topics      []string           `json:"topics"`
+		Commitments []struct {
+			Text string `json:"text"`
+			Turn *int   `json:"turn"`
+		} `json:"commitments"`
+	}
+	if err := json.Unmarshal([]byte(stripCodeFence(raw)), &resp); err != nil {
+		return models.SessionSummary{}, fmt.Errorf("failed to parse session summary: %w", err)
+	}
+	if strings.TrimSpace(resp.Summary) == "" {
+		return models.SessionSummary{}, errNoSummary
+	}
+
+	s := models.SessionSummary{Summary: strings.TrimSpace(resp.Summary)}
+	// Moments with an unknown label or outside the session are dropped, and
+	// ranges running past its end are cut short.
+	for _, m := range resp.KeyMoments {
+		m.Label = strings.ToLower(strings.TrimSpace(m.Label))
+		if !models.IsKeyMomentLabel(m.Label) || m.StartTurn < 0 || m.StartTurn >= len(turns) {
+			continue
+		}
+		m.EndTurn = min(max(m.EndTurn, m.StartTurn), len(turns)-1)
+		m.Description = strings.TrimSpace(m.Description)
+		s.KeyMoments = append(s.KeyMoments, m)
+	}
+	sort.SliceStable(s.KeyMoments, func(i, j int) bool { return s.KeyMoments[i].StartTurn < s.KeyMoments[j].StartTurn })
+
+	s.Topics = models.NormalizeTags(resp.Topics)
+	if len(s.Topics) > maxSessionTopics {
+		s.Topics = s.Topics[:maxSessionTopics]
+	}
+	for _, c := range resp.Commitments {
+		text := strings.TrimSpace(c.Text)
+		if text == "" {
+			continue
+		}
+		if c.Turn != nil && (*c.Turn < 0 || *c.Turn >= len(turns)) {
+			c.Turn = nil
+		}
+		s.Commitments = append(s.Commitments, models.Commitment{Text: text, Turn: c.Turn})
+	}
+	return s, nil
+}
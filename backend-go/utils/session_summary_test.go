@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"mindful/backend-go/database"
+	"mindful/backend-go/models"
+	"testing"
+)
+
+func TestSummarizeSessionKeepsSummaryOfRedactedSession(t *testing.T) {
+	openTestDB(t)
+	tr := importTestTranscript(t, "s1", "I keep waking up at four and can't get back to sleep.")
+	if _, err := models.CompleteSessionSummary(models.SessionSummary{
+		SessionID:    "s1",
+		TranscriptID: tr.ID,
+		Summary:      "The user talked about poor sleep.",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.DB.Exec(`UPDATE transcripts SET created_at = datetime('now', '-100 days') WHERE id = ?`, tr.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := models.ApplyRetention(false); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := SummarizeSession(context.Background(), "s1"); !errors.Is(err, ErrTranscriptRedacted) {
+		t.Fatalf("summarizing a redacted session: %v, want ErrTranscriptRedacted", err)
+	}
+	kept, err := models.GetSessionSummary("s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kept.Summary != "The user talked about poor sleep." || kept.Status != models.SummaryStatusCompleted || kept.Error != "" {
+		t.Errorf("summary = %+v, want the kept summary unchanged", kept)
+	}
+}
@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"mindful/backend-go/models"
+	"strings"
+)
+
+// maxSuggestedTags caps how many tags are suggested for one entry.
+const maxSuggestedTags = 5
+
+// SuggestTags asks the model for short tags describing a journal entry.
+// Tags the user already uses are offered to the model so it reuses them
+// rather than inventing near-duplicates.
+func SuggestTags(ctx context.Context, content string, known []string) ([]string, error) {
+	prompt := fmt.Sprintf(`Suggest up to %d short tags (one or two words each) for the journal entry below, describing its topics, people, places or activities rather than emotions.
+Prefer tags from this list of tags the user already uses when they fit: %s
+Respond with only a JSON array of strings, for example ["work", "sleep"].
+
+Journal entry:
+%s`, maxSuggestedTags, strings.Join(known, ", "), content)
+
+	raw, err := generateText(ctx, prompt)
+	if err != nil {
+		return nil, err
+	}
+	var tags []string
+	if err := json.Unmarshal([]byte(stripCodeFence(raw)), &tags); err != nil {
+		return nil, fmt.Errorf("failed to parse tag suggestions: %w", err)
+	}
+	tags = models.NormalizeTags(tags)
+	if len(tags) > maxSuggestedTags {
+		tags = tags[:maxSuggestedTags]
+	}
+	return tags, nil
+}
+
+// suggestJournalTags stores tag suggestions for a journal entry for the user
+// to accept or reject.
+func suggestJournalTags(id int, content string) error {
+	counts, err := models.GetTagCounts()
+	if err != nil {
+		return err
+	}
+	var known []string
+	for _, c := range counts {
+		known = append(known, c.Tag)
+	}
+
+	tags, err := SuggestTags(context.Background(), content, known)
+	if err != nil {
+		return err
+	}
+	return models.StoreTagSuggestions(id, content, tags)
+}
@@ -0,0 +1,243 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TranscriptSegment is a stretch of recognized speech. Speaker is set when
+// the audio was diarized, as "speaker_1", "speaker_2" and so on.
+type TranscriptSegment struct {
+	StartMs int64  `json:"start_ms"`
+	EndMs   int64  `json:"end_ms"`
+	Text    string `json:"text"`
+	Speaker string `json:"speaker,omitempty"`
+}
+
+// TranscribeOptions tune a transcription. Language is an ISO 639-1 code;
+// empty lets the transcriber detect it.
+type TranscribeOptions struct {
+	Language string
+	Diarize  bool
+}
+
+// Transcriber turns recorded speech into timed segments. Name identifies
+// the engine in logs and job errors.
+type Transcriber interface {
+	Name() string
+	Transcribe(ctx context.Context, audio io.Reader, contentType string, opts TranscribeOptions) ([]TranscriptSegment, error)
+}
+
+// DefaultTranscriber returns the transcriber selected by TRANSCRIBER: "fake"
+// serves the segments in TRANSCRIBER_FIXTURE, otherwise the whisper.cpp
+// server at WHISPER_URL (default http://127.0.0.1:8081) is used.
+func DefaultTranscriber() Transcriber {
+	if os.Getenv("TRANSCRIBER") == "fake" {
+		return FakeTranscriber{Fixture: os.Getenv("TRANSCRIBER_FIXTURE")}
+	}
+	url := os.Getenv("WHISPER_URL")
+	if url == "" {
+		url = "http://127.0.0.1:8081"
+	}
+	return WhisperTranscriber{URL: url, Diarization: os.Getenv("WHISPER_DIARIZATION")}
+}
+
+// WhisperTranscriber calls the HTTP server that ships with whisper.cpp
+// (whisper-server). Start it with --convert so it accepts WebM and Ogg as
+// well as WAV. Diarization is "stereo", which tells apart the two channels
+// of a stereo recording, or "tinydiarize", which needs a tdrz model and
+// marks speaker changes without telling speakers apart; two alternating
+// speakers are assumed then.
+type WhisperTranscriber struct {
+	URL         string
+	Diarization string
+	Client      *http.Client
+}
+
+// whisperClient allows for slow CPU inference of long recordings.
+var whisperClient = &http.Client{Timeout: 20 * time.Minute}
+
+func (t WhisperTranscriber) Name() string {
+	return "whisper.cpp"
+}
+
+type whisperResponse struct {
+	Error    string `json:"error"`
+	Segments []struct {
+		Start           float64         `json:"start"`
+		End             float64         `json:"end"`
+		Text            string          `json:"text"`
+		Speaker         json.RawMessage `json:"speaker"`
+		SpeakerTurnNext bool            `json:"speaker_turn_next"`
+	} `json:"segments"`
+}
+
+func (t WhisperTranscriber) Transcribe(ctx context.Context, audio io.Reader, contentType string, opts TranscribeOptions) ([]TranscriptSegment, error) {
+	fields := map[string]string{"response_format": "verbose_json", "temperature": "0.0"}
+	if opts.Language != "" {
+		fields["language"] = opts.Language
+	}
+	if opts.Diarize {
+		if t.Diarization == "tinydiarize" {
+			fields["tinydiarize"] = "true"
+		} else {
+			fields["diarize"] = "true"
+		}
+	}
+
+	// The recording is streamed into the form rather than held in memory.
+	// Transcribe waits for the writer to stop before returning, so the
+	// caller can close the audio.
+	body, pw := io.Pipe()
+	form := multipart.NewWriter(pw)
+	done := make(chan struct{})
+	defer func() {
+		body.Close()
+		<-done
+	}()
+	go func() {
+		defer close(done)
+		for name, value := range fields {
+			if err := form.WriteField(name, value); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		ext := audioExtensions[contentType]
+		if ext == "" {
+			ext = ".wav"
+		}
+		part, err := form.CreateFormFile("file", "audio"+ext)
+		if err == nil {
+			_, err = io.Copy(part, audio)
+		}
+		if err == nil {
+			err = form.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(t.URL, "/")+"/inference", body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	client := t.Client
+	if client == nil {
+		client = whisperClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("whisper server request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 32<<20))
+	if err != nil {
+		return nil, fmt.Errorf("reading whisper response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("whisper server returned %s: %s", resp.Status, strings.TrimSpace(string(data[:min(len(data), 1024)])))
+	}
+	var result whisperResponse
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("decoding whisper response: %w", err)
+	}
+	if result.Error != "" {
+		return nil, fmt.Errorf("whisper server: %s", result.Error)
+	}
+
+	segments := make([]TranscriptSegment, 0, len(result.Segments))
+	turn := 0
+	for _, s := range result.Segments {
+		seg := TranscriptSegment{
+			StartMs: int64(s.Start * 1000),
+			EndMs:   int64(s.End * 1000),
+			Text:    s.Text,
+		}
+		if opts.Diarize {
+			if n, ok := whisperSpeaker(s.Speaker); ok {
+				seg.Speaker = diarizedSpeaker(n)
+			} else if t.Diarization == "tinydiarize" {
+				seg.Speaker = diarizedSpeaker(turn % 2)
+			}
+		}
+		if s.SpeakerTurnNext {
+			turn++
+		}
+		segments = append(segments, seg)
+	}
+	return segments, nil
+}
+
+// whisperSpeaker reads the speaker index of a stereo-diarized segment,
+// which whisper.cpp gives as a number or a string; "?" means unknown.
+func whisperSpeaker(raw json.RawMessage) (int, bool) {
+	if len(raw) == 0 {
+		return 0, false
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		s = string(raw)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	return n, err == nil && n >= 0
+}
+
+func diarizedSpeaker(n int) string {
+	return fmt.Sprintf("speaker_%d", n+1)
+}
+
+// FakeTranscriber returns fixed segments, or those in the JSON file named by
+// Fixture, without looking at the audio beyond reading it. Speakers are
+// dropped unless diarization is asked for. It is meant for tests and local
+// development without a speech-to-text server.
+type FakeTranscriber struct {
+	Segments []TranscriptSegment
+	Fixture  string
+	Err      error
+}
+
+func (t FakeTranscriber) Name() string {
+	return "fake"
+}
+
+func (t FakeTranscriber) Transcribe(ctx context.Context, audio io.Reader, contentType string, opts TranscribeOptions) ([]TranscriptSegment, error) {
+	if _, err := io.Copy(io.Discard, audio); err != nil {
+		return nil, err
+	}
+	if t.Err != nil {
+		return nil, t.Err
+	}
+	fixture := t.Segments
+	if fixture == nil {
+		if t.Fixture == "" {
+			return nil, errors.New("no fixture configured for the fake transcriber")
+		}
+		data, err := os.ReadFile(t.Fixture)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &fixture); err != nil {
+			return nil, fmt.Errorf("decoding transcriber fixture: %w", err)
+		}
+	}
+
+	segments := make([]TranscriptSegment, len(fixture))
+	copy(segments, fixture)
+	if !opts.Diarize {
+		for i := range segments {
+			segments[i].Speaker = ""
+		}
+	}
+	return segments, nil
+}
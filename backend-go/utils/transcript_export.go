@@ -0,0 +1,373 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"mindful/backend-go/models"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Transcript export formats, alongside TranscriptFormatVTT and
+// TranscriptFormatSRT shared with imports.
+const (
+	TranscriptFormatJSON     = "json"
+	TranscriptFormatMarkdown = "markdown"
+	TranscriptFormatText     = "text"
+	TranscriptFormatHTML     = "html"
+)
+
+var ErrUnsupportedTranscriptExport = errors.New("unsupported transcript export format")
+
+var transcriptExportTypes = map[string]string{
+	TranscriptFormatJSON:     "application/json",
+	TranscriptFormatMarkdown: "text/markdown; charset=utf-8",
+	TranscriptFormatText:     "text/plain; charset=utf-8",
+	TranscriptFormatVTT:      "text/vtt; charset=utf-8",
+	TranscriptFormatSRT:      "application/x-subrip; charset=utf-8",
+	TranscriptFormatHTML:     "text/html; charset=utf-8",
+}
+
+var transcriptExportExtensions = map[string]string{
+	TranscriptFormatJSON:     "json",
+	TranscriptFormatMarkdown: "md",
+	TranscriptFormatText:     "txt",
+	TranscriptFormatVTT:      "vtt",
+	TranscriptFormatSRT:      "srt",
+	TranscriptFormatHTML:     "html",
+}
+
+var transcriptFormatAliases = map[string]string{
+	"md":     TranscriptFormatMarkdown,
+	"txt":    TranscriptFormatText,
+	"plain":  TranscriptFormatText,
+	"webvtt": TranscriptFormatVTT,
+}
+
+// acceptedTranscriptTypes maps Accept header media types to formats.
+var acceptedTranscriptTypes = map[string]string{
+	"*/*":                  TranscriptFormatJSON,
+	"application/*":        TranscriptFormatJSON,
+	"application/json":     TranscriptFormatJSON,
+	"text/markdown":        TranscriptFormatMarkdown,
+	"text/x-markdown":      TranscriptFormatMarkdown,
+	"text/*":               TranscriptFormatText,
+	"text/plain":           TranscriptFormatText,
+	"text/vtt":             TranscriptFormatVTT,
+	"application/x-subrip": TranscriptFormatSRT,
+	"text/srt":             TranscriptFormatSRT,
+	"text/html":            TranscriptFormatHTML,
+}
+
+// TranscriptExportOptions control an export. Location is the time zone
+// timestamps are shown in, UTC when nil; Redact masks personal details.
+type TranscriptExportOptions struct {
+	Location *time.Location
+	Redact   bool
+}
+
+// TranscriptExportFormat resolves a ?format= value such as "md" or "vtt".
+func TranscriptExportFormat(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if alias, ok := transcriptFormatAliases[name]; ok {
+		name = alias
+	}
+	if _, ok := transcriptExportTypes[name]; !ok {
+		return "", fmt.Errorf("%w %q", ErrUnsupportedTranscriptExport, name)
+	}
+	return name, nil
+}
+
+// NegotiateTranscriptFormat picks the export format from an Accept header,
+// preferring higher q values and then the order listed. An empty header
+// means JSON; false means nothing acceptable is offered.
+func NegotiateTranscriptFormat(accept string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return TranscriptFormatJSON, true
+	}
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		format := acceptedTranscriptTypes[strings.ToLower(strings.TrimSpace(params[0]))]
+		q := 1.0
+		for _, p := range params[1:] {
+			if key, value, ok := strings.Cut(strings.TrimSpace(p), "="); ok && key == "q" {
+				if f, err := strconv.ParseFloat(value, 64); err == nil {
+					q = f
+				}
+			}
+		}
+		if format == "" || q <= bestQ {
+			continue
+		}
+		best, bestQ = format, q
+	}
+	return best, best != ""
+}
+
+// TranscriptContentType returns the media type an export format is served as.
+func TranscriptContentType(format string) string {
+	return transcriptExportTypes[format]
+}
+
+// TranscriptFilename names a download of the session in format, keeping
+// only characters that are safe in a Content-Disposition header.
+func TranscriptFilename(sessionID, format string) string {
+	name := unsafeFilenameChars.ReplaceAllString(sessionID, "_")
+	if name == "" {
+		name = "transcript"
+	}
+	return name + "." + transcriptExportExtensions[format]
+}
+
+var unsafeFilenameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// ExportTranscript renders a transcript in format. Transcripts added as
+// plain text have no stored turns, so turns are split from the text; JSON
+// exports of them still leave turns out.
+func ExportTranscript(t models.Transcript, format string, opts TranscriptExportOptions) ([]byte, error) {
+	if opts.Location == nil {
+		opts.Location = time.UTC
+	}
+	stored := len(t.Turns) > 0
+	if !stored {
+		t.Turns = models.SplitTranscriptTurns(t.Transcript)
+	}
+	if opts.Redact {
+		t.Turns = RedactTurns(t.Turns)
+		t.Transcript = models.RenderTranscript(t.Turns)
+	}
+	if !stored && format == TranscriptFormatJSON {
+		t.Turns = nil
+	}
+	var recorded string
+	if created, err := models.ParseTimestamp(t.CreatedAt); err == nil {
+		t.CreatedAt = created.In(opts.Location).Format(time.RFC3339)
+		recorded = "Recorded " + created.In(opts.Location).Format("Mon 2 Jan 2006, 15:04 MST")
+	}
+
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case TranscriptFormatJSON:
+		err = json.NewEncoder(&buf).Encode(t)
+	case TranscriptFormatMarkdown:
+		writeTranscriptMarkdown(&buf, t, recorded, opts.Redact)
+	case TranscriptFormatText:
+		writeTranscriptText(&buf, t, recorded, opts.Redact)
+	case TranscriptFormatVTT:
+		writeTranscriptCaptions(&buf, t, true)
+	case TranscriptFormatSRT:
+		writeTranscriptCaptions(&buf, t, false)
+	case TranscriptFormatHTML:
+		err = writeTranscriptHTML(&buf, t, recorded, opts.Redact)
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnsupportedTranscriptExport, format)
+	}
+	return buf.Bytes(), err
+}
+
+// speakerName shows a speaker label as a name, so "Dr_Smith" reads
+// "Dr Smith".
+func speakerName(label string) string {
+	return strings.ReplaceAll(label, "_", " ")
+}
+
+// formatOffset shows a turn's offset into the session as m:ss or h:mm:ss.
+func formatOffset(ms int64) string {
+	s := ms / 1000
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+	}
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
+
+var markdownSpecial = strings.NewReplacer(`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`, "]", `\]`, "<", `\<`, ">", `\>`, "#", `\#`, "|", `\|`)
+
+func writeTranscriptMarkdown(buf *bytes.Buffer, t models.Transcript, recorded string, redacted bool) {
+	fmt.Fprintf(buf, "# Session %s\n\n", markdownSpecial.Replace(t.SessionID))
+	if recorded != "" {
+		fmt.Fprintf(buf, "*%s*\n\n", recorded)
+	}
+	if redacted {
+		buf.WriteString("*Personal details have been redacted.*\n\n")
+	}
+	for _, turn := range t.Turns {
+		if turn.Speaker != "" {
+			fmt.Fprintf(buf, "**%s**", markdownSpecial.Replace(speakerName(turn.Speaker)))
+			if turn.StartMs != nil {
+				fmt.Fprintf(buf, " · %s", formatOffset(*turn.StartMs))
+			}
+			buf.WriteString("\n\n")
+		}
+		fmt.Fprintf(buf, "%s\n\n", markdownSpecial.Replace(turn.Text))
+	}
+}
+
+func writeTranscriptText(buf *bytes.Buffer, t models.Transcript, recorded string, redacted bool) {
+	fmt.Fprintf(buf, "Session %s\n", t.SessionID)
+	if recorded != "" {
+		fmt.Fprintf(buf, "%s\n", recorded)
+	}
+	if redacted {
+		buf.WriteString("Personal details have been redacted.\n")
+	}
+	buf.WriteString("\n")
+	for _, turn := range t.Turns {
+		if turn.StartMs != nil {
+			fmt.Fprintf(buf, "[%s] ", formatOffset(*turn.StartMs))
+		}
+		if turn.Speaker != "" {
+			fmt.Fprintf(buf, "%s: ", speakerName(turn.Speaker))
+		}
+		fmt.Fprintf(buf, "%s\n", turn.Text)
+	}
+}
+
+// captionTimings returns start and end offsets for every turn, filling in
+// what wasn't recorded: a turn starts when the previous one ends and lasts
+// about as long as reading it aloud takes, at roughly 150 words a minute.
+func captionTimings(turns []models.TranscriptTurn) [][2]int64 {
+	timings := make([][2]int64, len(turns))
+	var clock int64
+	for i, turn := range turns {
+		start := clock
+		if turn.StartMs != nil {
+			start = *turn.StartMs
+		}
+		var end int64
+		switch {
+		case turn.EndMs != nil && *turn.EndMs > start:
+			end = *turn.EndMs
+		case i+1 < len(turns) && turns[i+1].StartMs != nil && *turns[i+1].StartMs > start:
+			end = *turns[i+1].StartMs
+		default:
+			spoken := int64(len(strings.Fields(turn.Text))) * 400
+			if spoken < 1000 {
+				spoken = 1000
+			}
+			end = start + spoken
+		}
+		timings[i] = [2]int64{start, end}
+		clock = end
+	}
+	return timings
+}
+
+func captionTime(ms int64, separator string) string {
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3600000, ms/60000%60, ms/1000%60, separator, ms%1000)
+}
+
+var vttEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// writeTranscriptCaptions writes one cue per turn, as WebVTT with voice
+// tags or as SRT with "Speaker: " prefixes.
+func writeTranscriptCaptions(buf *bytes.Buffer, t models.Transcript, vtt bool) {
+	if vtt {
+		buf.WriteString("WEBVTT\n\n")
+		fmt.Fprintf(buf, "NOTE Session %s\n\n", strings.ReplaceAll(t.SessionID, "-->", "->"))
+	}
+	for i, timing := range captionTimings(t.Turns) {
+		turn := t.Turns[i]
+		fmt.Fprintf(buf, "%d\n", i+1)
+		if vtt {
+			fmt.Fprintf(buf, "%s --> %s\n", captionTime(timing[0], "."), captionTime(timing[1], "."))
+			if turn.Speaker != "" {
+				fmt.Fprintf(buf, "<v %s>", vttEscaper.Replace(speakerName(turn.Speaker)))
+			}
+			fmt.Fprintf(buf, "%s\n\n", vttEscaper.Replace(turn.Text))
+			continue
+		}
+		fmt.Fprintf(buf, "%s --> %s\n", captionTime(timing[0], ","), captionTime(timing[1], ","))
+		if turn.Speaker != "" {
+			fmt.Fprintf(buf, "%s: ", speakerName(turn.Speaker))
+		}
+		fmt.Fprintf(buf, "%s\n\n", turn.Text)
+	}
+}
+
+type transcriptPageTurn struct {
+	Speaker string
+	Class   string
+	Offset  string
+	Text    string
+}
+
+type transcriptPageData struct {
+	SessionID string
+	Recorded  string
+	Redacted  bool
+	Turns     []transcriptPageTurn
+}
+
+// transcriptPage is a self-contained page meant for reading and printing.
+// The user and assistant have fixed colours; other speakers take the next
+// colour of the palette in order of appearance.
+var transcriptPage = template.Must(template.New("transcript").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Session {{.SessionID}}</title>
+<style>
+body { font-family: Georgia, "Times New Roman", serif; color: #222; line-height: 1.55; max-width: 44rem; margin: 2rem auto; padding: 0 1rem; }
+header { border-bottom: 1px solid #ccc; margin-bottom: 1.5rem; }
+header p { color: #666; margin-top: 0; }
+.turn { border-left: 4px solid #999; margin: 0 0 1rem; padding-left: .8rem; break-inside: avoid; }
+.turn p { margin: .2rem 0 0; white-space: pre-wrap; }
+.speaker { font-family: Helvetica, Arial, sans-serif; font-size: .8rem; font-weight: bold; letter-spacing: .04em; text-transform: uppercase; }
+.offset { color: #888; font-weight: normal; margin-left: .5rem; }
+.speaker-user { border-color: #2b6cb0; } .speaker-user .speaker { color: #2b6cb0; }
+.speaker-assistant { border-color: #2f855a; } .speaker-assistant .speaker { color: #2f855a; }
+.speaker-1 { border-color: #9c4221; } .speaker-1 .speaker { color: #9c4221; }
+.speaker-2 { border-color: #6b46c1; } .speaker-2 .speaker { color: #6b46c1; }
+.speaker-3 { border-color: #b7791f; } .speaker-3 .speaker { color: #b7791f; }
+.speaker-4 { border-color: #2c7a7b; } .speaker-4 .speaker { color: #2c7a7b; }
+@media print {
+  body { margin: 0; max-width: none; font-size: 11pt; }
+  .turn { border-left-width: 2px; }
+}
+</style>
+</head>
+<body>
+<header>
+<h1>Session {{.SessionID}}</h1>
+{{if .Recorded}}<p>{{.Recorded}}</p>{{end}}
+{{if .Redacted}}<p>Personal details have been redacted.</p>{{end}}
+</header>
+<main>
+{{range .Turns}}<section class="turn {{.Class}}">
+{{if .Speaker}}<div class="speaker">{{.Speaker}}{{if .Offset}}<span class="offset">{{.Offset}}</span>{{end}}</div>{{end}}
+<p>{{.Text}}</p>
+</section>
+{{end}}</main>
+</body>
+</html>
+`))
+
+func writeTranscriptHTML(buf *bytes.Buffer, t models.Transcript, recorded string, redacted bool) error {
+	data := transcriptPageData{SessionID: t.SessionID, Recorded: recorded, Redacted: redacted}
+	others := map[string]int{}
+	for _, turn := range t.Turns {
+		page := transcriptPageTurn{Speaker: speakerName(turn.Speaker), Text: turn.Text}
+		switch strings.ToLower(turn.Speaker) {
+		case "":
+		case "user", "assistant":
+			page.Class = "speaker-" + strings.ToLower(turn.Speaker)
+		default:
+			if _, ok := others[turn.Speaker]; !ok {
+				others[turn.Speaker] = len(others)%4 + 1
+			}
+			page.Class = fmt.Sprintf("speaker-%d", others[turn.Speaker])
+		}
+		if turn.StartMs != nil {
+			page.Offset = formatOffset(*turn.StartMs)
+		}
+		data.Turns = append(data.Turns, page)
+	}
+	return transcriptPage.Execute(buf, data)
+}
@@ -0,0 +1,212 @@
+package utils
+
+import (
+	"errors"
+	"mindful/backend-go/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+func ms(n int64) *int64 { return &n }
+
+func TestCaptionTime(t *testing.T) {
+	tests := []struct {
+		ms       int64
+		vtt, srt string
+	}{
+		{0, "00:00:00.000", "00:00:00,000"},
+		{1500, "00:00:01.500", "00:00:01,500"},
+		{59999, "00:00:59.999", "00:00:59,999"},
+		{3723456, "01:02:03.456", "01:02:03,456"},
+		{36000000, "10:00:00.000", "10:00:00,000"},
+	}
+	for _, tt := range tests {
+		if got := captionTime(tt.ms, "."); got != tt.vtt {
+			t.Errorf("captionTime(%d, \".\") = %q, want %q", tt.ms, got, tt.vtt)
+		}
+		if got := captionTime(tt.ms, ","); got != tt.srt {
+			t.Errorf("captionTime(%d, \",\") = %q, want %q", tt.ms, got, tt.srt)
+		}
+	}
+}
+
+func TestFormatOffset(t *testing.T) {
+	tests := []struct {
+		ms   int64
+		want string
+	}{
+		{0, "0:00"},
+		{999, "0:00"},
+		{65000, "1:05"},
+		{3599999, "59:59"},
+		{3723456, "1:02:03"},
+	}
+	for _, tt := range tests {
+		if got := formatOffset(tt.ms); got != tt.want {
+			t.Errorf("formatOffset(%d) = %q, want %q", tt.ms, got, tt.want)
+		}
+	}
+}
+
+// captionTranscript has a timed turn, a turn with only a start and a turn
+// without times, whose timings are estimated.
+var captionTranscript = models.Transcript{
+	SessionID: "s-->1",
+	Turns: []models.TranscriptTurn{
+		{Speaker: "Dr_Smith", Text: "Use <b> & stay", StartMs: ms(0), EndMs: ms(1500)},
+		{Speaker: "user", Text: "Okay --> fine", StartMs: ms(62000)},
+		{Text: "Bye."},
+	},
+}
+
+func TestExportTranscriptVTT(t *testing.T) {
+	data, err := ExportTranscript(captionTranscript, TranscriptFormatVTT, TranscriptExportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "WEBVTT\n\n" +
+		"NOTE Session s->1\n\n" +
+		"1\n00:00:00.000 --> 00:00:01.500\n<v Dr Smith>Use &lt;b&gt; &amp; stay\n\n" +
+		"2\n00:01:02.000 --> 00:01:03.200\n<v user>Okay --&gt; fine\n\n" +
+		"3\n00:01:03.200 --> 00:01:04.200\nBye.\n\n"
+	if string(data) != want {
+		t.Errorf("got\n%s\nwant\n%s", data, want)
+	}
+
+	// The export reads back as the same turns.
+	turns, err := parseCaptions(string(data), TranscriptFormatVTT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := describeTurns(turns)
+	wantTurns := "Dr_Smith|Use <b> & stay|0-1500\nuser|Okay --> fine Bye.|62000-64200"
+	if got != wantTurns {
+		t.Errorf("read back as\n%s\nwant\n%s", got, wantTurns)
+	}
+}
+
+func TestExportTranscriptSRT(t *testing.T) {
+	data, err := ExportTranscript(captionTranscript, TranscriptFormatSRT, TranscriptExportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "1\n00:00:00,000 --> 00:00:01,500\nDr Smith: Use <b> & stay\n\n" +
+		"2\n00:01:02,000 --> 00:01:03,200\nuser: Okay --> fine\n\n" +
+		"3\n00:01:03,200 --> 00:01:04,200\nBye.\n\n"
+	if string(data) != want {
+		t.Errorf("got\n%s\nwant\n%s", data, want)
+	}
+}
+
+func TestExportTranscriptHTMLEscapes(t *testing.T) {
+	transcript := models.Transcript{
+		SessionID: "<script>alert(1)</script>",
+		CreatedAt: "2024-03-31T09:30:00Z",
+		Turns: []models.TranscriptTurn{
+			{Speaker: "user", Text: `<img src=x onerror="alert(1)"> & more`, StartMs: ms(65000)},
+			{Speaker: "Eve<b>", Text: "Hi"},
+			{Speaker: "assistant", Text: "Hello"},
+			{Speaker: "Mallory", Text: "Hey"},
+		},
+	}
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+	data, err := ExportTranscript(transcript, TranscriptFormatHTML, TranscriptExportOptions{Location: berlin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := string(data)
+	for _, unwanted := range []string{"<script>", "<img", "Eve<b>"} {
+		if strings.Contains(page, unwanted) {
+			t.Errorf("page contains unescaped %q", unwanted)
+		}
+	}
+	for _, want := range []string{
+		"<title>Session &lt;script&gt;alert(1)&lt;/script&gt;</title>",
+		"<p>&lt;img src=x onerror=&#34;alert(1)&#34;&gt; &amp; more</p>",
+		`<section class="turn speaker-user">`,
+		`<span class="offset">1:05</span>`,
+		`<section class="turn speaker-1">` + "\n" + `<div class="speaker">Eve&lt;b&gt;</div>`,
+		`<section class="turn speaker-assistant">`,
+		`<section class="turn speaker-2">` + "\n" + `<div class="speaker">Mallory</div>`,
+		"<p>Recorded Sun 31 Mar 2024, 11:30 CEST</p>",
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("page is missing %q:\n%s", want, page)
+		}
+	}
+}
+
+func TestExportTranscriptMarkdownEscapes(t *testing.T) {
+	transcript := models.Transcript{
+		SessionID: "s_1",
+		Turns:     []models.TranscriptTurn{{Speaker: "user", Text: "*not bold* [link](x) # <b> | `code`"}},
+	}
+	data, err := ExportTranscript(transcript, TranscriptFormatMarkdown, TranscriptExportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# Session s\\_1\n\n**user**\n\n\\*not bold\\* \\[link\\](x) \\# \\<b\\> \\| \\`code\\`\n\n"
+	if string(data) != want {
+		t.Errorf("got\n%s\nwant\n%s", data, want)
+	}
+}
+
+func TestNegotiateTranscriptFormat(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", TranscriptFormatJSON},
+		{"text/vtt", TranscriptFormatVTT},
+		{"TEXT/VTT", TranscriptFormatVTT},
+		{"application/x-subrip; charset=utf-8", TranscriptFormatSRT},
+		{"text/html;q=0.5, text/markdown", TranscriptFormatMarkdown},
+		{"text/markdown;q=0.2, text/html;q=0.8", TranscriptFormatHTML},
+		{"text/plain, text/html", TranscriptFormatText},
+		{"text/html;level=1;q=0.9, text/vtt;q=0.4", TranscriptFormatHTML},
+		{"*/*", TranscriptFormatJSON},
+		{"text/*", TranscriptFormatText},
+		{"image/png, */*;q=0.1", TranscriptFormatJSON},
+		{"text/html;q=0, text/*;q=0.3", TranscriptFormatText},
+		{"text/vtt;q=oops", TranscriptFormatVTT},
+	}
+	for _, tt := range tests {
+		got, ok := NegotiateTranscriptFormat(tt.accept)
+		if !ok || got != tt.want {
+			t.Errorf("NegotiateTranscriptFormat(%q) = %q, %v, want %q", tt.accept, got, ok, tt.want)
+		}
+	}
+	for _, accept := range []string{"image/png", "application/pdf, image/*", "text/html;q=0", "*/*;q=0"} {
+		if got, ok := NegotiateTranscriptFormat(accept); ok {
+			t.Errorf("NegotiateTranscriptFormat(%q) = %q, want nothing acceptable", accept, got)
+		}
+	}
+}
+
+func TestTranscriptExportFormat(t *testing.T) {
+	tests := map[string]string{
+		"json":     TranscriptFormatJSON,
+		"md":       TranscriptFormatMarkdown,
+		" Plain ":  TranscriptFormatText,
+		"txt":      TranscriptFormatText,
+		"WebVTT":   TranscriptFormatVTT,
+		"srt":      TranscriptFormatSRT,
+		"html":     TranscriptFormatHTML,
+		"markdown": TranscriptFormatMarkdown,
+	}
+	for name, want := range tests {
+		if got, err := TranscriptExportFormat(name); err != nil || got != want {
+			t.Errorf("TranscriptExportFormat(%q) = %q, %v, want %q", name, got, err, want)
+		}
+	}
+	if _, err := TranscriptExportFormat("pdf"); !errors.Is(err, ErrUnsupportedTranscriptExport) {
+		t.Errorf("TranscriptExportFormat(pdf) = %v, want ErrUnsupportedTranscriptExport", err)
+	}
+	if got := TranscriptFilename(`a b/"c"`, TranscriptFormatSRT); got != "a_b_c_.srt" {
+		t.Errorf("TranscriptFilename = %q", got)
+	}
+}
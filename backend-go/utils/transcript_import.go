@@ -0,0 +1,517 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"mindful/backend-go/models"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Transcript formats accepted by ImportTranscripts.
+const (
+	TranscriptFormatVTT   = "vtt"
+	TranscriptFormatSRT   = "srt"
+	TranscriptFormatPlain = "plain"
+	TranscriptFormatHume  = "hume"
+)
+
+const (
+	ImportStatusImported = "imported"
+	ImportStatusSkipped  = "skipped"
+	ImportStatusFailed   = "failed"
+)
+
+var ErrUnknownTranscriptFormat = errors.New("unknown transcript format")
+
+// TranscriptUpload is one file to import. Format is detected from the file
+// name and content when empty; SessionID overrides the session ID of a file
+// holding a single session.
+type TranscriptUpload struct {
+	Filename  string `json:"filename"`
+	Format    string `json:"format"`
+	SessionID string `json:"session_id"`
+	Content   []byte `json:"-"`
+}
+
+// TranscriptImportItem is the outcome for one session found in a file.
+type TranscriptImportItem struct {
+	SessionID    string `json:"session_id"`
+	Status       string `json:"status"`
+	TranscriptID int    `json:"transcript_id,omitempty"`
+	Turns        int    `json:"turns,omitempty"`
+	Reason       string `json:"reason,omitempty"`
+}
+
+// TranscriptFileReport sums up one file. Error is set when the file could
+// not be parsed at all, which counts as one failure.
+type TranscriptFileReport struct {
+	Filename string                 `json:"filename"`
+	Format   string                 `json:"format,omitempty"`
+	Imported int                    `json:"imported"`
+	Skipped  int                    `json:"skipped"`
+	Failed   int                    `json:"failed"`
+	Error    string                 `json:"error,omitempty"`
+	Items    []TranscriptImportItem `json:"items"`
+}
+
+type TranscriptImportReport struct {
+	Imported int                    `json:"imported"`
+	Skipped  int                    `json:"skipped"`
+	Failed   int                    `json:"failed"`
+	Files    []TranscriptFileReport `json:"files"`
+}
+
+// parsedSession is a session read from a file. SessionID is only set by
+// formats that carry one, such as Hume chat IDs.
+type parsedSession struct {
+	SessionID string
+	Turns     []models.TranscriptTurn
+}
+
+// DetectTranscriptFormat guesses a file's format from its extension, then
+// from its content.
+func DetectTranscriptFormat(filename string, data []byte) string {
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".vtt":
+		return TranscriptFormatVTT
+	case ".srt":
+		return TranscriptFormatSRT
+	case ".json":
+		return TranscriptFormatHume
+	case ".txt", ".log", ".md":
+		return TranscriptFormatPlain
+	}
+	trimmed := bytes.TrimSpace(bytes.TrimPrefix(data, []byte("\ufeff")))
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("WEBVTT")):
+		return TranscriptFormatVTT
+	case bytes.HasPrefix(trimmed, []byte("{")), bytes.HasPrefix(trimmed, []byte("[")):
+		return TranscriptFormatHume
+	case bytes.Contains(trimmed, []byte("-->")):
+		return TranscriptFormatSRT
+	}
+	return TranscriptFormatPlain
+}
+
+func parseTranscriptFile(format string, data []byte) ([]parsedSession, error) {
+	text := strings.ReplaceAll(strings.TrimPrefix(string(data), "\ufeff"), "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+	switch format {
+	case TranscriptFormatVTT, TranscriptFormatSRT:
+		turns, err := parseCaptions(text, format)
+		return []parsedSession{{Turns: turns}}, err
+	case TranscriptFormatPlain:
+		return []parsedSession{{Turns: parsePlainTranscript(text)}}, nil
+	case TranscriptFormatHume:
+		return parseHumeChats(data)
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnknownTranscriptFormat, format)
+}
+
+var (
+	cueTiming      = regexp.MustCompile(`^\s*((?:\d+:)?\d{1,2}:\d{2}[.,]\d{1,3})\s*-->\s*((?:\d+:)?\d{1,2}:\d{2}[.,]\d{1,3})`)
+	cueVoice       = regexp.MustCompile(`<v(?:\.[^\s>]*)?\s+([^>]+)>`)
+	cueTag         = regexp.MustCompile(`<[^>]*>`)
+	blankLines     = regexp.MustCompile(`\n[ \t]*\n`)
+	bracketSpeaker = regexp.MustCompile(`^\[([^\]]{1,40})\]\s*`)
+	prefixSpeaker  = regexp.MustCompile(`^([\p{L}][\p{L}\p{N}_.'’-]*(?: [\p{Lu}][\p{L}\p{N}_.'’-]*){0,2}):\s+`)
+	plainTimestamp = regexp.MustCompile(`^[\[(]?((?:\d+:)?\d{1,2}:\d{2}(?:[.,]\d{1,3})?)[\])]?\s*(?:[-–]\s+)?`)
+)
+
+// parseCueTime parses "01:02:03.456", "02:03.456" or the SRT form
+// "01:02:03,456" into milliseconds.
+func parseCueTime(s string) (int64, error) {
+	clock, frac, _ := strings.Cut(strings.Replace(s, ",", ".", 1), ".")
+	var ms int64
+	for _, part := range strings.Split(clock, ":") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return 0, err
+		}
+		ms = ms*60 + int64(n)
+	}
+	ms *= 1000
+	if frac != "" {
+		frac = (frac + "00")[:3]
+		n, err := strconv.Atoi(frac)
+		if err != nil {
+			return 0, err
+		}
+		ms += int64(n)
+	}
+	return ms, nil
+}
+
+// cueSpeaker splits a caption into speaker and text. WebVTT voice tags win;
+// otherwise "[Name]" and "Name:" prefixes are recognized.
+func cueSpeaker(raw string) (speaker, text string) {
+	if m := cueVoice.FindStringSubmatch(raw); m != nil {
+		speaker = strings.TrimSpace(m[1])
+	}
+	text = html.UnescapeString(cueTag.ReplaceAllString(raw, ""))
+	text = strings.Join(strings.Fields(text), " ")
+	text = strings.TrimSpace(strings.TrimPrefix(text, ">>"))
+	if speaker != "" {
+		return speaker, text
+	}
+	if m := bracketSpeaker.FindStringSubmatch(text); m != nil {
+		return strings.TrimSpace(m[1]), text[len(m[0]):]
+	}
+	if m := prefixSpeaker.FindStringSubmatch(text); m != nil {
+		return m[1], text[len(m[0]):]
+	}
+	return "", text
+}
+
+// parseCaptions reads WebVTT or SRT cues and merges consecutive cues of the
+// same speaker into one turn. Cues without a speaker continue the previous
+// one, as captions usually split a speaker's sentences across cues.
+func parseCaptions(text, format string) ([]models.TranscriptTurn, error) {
+	var turns []models.TranscriptTurn
+	cues := 0
+	for _, block := range blankLines.Split(text, -1) {
+		lines := strings.Split(strings.Trim(block, "\n"), "\n")
+		timing := -1
+		for i, line := range lines {
+			if strings.Contains(line, "-->") {
+				timing = i
+				break
+			}
+		}
+		// Headers, NOTE, STYLE and REGION blocks have no timing line.
+		if timing < 0 {
+			continue
+		}
+		m := cueTiming.FindStringSubmatch(lines[timing])
+		if m == nil {
+			return nil, fmt.Errorf("invalid cue timing %q", strings.TrimSpace(lines[timing]))
+		}
+		start, err := parseCueTime(m[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid cue timing %q", strings.TrimSpace(lines[timing]))
+		}
+		end, err := parseCueTime(m[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid cue timing %q", strings.TrimSpace(lines[timing]))
+		}
+		cues++
+
+		speaker, body := cueSpeaker(strings.Join(lines[timing+1:], "\n"))
+		if body == "" {
+			continue
+		}
+		speaker = models.SpeakerLabel(speaker)
+		if n := len(turns); n > 0 && (speaker == "" || speaker == turns[n-1].Speaker) {
+			last := &turns[n-1]
+			last.Text += " " + body
+			if end > *last.EndMs {
+				last.EndMs = &end
+			}
+			continue
+		}
+		turns = append(turns, models.TranscriptTurn{Speaker: speaker, Text: body, StartMs: &start, EndMs: &end})
+	}
+	if cues == 0 {
+		return nil, fmt.Errorf("no %s cues found", strings.ToUpper(format))
+	}
+	return turns, nil
+}
+
+// parsePlainTranscript reads "Speaker: text" lines, optionally starting
+// with a timestamp such as "[00:01:05]". Each timestamp also ends the turn
+// before it.
+func parsePlainTranscript(text string) []models.TranscriptTurn {
+	var turns []models.TranscriptTurn
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		var start *int64
+		if m := plainTimestamp.FindStringSubmatch(line); m != nil && m[0] != "" {
+			if ms, err := parseCueTime(m[1]); err == nil {
+				start = &ms
+				line = strings.TrimSpace(line[len(m[0]):])
+			}
+		}
+		if line == "" {
+			continue
+		}
+		speaker, body := "", line
+		if m := prefixSpeaker.FindStringSubmatch(line); m != nil {
+			speaker, body = m[1], line[len(m[0]):]
+		} else if parsed := models.SplitTranscriptTurns(line); parsed[0].Speaker != "" {
+			speaker, body = parsed[0].Speaker, parsed[0].Text
+		}
+		if speaker != "" || len(turns) == 0 {
+			if n := len(turns); n > 0 && start != nil && turns[n-1].EndMs == nil {
+				turns[n-1].EndMs = start
+			}
+			turns = append(turns, models.TranscriptTurn{Speaker: models.SpeakerLabel(speaker), Text: body, StartMs: start})
+			continue
+		}
+		turns[len(turns)-1].Text += " " + line
+	}
+	return turns
+}
+
+// humeEvent and humeChat follow the chat history returned by Hume's EVI
+// API (GET /v0/evi/chats/{id}): events carry epoch-millisecond timestamps.
+type humeEvent struct {
+	ChatID      string `json:"chat_id"`
+	Timestamp   int64  `json:"timestamp"`
+	Role        string `json:"role"`
+	Type        string `json:"type"`
+	MessageText string `json:"message_text"`
+	// EmotionFeatures holds the prosody scores of a user message, as a JSON
+	// object encoded in a string.
+	EmotionFeatures json.RawMessage `json:"emotion_features"`
+}
+
+// humeEmotionFeatures reads an event's prosody scores, whether encoded in a
+// string as the chat history API returns them or given as an object.
+func humeEmotionFeatures(raw json.RawMessage) map[string]float64 {
+	var encoded string
+	if err := json.Unmarshal(raw, &encoded); err == nil {
+		raw = json.RawMessage(encoded)
+	}
+	var scores map[string]float64
+	if err := json.Unmarshal(raw, &scores); err != nil {
+		return nil
+	}
+	return scores
+}
+
+type humeChat struct {
+	ID             string      `json:"id"`
+	StartTimestamp int64       `json:"start_timestamp"`
+	EndTimestamp   int64       `json:"end_timestamp"`
+	EventsPage     []humeEvent `json:"events_page"`
+}
+
+// parseHumeChats reads one chat, an array of chats (for example several
+// pages of the same chat) or a bare array of events. Pages of a chat are
+// joined by chat ID.
+func parseHumeChats(data []byte) ([]parsedSession, error) {
+	var chats []humeChat
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("[")) {
+		var items []json.RawMessage
+		if err := json.Unmarshal(trimmed, &items); err != nil {
+			return nil, fmt.Errorf("invalid Hume chat history: %v", err)
+		}
+		var events []humeEvent
+		for _, item := range items {
+			var probe map[string]json.RawMessage
+			if err := json.Unmarshal(item, &probe); err != nil {
+				return nil, fmt.Errorf("invalid Hume chat history: %v", err)
+			}
+			if _, ok := probe["events_page"]; ok {
+				var c humeChat
+				if err := json.Unmarshal(item, &c); err != nil {
+					return nil, fmt.Errorf("invalid Hume chat history: %v", err)
+				}
+				chats = append(chats, c)
+				continue
+			}
+			var e humeEvent
+			if err := json.Unmarshal(item, &e); err != nil {
+				return nil, fmt.Errorf("invalid Hume chat event: %v", err)
+			}
+			events = append(events, e)
+		}
+		if len(events) > 0 {
+			chats = append(chats, humeChat{EventsPage: events})
+		}
+	} else {
+		var c humeChat
+		if err := json.Unmarshal(trimmed, &c); err != nil {
+			return nil, fmt.Errorf("invalid Hume chat history: %v", err)
+		}
+		if c.EventsPage == nil {
+			return nil, errors.New("invalid Hume chat history: no events_page")
+		}
+		chats = append(chats, c)
+	}
+
+	var order []string
+	byID := map[string]*humeChat{}
+	for _, c := range chats {
+		if c.ID == "" && len(c.EventsPage) > 0 {
+			c.ID = c.EventsPage[0].ChatID
+		}
+		if existing, ok := byID[c.ID]; ok {
+			existing.EventsPage = append(existing.EventsPage, c.EventsPage...)
+			if c.StartTimestamp != 0 && (existing.StartTimestamp == 0 || c.StartTimestamp < existing.StartTimestamp) {
+				existing.StartTimestamp = c.StartTimestamp
+			}
+			if c.EndTimestamp > existing.EndTimestamp {
+				existing.EndTimestamp = c.EndTimestamp
+			}
+			continue
+		}
+		chat := c
+		byID[c.ID] = &chat
+		order = append(order, c.ID)
+	}
+
+	var sessions []parsedSession
+	for _, id := range order {
+		sessions = append(sessions, parsedSession{SessionID: id, Turns: humeTurns(*byID[id])})
+	}
+	return sessions, nil
+}
+
+func humeTurns(c humeChat) []models.TranscriptTurn {
+	events := c.EventsPage
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Timestamp < events[j].Timestamp })
+	origin := c.StartTimestamp
+	if origin == 0 && len(events) > 0 {
+		origin = events[0].Timestamp
+	}
+
+	var turns []models.TranscriptTurn
+	// merged counts the messages whose scores were averaged into each turn.
+	var merged []int
+	for i, e := range events {
+		var speaker string
+		switch {
+		case e.Type == "USER_MESSAGE" || e.Type == "" && strings.EqualFold(e.Role, "user"):
+			speaker = "user"
+		case e.Type == "AGENT_MESSAGE" || e.Type == "" && strings.EqualFold(e.Role, "agent"):
+			speaker = "assistant"
+		default:
+			continue
+		}
+		text := strings.Join(strings.Fields(e.MessageText), " ")
+		if text == "" {
+			continue
+		}
+		start := e.Timestamp - origin
+		// Events have no duration; a message lasts until the next event.
+		var end *int64
+		if i+1 < len(events) {
+			ms := events[i+1].Timestamp - origin
+			end = &ms
+		} else if c.EndTimestamp >= e.Timestamp {
+			ms := c.EndTimestamp - origin
+			end = &ms
+		}
+		scores := humeEmotionFeatures(e.EmotionFeatures)
+
+		if n := len(turns); n > 0 && turns[n-1].Speaker == speaker {
+			turns[n-1].Text += " " + text
+			if end != nil {
+				turns[n-1].EndMs = end
+			}
+			if len(scores) > 0 {
+				turns[n-1].Prosody = averageScores(turns[n-1].Prosody, merged[n-1], scores)
+				merged[n-1]++
+			}
+			continue
+		}
+		turn := models.TranscriptTurn{Speaker: speaker, Text: text, StartMs: &start, EndMs: end}
+		count := 0
+		if len(scores) > 0 {
+			turn.Prosody = scores
+			count = 1
+		}
+		turns = append(turns, turn)
+		merged = append(merged, count)
+	}
+	return turns
+}
+
+// importSessionID picks a session ID for a parsed session: the file's own,
+// then the one given with the upload, then the file name, and finally a
+// hash of the content, so re-importing an unnamed file is still detected.
+func importSessionID(s parsedSession, u TranscriptUpload, sessions int) string {
+	if u.SessionID != "" && sessions == 1 {
+		return u.SessionID
+	}
+	if s.SessionID != "" {
+		return s.SessionID
+	}
+	base := path.Base(strings.ReplaceAll(u.Filename, "\\", "/"))
+	if base = strings.TrimSuffix(base, path.Ext(base)); base != "" && base != "." && base != "/" {
+		return base
+	}
+	sum := sha256.Sum256(u.Content)
+	return "import-" + hex.EncodeToString(sum[:6])
+}
+
+// ImportTranscripts parses each upload and stores every session in it as a
+// transcript with timed turns, skipping session IDs that already exist.
+// userSpeaker names the speaker who is the user, whose turns are labelled
+// "user" so distortion detection and search treat them as the user's.
+func ImportTranscripts(uploads []TranscriptUpload, userSpeaker string) TranscriptImportReport {
+	report := TranscriptImportReport{Files: []TranscriptFileReport{}}
+	userLabel := models.SpeakerLabel(userSpeaker)
+	seen := map[string]bool{}
+
+	for _, u := range uploads {
+		file := TranscriptFileReport{Filename: u.Filename, Format: strings.ToLower(u.Format), Items: []TranscriptImportItem{}}
+		if file.Format == "" {
+			file.Format = DetectTranscriptFormat(u.Filename, u.Content)
+		}
+		sessions, err := parseTranscriptFile(file.Format, u.Content)
+		if err != nil {
+			file.Error = err.Error()
+			file.Failed = 1
+			report.Failed++
+			report.Files = append(report.Files, file)
+			continue
+		}
+
+		for _, s := range sessions {
+			item := TranscriptImportItem{SessionID: importSessionID(s, u, len(sessions))}
+			for i := range s.Turns {
+				if userLabel != "" && strings.EqualFold(s.Turns[i].Speaker, userLabel) {
+					s.Turns[i].Speaker = "user"
+				}
+			}
+			exists, err := models.TranscriptSessionExists(item.SessionID)
+			switch {
+			case err != nil:
+				log.Printf("Error checking session %q: %v", item.SessionID, err)
+				item.Status, item.Reason = ImportStatusFailed, "could not check for an existing session"
+			case exists || seen[item.SessionID]:
+				item.Status, item.Reason = ImportStatusSkipped, "session_id already exists"
+			case len(s.Turns) == 0:
+				item.Status, item.Reason = ImportStatusSkipped, "no speech found"
+			default:
+				t, err := models.ImportTranscript(item.SessionID, file.Format, s.Turns)
+				if err != nil {
+					log.Printf("Error importing session %q: %v", item.SessionID, err)
+					item.Status, item.Reason = ImportStatusFailed, "could not store transcript"
+					break
+				}
+				item.Status, item.TranscriptID, item.Turns = ImportStatusImported, t.ID, len(t.Turns)
+				seen[item.SessionID] = true
+				AnalyzeTranscriptDistortionsAsync(t)
+			}
+
+			switch item.Status {
+			case ImportStatusImported:
+				file.Imported++
+			case ImportStatusSkipped:
+				file.Skipped++
+			default:
+				file.Failed++
+			}
+			file.Items = append(file.Items, item)
+		}
+		report.Imported += file.Imported
+		report.Skipped += file.Skipped
+		report.Failed += file.Failed
+		report.Files = append(report.Files, file)
+	}
+	return report
+}
@@ -0,0 +1,315 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"mindful/backend-go/models"
+	"strings"
+	"testing"
+)
+
+// describeTurns renders turns as "speaker|text|start-end" lines, with "-"
+// for a missing time, so expectations can be written as plain strings.
+func describeTurns(turns []models.TranscriptTurn) string {
+	ms := func(p *int64) string {
+		if p == nil {
+			return "-"
+		}
+		return fmt.Sprint(*p)
+	}
+	lines := make([]string, len(turns))
+	for i, t := range turns {
+		lines[i] = fmt.Sprintf("%s|%s|%s-%s", t.Speaker, t.Text, ms(t.StartMs), ms(t.EndMs))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestParseCueTime(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		{"01:02:03.456", 3723456},
+		{"02:03.456", 123456},
+		{"01:02:03,456", 3723456},
+		{"00:00:01.5", 1500},
+		{"00:00:01,25", 1250},
+		{"1:00:00.000", 3600000},
+		{"00:00:07", 7000},
+	}
+	for _, tt := range tests {
+		got, err := parseCueTime(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("parseCueTime(%q) = %d, %v, want %d", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{"aa:00.000", "00:00.x", "00::01.000"} {
+		if got, err := parseCueTime(in); err == nil {
+			t.Errorf("parseCueTime(%q) = %d, want an error", in, got)
+		}
+	}
+}
+
+func TestParseCaptions(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		in     string
+		want   string
+	}{
+		{
+			name:   "webvtt voice tags with note and style blocks",
+			format: TranscriptFormatVTT,
+			in: `WEBVTT
+
+STYLE
+::cue { color: white }
+
+NOTE Speakers were labelled by hand,
+and the last cue has no voice tag.
+
+1
+00:00:01.000 --> 00:00:04.000
+<v Dr. Smith>How have you been sleeping?</v>
+
+00:00:04.500 --> 00:00:06.000 align:start
+<v.loud Sam Lee>Not great,
+honestly.
+
+00:00:06.000 --> 00:00:08.250
+<i>I wake at four &amp; stay up.</i>
+`,
+			want: "Dr._Smith|How have you been sleeping?|1000-4000\n" +
+				"Sam_Lee|Not great, honestly. I wake at four & stay up.|4500-8250",
+		},
+		{
+			name:   "srt with comma milliseconds",
+			format: TranscriptFormatSRT,
+			in: `1
+00:00:01,500 --> 00:00:03,000
+Therapist: Hello there.
+
+2
+00:01:02,5 --> 00:01:04,25
+[Client] Hi.
+`,
+			want: "Therapist|Hello there.|1500-3000\n" +
+				"Client|Hi.|62500-64250",
+		},
+		{
+			name:   "speakerless cues continue the previous speaker",
+			format: TranscriptFormatSRT,
+			in: `1
+00:00:01,000 --> 00:00:02,000
+Anna: I started running.
+
+2
+00:00:02,000 --> 00:00:03,000
+Every morning,
+
+3
+00:00:03,000 --> 00:00:04,000
+
+4
+00:00:04,000 --> 00:00:05,000
+Anna: before work.
+
+5
+00:00:05,000 --> 00:00:06,000
+Ben: That's great.
+`,
+			want: "Anna|I started running. Every morning, before work.|1000-5000\n" +
+				"Ben|That's great.|5000-6000",
+		},
+		{
+			name:   "leading speakerless cues form one turn",
+			format: TranscriptFormatVTT,
+			in: `WEBVTT
+
+00:00.000 --> 00:02.000
+Hello.
+
+00:02.000 --> 00:03.000
+>> Is this on?
+`,
+			want: "|Hello. Is this on?|0-3000",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			turns, err := parseCaptions(tt.in, tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := describeTurns(turns); got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCaptionsErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		in     string
+		want   string
+	}{
+		{
+			name:   "malformed timing line",
+			format: TranscriptFormatSRT,
+			in:     "1\n00:00:01,000 --> 00:00:02,000\nHi.\n\n2\n00:00:02 --> 00:00:03\nThere.\n",
+			want:   `invalid cue timing "00:00:02 --> 00:00:03"`,
+		},
+		{
+			name:   "no cues",
+			format: TranscriptFormatVTT,
+			in:     "WEBVTT\n\nNOTE nothing was said\n",
+			want:   "no VTT cues found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			turns, err := parseCaptions(tt.in, tt.format)
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("parseCaptions = %v, %v, want error %q", turns, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePlainTranscript(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "timestamped speaker lines",
+			in: "[00:01:05] Dr Smith: How are you?\n" +
+				"[00:01:10] Sam: Tired.\n" +
+				"I keep waking up.\n" +
+				"\n" +
+				"(00:01:30) - Dr Smith: Why do you think that is?\n",
+			want: "Dr_Smith|How are you?|65000-70000\n" +
+				"Sam|Tired. I keep waking up.|70000-90000\n" +
+				"Dr_Smith|Why do you think that is?|90000--",
+		},
+		{
+			name: "short timestamps",
+			in:   "1:05 Sam: Hi.\n2:00.5 Alex: Hello.",
+			want: "Sam|Hi.|65000-120500\nAlex|Hello.|120500--",
+		},
+		{
+			name: "speaker lines without timestamps",
+			in:   "user: I feel stuck.\nassistant: Stuck how?",
+			want: "user|I feel stuck.|---\nassistant|Stuck how?|---",
+		},
+		{
+			name: "no speakers",
+			in:   "Just a note to myself.\nNothing more.",
+			want: "|Just a note to myself. Nothing more.|---",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := describeTurns(parsePlainTranscript(tt.in)); got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseHumeChats(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		// want maps each session ID, in order, to its turns.
+		want []string
+	}{
+		{
+			name: "single chat",
+			in: `{"id": "c1", "start_timestamp": 1000, "end_timestamp": 10000, "events_page": [
+				{"chat_id": "c1", "timestamp": 5000, "role": "AGENT", "type": "AGENT_MESSAGE", "message_text": "Tell me more."},
+				{"chat_id": "c1", "timestamp": 2000, "role": "USER", "type": "USER_MESSAGE", "message_text": "I'm  tired"},
+				{"chat_id": "c1", "timestamp": 3000, "role": "USER", "type": "USER_MESSAGE", "message_text": "all the time."},
+				{"chat_id": "c1", "timestamp": 6000, "role": "SYSTEM", "type": "SYSTEM_PROMPT", "message_text": "Be kind."}
+			]}`,
+			want: []string{"c1", "user|I'm tired all the time.|1000-4000\nassistant|Tell me more.|4000-5000"},
+		},
+		{
+			name: "pages joined by chat id",
+			in: `[
+				{"id": "c1", "start_timestamp": 1000, "events_page": [
+					{"chat_id": "c1", "timestamp": 1000, "type": "USER_MESSAGE", "message_text": "Hello."}
+				]},
+				{"id": "c2", "start_timestamp": 500, "end_timestamp": 900, "events_page": [
+					{"chat_id": "c2", "timestamp": 600, "type": "USER_MESSAGE", "message_text": "Other chat."}
+				]},
+				{"id": "c1", "end_timestamp": 4000, "events_page": [
+					{"chat_id": "c1", "timestamp": 3000, "type": "AGENT_MESSAGE", "message_text": "Hi."}
+				]}
+			]`,
+			want: []string{
+				"c1", "user|Hello.|0-2000\nassistant|Hi.|2000-3000",
+				"c2", "user|Other chat.|100-400",
+			},
+		},
+		{
+			name: "bare array of events",
+			in: `[
+				{"chat_id": "c3", "timestamp": 100, "role": "user", "message_text": "Hi."},
+				{"chat_id": "c3", "timestamp": 400, "role": "agent", "message_text": "Hello."}
+			]`,
+			want: []string{"c3", "user|Hi.|0-300\nassistant|Hello.|300--"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessions, err := parseHumeChats([]byte(tt.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, s := range sessions {
+				got = append(got, s.SessionID, describeTurns(s.Turns))
+			}
+			if strings.Join(got, "\n\n") != strings.Join(tt.want, "\n\n") {
+				t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n\n"), strings.Join(tt.want, "\n\n"))
+			}
+		})
+	}
+}
+
+func TestParseHumeChatsAveragesProsody(t *testing.T) {
+	in := `{"id": "c1", "events_page": [
+		{"timestamp": 1000, "type": "USER_MESSAGE", "message_text": "I'm tired.", "emotion_features": "{\"Tiredness\": 0.8, \"Calmness\": 0.2}"},
+		{"timestamp": 2000, "type": "USER_MESSAGE", "message_text": "Really tired.", "emotion_features": {"Tiredness": 0.4}},
+		{"timestamp": 3000, "type": "USER_MESSAGE", "message_text": "Anyway."}
+	]}`
+	sessions, err := parseHumeChats([]byte(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || len(sessions[0].Turns) != 1 {
+		t.Fatalf("sessions = %+v, want one turn", sessions)
+	}
+	prosody := sessions[0].Turns[0].Prosody
+	want := map[string]float64{"Tiredness": 0.6, "Calmness": 0.1}
+	if len(prosody) != len(want) {
+		t.Fatalf("prosody = %v, want %v", prosody, want)
+	}
+	for name, score := range want {
+		if math.Abs(prosody[name]-score) > 1e-9 {
+			t.Errorf("prosody[%s] = %v, want %v", name, prosody[name], score)
+		}
+	}
+}
+
+func TestParseHumeChatsErrors(t *testing.T) {
+	for _, in := range []string{`{"id": "c1"}`, `{"id": `, `[1, 2]`, `[{"events_page": "none"}]`} {
+		if sessions, err := parseHumeChats([]byte(in)); err == nil {
+			t.Errorf("parseHumeChats(%s) = %+v, want an error", in, sessions)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"mindful/backend-go/models"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// transcriptionMaxAttempts is how often a job is tried before it is
+	// marked failed; failures that retrying can't fix end it at once.
+	transcriptionMaxAttempts = 3
+	transcriptionBackoff     = 5 * time.Minute
+	// transcriptionLease reserves a claimed job for one attempt; it must
+	// outlast the whisper client timeout.
+	transcriptionLease = 30 * time.Minute
+	// SourceSpeechToText marks transcripts produced from session audio.
+	SourceSpeechToText = "stt"
+)
+
+var (
+	ErrTranscriptExists = errors.New("session already has a transcript; set replace to transcribe it again")
+	errNoSpeech         = errors.New("no speech found in the recording")
+)
+
+// transcriptionWake lets a newly queued job start without waiting for the
+// worker's next tick.
+var transcriptionWake = make(chan struct{}, 1)
+
+// QueueTranscription queues a transcription of a session's completed
+// recording and wakes the worker.
+func QueueTranscription(job models.TranscriptionJob) (models.TranscriptionJob, error) {
+	audio, err := models.GetSessionAudio(job.SessionID)
+	if err != nil {
+		return models.TranscriptionJob{}, err
+	}
+	if audio.Status != models.AudioStatusComplete {
+		return models.TranscriptionJob{}, models.ErrAudioIncomplete
+	}
+	if !job.Replace {
+		exists, err := models.TranscriptSessionExists(job.SessionID)
+		if err != nil {
+			return models.TranscriptionJob{}, err
+		}
+		if exists {
+			return models.TranscriptionJob{}, ErrTranscriptExists
+		}
+	}
+	job, err = models.QueueTranscriptionJob(job, time.Now())
+	if err != nil {
+		return models.TranscriptionJob{}, err
+	}
+	select {
+	case transcriptionWake <- struct{}{}:
+	default:
+	}
+	return job, nil
+}
+
+// QueueAutoTranscription queues a transcription with default options once
+// a session's upload completes, unless AUTO_TRANSCRIBE is "false", the
+// session was transcribed or queued before, or it already has a transcript.
+func QueueAutoTranscription(sessionID string) {
+	if os.Getenv("AUTO_TRANSCRIBE") == "false" {
+		return
+	}
+	jobs, err := models.ListTranscriptionJobs(sessionID)
+	if err != nil {
+		log.Printf("Error listing transcription jobs for session %s: %v", sessionID, err)
+		return
+	}
+	if len(jobs) > 0 {
+		return
+	}
+	_, err = QueueTranscription(models.TranscriptionJob{SessionID: sessionID})
+	if err != nil && !errors.Is(err, ErrTranscriptExists) {
+		log.Printf("Error queueing transcription for session %s: %v", sessionID, err)
+	}
+}
+
+// StartTranscriptionWorker runs due transcription jobs one at a time, every
+// interval or as soon as one is queued, until the process exits. Jobs left
+// running by a restart are retried once their lease runs out.
+func StartTranscriptionWorker(interval time.Duration, store BlobStore, transcriber Transcriber) {
+	go func() {
+		for {
+			RunDueTranscriptionJobs(context.Background(), store, transcriber, time.Now())
+			select {
+			case <-transcriptionWake:
+			case <-time.After(interval):
+			}
+		}
+	}()
+}
+
+// RunDueTranscriptionJobs runs every transcription job due at now.
+func RunDueTranscriptionJobs(ctx context.Context, store BlobStore, transcriber Transcriber, now time.Time) {
+	due, err := models.DueTranscriptionJobs(now, 20)
+	if err != nil {
+		log.Printf("Error loading due transcription jobs: %v", err)
+		return
+	}
+	for _, job := range due {
+		RunTranscriptionJob(ctx, store, transcriber, job, now)
+	}
+}
+
+// RunTranscriptionJob makes one attempt at a job and records the outcome.
+// Jobs another worker has claimed are left alone.
+func RunTranscriptionJob(ctx context.Context, store BlobStore, transcriber Transcriber, job models.TranscriptionJob, now time.Time) {
+	claimed, err := models.ClaimTranscriptionJob(job.ID, now, transcriptionLease)
+	if err != nil {
+		log.Printf("Error claiming transcription job %d: %v", job.ID, err)
+		return
+	}
+	if !claimed {
+		return
+	}
+	log.Printf("Running transcription job %d for session %s with %s", job.ID, job.SessionID, transcriber.Name())
+
+	ctx, cancel := context.WithTimeout(ctx, transcriptionLease-time.Minute)
+	defer cancel()
+	t, err := transcribeSession(ctx, store, transcriber, job)
+	if err != nil {
+		var retryAt time.Time
+		if job.Attempts+1 < transcriptionMaxAttempts && retryableTranscription(err) {
+			retryAt = time.Now().Add(transcriptionBackoff * time.Duration(job.Attempts+1))
+		}
+		log.Printf("Transcription job %d for session %s failed: %v", job.ID, job.SessionID, err)
+		if err := models.FailTranscriptionJob(job.ID, err.Error(), retryAt, time.Now()); err != nil {
+			log.Printf("Error recording transcription job %d: %v", job.ID, err)
+		}
+		return
+	}
+	if err := models.CompleteTranscriptionJob(job.ID, t.ID, time.Now()); err != nil {
+		log.Printf("Error recording transcription job %d: %v", job.ID, err)
+	}
+	processSessionTranscript(t)
+}
+
+// processSessionTranscript runs what follows a completed session: the
+// transcript is checked for distortions and safety risks, the session is
+// summarized, which embeds it, and it is announced with session.completed.
+func processSessionTranscript(t models.Transcript) {
+	AnalyzeTranscriptDistortionsAsync(t)
+	SummarizeSessionAsync(t.SessionID)
+	EmitEvent(models.EventSessionCompleted, map[string]interface{}{
+		"transcript_id": t.ID,
+		"session_id":    t.SessionID,
+		"turns":         len(t.Turns),
+	})
+	FlagTranscriptSafety(t)
+}
+
+// retryableTranscription reports whether a failure may go away on its own,
+// such as the speech-to-text server being down.
+func retryableTranscription(err error) bool {
+	return !errors.Is(err, models.ErrNotFound) && !errors.Is(err, models.ErrAudioIncomplete) &&
+		!errors.Is(err, ErrTranscriptExists) && !errors.Is(err, errNoSpeech)
+}
+
+func transcribeSession(ctx context.Context, store BlobStore, transcriber Transcriber, job models.TranscriptionJob) (models.Transcript, error) {
+	exists, err := models.TranscriptSessionExists(job.SessionID)
+	if err != nil {
+		return models.Transcript{}, err
+	}
+	if exists && !job.Replace {
+		return models.Transcript{}, ErrTranscriptExists
+	}
+
+	audio, content, err := OpenSessionAudio(ctx, store, job.SessionID)
+	if err != nil {
+		return models.Transcript{}, fmt.Errorf("opening recording: %w", err)
+	}
+	segments, err := transcriber.Transcribe(ctx, content, audio.ContentType, TranscribeOptions{
+		Language: job.Language,
+		Diarize:  job.Diarize,
+	})
+	content.Close()
+	if err != nil {
+		return models.Transcript{}, err
+	}
+
+	turns := SegmentTurns(segments, job.Diarize, job.UserSpeaker)
+	if len(turns) == 0 {
+		return models.Transcript{}, errNoSpeech
+	}
+	action, write := "create", models.ImportTranscript
+	if exists {
+		action, write = "update", models.ReplaceTranscript
+	}
+	t, err := write(job.SessionID, SourceSpeechToText, turns)
+	if err != nil {
+		return models.Transcript{}, err
+	}
+	auditSystemWrite("transcription", action, "transcript", t.ID)
+	return t, nil
+}
+
+var (
+	// nonSpeechTag matches markers such as [BLANK_AUDIO] or [MUSIC] that
+	// whisper writes in place of speech.
+	nonSpeechTag = regexp.MustCompile(`\[[A-Z_ ]+\]`)
+	// soundOnly matches segments that just describe a sound, like "(wind
+	// blowing)" or "* music *".
+	soundOnly = regexp.MustCompile(`^(?:\([^)]*\)|\*[^*]*\*|♪[^♪]*♪?)$`)
+)
+
+// SegmentTurns turns transcriber segments into speaker turns, dropping
+// non-speech markers and merging consecutive segments of a speaker.
+// Without diarization every turn is the user's, since a session recording
+// is the user's microphone. With it, turns keep their diarized labels
+// except those of userSpeaker, which become the user's, and segments with
+// no speaker continue the previous turn.
+func SegmentTurns(segments []TranscriptSegment, diarized bool, userSpeaker string) []models.TranscriptTurn {
+	var turns []models.TranscriptTurn
+	for _, s := range segments {
+		text := strings.Join(strings.Fields(nonSpeechTag.ReplaceAllString(s.Text, " ")), " ")
+		if text == "" || soundOnly.MatchString(text) {
+			continue
+		}
+		n := len(turns)
+		speaker := "user"
+		switch {
+		case !diarized:
+		case s.Speaker == "" && n > 0:
+			// A segment the diarizer couldn't place continues the turn.
+			speaker = turns[n-1].Speaker
+		case s.Speaker != "" && !strings.EqualFold(s.Speaker, userSpeaker):
+			speaker = models.SpeakerLabel(s.Speaker)
+		}
+		start, end := s.StartMs, s.EndMs
+		if n > 0 && turns[n-1].Speaker == speaker {
+			turns[n-1].Text += " " + text
+			turns[n-1].EndMs = &end
+			continue
+		}
+		turns = append(turns, models.TranscriptTurn{Speaker: speaker, Text: text, StartMs: &start, EndMs: &end})
+	}
+	return turns
+}
@@ -0,0 +1,239 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mindful/backend-go/models"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testSegments = []TranscriptSegment{
+	{StartMs: 0, EndMs: 1800, Text: " How have you been since last week?", Speaker: "speaker_1"},
+	{StartMs: 2000, EndMs: 3500, Text: " Honestly, pretty anxious.", Speaker: "speaker_2"},
+	{StartMs: 3500, EndMs: 4000, Text: " [BLANK_AUDIO]", Speaker: "speaker_2"},
+	{StartMs: 4000, EndMs: 5200, Text: " I always mess up at work.", Speaker: ""},
+	{StartMs: 5400, EndMs: 5900, Text: " (sighs)", Speaker: "speaker_1"},
+	{StartMs: 6000, EndMs: 7500, Text: " What about work worries you?", Speaker: "speaker_1"},
+}
+
+// countingTranscriber counts the calls made to a FakeTranscriber.
+type countingTranscriber struct {
+	FakeTranscriber
+	calls atomic.Int32
+}
+
+func (t *countingTranscriber) Transcribe(ctx context.Context, audio io.Reader, contentType string, opts TranscribeOptions) ([]TranscriptSegment, error) {
+	t.calls.Add(1)
+	return t.FakeTranscriber.Transcribe(ctx, audio, contentType, opts)
+}
+
+// queueTestTranscription uploads the test recording for a session and
+// queues its transcription.
+func queueTestTranscription(t *testing.T, store BlobStore, job models.TranscriptionJob) models.TranscriptionJob {
+	t.Helper()
+	t.Setenv("AUTO_TRANSCRIBE", "false")
+	t.Setenv("GEMINI_API_KEY", "")
+	uploadTestRecording(t, store, job.SessionID)
+	job, err := QueueTranscription(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return job
+}
+
+func getJob(t *testing.T, id int) models.TranscriptionJob {
+	t.Helper()
+	job, err := models.GetTranscriptionJob(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return job
+}
+
+func storedTurns(t *testing.T, job models.TranscriptionJob) []models.TranscriptTurn {
+	t.Helper()
+	if job.TranscriptID == nil {
+		t.Fatalf("job %d has no transcript", job.ID)
+	}
+	turns, err := models.GetTranscriptTurns(*job.TranscriptID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForSessionProcessing(t, job.SessionID, *job.TranscriptID)
+	return turns
+}
+
+// waitForSessionProcessing waits for the background work that follows a
+// new transcript: its distortion findings and an attempt at the session
+// summary, which fails without a model.
+func waitForSessionProcessing(t *testing.T, sessionID string, transcriptID int) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		findings, _ := models.GetDistortionFindings(models.SearchKindTranscript, transcriptID)
+		summary, _ := models.GetSessionSummary(sessionID)
+		if len(findings) > 0 && summary.Status == models.SummaryStatusFailed {
+			return
+		}
+	}
+	t.Fatalf("transcript %d was not processed", transcriptID)
+}
+
+func TestRunTranscriptionJobDiarized(t *testing.T) {
+	openTestDB(t)
+	store := LocalBlobStore{Dir: t.TempDir()}
+	job := queueTestTranscription(t, store, models.TranscriptionJob{SessionID: "s1", Diarize: true, UserSpeaker: "speaker_2"})
+
+	now := time.Now()
+	RunDueTranscriptionJobs(context.Background(), store, FakeTranscriber{Segments: testSegments}, now)
+
+	job = getJob(t, job.ID)
+	if job.Status != models.TranscriptionStatusCompleted || job.Attempts != 1 || job.Error != "" || job.NextAttemptAt != "" {
+		t.Fatalf("job = %+v, want completed after one attempt", job)
+	}
+	turns := storedTurns(t, job)
+	want := []struct {
+		speaker, text string
+		start, end    int64
+	}{
+		{"speaker_1", "How have you been since last week?", 0, 1800},
+		{"user", "Honestly, pretty anxious. I always mess up at work.", 2000, 5200},
+		{"speaker_1", "What about work worries you?", 6000, 7500},
+	}
+	if len(turns) != len(want) {
+		t.Fatalf("stored %d turns, want %d: %+v", len(turns), len(want), turns)
+	}
+	for i, w := range want {
+		got := turns[i]
+		if got.Index != i || got.Speaker != w.speaker || got.Text != w.text {
+			t.Errorf("turn %d = %d %s: %q, want %s: %q", i, got.Index, got.Speaker, got.Text, w.speaker, w.text)
+		}
+		if got.StartMs == nil || got.EndMs == nil || *got.StartMs != w.start || *got.EndMs != w.end {
+			t.Errorf("turn %d runs %v-%v, want %d-%d", i, got.StartMs, got.EndMs, w.start, w.end)
+		}
+	}
+
+	assertSystemAudit(t, "transcription", "create", "transcript", *job.TranscriptID)
+
+	transcripts, err := models.GetTranscriptsBySessionID("s1")
+	if err != nil || len(transcripts) != 1 {
+		t.Fatalf("session has %d transcripts: %v", len(transcripts), err)
+	}
+	if !strings.HasPrefix(transcripts[0].Transcript, "speaker_1: How have you been since last week?\nuser: Honestly") {
+		t.Errorf("transcript = %q", transcripts[0].Transcript)
+	}
+
+	if _, err := QueueTranscription(models.TranscriptionJob{SessionID: "s1"}); !errors.Is(err, ErrTranscriptExists) {
+		t.Errorf("queueing again: %v, want ErrTranscriptExists", err)
+	}
+}
+
+func TestRunTranscriptionJobWithoutDiarization(t *testing.T) {
+	openTestDB(t)
+	store := LocalBlobStore{Dir: t.TempDir()}
+	job := queueTestTranscription(t, store, models.TranscriptionJob{SessionID: "s1"})
+
+	RunDueTranscriptionJobs(context.Background(), store, FakeTranscriber{Segments: testSegments}, time.Now())
+
+	turns := storedTurns(t, getJob(t, job.ID))
+	if len(turns) != 1 || turns[0].Speaker != "user" {
+		t.Fatalf("turns = %+v, want a single user turn", turns)
+	}
+	want := "How have you been since last week? Honestly, pretty anxious. I always mess up at work. What about work worries you?"
+	if turns[0].Text != want {
+		t.Errorf("text = %q, want %q", turns[0].Text, want)
+	}
+}
+
+func TestRunTranscriptionJobRetries(t *testing.T) {
+	openTestDB(t)
+	store := LocalBlobStore{Dir: t.TempDir()}
+	job := queueTestTranscription(t, store, models.TranscriptionJob{SessionID: "s1"})
+	transcriber := &countingTranscriber{FakeTranscriber: FakeTranscriber{Err: errors.New("whisper server request failed: connection refused")}}
+
+	now := time.Now()
+	for attempt := 1; attempt < transcriptionMaxAttempts; attempt++ {
+		ranAt := time.Now()
+		RunDueTranscriptionJobs(context.Background(), store, transcriber, now)
+		job = getJob(t, job.ID)
+		if job.Status != models.TranscriptionStatusPending || job.Attempts != attempt || !strings.Contains(job.Error, "connection refused") {
+			t.Fatalf("after attempt %d: job = %+v", attempt, job)
+		}
+		next, err := time.Parse(models.TimestampLayout, job.NextAttemptAt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		backoff := transcriptionBackoff * time.Duration(attempt)
+		// Retries are timed from the end of the attempt.
+		if wait := next.Sub(ranAt); wait < backoff-time.Second || wait > backoff+time.Minute {
+			t.Fatalf("after attempt %d: retry in %s, want %s", attempt, wait, backoff)
+		}
+
+		// Not due yet: the worker leaves it alone.
+		RunDueTranscriptionJobs(context.Background(), store, transcriber, next.Add(-time.Second))
+		if int(transcriber.calls.Load()) != attempt {
+			t.Fatalf("job retried before it was due")
+		}
+		now = next
+	}
+
+	RunDueTranscriptionJobs(context.Background(), store, transcriber, now)
+	job = getJob(t, job.ID)
+	if job.Status != models.TranscriptionStatusFailed || job.Attempts != transcriptionMaxAttempts || job.NextAttemptAt != "" || job.FinishedAt == "" {
+		t.Errorf("after the last attempt: job = %+v, want failed", job)
+	}
+	if exists, _ := models.TranscriptSessionExists("s1"); exists {
+		t.Error("a failed job stored a transcript")
+	}
+}
+
+func TestRunTranscriptionJobNoSpeech(t *testing.T) {
+	openTestDB(t)
+	store := LocalBlobStore{Dir: t.TempDir()}
+	job := queueTestTranscription(t, store, models.TranscriptionJob{SessionID: "s1"})
+
+	silence := FakeTranscriber{Segments: []TranscriptSegment{{StartMs: 0, EndMs: 3000, Text: " [BLANK_AUDIO]"}}}
+	RunDueTranscriptionJobs(context.Background(), store, silence, time.Now())
+
+	job = getJob(t, job.ID)
+	if job.Status != models.TranscriptionStatusFailed || job.Attempts != 1 || job.Error != errNoSpeech.Error() {
+		t.Errorf("job = %+v, want failed without a retry", job)
+	}
+}
+
+func TestRunTranscriptionJobLease(t *testing.T) {
+	openTestDB(t)
+	store := LocalBlobStore{Dir: t.TempDir()}
+	job := queueTestTranscription(t, store, models.TranscriptionJob{SessionID: "s1", Diarize: true, UserSpeaker: "speaker_2"})
+	transcriber := &countingTranscriber{FakeTranscriber: FakeTranscriber{Segments: testSegments}}
+
+	// Another worker claims the job and dies before finishing it.
+	now := time.Now()
+	if claimed, err := models.ClaimTranscriptionJob(job.ID, now, transcriptionLease); err != nil || !claimed {
+		t.Fatalf("claim: %v %v", claimed, err)
+	}
+	if claimed, _ := models.ClaimTranscriptionJob(job.ID, now, transcriptionLease); claimed {
+		t.Fatal("a claimed job was claimed again")
+	}
+	if job = getJob(t, job.ID); job.Status != models.TranscriptionStatusRunning || job.Attempts != 1 {
+		t.Fatalf("job = %+v, want running", job)
+	}
+
+	RunTranscriptionJob(context.Background(), store, transcriber, job, now)
+	RunDueTranscriptionJobs(context.Background(), store, transcriber, now.Add(transcriptionLease-time.Second))
+	if transcriber.calls.Load() != 0 {
+		t.Fatal("job run while another worker held its lease")
+	}
+
+	RunDueTranscriptionJobs(context.Background(), store, transcriber, now.Add(transcriptionLease))
+	job = getJob(t, job.ID)
+	if transcriber.calls.Load() != 1 || job.Status != models.TranscriptionStatusCompleted || job.Attempts != 2 {
+		t.Fatalf("job = %+v after %d calls, want completed on the second attempt", job, transcriber.calls.Load())
+	}
+	if turns := storedTurns(t, job); len(turns) != 3 {
+		t.Errorf("stored %d turns, want 3", len(turns))
+	}
+}
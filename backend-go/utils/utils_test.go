@@ -0,0 +1,17 @@
+package utils
+
+import (
+	"mindful/backend-go/database"
+	"mindful/backend-go/models"
+	"testing"
+)
+
+// openTestDB creates a fresh database in a temporary directory and makes it
+// the working directory for the rest of the test.
+func openTestDB(t *testing.T) {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	database.InitDB()
+	models.InitDatabase(database.DB)
+	t.Cleanup(func() { database.DB.Close() })
+}
@@ -0,0 +1,241 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"mindful/backend-go/models"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// SourceVoice marks transcripts captured by the voice relay.
+const SourceVoice = "hume"
+
+// maxVoiceMessage bounds a single relayed message; audio frames are well
+// below it.
+const maxVoiceMessage = 4 << 20
+
+// VoiceChat is what the relay captured of an EVI chat.
+type VoiceChat struct {
+	ChatID      string
+	ChatGroupID string
+	Turns       []models.TranscriptTurn
+	// merged counts the messages folded into each turn, to average their
+	// prosody scores.
+	merged []int
+}
+
+// eviMessage holds the fields of EVI server messages the relay reads.
+type eviMessage struct {
+	Type        string `json:"type"`
+	ChatID      string `json:"chat_id"`
+	ChatGroupID string `json:"chat_group_id"`
+	Message     struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	} `json:"message"`
+	Models struct {
+		Prosody struct {
+			Scores map[string]float64 `json:"scores"`
+		} `json:"prosody"`
+	} `json:"models"`
+	Time *struct {
+		Begin int64 `json:"begin"`
+		End   int64 `json:"end"`
+	} `json:"time"`
+	Interim bool   `json:"interim"`
+	Code    string `json:"code"`
+	Slug    string `json:"slug"`
+}
+
+// observe records the chat IDs and every final user and assistant message.
+// Consecutive messages of a speaker become one turn. User messages carry
+// their offsets in the chat; assistant messages are placed at the offset
+// they arrived at, but not before the turn they answer.
+func (c *VoiceChat) observe(data []byte, offset time.Duration) {
+	var m eviMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		return
+	}
+	var speaker string
+	switch m.Type {
+	case "chat_metadata":
+		c.ChatID, c.ChatGroupID = m.ChatID, m.ChatGroupID
+		return
+	case "error":
+		log.Printf("Voice chat %s reported error %s (%s)", c.ChatID, m.Code, m.Slug)
+		return
+	case "user_message":
+		if m.Interim {
+			return
+		}
+		speaker = "user"
+	case "assistant_message":
+		speaker = "assistant"
+	default:
+		return
+	}
+	text := strings.Join(strings.Fields(m.Message.Content), " ")
+	if text == "" {
+		return
+	}
+
+	start := offset.Milliseconds()
+	var end *int64
+	if m.Time != nil {
+		start = m.Time.Begin
+		end = &m.Time.End
+	} else if prev := turnsEnd(c.Turns); prev > start {
+		start = prev
+	}
+	scores := m.Models.Prosody.Scores
+
+	if n := len(c.Turns); n > 0 && c.Turns[n-1].Speaker == speaker {
+		turn := &c.Turns[n-1]
+		turn.Text += " " + text
+		if end != nil {
+			turn.EndMs = end
+		}
+		if len(scores) > 0 {
+			turn.Prosody = averageScores(turn.Prosody, c.merged[n-1], scores)
+			c.merged[n-1]++
+		}
+		return
+	}
+	turn := models.TranscriptTurn{Speaker: speaker, Text: text, StartMs: &start, EndMs: end}
+	merged := 0
+	if len(scores) > 0 {
+		turn.Prosody = averageScores(nil, 0, scores)
+		merged = 1
+	}
+	c.Turns = append(c.Turns, turn)
+	c.merged = append(c.merged, merged)
+}
+
+// averageScores folds scores into the running average avg of n messages.
+func averageScores(avg map[string]float64, n int, scores map[string]float64) map[string]float64 {
+	out := make(map[string]float64, len(scores))
+	for name, score := range scores {
+		out[name] = (avg[name]*float64(n) + score) / float64(n+1)
+	}
+	for name, score := range avg {
+		if _, ok := scores[name]; !ok {
+			out[name] = score * float64(n) / float64(n+1)
+		}
+	}
+	return out
+}
+
+// RelayVoiceChat passes messages both ways between a browser and an EVI
+// chat until either side closes, then closes the other with the same code.
+// It returns what was said, as seen in the chat's messages.
+func RelayVoiceChat(browser, upstream *websocket.Conn) VoiceChat {
+	browser.SetReadLimit(maxVoiceMessage)
+	upstream.SetReadLimit(maxVoiceMessage)
+	started := time.Now()
+	var chat VoiceChat
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		pumpVoice(browser, upstream, nil)
+	}()
+	go func() {
+		defer wg.Done()
+		pumpVoice(upstream, browser, func(data []byte) {
+			chat.observe(data, time.Since(started))
+		})
+	}()
+	wg.Wait()
+	return chat
+}
+
+// pumpVoice copies messages from src to dst, showing text messages to
+// observe, and closes dst once src is done.
+func pumpVoice(src, dst *websocket.Conn, observe func([]byte)) {
+	defer dst.Close()
+	for {
+		kind, data, err := src.ReadMessage()
+		if err != nil {
+			code, text := websocket.CloseNormalClosure, ""
+			var closeErr *websocket.CloseError
+			if errors.As(err, &closeErr) {
+				code, text = closeErr.Code, closeErr.Text
+			}
+			// These codes report a missing status or a dropped connection
+			// and must not be sent.
+			if code == websocket.CloseNoStatusReceived || code == websocket.CloseAbnormalClosure || code == websocket.CloseTLSHandshake {
+				code = websocket.CloseGoingAway
+			}
+			dst.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(time.Second))
+			return
+		}
+		if observe != nil && kind == websocket.TextMessage {
+			observe(data)
+		}
+		if err := dst.WriteMessage(kind, data); err != nil {
+			src.Close()
+			return
+		}
+	}
+}
+
+// SaveVoiceChat stores a captured chat as the session's transcript and
+// processes it like a live session's. A session that already has a
+// transcript, such as one resumed after a dropped connection, gets the new
+// turns appended, placed after its last turn.
+func SaveVoiceChat(sessionID string, chat VoiceChat) (models.Transcript, error) {
+	if len(chat.Turns) == 0 {
+		return models.Transcript{}, nil
+	}
+	turns, _, err := sessionTurns(sessionID)
+	if err != nil && !errors.Is(err, models.ErrNotFound) {
+		return models.Transcript{}, err
+	}
+	action := "create"
+	if len(turns) > 0 {
+		action = "update"
+	}
+	shiftTurns(chat.Turns, turnsEnd(turns))
+	turns = append(turns, chat.Turns...)
+
+	t, err := models.ReplaceTranscript(sessionID, SourceVoice, turns)
+	if err != nil {
+		return models.Transcript{}, err
+	}
+	auditSystemWrite("voice", action, "transcript", t.ID)
+	processSessionTranscript(t)
+	return t, nil
+}
+
+// turnsEnd is the latest offset in turns, in milliseconds.
+func turnsEnd(turns []models.TranscriptTurn) int64 {
+	var end int64
+	for _, t := range turns {
+		if t.StartMs != nil && *t.StartMs > end {
+			end = *t.StartMs
+		}
+		if t.EndMs != nil && *t.EndMs > end {
+			end = *t.EndMs
+		}
+	}
+	return end
+}
+
+func shiftTurns(turns []models.TranscriptTurn, by int64) {
+	for i := range turns {
+		if turns[i].StartMs != nil {
+			start := *turns[i].StartMs + by
+			turns[i].StartMs = &start
+		}
+		if turns[i].EndMs != nil {
+			end := *turns[i].EndMs + by
+			turns[i].EndMs = &end
+		}
+	}
+}
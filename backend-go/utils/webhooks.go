@@ -0,0 +1,263 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mindful/backend-go/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// webhookMaxAttempts is how often a delivery is tried before it is
+	// marked failed. With the backoff below that spans about two hours.
+	webhookMaxAttempts = 8
+	webhookBaseBackoff = 30 * time.Second
+	webhookMaxBackoff  = time.Hour
+	// webhookLease is how long a claimed delivery is reserved for one
+	// attempt; it must outlast the client timeout.
+	webhookLease = 2 * time.Minute
+)
+
+// WebhookSignatureHeader carries "t=<unix seconds>,v1=<hex HMAC-SHA256>",
+// where the HMAC of "<t>.<body>" is keyed with the subscription secret.
+const WebhookSignatureHeader = "X-Mindful-Signature"
+
+// webhookClient does not follow redirects, so a receiver can't bounce
+// signed payloads elsewhere; a redirect counts as a failed attempt.
+var webhookClient = &http.Client{
+	Timeout: 10 * time.Second,
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// WebhookEvent is the JSON body of every delivery. Data carries IDs and
+// metadata of the record involved, not journal or session text.
+type WebhookEvent struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt string      `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// SignWebhookPayload returns the signature header value for a body sent at
+// timestamp.
+func SignWebhookPayload(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return fmt.Sprintf("t=%d,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// VerifyWebhookSignature checks a signature header against the body, as a
+// receiver would. Signatures older than tolerance are rejected to limit
+// replays; a zero tolerance skips that check.
+func VerifyWebhookSignature(secret, header string, body []byte, now time.Time, tolerance time.Duration) error {
+	var timestamp int64
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp, _ = strconv.ParseInt(value, 10, 64)
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	if timestamp == 0 || len(signatures) == 0 {
+		return errors.New("malformed webhook signature")
+	}
+	if tolerance > 0 {
+		if age := now.Sub(time.Unix(timestamp, 0)); age > tolerance || age < -tolerance {
+			return errors.New("webhook signature timestamp out of tolerance")
+		}
+	}
+	_, expected, _ := strings.Cut(SignWebhookPayload(secret, timestamp, body), "v1=")
+	for _, sig := range signatures {
+		if hmac.Equal([]byte(sig), []byte(expected)) {
+			return nil
+		}
+	}
+	return errors.New("webhook signature mismatch")
+}
+
+// webhookBackoff is the wait after a delivery's nth failed attempt:
+// 30s, 1m, 2m, 4m and so on, capped at an hour.
+func webhookBackoff(attempts int) time.Duration {
+	d := webhookBaseBackoff
+	for i := 1; i < attempts && d < webhookMaxBackoff; i++ {
+		d *= 2
+	}
+	if d > webhookMaxBackoff {
+		d = webhookMaxBackoff
+	}
+	return d
+}
+
+func newEventID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return "evt_" + hex.EncodeToString(b)
+}
+
+// EmitEvent queues a domain event for every subscription that wants it and
+// attempts the deliveries in the background. Failures are logged, never
+// returned, so webhooks can't break the request that caused the event.
+func EmitEvent(eventType string, data interface{}) {
+	if _, err := queueEvent(eventType, data, 0); err != nil {
+		log.Printf("Error queueing %s webhooks: %v", eventType, err)
+	}
+}
+
+// PingWebhook queues a ping event for one subscription, whatever events it
+// subscribes to, and attempts it in the background.
+func PingWebhook(subscriptionID int) (models.WebhookDelivery, error) {
+	if _, err := models.GetWebhook(subscriptionID); err != nil {
+		return models.WebhookDelivery{}, err
+	}
+	deliveries, err := queueEvent(models.EventPing, map[string]int{"subscription_id": subscriptionID}, subscriptionID)
+	if err != nil {
+		return models.WebhookDelivery{}, err
+	}
+	if len(deliveries) == 0 {
+		return models.WebhookDelivery{}, models.ErrNotFound
+	}
+	return deliveries[0], nil
+}
+
+// Redeliver queues a logged delivery again and attempts it in the
+// background.
+func Redeliver(deliveryID int) (models.WebhookDelivery, error) {
+	d, err := models.RedeliverWebhook(deliveryID, time.Now())
+	if err != nil {
+		return models.WebhookDelivery{}, err
+	}
+	go deliverQueued([]models.WebhookDelivery{d})
+	return d, nil
+}
+
+func queueEvent(eventType string, data interface{}, subscriptionID int) ([]models.WebhookDelivery, error) {
+	now := time.Now()
+	event := WebhookEvent{ID: newEventID(), Type: eventType, CreatedAt: now.UTC().Format(time.RFC3339), Data: data}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	deliveries, err := models.QueueWebhookDeliveries(event.ID, eventType, payload, subscriptionID, now)
+	if len(deliveries) > 0 {
+		go deliverQueued(deliveries)
+	}
+	return deliveries, err
+}
+
+func deliverQueued(deliveries []models.WebhookDelivery) {
+	for _, d := range deliveries {
+		DeliverWebhook(context.Background(), d, time.Now())
+	}
+}
+
+// StartWebhookWorker retries due webhook deliveries every interval until
+// the process exits. The queue lives in the database, so deliveries left
+// pending by a restart are picked up on the first run.
+func StartWebhookWorker(interval time.Duration) {
+	go func() {
+		for {
+			RunDueWebhookDeliveries(context.Background(), time.Now())
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// RunDueWebhookDeliveries attempts every pending delivery due at now.
+func RunDueWebhookDeliveries(ctx context.Context, now time.Time) {
+	due, err := models.DueWebhookDeliveries(now, 100)
+	if err != nil {
+		log.Printf("Error loading due webhook deliveries: %v", err)
+		return
+	}
+	for _, d := range due {
+		DeliverWebhook(ctx, d, now)
+	}
+}
+
+// DeliverWebhook makes one attempt at a delivery and records the outcome,
+// scheduling a retry with exponential backoff after a failure. Deliveries
+// another worker has claimed are left alone.
+func DeliverWebhook(ctx context.Context, d models.WebhookDelivery, now time.Time) {
+	claimed, err := models.ClaimWebhookDelivery(d.ID, now, webhookLease)
+	if err != nil {
+		log.Printf("Error claiming webhook delivery %d: %v", d.ID, err)
+		return
+	}
+	if !claimed {
+		return
+	}
+
+	statusCode, attemptErr := attemptWebhook(ctx, d)
+	var errText string
+	var retryAt time.Time
+	if attemptErr != nil {
+		errText = attemptErr.Error()
+		if d.Attempts+1 < webhookMaxAttempts && !errors.Is(attemptErr, errWebhookGone) {
+			retryAt = now.Add(webhookBackoff(d.Attempts + 1))
+		}
+		log.Printf("Webhook delivery %d (%s) failed: %v", d.ID, d.EventType, attemptErr)
+	}
+	if err := models.RecordWebhookAttempt(d.ID, statusCode, errText, attemptErr == nil, retryAt, now); err != nil {
+		log.Printf("Error recording webhook delivery %d: %v", d.ID, err)
+		return
+	}
+	auditSystemWrite("webhooks", "update", "webhook_delivery", d.ID)
+}
+
+// errWebhookGone marks failures that retrying can't fix.
+var errWebhookGone = errors.New("subscription is deleted or inactive")
+
+func attemptWebhook(ctx context.Context, d models.WebhookDelivery) (int, error) {
+	sub, err := models.GetWebhook(d.SubscriptionID)
+	if errors.Is(err, models.ErrNotFound) || (err == nil && !*sub.Active) {
+		return 0, errWebhookGone
+	}
+	if err != nil {
+		return 0, err
+	}
+	secret, err := models.GetWebhookSecret(d.SubscriptionID)
+	if err != nil {
+		return 0, err
+	}
+
+	body := []byte(d.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Mindful-Webhooks/1.0")
+	req.Header.Set("X-Mindful-Event", d.EventType)
+	req.Header.Set("X-Mindful-Event-ID", d.EventID)
+	req.Header.Set("X-Mindful-Delivery", strconv.Itoa(d.ID))
+	req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(secret, time.Now().Unix(), body))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver returned %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,199 @@
+package utils
+
+import (
+	"context"
+	"io"
+	"mindful/backend-go/models"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"id":"evt_1","type":"ping"}`)
+	header := SignWebhookPayload("whsec_test", now.Unix(), body)
+
+	if err := VerifyWebhookSignature("whsec_test", header, body, now, 5*time.Minute); err != nil {
+		t.Errorf("valid signature rejected: %v", err)
+	}
+	tests := []struct {
+		name, secret, header string
+		body                 []byte
+		now                  time.Time
+	}{
+		{"wrong secret", "whsec_other", header, body, now},
+		{"tampered body", "whsec_test", header, []byte(`{"id":"evt_2","type":"ping"}`), now},
+		{"too old", "whsec_test", header, body, now.Add(6 * time.Minute)},
+		{"malformed", "whsec_test", "v1=abc", body, now},
+	}
+	for _, tt := range tests {
+		if err := VerifyWebhookSignature(tt.secret, tt.header, tt.body, tt.now, 5*time.Minute); err == nil {
+			t.Errorf("%s: signature accepted", tt.name)
+		}
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	want := []time.Duration{30 * time.Second, time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute,
+		16 * time.Minute, 32 * time.Minute, time.Hour, time.Hour}
+	for i, w := range want {
+		if got := webhookBackoff(i + 1); got != w {
+			t.Errorf("webhookBackoff(%d) = %s, want %s", i+1, got, w)
+		}
+	}
+}
+
+// queueTestDelivery subscribes url to every event and queues one ping for
+// it, due at now.
+func queueTestDelivery(t *testing.T, url string, now time.Time) (models.WebhookSubscription, models.WebhookDelivery) {
+	t.Helper()
+	sub, err := models.CreateWebhook(models.WebhookSubscription{URL: url, EventTypes: []string{"*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deliveries, err := models.QueueWebhookDeliveries("evt_test", models.EventPing, []byte(`{"id":"evt_test"}`), sub.ID, now)
+	if err != nil || len(deliveries) != 1 {
+		t.Fatalf("queued %d deliveries: %v", len(deliveries), err)
+	}
+	return sub, deliveries[0]
+}
+
+func getDelivery(t *testing.T, id int) models.WebhookDelivery {
+	t.Helper()
+	d, err := models.GetWebhookDelivery(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestDeliverWebhookSignsPayload(t *testing.T) {
+	openTestDB(t)
+	requests := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- r
+		bodies <- body
+	}))
+	defer srv.Close()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	sub, d := queueTestDelivery(t, srv.URL, now)
+	DeliverWebhook(context.Background(), d, now)
+
+	r, body := <-requests, <-bodies
+	if err := VerifyWebhookSignature(sub.Secret, r.Header.Get(WebhookSignatureHeader), body, time.Now(), 5*time.Minute); err != nil {
+		t.Errorf("signature does not verify: %v", err)
+	}
+	if string(body) != `{"id":"evt_test"}` {
+		t.Errorf("body = %s", body)
+	}
+	if got := r.Header.Get("X-Mindful-Event"); got != models.EventPing {
+		t.Errorf("X-Mindful-Event = %q", got)
+	}
+	if got := r.Header.Get("X-Mindful-Event-ID"); got != "evt_test" {
+		t.Errorf("X-Mindful-Event-ID = %q", got)
+	}
+
+	d = getDelivery(t, d.ID)
+	if d.Status != models.DeliveryStatusSucceeded || d.Attempts != 1 || d.LastStatusCode != http.StatusOK {
+		t.Errorf("delivery = %+v, want succeeded after one attempt with 200", d)
+	}
+	if d.DeliveredAt != now.Format(models.TimestampLayout) || d.NextAttemptAt != "" || d.LastError != "" {
+		t.Errorf("delivery = %+v", d)
+	}
+	assertSystemAudit(t, "webhooks", "update", "webhook_delivery", d.ID)
+}
+
+func TestDeliverWebhookBacksOffAfterServerError(t *testing.T) {
+	openTestDB(t)
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	_, d := queueTestDelivery(t, srv.URL, now)
+	for attempt := 1; attempt < webhookMaxAttempts; attempt++ {
+		DeliverWebhook(context.Background(), getDelivery(t, d.ID), now)
+		got := getDelivery(t, d.ID)
+		next := now.Add(webhookBackoff(attempt))
+		if got.Status != models.DeliveryStatusPending || got.Attempts != attempt || got.LastStatusCode != http.StatusServiceUnavailable {
+			t.Fatalf("after attempt %d: delivery = %+v", attempt, got)
+		}
+		if got.NextAttemptAt != next.Format(models.TimestampLayout) {
+			t.Fatalf("after attempt %d: next attempt at %s, want %s", attempt, got.NextAttemptAt, next.Format(models.TimestampLayout))
+		}
+		if got.LastError != "receiver returned 503 Service Unavailable" {
+			t.Errorf("last error = %q", got.LastError)
+		}
+
+		// Not due yet: the worker leaves it alone.
+		RunDueWebhookDeliveries(context.Background(), next.Add(-time.Second))
+		if int(calls.Load()) != attempt {
+			t.Fatalf("delivery attempted before its retry was due")
+		}
+		now = next
+	}
+
+	DeliverWebhook(context.Background(), getDelivery(t, d.ID), now)
+	got := getDelivery(t, d.ID)
+	if got.Status != models.DeliveryStatusFailed || got.Attempts != webhookMaxAttempts || got.NextAttemptAt != "" {
+		t.Errorf("after the last attempt: delivery = %+v, want failed", got)
+	}
+	if calls.Load() != webhookMaxAttempts {
+		t.Errorf("receiver called %d times, want %d", calls.Load(), webhookMaxAttempts)
+	}
+}
+
+func TestDeliverWebhookDoesNotFollowRedirects(t *testing.T) {
+	openTestDB(t)
+	var followed atomic.Bool
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		followed.Store(true)
+	}))
+	defer target.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL, http.StatusTemporaryRedirect)
+	}))
+	defer srv.Close()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	_, d := queueTestDelivery(t, srv.URL, now)
+	DeliverWebhook(context.Background(), d, now)
+
+	if followed.Load() {
+		t.Error("redirect was followed")
+	}
+	got := getDelivery(t, d.ID)
+	if got.Status != models.DeliveryStatusPending || got.Attempts != 1 || got.LastStatusCode != http.StatusTemporaryRedirect {
+		t.Errorf("delivery = %+v, want a failed attempt with 307", got)
+	}
+}
+
+func TestDeliverWebhookToInactiveSubscription(t *testing.T) {
+	openTestDB(t)
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { calls.Add(1) }))
+	defer srv.Close()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	sub, d := queueTestDelivery(t, srv.URL, now)
+	active := false
+	sub.Active = &active
+	if _, err := models.UpdateWebhook(sub.ID, sub); err != nil {
+		t.Fatal(err)
+	}
+	DeliverWebhook(context.Background(), d, now)
+
+	got := getDelivery(t, d.ID)
+	if calls.Load() != 0 || got.Status != models.DeliveryStatusFailed || got.NextAttemptAt != "" {
+		t.Errorf("delivery = %+v after %d calls, want failed without a retry", got, calls.Load())
+	}
+}